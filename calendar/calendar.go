@@ -0,0 +1,37 @@
+// Package calendar works out the yearly occurrences of significant dates such as birthdays and
+// anniversaries. Dates are compared on the calendar day of the time.Time they are given, so callers
+// pick the time zone the day is read in
+package calendar
+
+import (
+	"time"
+)
+
+// DaysIn public function that returns the number of days in a month of a year
+func DaysIn(month time.Month, year int) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// NextOccurrence public function that returns the first occurrence of a month and day on or after
+// the from date, at midnight in from's location. Feb 29 falls on Feb 28 in years that are not leap years
+func NextOccurrence(month time.Month, day int, from time.Time) time.Time {
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+	for year := from.Year(); ; year++ {
+		observedDay := day
+		if observedDay > DaysIn(month, year) {
+			observedDay = DaysIn(month, year)
+		}
+		occurrence := time.Date(year, month, observedDay, 0, 0, 0, 0, from.Location())
+		if !occurrence.Before(from) {
+			return occurrence
+		}
+	}
+}
+
+// DaysBetween public function that counts the calendar days from one date to another, daylight
+// saving changes in between do not matter
+func DaysBetween(from, to time.Time) int {
+	fromDay := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	toDay := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(toDay.Sub(fromDay).Hours() / 24)
+}
@@ -0,0 +1,101 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // the tests do not depend on the zone files of the machine
+)
+
+func TestDaysIn(t *testing.T) {
+	tests := []struct {
+		month time.Month
+		year  int
+		want  int
+	}{
+		{time.January, 2026, 31},
+		{time.April, 2026, 30},
+		{time.February, 2026, 28},
+		{time.February, 2024, 29},
+		{time.February, 2000, 29},
+		{time.February, 1900, 28},
+		{time.December, 2026, 31},
+	}
+	for _, test := range tests {
+		if got := DaysIn(test.month, test.year); got != test.want {
+			t.Errorf("DaysIn(%s %d) = %d, want %d", test.month, test.year, got, test.want)
+		}
+	}
+}
+
+func TestNextOccurrence(t *testing.T) {
+	tests := []struct {
+		name  string
+		month time.Month
+		day   int
+		from  string
+		want  string
+	}{
+		{"later this year", time.June, 15, "2026-03-10", "2026-06-15"},
+		{"today", time.March, 10, "2026-03-10", "2026-03-10"},
+		{"yesterday moves to next year", time.March, 9, "2026-03-10", "2027-03-09"},
+		{"Feb 29 in a non-leap year", time.February, 29, "2026-01-10", "2026-02-28"},
+		{"Feb 29 in a leap year", time.February, 29, "2028-01-10", "2028-02-29"},
+		{"Feb 29 observed today", time.February, 29, "2026-02-28", "2026-02-28"},
+		{"Feb 29 after Feb 28 of a non-leap year", time.February, 29, "2026-03-01", "2027-02-28"},
+		{"Feb 29 after Feb 28 before a leap year", time.February, 29, "2027-03-01", "2028-02-29"},
+		{"Jan date seen in Dec", time.January, 2, "2026-12-30", "2027-01-02"},
+		{"Dec date seen in Dec", time.December, 31, "2026-12-30", "2026-12-31"},
+		{"Dec date seen in Jan", time.December, 31, "2027-01-01", "2027-12-31"},
+		{"Jan 1 seen on Dec 31", time.January, 1, "2026-12-31", "2027-01-01"},
+	}
+	for _, test := range tests {
+		from, _ := time.Parse("2006-01-02", test.from)
+		// the time of day is ignored
+		from = from.Add(23*time.Hour + 59*time.Minute)
+		if got := NextOccurrence(test.month, test.day, from).Format("2006-01-02"); got != test.want {
+			t.Errorf("%s: NextOccurrence(%s %d, %s) = %s, want %s", test.name, test.month, test.day, test.from,
+				got, test.want)
+		}
+	}
+}
+
+func TestNextOccurrenceKeepsTheLocation(t *testing.T) {
+	nairobi, err := time.LoadLocation("Africa/Nairobi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 22:30 UTC on Dec 31 is already Jan 1 in Nairobi
+	from := time.Date(2026, time.December, 31, 22, 30, 0, 0, time.UTC).In(nairobi)
+	got := NextOccurrence(time.January, 1, from)
+	if want := time.Date(2027, time.January, 1, 0, 0, 0, 0, nairobi); !got.Equal(want) || got.Location() != nairobi {
+		t.Errorf("NextOccurrence(Jan 1, %v) = %v, want %v", from, got, want)
+	}
+}
+
+func TestDaysBetween(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     int
+	}{
+		{"same day", time.Date(2026, time.March, 10, 23, 0, 0, 0, time.UTC),
+			time.Date(2026, time.March, 10, 0, 0, 0, 0, time.UTC), 0},
+		{"across the new year", time.Date(2026, time.December, 30, 0, 0, 0, 0, time.UTC),
+			time.Date(2027, time.January, 2, 0, 0, 0, 0, time.UTC), 3},
+		{"across Feb 29", time.Date(2028, time.February, 28, 0, 0, 0, 0, time.UTC),
+			time.Date(2028, time.March, 1, 0, 0, 0, 0, time.UTC), 2},
+		{"across a daylight saving change", time.Date(2026, time.March, 7, 0, 0, 0, 0, newYork),
+			time.Date(2026, time.March, 9, 0, 0, 0, 0, newYork), 2},
+		{"a year", time.Date(2026, time.March, 10, 0, 0, 0, 0, time.UTC),
+			time.Date(2027, time.March, 10, 0, 0, 0, 0, time.UTC), 365},
+	}
+	for _, test := range tests {
+		if got := DaysBetween(test.from, test.to); got != test.want {
+			t.Errorf("%s: DaysBetween = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+// Package carddav serves the address books of an account to native contact apps over CardDAV
+// (RFC 6352). The handler speaks the protocol and leaves storage to a Backend, clients
+// authenticate with basic auth on every request.
+//
+// Resources are laid out under the prefix the handler is mounted on:
+//
+//	/principal/         the authenticated account
+//	/books/             its address book home, one collection per address book
+//	/books/{id}/        an address book
+//	/books/{id}/{name}  a card, {id}.vcf for contacts not created over CardDAV
+package carddav
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/cermu/Go-phoneBook-API/vcard"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// WellKnownPath is where clients look for the CardDAV service of a host (RFC 6764)
+	WellKnownPath = "/.well-known/carddav"
+
+	allowedMethods      = "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT"
+	realm               = "Phone book"
+	defaultMaxCardBytes = 10 << 20 // used when the handler has no MaxCardBytes, inline photos included
+)
+
+// Errors returned by a Backend, the handler maps them to HTTP statuses
+var (
+	ErrUnauthorized       = errors.New("carddav: invalid credentials")
+	ErrTooManyAttempts    = errors.New("carddav: too many failed sign in attempts")
+	ErrNotFound           = errors.New("carddav: resource not found")
+	ErrForbidden          = errors.New("carddav: the address book is read only")
+	ErrPreconditionFailed = errors.New("carddav: precondition failed")
+	ErrUIDConflict        = errors.New("carddav: another card of the address book has the same UID")
+)
+
+// InvalidCardError is returned by a Backend rejecting a card it can not store, Reason is shown to the client
+type InvalidCardError struct {
+	Reason string
+}
+
+// Error public method that returns the reason a card was rejected
+func (err *InvalidCardError) Error() string {
+	return "carddav: invalid card, " + err.Reason
+}
+
+// Book struct describes an address book of the authenticated account
+type Book struct {
+	ID       uint
+	Name     string
+	CTag     string // changes whenever a card of the book is added, changed or removed
+	ReadOnly bool
+}
+
+// Object struct describes a card of an address book
+type Object struct {
+	Name     string // the last segment of the card's URL, e.g. 12.vcf
+	ETag     string // quoted, e.g. "3"
+	Modified time.Time
+	Card     *vcard.Card // only loaded when the content of the card is needed
+}
+
+// Backend interface gives the handler access to accounts, their address books and the cards in them
+type Backend interface {
+	// Authenticate checks basic auth credentials sent from clientIP and returns the id of the account,
+	// ErrUnauthorized when they are not valid and ErrTooManyAttempts when the username is refused
+	// from that address for now
+	Authenticate(username, password, clientIP string) (uint, error)
+
+	// Books lists the address books of an account
+	Books(accountId uint) ([]*Book, error)
+
+	// Objects lists the cards of an address book, or the ones with the names passed when names is
+	// not nil. Cards the book does not hold are left out, ErrNotFound means the book itself was not found
+	Objects(accountId, bookId uint, names []string, withCards bool) ([]*Object, error)
+
+	// PutObject creates or replaces a card, ifMatch and ifNoneMatch are the headers of the request.
+	// It reports whether the card was created
+	PutObject(accountId, bookId uint, name string, card *vcard.Card, ifMatch, ifNoneMatch string) (bool, error)
+
+	// DeleteObject removes a card, ifMatch is the If-Match header of the request
+	DeleteObject(accountId, bookId uint, name, ifMatch string) error
+}
+
+// Handler struct is the http.Handler of the CardDAV service, mounted on Prefix, e.g. /carddav
+type Handler struct {
+	Backend      Backend
+	Prefix       string
+	MaxCardBytes int64 // the largest card a client can upload
+}
+
+// resourceKind tells what a request path points at
+type resourceKind int
+
+const (
+	unknownResource resourceKind = iota
+	rootResource
+	principalResource
+	homeResource
+	bookResource
+	objectResource
+)
+
+// resource struct is a resolved request path
+type resource struct {
+	kind   resourceKind
+	bookId uint
+	name   string
+}
+
+// Mount public method that registers the handler on a mux under its prefix and the well-known path. The
+// prefix without its trailing slash is served too, clients drop it when joining paths and the mux would
+// answer with a redirect that turns their OPTIONS and PROPFIND requests into GETs
+func (handler *Handler) Mount(mux *http.ServeMux) {
+	mux.Handle(handler.Prefix, handler)
+	mux.Handle(handler.Prefix+"/", handler)
+	mux.Handle(WellKnownPath, handler)
+}
+
+// ServeHTTP public method that answers a CardDAV request
+func (handler *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == WellKnownPath {
+		http.Redirect(w, req, handler.Prefix+"/", http.StatusMovedPermanently)
+		return
+	}
+	if req.Method == http.MethodOptions {
+		w.Header().Set("DAV", "1, 3, addressbook")
+		w.Header().Set("Allow", allowedMethods)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	accountId, ok := handler.authenticate(w, req)
+	if !ok {
+		return
+	}
+	target := handler.resolve(req.URL.Path)
+	if target.kind == unknownResource {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	switch req.Method {
+	case "PROPFIND":
+		handler.propfind(w, req, accountId, target)
+	case "REPORT":
+		handler.report(w, req, accountId, target)
+	case http.MethodGet, http.MethodHead:
+		handler.get(w, req, accountId, target)
+	case http.MethodPut:
+		handler.put(w, req, accountId, target)
+	case http.MethodDelete:
+		handler.delete(w, req, accountId, target)
+	default:
+		w.Header().Set("Allow", allowedMethods)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// authenticate private method that checks the basic auth credentials of a request and returns the
+// account id, a failed check has already been answered when ok is false
+func (handler *Handler) authenticate(w http.ResponseWriter, req *http.Request) (uint, bool) {
+	username, password, ok := req.BasicAuth()
+	if ok {
+		accountId, err := handler.Backend.Authenticate(username, password, clientIP(req))
+		if err == nil {
+			return accountId, true
+		}
+		if err == ErrTooManyAttempts {
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return 0, false
+		}
+		if err != ErrUnauthorized {
+			log.Printf("WARNING | An error occurred while authenticating CardDAV request: %v\n", err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return 0, false
+		}
+	}
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s", charset="UTF-8"`, realm))
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	return 0, false
+}
+
+// clientIP private function that returns the address a request was sent from, without the port
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// resolve private method that maps a request path to the resource it points at
+func (handler *Handler) resolve(path string) *resource {
+	if !strings.HasPrefix(path, handler.Prefix) {
+		return &resource{}
+	}
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(path, handler.Prefix), "/"), "/")
+	switch {
+	case len(segments) == 1 && segments[0] == "":
+		return &resource{kind: rootResource}
+	case len(segments) == 1 && segments[0] == "principal":
+		return &resource{kind: principalResource}
+	case len(segments) == 1 && segments[0] == "books":
+		return &resource{kind: homeResource}
+	case len(segments) < 2 || len(segments) > 3 || segments[0] != "books":
+		return &resource{}
+	}
+
+	bookId, err := strconv.ParseUint(segments[1], 10, 64)
+	if err != nil || bookId == 0 {
+		return &resource{}
+	}
+	if len(segments) == 2 {
+		return &resource{kind: bookResource, bookId: uint(bookId)}
+	}
+	// a trailing slash names a collection, books hold no other collections
+	if strings.HasSuffix(path, "/") {
+		return &resource{}
+	}
+	return &resource{kind: objectResource, bookId: uint(bookId), name: segments[2]}
+}
+
+// findBook private method that returns one of the account's address books, nil when it has no such book
+func (handler *Handler) findBook(accountId, bookId uint) (*Book, error) {
+	books, err := handler.Backend.Books(accountId)
+	if err != nil {
+		return nil, err
+	}
+	for _, book := range books {
+		if book.ID == bookId {
+			return book, nil
+		}
+	}
+	return nil, nil
+}
+
+// findObject private method that loads a card together with its content, nil when the book does not hold it
+func (handler *Handler) findObject(accountId uint, target *resource) (*Object, error) {
+	objects, err := handler.Backend.Objects(accountId, target.bookId, []string{target.name}, true)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil || len(objects) == 0 {
+		return nil, err
+	}
+	return objects[0], nil
+}
+
+// get private method that answers a GET or HEAD request for a card
+func (handler *Handler) get(w http.ResponseWriter, req *http.Request, accountId uint, target *resource) {
+	if target.kind != objectResource {
+		w.Header().Set("Allow", "OPTIONS, PROPFIND, REPORT")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	object, err := handler.findObject(accountId, target)
+	if err != nil {
+		handler.serverError(w, err)
+		return
+	}
+	if object == nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	// the Accept header picks the vCard version, 3.0 otherwise
+	version, _ := vcard.NegotiateVersion("", req.Header.Get("Accept"))
+	body := &bytes.Buffer{}
+	if err := vcard.Encode(body, object.Card, version); err != nil {
+		handler.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/vcard; charset=utf-8; version="+version)
+	w.Header().Set("Content-Length", strconv.Itoa(body.Len()))
+	w.Header().Set("ETag", object.ETag)
+	w.Header().Set("Last-Modified", object.Modified.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+	if req.Method != http.MethodHead {
+		_, _ = w.Write(body.Bytes())
+	}
+}
+
+// put private method that answers a PUT request creating or replacing a card
+func (handler *Handler) put(w http.ResponseWriter, req *http.Request, accountId uint, target *resource) {
+	if target.kind != objectResource {
+		w.Header().Set("Allow", "OPTIONS, PROPFIND, REPORT")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if len(target.name) > 255 {
+		writeError(w, http.StatusForbidden, nsDAV, "name-allowed", "the card name is too long")
+		return
+	}
+
+	maxBytes := handler.MaxCardBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxCardBytes
+	}
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxBytes))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, nsCardDAV, "max-resource-size",
+			fmt.Sprintf("a card can be at most %d bytes", maxBytes))
+		return
+	}
+	results, err := vcard.Decode(bytes.NewReader(data))
+	if err != nil || len(results) != 1 || results[0].Err != nil {
+		writeError(w, http.StatusForbidden, nsCardDAV, "valid-address-data", "the body should hold exactly one valid vCard")
+		return
+	}
+
+	created, err := handler.Backend.PutObject(accountId, target.bookId, target.name, results[0].Card,
+		req.Header.Get("If-Match"), req.Header.Get("If-None-Match"))
+	if err != nil {
+		handler.writeChangeError(w, err)
+		return
+	}
+
+	// the stored card differs from the one sent, phone numbers are normalized, so no ETag is
+	// returned and the client fetches the card again (RFC 6352 section 6.3.2.3)
+	if created {
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// delete private method that answers a DELETE request for a card, address books can not be deleted over CardDAV
+func (handler *Handler) delete(w http.ResponseWriter, req *http.Request, accountId uint, target *resource) {
+	if target.kind != objectResource {
+		writeError(w, http.StatusForbidden, nsDAV, "need-privileges", "address books can not be deleted over CardDAV")
+		return
+	}
+	err := handler.Backend.DeleteObject(accountId, target.bookId, target.name, req.Header.Get("If-Match"))
+	if err != nil {
+		handler.writeChangeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeChangeError private method that answers a PUT or DELETE the backend refused
+func (handler *Handler) writeChangeError(w http.ResponseWriter, err error) {
+	if invalid, ok := err.(*InvalidCardError); ok {
+		writeError(w, http.StatusForbidden, nsCardDAV, "valid-address-data", invalid.Reason)
+		return
+	}
+	switch err {
+	case ErrNotFound:
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	case ErrForbidden:
+		writeError(w, http.StatusForbidden, nsDAV, "need-privileges", "you can only view the contacts of this address book")
+	case ErrPreconditionFailed:
+		http.Error(w, http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
+	case ErrUIDConflict:
+		writeError(w, http.StatusConflict, nsCardDAV, "no-uid-conflict", "another card of the address book has the same UID")
+	default:
+		handler.serverError(w, err)
+	}
+}
+
+// serverError private method that logs an unexpected error and answers with a 500
+func (handler *Handler) serverError(w http.ResponseWriter, err error) {
+	log.Printf("WARNING | An error occurred while serving CardDAV request: %v\n", err.Error())
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
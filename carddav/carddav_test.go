@@ -0,0 +1,755 @@
+package carddav
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/cermu/Go-phoneBook-API/vcard"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testUser     = "jane@example.com"
+	testPassword = "1-abcd-efgh-ijkl-mnop"
+	lockedUser   = "locked@example.com"
+)
+
+// fakeBackend struct is a Backend keeping the address books of one account in memory. It applies
+// If-Match, If-None-Match and UID uniqueness the way models.CardDAVBackend does
+type fakeBackend struct {
+	mu      sync.Mutex
+	books   []*Book
+	objects map[uint]map[string]*Object
+	version int
+}
+
+func newFakeBackend() *fakeBackend {
+	backend := &fakeBackend{
+		books: []*Book{
+			{ID: 1, Name: "Personal"},
+			{ID: 2, Name: "Family & friends", ReadOnly: true},
+		},
+		objects: map[uint]map[string]*Object{1: {}, 2: {}},
+	}
+	backend.add(1, "10.vcf", &vcard.Card{UID: "uid-10", FirstName: "Ada", LastName: "Lovelace",
+		Emails: []vcard.Email{{Type: "work", Value: "ada@example.com"}},
+		Phones: []vcard.Phone{{Type: "mobile", Value: "+254700000001"}}})
+	backend.add(1, "11.vcf", &vcard.Card{UID: "uid-11", FirstName: "Alan", LastName: "Turing",
+		Emails: []vcard.Email{{Type: "home", Value: "alan@example.org"}}})
+	backend.add(1, "phone-made.vcf", &vcard.Card{UID: "uid-12", FirstName: "Grace", LastName: "Hopper"})
+	backend.add(2, "20.vcf", &vcard.Card{UID: "uid-20", FirstName: "Mum"})
+	return backend
+}
+
+// add private method that stores a card under a new ETag and bumps the CTag of its book
+func (backend *fakeBackend) add(bookId uint, name string, card *vcard.Card) {
+	backend.version++
+	backend.objects[bookId][name] = &Object{Name: name, ETag: fmt.Sprintf(`"%d"`, backend.version),
+		Modified: time.Date(2026, time.March, 1, 0, 0, backend.version, 0, time.UTC), Card: card}
+	for _, book := range backend.books {
+		if book.ID == bookId {
+			book.CTag = fmt.Sprint(backend.version)
+		}
+	}
+}
+
+func (backend *fakeBackend) Authenticate(username, password, clientIP string) (uint, error) {
+	// the test server is reached over the loopback address, the port is left out
+	if username == lockedUser && clientIP == "127.0.0.1" {
+		return 0, ErrTooManyAttempts
+	}
+	if username != testUser || password != testPassword {
+		return 0, ErrUnauthorized
+	}
+	return 7, nil
+}
+
+func (backend *fakeBackend) Books(accountId uint) ([]*Book, error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	books := make([]*Book, 0, len(backend.books))
+	for _, book := range backend.books {
+		copied := *book
+		books = append(books, &copied)
+	}
+	return books, nil
+}
+
+func (backend *fakeBackend) Objects(accountId, bookId uint, names []string, withCards bool) ([]*Object, error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	stored, ok := backend.objects[bookId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if names == nil {
+		for name := range stored {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	objects := make([]*Object, 0)
+	for _, name := range names {
+		if object, found := stored[name]; found {
+			copied := *object
+			if !withCards {
+				copied.Card = nil
+			}
+			objects = append(objects, &copied)
+		}
+	}
+	return objects, nil
+}
+
+func (backend *fakeBackend) PutObject(accountId, bookId uint, name string, card *vcard.Card, ifMatch,
+	ifNoneMatch string) (bool, error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	stored, ok := backend.objects[bookId]
+	if !ok {
+		return false, ErrNotFound
+	}
+	for _, book := range backend.books {
+		if book.ID == bookId && book.ReadOnly {
+			return false, ErrForbidden
+		}
+	}
+	existing, exists := stored[name]
+	if (ifNoneMatch == "*" && exists) || (ifMatch != "" && (!exists || (ifMatch != "*" && ifMatch != existing.ETag))) {
+		return false, ErrPreconditionFailed
+	}
+	if card.FirstName == "" && card.LastName == "" && card.FullName == "" {
+		return false, &InvalidCardError{Reason: "a contact needs a name"}
+	}
+	for otherName, other := range stored {
+		if otherName != name && card.UID != "" && other.Card.UID == card.UID {
+			return false, ErrUIDConflict
+		}
+	}
+	backend.add(bookId, name, card)
+	return !exists, nil
+}
+
+func (backend *fakeBackend) DeleteObject(accountId, bookId uint, name, ifMatch string) error {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	stored, ok := backend.objects[bookId]
+	if !ok {
+		return ErrNotFound
+	}
+	for _, book := range backend.books {
+		if book.ID == bookId && book.ReadOnly {
+			return ErrForbidden
+		}
+	}
+	existing, exists := stored[name]
+	if !exists {
+		return ErrNotFound
+	}
+	if ifMatch != "" && ifMatch != "*" && ifMatch != existing.ETag {
+		return ErrPreconditionFailed
+	}
+	delete(stored, name)
+	backend.version++
+	return nil
+}
+
+// davClient struct is a small CardDAV client, it signs every request in with basic auth and
+// does not follow redirects so that discovery can be checked step by step
+type davClient struct {
+	t        *testing.T
+	server   *httptest.Server
+	username string
+	password string
+	http     *http.Client
+}
+
+// newTestServer private function that serves the handler the way the API server mounts it, other
+// paths answer 404 like the API router does for unknown routes
+func newTestServer(t *testing.T, backend Backend) *davClient {
+	mux := http.NewServeMux()
+	(&Handler{Backend: backend, Prefix: "/carddav", MaxCardBytes: 4096}).Mount(mux)
+	mux.Handle("/", http.NotFoundHandler())
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return &davClient{t: t, server: server, username: testUser, password: testPassword, http: &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}}
+}
+
+// do private method that sends a request and returns the response with its body read
+func (client *davClient) do(method, path string, headers map[string]string, body string) (*http.Response, string) {
+	client.t.Helper()
+	req, err := http.NewRequest(method, client.server.URL+path, strings.NewReader(body))
+	if err != nil {
+		client.t.Fatalf("building %s %s: %v", method, path, err)
+	}
+	if client.username != "" {
+		req.SetBasicAuth(client.username, client.password)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := client.http.Do(req)
+	if err != nil {
+		client.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		client.t.Fatalf("reading %s %s: %v", method, path, err)
+	}
+	return resp, string(data)
+}
+
+// multistatus private method that sends a PROPFIND or REPORT and parses the 207 response
+func (client *davClient) multistatus(method, path, depth, body string) *testMultistatus {
+	client.t.Helper()
+	headers := map[string]string{"Content-Type": "application/xml; charset=utf-8"}
+	if depth != "" {
+		headers["Depth"] = depth
+	}
+	resp, data := client.do(method, path, headers, body)
+	if resp.StatusCode != http.StatusMultiStatus {
+		client.t.Fatalf("%s %s answered %d, want 207:\n%s", method, path, resp.StatusCode, data)
+	}
+	result := &testMultistatus{}
+	if err := xml.Unmarshal([]byte(data), result); err != nil {
+		client.t.Fatalf("parsing the %s %s response: %v\n%s", method, path, err, data)
+	}
+	return result
+}
+
+// testMultistatus, testResponse and testProp structs parse a multistatus the way a client reads it
+type testMultistatus struct {
+	XMLName   xml.Name        `xml:"DAV: multistatus"`
+	Responses []*testResponse `xml:"DAV: response"`
+}
+
+type testResponse struct {
+	Href      string `xml:"DAV: href"`
+	Status    string `xml:"DAV: status"`
+	Propstats []struct {
+		Any    testPropList `xml:"DAV: prop"`
+		Status string       `xml:"DAV: status"`
+	} `xml:"DAV: propstat"`
+}
+
+type testPropList struct {
+	Props []*testProp `xml:",any"`
+}
+
+type testProp struct {
+	XMLName  xml.Name
+	Text     string   `xml:",chardata"`
+	Hrefs    []string `xml:"DAV: href"`
+	Children []struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+// response private method that returns the response for an href, nil when there is none
+func (ms *testMultistatus) response(href string) *testResponse {
+	for _, response := range ms.Responses {
+		if response.Href == href {
+			return response
+		}
+	}
+	return nil
+}
+
+// hrefs private method that lists the hrefs of the responses in order
+func (ms *testMultistatus) hrefs() []string {
+	hrefs := make([]string, 0, len(ms.Responses))
+	for _, response := range ms.Responses {
+		hrefs = append(hrefs, response.Href)
+	}
+	return hrefs
+}
+
+// prop private method that returns a property found with 200 OK, nil when it is not
+func (response *testResponse) prop(space, local string) *testProp {
+	for _, propstat := range response.Propstats {
+		if !strings.Contains(propstat.Status, " 200 ") {
+			continue
+		}
+		for _, prop := range propstat.Any.Props {
+			if prop.XMLName.Space == space && prop.XMLName.Local == local {
+				return prop
+			}
+		}
+	}
+	return nil
+}
+
+// missing private method that lists the properties reported with 404 Not Found
+func (response *testResponse) missing() []string {
+	names := make([]string, 0)
+	for _, propstat := range response.Propstats {
+		if strings.Contains(propstat.Status, " 404 ") {
+			for _, prop := range propstat.Any.Props {
+				names = append(names, prop.XMLName.Local)
+			}
+		}
+	}
+	return names
+}
+
+// has private method that checks a property has a child element, e.g. the addressbook resource type
+func (prop *testProp) has(space, local string) bool {
+	for _, child := range prop.Children {
+		if child.XMLName.Space == space && child.XMLName.Local == local {
+			return true
+		}
+	}
+	return false
+}
+
+const propfindAll = `<?xml version="1.0" encoding="utf-8"?><d:propfind xmlns:d="DAV:"><d:allprop/></d:propfind>`
+
+// propfind private function that returns a PROPFIND body asking for properties given as "space local"
+func propfind(names ...string) string {
+	var props strings.Builder
+	for _, name := range names {
+		parts := strings.SplitN(name, " ", 2)
+		props.WriteString(fmt.Sprintf(`<%s xmlns="%s"/>`, parts[1], parts[0]))
+	}
+	return `<?xml version="1.0" encoding="utf-8"?><d:propfind xmlns:d="DAV:"><d:prop>` + props.String() +
+		`</d:prop></d:propfind>`
+}
+
+// card private function that returns a vCard 3.0 body
+func card(uid, name, email string) string {
+	lines := []string{"BEGIN:VCARD", "VERSION:3.0", "UID:" + uid, "FN:" + name, "N:" + name + ";;;;"}
+	if email != "" {
+		lines = append(lines, "EMAIL;TYPE=HOME:"+email)
+	}
+	return strings.Join(append(lines, "END:VCARD"), "\r\n") + "\r\n"
+}
+
+func TestAuthentication(t *testing.T) {
+	client := newTestServer(t, newFakeBackend())
+
+	// OPTIONS tells clients the server speaks CardDAV without asking them to sign in
+	client.username = ""
+	resp, _ := client.do(http.MethodOptions, "/carddav/", nil, "")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("DAV"), "addressbook") {
+		t.Errorf("OPTIONS answered %d with DAV %q, want 200 with addressbook", resp.StatusCode,
+			resp.Header.Get("DAV"))
+	}
+
+	resp, _ = client.do("PROPFIND", "/carddav/", map[string]string{"Depth": "0"}, propfindAll)
+	if resp.StatusCode != http.StatusUnauthorized || !strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), "Basic ") {
+		t.Errorf("PROPFIND without credentials answered %d, want 401 with a Basic challenge", resp.StatusCode)
+	}
+
+	client.username, client.password = testUser, "wrong"
+	if resp, _ = client.do("PROPFIND", "/carddav/", nil, propfindAll); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("PROPFIND with a wrong password answered %d, want 401", resp.StatusCode)
+	}
+
+	client.username, client.password = lockedUser, testPassword
+	if resp, _ = client.do("PROPFIND", "/carddav/", nil, propfindAll); resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("PROPFIND of a locked out user answered %d, want 429", resp.StatusCode)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	client := newTestServer(t, newFakeBackend())
+
+	// /.well-known/carddav points at the service
+	resp, _ := client.do("PROPFIND", WellKnownPath, map[string]string{"Depth": "0"},
+		propfind("DAV: current-user-principal"))
+	if resp.StatusCode != http.StatusMovedPermanently {
+		t.Fatalf("PROPFIND %s answered %d, want 301", WellKnownPath, resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || location.Path != "/carddav/" {
+		t.Fatalf("well-known redirect to %q, want /carddav/", resp.Header.Get("Location"))
+	}
+
+	// the service tells who is signed in
+	ms := client.multistatus("PROPFIND", location.Path, "0", propfind("DAV: current-user-principal"))
+	principal := ms.response("/carddav/").prop("DAV:", "current-user-principal")
+	if principal == nil || len(principal.Hrefs) != 1 {
+		t.Fatalf("no current-user-principal on /carddav/: %+v", ms.Responses[0])
+	}
+
+	// the principal tells where its address books are
+	ms = client.multistatus("PROPFIND", principal.Hrefs[0], "0", propfind("urn:ietf:params:xml:ns:carddav addressbook-home-set",
+		"DAV: resourcetype"))
+	response := ms.response(principal.Hrefs[0])
+	if response == nil {
+		t.Fatalf("no response for the principal %s, got %v", principal.Hrefs[0], ms.hrefs())
+	}
+	if resourceType := response.prop("DAV:", "resourcetype"); resourceType == nil || !resourceType.has("DAV:", "principal") {
+		t.Errorf("%s is not a principal", principal.Hrefs[0])
+	}
+	homeSet := response.prop(nsCardDAV, "addressbook-home-set")
+	if homeSet == nil || len(homeSet.Hrefs) != 1 || homeSet.Hrefs[0] != "/carddav/books/" {
+		t.Fatalf("addressbook-home-set of the principal is %+v, want /carddav/books/", homeSet)
+	}
+
+	// the home lists the address books
+	ms = client.multistatus("PROPFIND", homeSet.Hrefs[0], "1", propfind("DAV: resourcetype", "DAV: displayname",
+		"DAV: current-user-privilege-set"))
+	if got := strings.Join(ms.hrefs(), " "); got != "/carddav/books/ /carddav/books/1/ /carddav/books/2/" {
+		t.Fatalf("home lists %s, want the home and both books", got)
+	}
+	for href, want := range map[string]string{"/carddav/books/1/": "Personal", "/carddav/books/2/": "Family & friends"} {
+		book := ms.response(href)
+		if resourceType := book.prop("DAV:", "resourcetype"); resourceType == nil ||
+			!resourceType.has(nsCardDAV, "addressbook") || !resourceType.has("DAV:", "collection") {
+			t.Errorf("%s is not an address book collection", href)
+		}
+		if name := book.prop("DAV:", "displayname"); name == nil || name.Text != want {
+			t.Errorf("%s is named %+v, want %q", href, name, want)
+		}
+	}
+	privileges := ms.response("/carddav/books/2/").prop("DAV:", "current-user-privilege-set")
+	for _, privilege := range privileges.Children {
+		if privilege.XMLName.Local != "privilege" {
+			t.Errorf("unexpected %s in the privileges of the read only book", privilege.XMLName.Local)
+		}
+	}
+	if _, data := client.do("PROPFIND", "/carddav/books/2/", map[string]string{"Depth": "0"},
+		propfind("DAV: current-user-privilege-set")); strings.Contains(data, "<write") {
+		t.Errorf("the read only book grants write:\n%s", data)
+	}
+}
+
+func TestPropfindDepth(t *testing.T) {
+	client := newTestServer(t, newFakeBackend())
+
+	ms := client.multistatus("PROPFIND", "/carddav/books/1/", "0", propfind("http://calendarserver.org/ns/ getctag",
+		"DAV: displayname", "DAV: quota-used-bytes"))
+	if len(ms.Responses) != 1 || ms.Responses[0].Href != "/carddav/books/1/" {
+		t.Fatalf("Depth 0 on a book answered %v, want only the book", ms.hrefs())
+	}
+	book := ms.Responses[0]
+	if ctag := book.prop(nsCalendarSrv, "getctag"); ctag == nil || ctag.Text == "" {
+		t.Error("the book has no getctag")
+	}
+	if missing := book.missing(); len(missing) != 1 || missing[0] != "quota-used-bytes" {
+		t.Errorf("properties reported missing: %v, want quota-used-bytes", missing)
+	}
+
+	ms = client.multistatus("PROPFIND", "/carddav/books/1/", "1", propfind("DAV: getetag", "DAV: resourcetype"))
+	want := "/carddav/books/1/ /carddav/books/1/10.vcf /carddav/books/1/11.vcf /carddav/books/1/phone-made.vcf"
+	if got := strings.Join(ms.hrefs(), " "); got != want {
+		t.Fatalf("Depth 1 on a book answered %s, want %s", got, want)
+	}
+	for _, response := range ms.Responses[1:] {
+		if etag := response.prop("DAV:", "getetag"); etag == nil || !strings.HasPrefix(etag.Text, `"`) {
+			t.Errorf("%s has no quoted getetag", response.Href)
+		}
+		if strings.Contains(response.Href, "address-data") {
+			t.Errorf("%s: PROPFIND should not return card contents", response.Href)
+		}
+	}
+
+	// a missing Depth header is treated as infinity, which lists the children too
+	if ms = client.multistatus("PROPFIND", "/carddav/books/1/", "", propfindAll); len(ms.Responses) != 4 {
+		t.Errorf("PROPFIND without Depth answered %d responses, want 4", len(ms.Responses))
+	}
+
+	ms = client.multistatus("PROPFIND", "/carddav/books/1/11.vcf", "0", propfind("DAV: getetag",
+		"DAV: getcontenttype"))
+	if len(ms.Responses) != 1 || ms.Responses[0].prop("DAV:", "getcontenttype") == nil {
+		t.Errorf("PROPFIND on a card answered %v", ms.hrefs())
+	}
+
+	// propname lists the names only
+	_, data := client.do("PROPFIND", "/carddav/books/1/", map[string]string{"Depth": "0"},
+		`<?xml version="1.0"?><propfind xmlns="DAV:"><propname/></propfind>`)
+	if !strings.Contains(data, "<getctag") || strings.Contains(data, "Personal") {
+		t.Errorf("propname should name the properties without their values:\n%s", data)
+	}
+
+	for path, status := range map[string]int{"/carddav/books/1/missing.vcf": http.StatusNotFound,
+		"/carddav/books/9/": http.StatusNotFound, "/carddav/books/x/": http.StatusNotFound,
+		"/carddav/other/": http.StatusNotFound} {
+		if resp, _ := client.do("PROPFIND", path, map[string]string{"Depth": "0"}, propfindAll); resp.StatusCode != status {
+			t.Errorf("PROPFIND %s answered %d, want %d", path, resp.StatusCode, status)
+		}
+	}
+	if resp, _ := client.do("PROPFIND", "/carddav/", nil, "<propfind"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("PROPFIND with broken XML answered %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	client := newTestServer(t, newFakeBackend())
+
+	padding := "<!--" + strings.Repeat("x", maxXMLBytes) + "-->"
+	for _, method := range []string{"PROPFIND", "REPORT"} {
+		resp, _ := client.do(method, "/carddav/books/1/", map[string]string{"Depth": "1"}, padding+propfindAll)
+		if resp.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s with a body over 1 MB answered %d, want 413", method, resp.StatusCode)
+		}
+	}
+	resp, data := client.do(http.MethodPut, "/carddav/books/1/big.vcf", nil,
+		card("uid-big", "Big", strings.Repeat("x", 5000)+"@example.com"))
+	if resp.StatusCode != http.StatusRequestEntityTooLarge || !strings.Contains(data, "max-resource-size") {
+		t.Errorf("PUT of a card over MaxCardBytes answered %d, want 413 max-resource-size:\n%s", resp.StatusCode, data)
+	}
+}
+
+func TestReportMultiget(t *testing.T) {
+	client := newTestServer(t, newFakeBackend())
+
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<c:addressbook-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:carddav">
+	<d:prop><d:getetag/><c:address-data/></d:prop>
+	<d:href>/carddav/books/1/10.vcf</d:href>
+	<d:href>/carddav/books/1/gone.vcf</d:href>
+	<d:href>/carddav/books/2/20.vcf</d:href>
+	<d:href>/carddav/books/1/phone-made.vcf</d:href>
+</c:addressbook-multiget>`
+	ms := client.multistatus("REPORT", "/carddav/books/1/", "1", body)
+	want := "/carddav/books/1/10.vcf /carddav/books/1/gone.vcf /carddav/books/2/20.vcf /carddav/books/1/phone-made.vcf"
+	if got := strings.Join(ms.hrefs(), " "); got != want {
+		t.Fatalf("multiget answered %s, want every href in order: %s", got, want)
+	}
+
+	ada := ms.response("/carddav/books/1/10.vcf")
+	data := ada.prop(nsCardDAV, "address-data")
+	if data == nil || !strings.Contains(data.Text, "VERSION:3.0") || !strings.Contains(data.Text, "FN:Ada Lovelace") ||
+		!strings.Contains(data.Text, "UID:uid-10") {
+		t.Errorf("address-data of 10.vcf is %+v, want the vCard 3.0 of Ada", data)
+	}
+	if etag := ada.prop("DAV:", "getetag"); etag == nil || etag.Text == "" {
+		t.Error("10.vcf has no getetag")
+	}
+	if grace := ms.response("/carddav/books/1/phone-made.vcf").prop(nsCardDAV, "address-data"); grace == nil ||
+		!strings.Contains(grace.Text, "FN:Grace Hopper") {
+		t.Errorf("address-data of phone-made.vcf is %+v", grace)
+	}
+	// hrefs that are not cards of the book are reported missing
+	for _, href := range []string{"/carddav/books/1/gone.vcf", "/carddav/books/2/20.vcf"} {
+		if status := ms.response(href).Status; !strings.Contains(status, " 404 ") {
+			t.Errorf("%s answered %q, want 404", href, status)
+		}
+	}
+
+	// the vCard version asked for is returned
+	body = strings.Replace(body, "<c:address-data/>", `<c:address-data content-type="text/vcard" version="4.0"/>`, 1)
+	ms = client.multistatus("REPORT", "/carddav/books/1/", "1", body)
+	if data := ms.response("/carddav/books/1/10.vcf").prop(nsCardDAV, "address-data"); data == nil ||
+		!strings.Contains(data.Text, "VERSION:4.0") {
+		t.Errorf("address-data asked in 4.0 is %+v", data)
+	}
+}
+
+func TestReportQuery(t *testing.T) {
+	client := newTestServer(t, newFakeBackend())
+
+	query := func(filter, limit string) string {
+		return `<?xml version="1.0" encoding="utf-8"?>
+<c:addressbook-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:carddav">
+	<d:prop><d:getetag/><c:address-data/></d:prop>` + filter + limit + `</c:addressbook-query>`
+	}
+
+	ms := client.multistatus("REPORT", "/carddav/books/1/", "1", query(`<c:filter>
+		<c:prop-filter name="EMAIL"><c:text-match collation="i;unicode-casemap" match-type="contains">EXAMPLE.COM</c:text-match></c:prop-filter>
+	</c:filter>`, ""))
+	if got := strings.Join(ms.hrefs(), " "); got != "/carddav/books/1/10.vcf" {
+		t.Errorf("EMAIL contains example.com matched %s, want only 10.vcf", got)
+	}
+	if data := ms.Responses[0].prop(nsCardDAV, "address-data"); data == nil || !strings.Contains(data.Text, "ada@example.com") {
+		t.Errorf("query result has no address-data: %+v", ms.Responses[0])
+	}
+
+	ms = client.multistatus("REPORT", "/carddav/books/1/", "1", query(`<c:filter test="allof">
+		<c:prop-filter name="FN"><c:text-match match-type="starts-with">a</c:text-match></c:prop-filter>
+		<c:prop-filter name="TEL"><c:is-not-defined/></c:prop-filter>
+	</c:filter>`, ""))
+	if got := strings.Join(ms.hrefs(), " "); got != "/carddav/books/1/11.vcf" {
+		t.Errorf("FN starts with a and no TEL matched %s, want only 11.vcf", got)
+	}
+
+	// without a filter every card matches, a limit truncates the result with a 507 on the book
+	ms = client.multistatus("REPORT", "/carddav/books/1/", "1", query("", "<c:limit><c:nresults>2</c:nresults></c:limit>"))
+	want := "/carddav/books/1/10.vcf /carddav/books/1/11.vcf /carddav/books/1/"
+	if got := strings.Join(ms.hrefs(), " "); got != want {
+		t.Fatalf("limited query answered %s, want %s", got, want)
+	}
+	if status := ms.Responses[2].Status; !strings.Contains(status, " 507 ") {
+		t.Errorf("truncated query reported %q on the book, want 507", status)
+	}
+
+	for name, c := range map[string]struct {
+		path, body, condition string
+	}{
+		"collation": {"/carddav/books/1/", query(`<c:filter><c:prop-filter name="FN">
+			<c:text-match collation="i;klingon">a</c:text-match></c:prop-filter></c:filter>`, ""), "supported-collation"},
+		"param-filter": {"/carddav/books/1/", query(`<c:filter><c:prop-filter name="TEL">
+			<c:param-filter name="TYPE"/></c:prop-filter></c:filter>`, ""), "supported-filter"},
+		"home": {"/carddav/books/", query("", ""), "supported-report"},
+		"sync-collection": {"/carddav/books/1/", `<?xml version="1.0"?><d:sync-collection xmlns:d="DAV:">
+			<d:sync-token/></d:sync-collection>`, "supported-report"},
+	} {
+		resp, data := client.do("REPORT", c.path, map[string]string{"Depth": "1"}, c.body)
+		if resp.StatusCode != http.StatusForbidden || !strings.Contains(data, "<"+c.condition) {
+			t.Errorf("%s: REPORT answered %d, want 403 with %s:\n%s", name, resp.StatusCode, c.condition, data)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	client := newTestServer(t, newFakeBackend())
+
+	resp, body := client.do(http.MethodGet, "/carddav/books/1/11.vcf", nil, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET answered %d, want 200", resp.StatusCode)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/vcard") || resp.Header.Get("ETag") == "" ||
+		resp.Header.Get("Last-Modified") == "" {
+		t.Errorf("GET headers %v, want a vCard with ETag and Last-Modified", resp.Header)
+	}
+	results, err := vcard.Decode(strings.NewReader(body))
+	if err != nil || len(results) != 1 || results[0].Err != nil || results[0].Card.UID != "uid-11" {
+		t.Errorf("GET returned %q, want the card of Alan", body)
+	}
+
+	resp, body = client.do(http.MethodGet, "/carddav/books/1/11.vcf", map[string]string{"Accept": "text/vcard;version=4.0"}, "")
+	if !strings.Contains(body, "VERSION:4.0") {
+		t.Errorf("GET accepting 4.0 returned %q", body)
+	}
+
+	resp, body = client.do(http.MethodHead, "/carddav/books/1/11.vcf", nil, "")
+	if resp.StatusCode != http.StatusOK || body != "" || resp.Header.Get("ETag") == "" {
+		t.Errorf("HEAD answered %d with %d bytes, want 200 with headers only", resp.StatusCode, len(body))
+	}
+
+	for path, status := range map[string]int{"/carddav/books/1/gone.vcf": http.StatusNotFound,
+		"/carddav/books/9/10.vcf": http.StatusNotFound, "/carddav/books/1/": http.StatusMethodNotAllowed} {
+		if resp, _ := client.do(http.MethodGet, path, nil, ""); resp.StatusCode != status {
+			t.Errorf("GET %s answered %d, want %d", path, resp.StatusCode, status)
+		}
+	}
+}
+
+func TestPut(t *testing.T) {
+	backend := newFakeBackend()
+	client := newTestServer(t, backend)
+	path := "/carddav/books/1/new-card.vcf"
+
+	// a client creating a card says it should not exist yet
+	resp, _ := client.do(http.MethodPut, path, map[string]string{"If-None-Match": "*", "Content-Type": "text/vcard"},
+		card("uid-new", "Katherine Johnson", "katherine@example.com"))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("PUT of a new card answered %d, want 201", resp.StatusCode)
+	}
+	resp, _ = client.do(http.MethodPut, path, map[string]string{"If-None-Match": "*"},
+		card("uid-new", "Katherine Johnson", ""))
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("PUT with If-None-Match on an existing card answered %d, want 412", resp.StatusCode)
+	}
+
+	getResp, _ := client.do(http.MethodGet, path, nil, "")
+	etag := getResp.Header.Get("ETag")
+
+	// updates are made against the version the client has
+	resp, _ = client.do(http.MethodPut, path, map[string]string{"If-Match": `"0"`}, card("uid-new", "Kate Johnson", ""))
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("PUT with a stale If-Match answered %d, want 412", resp.StatusCode)
+	}
+	resp, _ = client.do(http.MethodPut, path, map[string]string{"If-Match": etag}, card("uid-new", "Kate Johnson", ""))
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("PUT with the current If-Match answered %d, want 204", resp.StatusCode)
+	}
+	getResp, body := client.do(http.MethodGet, path, nil, "")
+	if getResp.Header.Get("ETag") == etag || !strings.Contains(body, "FN:Kate Johnson") {
+		t.Errorf("after the update the card has ETag %s and body %q, want a new ETag and the new name",
+			getResp.Header.Get("ETag"), body)
+	}
+	resp, _ = client.do(http.MethodPut, "/carddav/books/1/never-made.vcf", map[string]string{"If-Match": etag},
+		card("uid-other", "Nobody", ""))
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("PUT with If-Match on a missing card answered %d, want 412", resp.StatusCode)
+	}
+
+	// a UID can only be used by one card of the book
+	resp, data := client.do(http.MethodPut, "/carddav/books/1/copy.vcf", nil, card("uid-10", "Ada Copy", ""))
+	if resp.StatusCode != http.StatusConflict || !strings.Contains(data, "no-uid-conflict") {
+		t.Errorf("PUT of a card with a used UID answered %d, want 409 no-uid-conflict:\n%s", resp.StatusCode, data)
+	}
+
+	// viewers of a book can not change it
+	resp, data = client.do(http.MethodPut, "/carddav/books/2/21.vcf", nil, card("uid-21", "Dad", ""))
+	if resp.StatusCode != http.StatusForbidden || !strings.Contains(data, "need-privileges") {
+		t.Errorf("PUT in a read only book answered %d, want 403 need-privileges:\n%s", resp.StatusCode, data)
+	}
+
+	for name, c := range map[string]struct {
+		path, body string
+		status     int
+		condition  string
+	}{
+		"not a vcard":   {path, "hello", http.StatusForbidden, "valid-address-data"},
+		"two cards":     {path, card("a", "A", "") + card("b", "B", ""), http.StatusForbidden, "valid-address-data"},
+		"rejected":      {path, "BEGIN:VCARD\r\nVERSION:3.0\r\nUID:uid-new\r\nEND:VCARD\r\n", http.StatusForbidden, "valid-address-data"},
+		"long name":     {"/carddav/books/1/" + strings.Repeat("a", 256), card("x", "X", ""), http.StatusForbidden, "name-allowed"},
+		"on a book":     {"/carddav/books/1/", card("x", "X", ""), http.StatusMethodNotAllowed, ""},
+		"missing book":  {"/carddav/books/9/x.vcf", card("x", "X", ""), http.StatusNotFound, ""},
+		"outside books": {"/carddav/principal/x.vcf", card("x", "X", ""), http.StatusNotFound, ""},
+	} {
+		resp, data := client.do(http.MethodPut, c.path, nil, c.body)
+		if resp.StatusCode != c.status || !strings.Contains(data, c.condition) {
+			t.Errorf("%s: PUT answered %d, want %d %s:\n%s", name, resp.StatusCode, c.status, c.condition, data)
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	client := newTestServer(t, newFakeBackend())
+	path := "/carddav/books/1/10.vcf"
+
+	resp, _ := client.do(http.MethodDelete, path, map[string]string{"If-Match": `"0"`}, "")
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("DELETE with a stale If-Match answered %d, want 412", resp.StatusCode)
+	}
+	getResp, _ := client.do(http.MethodGet, path, nil, "")
+	resp, _ = client.do(http.MethodDelete, path, map[string]string{"If-Match": getResp.Header.Get("ETag")}, "")
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE answered %d, want 204", resp.StatusCode)
+	}
+	if resp, _ = client.do(http.MethodGet, path, nil, ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET of a deleted card answered %d, want 404", resp.StatusCode)
+	}
+	ms := client.multistatus("PROPFIND", "/carddav/books/1/", "1", propfind("DAV: getetag"))
+	if ms.response(path) != nil {
+		t.Errorf("the deleted card is still listed: %v", ms.hrefs())
+	}
+
+	for name, c := range map[string]struct {
+		path      string
+		status    int
+		condition string
+	}{
+		"deleted":   {path, http.StatusNotFound, ""},
+		"read only": {"/carddav/books/2/20.vcf", http.StatusForbidden, "need-privileges"},
+		"book":      {"/carddav/books/1/", http.StatusForbidden, "need-privileges"},
+	} {
+		resp, data := client.do(http.MethodDelete, c.path, nil, "")
+		if resp.StatusCode != c.status || !strings.Contains(data, c.condition) {
+			t.Errorf("%s: DELETE answered %d, want %d %s", name, resp.StatusCode, c.status, c.condition)
+		}
+	}
+}
+
+func TestUnknownMethod(t *testing.T) {
+	client := newTestServer(t, newFakeBackend())
+	resp, _ := client.do("MKCOL", "/carddav/books/3/", nil, "")
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") == "" {
+		t.Errorf("MKCOL answered %d, want 405 with Allow", resp.StatusCode)
+	}
+}
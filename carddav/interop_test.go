@@ -0,0 +1,150 @@
+package carddav
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	govcard "github.com/emersion/go-vcard"
+	"github.com/emersion/go-webdav"
+	davclient "github.com/emersion/go-webdav/carddav"
+)
+
+// newInteropClients private function that points the go-webdav WebDAV and CardDAV clients, a client
+// library native apps are built on, at a test server the way a user would configure an account
+func newInteropClients(t *testing.T, backend Backend) (*webdav.Client, *davclient.Client) {
+	server := newTestServer(t, backend).server
+	httpClient := webdav.HTTPClientWithBasicAuth(server.Client(), testUser, testPassword)
+	webdavClient, err := webdav.NewClient(httpClient, server.URL+"/carddav/")
+	if err != nil {
+		t.Fatalf("creating the WebDAV client: %v", err)
+	}
+	cardDAVClient, err := davclient.NewClient(httpClient, server.URL+"/carddav/")
+	if err != nil {
+		t.Fatalf("creating the CardDAV client: %v", err)
+	}
+	return webdavClient, cardDAVClient
+}
+
+func TestInteropDiscovery(t *testing.T) {
+	webdavClient, client := newInteropClients(t, newFakeBackend())
+	ctx := context.Background()
+
+	if err := client.HasSupport(ctx); err != nil {
+		t.Fatalf("HasSupport: %v", err)
+	}
+	principal, err := webdavClient.FindCurrentUserPrincipal(ctx)
+	if err != nil || principal != "/carddav/principal/" {
+		t.Fatalf("FindCurrentUserPrincipal returned %q, %v, want /carddav/principal/", principal, err)
+	}
+	home, err := client.FindAddressBookHomeSet(ctx, principal)
+	if err != nil || home != "/carddav/books/" {
+		t.Fatalf("FindAddressBookHomeSet returned %q, %v, want /carddav/books/", home, err)
+	}
+
+	books, err := client.FindAddressBooks(ctx, home)
+	if err != nil {
+		t.Fatalf("FindAddressBooks: %v", err)
+	}
+	found := make(map[string]string)
+	for _, book := range books {
+		found[book.Path] = book.Name
+		if book.Path == "/carddav/books/1/" && book.MaxResourceSize != 4096 {
+			t.Errorf("max resource size of %s is %d, want 4096", book.Path, book.MaxResourceSize)
+		}
+	}
+	if len(found) != 2 || found["/carddav/books/1/"] != "Personal" || found["/carddav/books/2/"] != "Family & friends" {
+		t.Errorf("FindAddressBooks found %v, want the Personal and Family & friends books", found)
+	}
+}
+
+func TestInteropQueryAndMultiget(t *testing.T) {
+	_, client := newInteropClients(t, newFakeBackend())
+	ctx := context.Background()
+
+	objects, err := client.QueryAddressBook(ctx, "/carddav/books/1/", &davclient.AddressBookQuery{
+		DataRequest: davclient.AddressDataRequest{AllProp: true},
+		PropFilters: []davclient.PropFilter{{
+			Name:        govcard.FieldEmail,
+			TextMatches: []davclient.TextMatch{{Text: "EXAMPLE.COM", MatchType: davclient.MatchContains}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("QueryAddressBook: %v", err)
+	}
+	if len(objects) != 1 || objects[0].Path != "/carddav/books/1/10.vcf" || objects[0].ETag == "" {
+		t.Fatalf("QueryAddressBook returned %+v, want 10.vcf with an ETag", objects)
+	}
+	if name := objects[0].Card.Name(); name == nil || name.GivenName != "Ada" || name.FamilyName != "Lovelace" {
+		t.Errorf("the queried card is named %+v, want Ada Lovelace", name)
+	}
+
+	objects, err = client.MultiGetAddressBook(ctx, "/carddav/books/1/", &davclient.AddressBookMultiGet{
+		Paths:       []string{"/carddav/books/1/11.vcf", "/carddav/books/1/phone-made.vcf"},
+		DataRequest: davclient.AddressDataRequest{AllProp: true},
+	})
+	if err != nil {
+		t.Fatalf("MultiGetAddressBook: %v", err)
+	}
+	uids := make([]string, 0, len(objects))
+	for _, object := range objects {
+		uids = append(uids, object.Card.Value(govcard.FieldUID))
+	}
+	sort.Strings(uids)
+	if len(uids) != 2 || uids[0] != "uid-11" || uids[1] != "uid-12" {
+		t.Errorf("MultiGetAddressBook returned the cards %v, want uid-11 and uid-12", uids)
+	}
+}
+
+func TestInteropPutGetDelete(t *testing.T) {
+	webdavClient, client := newInteropClients(t, newFakeBackend())
+	ctx := context.Background()
+
+	card := govcard.Card{}
+	card.SetValue(govcard.FieldVersion, "3.0")
+	card.SetValue(govcard.FieldUID, "uid-new")
+	card.SetValue(govcard.FieldFormattedName, "Katherine Johnson")
+	card.SetName(&govcard.Name{GivenName: "Katherine", FamilyName: "Johnson"})
+	card.Add(govcard.FieldTelephone, &govcard.Field{Value: "+254700000009",
+		Params: govcard.Params{govcard.ParamType: {govcard.TypeCell}}})
+	card.Add(govcard.FieldNote, &govcard.Field{Value: "Line one\nLine two, with a comma; and a semicolon"})
+
+	if _, err := client.PutAddressObject(ctx, "/carddav/books/1/new.vcf", card); err != nil {
+		t.Fatalf("PutAddressObject: %v", err)
+	}
+	object, err := client.GetAddressObject(ctx, "/carddav/books/1/new.vcf")
+	if err != nil {
+		t.Fatalf("GetAddressObject: %v", err)
+	}
+	if object.ETag == "" || object.Card.Value(govcard.FieldUID) != "uid-new" {
+		t.Errorf("GetAddressObject returned UID %q with ETag %q, want uid-new with an ETag",
+			object.Card.Value(govcard.FieldUID), object.ETag)
+	}
+	if name := object.Card.Name(); name == nil || name.GivenName != "Katherine" || name.FamilyName != "Johnson" {
+		t.Errorf("the stored card is named %+v, want Katherine Johnson", name)
+	}
+	if phone := object.Card.Value(govcard.FieldTelephone); phone != "+254700000009" {
+		t.Errorf("the stored card has the phone number %q, want +254700000009", phone)
+	}
+
+	// a read only book refuses the card
+	if _, err := client.PutAddressObject(ctx, "/carddav/books/2/new.vcf", card); !isHTTPStatus(err, http.StatusForbidden) {
+		t.Errorf("PutAddressObject in a read only book returned %v, want a 403", err)
+	}
+
+	if err := webdavClient.RemoveAll(ctx, "/carddav/books/1/new.vcf"); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	if _, err := client.GetAddressObject(ctx, "/carddav/books/1/new.vcf"); !isHTTPStatus(err, http.StatusNotFound) {
+		t.Errorf("GetAddressObject of a deleted card returned %v, want a 404", err)
+	}
+}
+
+// isHTTPStatus private function that tells whether a go-webdav error reports an HTTP status, the
+// client's error type is internal so its message is read, e.g. "403 Forbidden: ..."
+func isHTTPStatus(err error, status int) bool {
+	return err != nil && strings.HasPrefix(err.Error(), strconv.Itoa(status)+" ")
+}
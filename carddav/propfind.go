@@ -0,0 +1,310 @@
+package carddav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/cermu/Go-phoneBook-API/vcard"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// principalPath private method that returns the path of the authenticated account
+func (handler *Handler) principalPath() string {
+	return handler.Prefix + "/principal/"
+}
+
+// homePath private method that returns the path of the collection holding the address books
+func (handler *Handler) homePath() string {
+	return handler.Prefix + "/books/"
+}
+
+// bookPath private method that returns the path of an address book
+func (handler *Handler) bookPath(bookId uint) string {
+	return fmt.Sprintf("%s/books/%d/", handler.Prefix, bookId)
+}
+
+// objectPath private method that returns the path of a card
+func (handler *Handler) objectPath(bookId uint, name string) string {
+	return handler.bookPath(bookId) + url.PathEscape(name)
+}
+
+// collectionProps private method that returns the properties of the root, the principal and the home
+func (handler *Handler) collectionProps(kind resourceKind) []*property {
+	collection := element(xml.Name{Space: nsDAV, Local: "collection"}, "")
+	props := []*property{
+		{XMLName: propCurrentUserPrincipal, Inner: href(handler.principalPath())},
+		{XMLName: propHomeSet, Inner: href(handler.homePath())},
+		{XMLName: propPrivilegeSet, Inner: privileges(true)},
+	}
+	switch kind {
+	case principalResource:
+		props = append(props, &property{XMLName: propResourceType,
+			Inner: collection + element(xml.Name{Space: nsDAV, Local: "principal"}, "")},
+			&property{XMLName: propPrincipalURL, Inner: href(handler.principalPath())})
+	case homeResource:
+		props = append(props, &property{XMLName: propResourceType, Inner: collection},
+			&property{XMLName: propDisplayName, Inner: "Address books"})
+	default:
+		props = append(props, &property{XMLName: propResourceType, Inner: collection},
+			&property{XMLName: propDisplayName, Inner: realm})
+	}
+	return props
+}
+
+// bookProps private method that returns the properties of an address book
+func (handler *Handler) bookProps(book *Book) []*property {
+	supportedData := ""
+	for _, version := range []string{vcard.Version3, vcard.Version4} {
+		supportedData += fmt.Sprintf(`<address-data-type xmlns="%s" content-type="text/vcard" version="%s"/>`,
+			nsCardDAV, version)
+	}
+	reports := ""
+	for _, report := range []string{"addressbook-multiget", "addressbook-query"} {
+		reports += element(xml.Name{Space: nsDAV, Local: "supported-report"}, element(xml.Name{Space: nsDAV,
+			Local: "report"}, element(xml.Name{Space: nsCardDAV, Local: report}, "")))
+	}
+	maxBytes := handler.MaxCardBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxCardBytes
+	}
+
+	return []*property{
+		{XMLName: propResourceType, Inner: element(xml.Name{Space: nsDAV, Local: "collection"}, "") +
+			element(xml.Name{Space: nsCardDAV, Local: "addressbook"}, "")},
+		{XMLName: propDisplayName, Inner: escapeText(book.Name)},
+		{XMLName: propCurrentUserPrincipal, Inner: href(handler.principalPath())},
+		{XMLName: propPrivilegeSet, Inner: privileges(book.ReadOnly)},
+		{XMLName: propSupportedReports, Inner: reports},
+		{XMLName: propSupportedData, Inner: supportedData},
+		{XMLName: propMaxResourceSize, Inner: fmt.Sprint(maxBytes)},
+		{XMLName: propCTag, Inner: escapeText(book.CTag)},
+	}
+}
+
+// objectProps private method that returns the properties of a card, its content is included in the
+// vCard version passed, it is left out when version is empty
+func objectProps(book *Book, object *Object, version string) ([]*property, error) {
+	props := []*property{
+		{XMLName: propResourceType},
+		{XMLName: propETag, Inner: escapeText(object.ETag)},
+		{XMLName: propContentType, Inner: "text/vcard; charset=utf-8"},
+		{XMLName: propLastModified, Inner: object.Modified.UTC().Format(http.TimeFormat)},
+		{XMLName: propPrivilegeSet, Inner: privileges(book.ReadOnly)},
+	}
+	if version != "" && object.Card != nil {
+		data := &bytes.Buffer{}
+		if err := vcard.Encode(data, object.Card, version); err != nil {
+			return nil, err
+		}
+		props = append(props, &property{XMLName: propAddressData, Inner: escapeText(data.String())})
+	}
+	return props, nil
+}
+
+// propfind private method that answers a PROPFIND request, Depth 0 describes the resource and any
+// other depth its children as well
+func (handler *Handler) propfind(w http.ResponseWriter, req *http.Request, accountId uint, target *resource) {
+	request := &propfindRequest{}
+	if err := decodeBody(w, req, request); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	var names []xml.Name
+	if request.Prop != nil && request.AllProp == nil && request.PropName == nil {
+		names = append(make([]xml.Name, 0), request.Prop.Names...)
+	}
+	onlyNames := request.PropName != nil
+	children := req.Header.Get("Depth") != "0"
+
+	responses := make([]*response, 0)
+	switch target.kind {
+	case rootResource:
+		responses = append(responses, newResponse(handler.Prefix+"/", handler.collectionProps(rootResource), names,
+			onlyNames))
+		if children {
+			responses = append(responses,
+				newResponse(handler.principalPath(), handler.collectionProps(principalResource), names, onlyNames),
+				newResponse(handler.homePath(), handler.collectionProps(homeResource), names, onlyNames))
+		}
+	case principalResource:
+		responses = append(responses, newResponse(handler.principalPath(), handler.collectionProps(principalResource),
+			names, onlyNames))
+	case homeResource:
+		responses = append(responses, newResponse(handler.homePath(), handler.collectionProps(homeResource), names,
+			onlyNames))
+		if children {
+			books, err := handler.Backend.Books(accountId)
+			if err != nil {
+				handler.serverError(w, err)
+				return
+			}
+			for _, book := range books {
+				responses = append(responses, newResponse(handler.bookPath(book.ID), handler.bookProps(book), names,
+					onlyNames))
+			}
+		}
+	default:
+		book, err := handler.findBook(accountId, target.bookId)
+		if err != nil {
+			handler.serverError(w, err)
+			return
+		}
+		if book == nil {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		var objectNames []string
+		if target.kind == bookResource {
+			responses = append(responses, newResponse(handler.bookPath(book.ID), handler.bookProps(book), names,
+				onlyNames))
+			if !children {
+				break
+			}
+		} else {
+			objectNames = []string{target.name}
+		}
+		objects, err := handler.Backend.Objects(accountId, book.ID, objectNames, false)
+		if err != nil {
+			handler.serverError(w, err)
+			return
+		}
+		if target.kind == objectResource && len(objects) == 0 {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		for _, object := range objects {
+			props, _ := objectProps(book, object, "")
+			responses = append(responses, newResponse(handler.objectPath(book.ID, object.Name), props, names,
+				onlyNames))
+		}
+	}
+	writeMultistatus(w, responses)
+}
+
+// report private method that answers an addressbook-multiget or addressbook-query REPORT on an address book
+func (handler *Handler) report(w http.ResponseWriter, req *http.Request, accountId uint, target *resource) {
+	request := &reportRequest{}
+	if err := decodeBody(w, req, request); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if target.kind != bookResource || request.XMLName.Space != nsCardDAV ||
+		(request.XMLName.Local != "addressbook-multiget" && request.XMLName.Local != "addressbook-query") {
+		writeError(w, http.StatusForbidden, nsDAV, "supported-report",
+			"only addressbook-multiget and addressbook-query are supported, on address books")
+		return
+	}
+	book, err := handler.findBook(accountId, target.bookId)
+	if err != nil {
+		handler.serverError(w, err)
+		return
+	}
+	if book == nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	// the ETag and content of the cards are returned unless other properties are asked for
+	names := []xml.Name{propETag, propAddressData}
+	version := vcard.Version3
+	if request.Prop != nil && request.AllProp == nil {
+		names = append(make([]xml.Name, 0), request.Prop.Names...)
+		if request.Prop.AddressDataVersion == vcard.Version4 {
+			version = vcard.Version4
+		}
+	}
+	withCards := false
+	for _, name := range names {
+		withCards = withCards || name == propAddressData
+	}
+
+	responses := make([]*response, 0)
+	if request.XMLName.Local == "addressbook-multiget" {
+		// the cards are reported under the hrefs the client sent
+		hrefs := make(map[string]string, len(request.Hrefs))
+		objectNames := make([]string, 0, len(request.Hrefs))
+		for _, value := range request.Hrefs {
+			value = strings.TrimSpace(value)
+			if parsed, parseErr := url.Parse(value); parseErr == nil {
+				found := handler.resolve(parsed.Path)
+				if found.kind == objectResource && found.bookId == book.ID {
+					hrefs[value] = found.name
+					objectNames = append(objectNames, found.name)
+				}
+			}
+		}
+		objects, err := handler.Backend.Objects(accountId, book.ID, objectNames, withCards)
+		if err != nil {
+			handler.serverError(w, err)
+			return
+		}
+		byName := make(map[string]*Object, len(objects))
+		for _, object := range objects {
+			byName[object.Name] = object
+		}
+
+		for _, value := range request.Hrefs {
+			value = strings.TrimSpace(value)
+			object, ok := byName[hrefs[value]]
+			if !ok {
+				responses = append(responses, &response{Href: value, Status: statusLine(http.StatusNotFound)})
+				continue
+			}
+			props, err := objectProps(book, object, version)
+			if err != nil {
+				handler.serverError(w, err)
+				return
+			}
+			responses = append(responses, newResponse(value, props, names, false))
+		}
+		writeMultistatus(w, responses)
+		return
+	}
+
+	query := request.Filter
+	if query == nil {
+		query = &filter{}
+	}
+	if err := query.validate(); err != nil {
+		condition := "supported-filter"
+		if err == errUnsupportedCollation {
+			condition = "supported-collation"
+		}
+		writeError(w, http.StatusForbidden, nsCardDAV, condition, err.Error())
+		return
+	}
+	objects, err := handler.Backend.Objects(accountId, book.ID, nil, true)
+	if err != nil {
+		handler.serverError(w, err)
+		return
+	}
+
+	// a truncated result is reported on the address book with 507 (RFC 6352 section 8.6.1)
+	limit := 0
+	if request.Limit != nil && request.Limit.NResults > 0 {
+		limit = request.Limit.NResults
+	}
+	for _, object := range objects {
+		if !query.matches(object.Card) {
+			continue
+		}
+		if limit > 0 && len(responses) == limit {
+			responses = append(responses, &response{Href: handler.bookPath(book.ID),
+				Status: statusLine(http.StatusInsufficientStorage)})
+			break
+		}
+		if !withCards {
+			object.Card = nil
+		}
+		props, err := objectProps(book, object, version)
+		if err != nil {
+			handler.serverError(w, err)
+			return
+		}
+		responses = append(responses, newResponse(handler.objectPath(book.ID, object.Name), props, names, false))
+	}
+	writeMultistatus(w, responses)
+}
@@ -0,0 +1,168 @@
+package carddav
+
+import (
+	"errors"
+	"github.com/cermu/Go-phoneBook-API/vcard"
+	"strings"
+)
+
+var (
+	errUnsupportedFilter    = errors.New("only prop-filter with text-match and is-not-defined is supported")
+	errUnsupportedCollation = errors.New("collation should be one of i;unicode-casemap, i;ascii-casemap or i;octet")
+)
+
+// filter struct is the CARDDAV:filter of an addressbook-query, a card matches when any of the
+// property filters match it, or all of them when Test is allof
+type filter struct {
+	Test        string        `xml:"test,attr"`
+	PropFilters []*propFilter `xml:"urn:ietf:params:xml:ns:carddav prop-filter"`
+}
+
+// propFilter struct matches the values of a vCard property, e.g. EMAIL
+type propFilter struct {
+	Name         string       `xml:"name,attr"`
+	Test         string       `xml:"test,attr"`
+	IsNotDefined *struct{}    `xml:"urn:ietf:params:xml:ns:carddav is-not-defined"`
+	TextMatches  []*textMatch `xml:"urn:ietf:params:xml:ns:carddav text-match"`
+	ParamFilters []struct{}   `xml:"urn:ietf:params:xml:ns:carddav param-filter"`
+}
+
+// textMatch struct compares the values of a property with a string
+type textMatch struct {
+	Text            string `xml:",chardata"`
+	Collation       string `xml:"collation,attr"`
+	NegateCondition string `xml:"negate-condition,attr"`
+	MatchType       string `xml:"match-type,attr"`
+}
+
+// validate private method that checks the filter only uses what the server supports
+func (query *filter) validate() error {
+	for _, prop := range query.PropFilters {
+		if len(prop.ParamFilters) > 0 {
+			return errUnsupportedFilter
+		}
+		for _, match := range prop.TextMatches {
+			switch match.Collation {
+			case "", "i;unicode-casemap", "i;ascii-casemap", "i;octet":
+			default:
+				return errUnsupportedCollation
+			}
+			switch match.MatchType {
+			case "", "equals", "contains", "starts-with", "ends-with":
+			default:
+				return errUnsupportedFilter
+			}
+		}
+	}
+	return nil
+}
+
+// matches private method that checks a card against the filter, a filter without property filters matches every card
+func (query *filter) matches(card *vcard.Card) bool {
+	if len(query.PropFilters) == 0 {
+		return true
+	}
+	allOf := query.Test == "allof"
+	for _, prop := range query.PropFilters {
+		matched := prop.matches(card)
+		if allOf && !matched {
+			return false
+		}
+		if !allOf && matched {
+			return true
+		}
+	}
+	return allOf
+}
+
+// matches private method that checks the values a card has for the property
+func (prop *propFilter) matches(card *vcard.Card) bool {
+	values := propertyValues(card, prop.Name)
+	if prop.IsNotDefined != nil {
+		return len(values) == 0
+	}
+	if len(prop.TextMatches) == 0 {
+		return len(values) > 0
+	}
+	allOf := prop.Test == "allof"
+	for _, match := range prop.TextMatches {
+		matched := match.matches(values)
+		if allOf && !matched {
+			return false
+		}
+		if !allOf && matched {
+			return true
+		}
+	}
+	return allOf
+}
+
+// matches private method that checks whether any of the values matches, or none does when the condition is negated
+func (match *textMatch) matches(values []string) bool {
+	text := match.Text
+	if match.Collation != "i;octet" {
+		text = strings.ToLower(text)
+	}
+
+	matched := false
+	for _, value := range values {
+		if match.Collation != "i;octet" {
+			value = strings.ToLower(value)
+		}
+		switch match.MatchType {
+		case "equals":
+			matched = value == text
+		case "starts-with":
+			matched = strings.HasPrefix(value, text)
+		case "ends-with":
+			matched = strings.HasSuffix(value, text)
+		default:
+			matched = strings.Contains(value, text)
+		}
+		if matched {
+			break
+		}
+	}
+	if match.NegateCondition == "yes" {
+		return !matched
+	}
+	return matched
+}
+
+// propertyValues private function that returns the values a card has for a vCard property,
+// properties the phone book does not store have none
+func propertyValues(card *vcard.Card, name string) []string {
+	values := make([]string, 0)
+	switch strings.ToUpper(name) {
+	case "FN":
+		fullName := card.FullName
+		if fullName == "" {
+			fullName = strings.TrimSpace(card.FirstName + " " + card.LastName)
+		}
+		if fullName != "" {
+			values = append(values, fullName)
+		}
+	case "N":
+		if card.FirstName != "" || card.LastName != "" {
+			values = append(values, card.LastName+";"+card.FirstName)
+		}
+	case "UID":
+		if card.UID != "" {
+			values = append(values, card.UID)
+		}
+	case "TEL":
+		for _, phone := range card.Phones {
+			values = append(values, phone.Value)
+		}
+	case "EMAIL":
+		for _, email := range card.Emails {
+			values = append(values, email.Value)
+		}
+	case "ADR":
+		for _, address := range card.Addresses {
+			values = append(values, strings.Join([]string{"", "", address.Street, address.City, address.Region,
+				address.PostalCode, address.Country}, ";"))
+		}
+	}
+	return values
+}
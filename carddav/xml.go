@@ -0,0 +1,250 @@
+package carddav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// maxXMLBytes is the largest PROPFIND or REPORT body read, a multiget of a few thousand hrefs fits
+const maxXMLBytes = 1 << 20
+
+// errBodyTooLarge is returned by decodeBody when the body is over maxXMLBytes
+var errBodyTooLarge = errors.New("request body is too large")
+
+// XML namespaces of the protocol
+const (
+	nsDAV         = "DAV:"
+	nsCardDAV     = "urn:ietf:params:xml:ns:carddav"
+	nsCalendarSrv = "http://calendarserver.org/ns/" // getctag, still relied on by clients that predate sync reports
+)
+
+// property names
+var (
+	propResourceType         = xml.Name{Space: nsDAV, Local: "resourcetype"}
+	propDisplayName          = xml.Name{Space: nsDAV, Local: "displayname"}
+	propCurrentUserPrincipal = xml.Name{Space: nsDAV, Local: "current-user-principal"}
+	propPrincipalURL         = xml.Name{Space: nsDAV, Local: "principal-URL"}
+	propPrivilegeSet         = xml.Name{Space: nsDAV, Local: "current-user-privilege-set"}
+	propSupportedReports     = xml.Name{Space: nsDAV, Local: "supported-report-set"}
+	propETag                 = xml.Name{Space: nsDAV, Local: "getetag"}
+	propContentType          = xml.Name{Space: nsDAV, Local: "getcontenttype"}
+	propLastModified         = xml.Name{Space: nsDAV, Local: "getlastmodified"}
+	propHomeSet              = xml.Name{Space: nsCardDAV, Local: "addressbook-home-set"}
+	propSupportedData        = xml.Name{Space: nsCardDAV, Local: "supported-address-data"}
+	propMaxResourceSize      = xml.Name{Space: nsCardDAV, Local: "max-resource-size"}
+	propAddressData          = xml.Name{Space: nsCardDAV, Local: "address-data"}
+	propCTag                 = xml.Name{Space: nsCalendarSrv, Local: "getctag"}
+)
+
+// propNames struct holds the properties a PROPFIND or REPORT asks for, in the order they were asked.
+// AddressDataVersion is the vCard version of the address-data asked for
+type propNames struct {
+	Names              []xml.Name
+	AddressDataVersion string
+}
+
+// UnmarshalXML public method that collects the names of the children of a DAV:prop element
+func (props *propNames) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error {
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			props.Names = append(props.Names, element.Name)
+			if element.Name == propAddressData {
+				for _, attr := range element.Attr {
+					if attr.Name.Local == "version" {
+						props.AddressDataVersion = attr.Value
+					}
+				}
+			}
+			if err := decoder.Skip(); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// propfindRequest struct is the body of a PROPFIND request, an empty body asks for all properties
+type propfindRequest struct {
+	XMLName  xml.Name   `xml:"DAV: propfind"`
+	AllProp  *struct{}  `xml:"DAV: allprop"`
+	PropName *struct{}  `xml:"DAV: propname"`
+	Prop     *propNames `xml:"DAV: prop"`
+}
+
+// reportRequest struct is the body of an addressbook-multiget or addressbook-query REPORT
+type reportRequest struct {
+	XMLName xml.Name
+	AllProp *struct{}  `xml:"DAV: allprop"`
+	Prop    *propNames `xml:"DAV: prop"`
+	Hrefs   []string   `xml:"DAV: href"`
+	Filter  *filter    `xml:"urn:ietf:params:xml:ns:carddav filter"`
+	Limit   *struct {
+		NResults int `xml:"urn:ietf:params:xml:ns:carddav nresults"`
+	} `xml:"urn:ietf:params:xml:ns:carddav limit"`
+}
+
+// property struct is a property in a response, Inner is its XML content
+type property struct {
+	XMLName xml.Name
+	Inner   string `xml:",innerxml"`
+}
+
+// propList struct is the DAV:prop element of a propstat, every property is named by its XMLName
+type propList struct {
+	Props []*property
+}
+
+// propstat struct groups the properties of a resource that share a status
+type propstat struct {
+	Prop   propList `xml:"prop"`
+	Status string   `xml:"status"`
+}
+
+// response struct reports the properties of a resource, or only a status
+type response struct {
+	Href      string      `xml:"href"`
+	Propstats []*propstat `xml:"propstat,omitempty"`
+	Status    string      `xml:"status,omitempty"`
+}
+
+// multistatus struct is the body of a PROPFIND or REPORT response
+type multistatus struct {
+	XMLName   xml.Name    `xml:"DAV: multistatus"`
+	Responses []*response `xml:"response"`
+}
+
+// decodeBody private function that reads the XML body of a request, an empty body leaves v unchanged.
+// Bodies over maxXMLBytes are refused with errBodyTooLarge
+func decodeBody(w http.ResponseWriter, req *http.Request, v interface{}) error {
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxXMLBytes))
+	if err != nil && len(data) >= maxXMLBytes {
+		return errBodyTooLarge
+	}
+	if err != nil {
+		return err
+	}
+	err = xml.NewDecoder(bytes.NewReader(data)).Decode(v)
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// writeBodyError private function that answers a request whose body decodeBody could not read
+func writeBodyError(w http.ResponseWriter, err error) {
+	if err == errBodyTooLarge {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+}
+
+// statusLine private function that returns the status line of a propstat or response, e.g. HTTP/1.1 200 OK
+func statusLine(code int) string {
+	return fmt.Sprintf("HTTP/1.1 %d %s", code, http.StatusText(code))
+}
+
+// escapeText private function that escapes the text content of an element
+func escapeText(value string) string {
+	buffer := &bytes.Buffer{}
+	_ = xml.EscapeText(buffer, []byte(value))
+	return buffer.String()
+}
+
+// element private function that returns an element carrying its namespace
+func element(name xml.Name, inner string) string {
+	return fmt.Sprintf(`<%s xmlns="%s">%s</%s>`, name.Local, name.Space, inner, name.Local)
+}
+
+// href private function that returns a DAV:href element
+func href(path string) string {
+	return element(xml.Name{Space: nsDAV, Local: "href"}, escapeText(path))
+}
+
+// privileges private function that returns the privileges of the account on a resource
+func privileges(readOnly bool) string {
+	names := []string{"read", "read-current-user-privilege-set"}
+	if !readOnly {
+		names = append(names, "write", "write-content", "bind", "unbind")
+	}
+	inner := ""
+	for _, name := range names {
+		inner += element(xml.Name{Space: nsDAV, Local: "privilege"}, element(xml.Name{Space: nsDAV, Local: name}, ""))
+	}
+	return inner
+}
+
+// newResponse private function that splits the properties asked for into the ones a resource has and
+// the ones it does not. names is nil for allprop, onlyNames is set for propname
+func newResponse(path string, available []*property, names []xml.Name, onlyNames bool) *response {
+	found, missing := make([]*property, 0), make([]*property, 0)
+	if names == nil {
+		found = available
+	} else {
+		for _, name := range names {
+			var match *property
+			for _, prop := range available {
+				if prop.XMLName == name {
+					match = prop
+					break
+				}
+			}
+			if match == nil {
+				missing = append(missing, &property{XMLName: name})
+				continue
+			}
+			found = append(found, match)
+		}
+	}
+	if onlyNames {
+		names := make([]*property, 0, len(found))
+		for _, prop := range found {
+			names = append(names, &property{XMLName: prop.XMLName})
+		}
+		found = names
+	}
+
+	result := &response{Href: path}
+	if len(found) > 0 || len(missing) == 0 {
+		result.Propstats = append(result.Propstats, &propstat{Prop: propList{found}, Status: statusLine(http.StatusOK)})
+	}
+	if len(missing) > 0 {
+		result.Propstats = append(result.Propstats,
+			&propstat{Prop: propList{missing}, Status: statusLine(http.StatusNotFound)})
+	}
+	return result
+}
+
+// writeMultistatus private function that answers with a 207 Multi-Status
+func writeMultistatus(w http.ResponseWriter, responses []*response) {
+	body, err := xml.Marshal(&multistatus{Responses: responses})
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	_, _ = io.WriteString(w, xml.Header)
+	_, _ = w.Write(body)
+}
+
+// writeError private function that answers with the precondition or postcondition a request failed
+// (RFC 4918 section 16), description is the text of the condition element
+func writeError(w http.ResponseWriter, status int, space, condition, description string) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, xml.Header)
+	_, _ = io.WriteString(w, element(xml.Name{Space: nsDAV, Local: "error"},
+		element(xml.Name{Space: space, Local: condition}, escapeText(description))))
+}
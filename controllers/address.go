@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/cermu/Go-phoneBook-API/models"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"net/http"
+)
+
+// FetchAddresses public handler variable for listing a contact's addresses
+var FetchAddresses = func(w http.ResponseWriter, req *http.Request) {
+	address := &models.ContactAddress{}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := address.FetchAddresses(contactId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// CreateAddress public handler variable for adding an address to a contact
+var CreateAddress = func(w http.ResponseWriter, req *http.Request) {
+	address := &models.ContactAddress{}
+
+	// decode the request body into a struct
+	err := json.NewDecoder(req.Body).Decode(address)
+	if err != nil {
+		response := utl.Message(102, "request failed, check your inputs")
+		utl.Respond(w, response)
+		return
+	}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := address.CreateAddress(contactId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// UpdateAddress public handler variable for updating one of a contact's addresses
+var UpdateAddress = func(w http.ResponseWriter, req *http.Request) {
+	address := &models.ContactAddress{}
+
+	// decode the request body into a struct
+	err := json.NewDecoder(req.Body).Decode(address)
+	if err != nil {
+		response := utl.Message(102, "request failed, check your inputs")
+		utl.Respond(w, response)
+		return
+	}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+	addressId, ok := uriId(w, req, "addressId", "address")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := address.UpdateAddress(addressId, contactId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// DeleteAddress public handler variable for removing one of a contact's addresses
+var DeleteAddress = func(w http.ResponseWriter, req *http.Request) {
+	address := &models.ContactAddress{}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+	addressId, ok := uriId(w, req, "addressId", "address")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := address.DeleteAddress(addressId, contactId, accountId)
+	utl.Respond(w, response)
+	return
+}
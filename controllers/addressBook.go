@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/cermu/Go-phoneBook-API/models"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"net/http"
+)
+
+// CreateAddressBook public handler variable for creating an address book that can be shared with other accounts
+var CreateAddressBook = func(w http.ResponseWriter, req *http.Request) {
+	book := &models.AddressBook{}
+
+	// decode the request body into a struct
+	err := json.NewDecoder(req.Body).Decode(book)
+	if err != nil {
+		response := utl.Message(102, "request failed, check your inputs")
+		utl.Respond(w, response)
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := book.CreateAddressBook(accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// FetchAddressBooks public handler variable for listing the address books of the authenticated account
+var FetchAddressBooks = func(w http.ResponseWriter, req *http.Request) {
+	book := &models.AddressBook{}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := book.FetchAddressBooks(accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// FetchAddressBook public handler variable for fetching an address book and its members
+var FetchAddressBook = func(w http.ResponseWriter, req *http.Request) {
+	book := &models.AddressBook{}
+
+	bookId, ok := uriId(w, req, "bookId", "address book")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := book.FetchAddressBook(bookId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// UpdateAddressBook public handler variable for renaming an address book
+var UpdateAddressBook = func(w http.ResponseWriter, req *http.Request) {
+	book := &models.AddressBook{}
+
+	// decode the request body into a struct
+	err := json.NewDecoder(req.Body).Decode(book)
+	if err != nil {
+		response := utl.Message(102, "request failed, check your inputs")
+		utl.Respond(w, response)
+		return
+	}
+
+	bookId, ok := uriId(w, req, "bookId", "address book")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := book.UpdateAddressBook(bookId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// DeleteAddressBook public handler variable for deleting an empty address book
+var DeleteAddressBook = func(w http.ResponseWriter, req *http.Request) {
+	book := &models.AddressBook{}
+
+	bookId, ok := uriId(w, req, "bookId", "address book")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := book.DeleteAddressBook(bookId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// InviteMember public handler variable for inviting an account to an address book
+var InviteMember = func(w http.ResponseWriter, req *http.Request) {
+	invitation := &models.AddressBookInvitation{}
+
+	// decode the request body into a struct
+	err := json.NewDecoder(req.Body).Decode(invitation)
+	if err != nil {
+		response := utl.Message(102, "request failed, check your inputs")
+		utl.Respond(w, response)
+		return
+	}
+
+	bookId, ok := uriId(w, req, "bookId", "address book")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := invitation.InviteMember(bookId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// CancelInvitation public handler variable for withdrawing a pending invitation to an address book
+var CancelInvitation = func(w http.ResponseWriter, req *http.Request) {
+	invitation := &models.AddressBookInvitation{}
+
+	bookId, ok := uriId(w, req, "bookId", "address book")
+	if !ok {
+		return
+	}
+	invitationId, ok := uriId(w, req, "invitationId", "invitation")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := invitation.CancelInvitation(invitationId, bookId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// FetchInvitations public handler variable for listing the authenticated account's pending invitations
+var FetchInvitations = func(w http.ResponseWriter, req *http.Request) {
+	invitation := &models.AddressBookInvitation{}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := invitation.FetchInvitations(accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// AcceptInvitation public handler variable for joining the address book of an invitation
+var AcceptInvitation = func(w http.ResponseWriter, req *http.Request) {
+	invitation := &models.AddressBookInvitation{}
+
+	invitationId, ok := uriId(w, req, "invitationId", "invitation")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := invitation.AcceptInvitation(invitationId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// DeclineInvitation public handler variable for turning down an invitation
+var DeclineInvitation = func(w http.ResponseWriter, req *http.Request) {
+	invitation := &models.AddressBookInvitation{}
+
+	invitationId, ok := uriId(w, req, "invitationId", "invitation")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := invitation.DeclineInvitation(invitationId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// UpdateMemberRole public handler variable for changing the role of an address book member
+var UpdateMemberRole = func(w http.ResponseWriter, req *http.Request) {
+	member := &models.AddressBookMember{}
+
+	// decode the request body into a struct
+	err := json.NewDecoder(req.Body).Decode(member)
+	if err != nil {
+		response := utl.Message(102, "request failed, check your inputs")
+		utl.Respond(w, response)
+		return
+	}
+
+	bookId, ok := uriId(w, req, "bookId", "address book")
+	if !ok {
+		return
+	}
+	memberId, ok := uriId(w, req, "memberId", "member")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := member.UpdateMemberRole(bookId, memberId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// RemoveMember public handler variable for removing a member from an address book, or leaving it
+var RemoveMember = func(w http.ResponseWriter, req *http.Request) {
+	member := &models.AddressBookMember{}
+
+	bookId, ok := uriId(w, req, "bookId", "address book")
+	if !ok {
+		return
+	}
+	memberId, ok := uriId(w, req, "memberId", "member")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := member.RemoveMember(bookId, memberId, accountId)
+	utl.Respond(w, response)
+	return
+}
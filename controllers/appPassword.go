@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/cermu/Go-phoneBook-API/models"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"net/http"
+)
+
+// CreateAppPassword public handler variable for generating a password a contacts app signs in to CardDAV with
+var CreateAppPassword = func(w http.ResponseWriter, req *http.Request) {
+	appPassword := &models.AppPassword{}
+
+	// decode the request body into a struct
+	err := json.NewDecoder(req.Body).Decode(appPassword)
+	if err != nil {
+		response := utl.Message(102, "request failed, check your inputs")
+		utl.Respond(w, response)
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := appPassword.CreateAppPassword(accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// FetchAppPasswords public handler variable for listing the app passwords of the authenticated account
+var FetchAppPasswords = func(w http.ResponseWriter, req *http.Request) {
+	appPassword := &models.AppPassword{}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := appPassword.FetchAppPasswords(accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// DeleteAppPassword public handler variable for revoking an app password
+var DeleteAppPassword = func(w http.ResponseWriter, req *http.Request) {
+	appPassword := &models.AppPassword{}
+
+	appPasswordId, ok := uriId(w, req, "appPasswordId", "app password")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := appPassword.DeleteAppPassword(appPasswordId, accountId)
+	utl.Respond(w, response)
+	return
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/cermu/Go-phoneBook-API/models"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"net/http"
+)
+
+// BulkCreateContacts public handler variable for creating many contacts in one request
+var BulkCreateContacts = func(w http.ResponseWriter, req *http.Request) {
+	bulk := &models.BulkCreate{}
+
+	// decode the request body into a struct
+	err := json.NewDecoder(req.Body).Decode(bulk)
+	if err != nil {
+		response := utl.Message(102, "request failed, check your inputs")
+		utl.Respond(w, response)
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := bulk.BulkCreateContacts(accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// BulkUpdateContacts public handler variable for updating many contacts in one request
+var BulkUpdateContacts = func(w http.ResponseWriter, req *http.Request) {
+	bulk := &models.BulkUpdate{}
+
+	// decode the request body into a struct
+	err := json.NewDecoder(req.Body).Decode(bulk)
+	if err != nil {
+		response := utl.Message(102, "request failed, check your inputs")
+		utl.Respond(w, response)
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := bulk.BulkUpdateContacts(accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// BulkDeleteContacts public handler variable for deleting many contacts in one request
+var BulkDeleteContacts = func(w http.ResponseWriter, req *http.Request) {
+	bulk := &models.BulkDelete{}
+
+	// decode the request body into a struct
+	err := json.NewDecoder(req.Body).Decode(bulk)
+	if err != nil {
+		response := utl.Message(102, "request failed, check your inputs")
+		utl.Respond(w, response)
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := bulk.BulkDeleteContacts(accountId)
+	utl.Respond(w, response)
+	return
+}
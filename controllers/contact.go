@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"github.com/cermu/Go-phoneBook-API/models"
 	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"github.com/cermu/Go-phoneBook-API/vcard"
 	"github.com/gorilla/mux"
 	"net/http"
 	"strconv"
@@ -26,7 +27,7 @@ var CreateContact = func(w http.ResponseWriter, req *http.Request) {
 
 	// save the contact passed
 	response := contact.CreateContact(accountId)
-	utl.Respond(w, response)
+	respondContact(w, response)
 	return
 }
 
@@ -37,8 +38,41 @@ var FetchContactsByAccountId = func(w http.ResponseWriter, req *http.Request) {
 	// fetch account id from request context
 	accountId := req.Context().Value("account").(uint)
 
+	// read paging and sorting options from the query string
+	limit, ok := queryLimit(w, req)
+	if !ok {
+		return
+	}
+	query := req.URL.Query()
+	options := &models.ContactListOptions{
+		Limit:   limit,
+		Cursor:  query.Get("cursor"),
+		SortBy:  query.Get("sort"),
+		Order:   query.Get("order"),
+		City:    query.Get("city"),
+		Country: query.Get("country"),
+
+		PhoneCountry: query.Get("phone_country"),
+		LineType:     query.Get("line_type"),
+		Network:      query.Get("network"),
+	}
+	if groupId := query.Get("group_id"); groupId != "" {
+		groupIdValue, err := strconv.Atoi(groupId)
+		if err != nil || groupIdValue <= 0 {
+			response := utl.Message(102, "request failed, group_id should be a number")
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			utl.Respond(w, response)
+			return
+		}
+		options.GroupID = uint(groupIdValue)
+	}
+	if options.AddressBookID, ok = optionalId(w, query.Get("address_book_id"), "address_book_id"); !ok {
+		return
+	}
+
 	// fetch contacts
-	response := contact.FetchContactsByAccountId(accountId)
+	response := contact.FetchContactsByAccountId(accountId, options)
 	utl.Respond(w, response)
 	return
 }
@@ -58,8 +92,21 @@ var FetchContactById = func(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	response := contact.FetchContactById(uint(contactId))
-	utl.Respond(w, response)
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := contact.FetchContactById(uint(contactId), accountId)
+
+	// clients holding the current version get a 304 without a body
+	if fetched, ok := response["data"].(*models.Contact); ok {
+		etag := utl.ETag(fetched.Version)
+		if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch != "" && utl.ETagMatches(ifNoneMatch, etag, true) {
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	respondContact(w, response)
 	return
 
 }
@@ -87,9 +134,12 @@ var UpdateContact = func(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// update the contact
-	response := contact.UpdateContact(uint(contactId))
-	utl.Respond(w, response)
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	// update the contact, only when it has not changed since the client fetched it
+	response := contact.UpdateContact(uint(contactId), accountId, req.Header.Get("If-Match"))
+	respondContact(w, response)
 	return
 }
 
@@ -108,8 +158,377 @@ var DeleteContact = func(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
 	// delete the record
-	response := contact.DeleteContact(uint(contactId))
+	response := contact.DeleteContact(uint(contactId), accountId, req.Header.Get("If-Match"))
+	respondContact(w, response)
+	return
+}
+
+// SearchContacts public handler variable for searching the authenticated account's contacts
+var SearchContacts = func(w http.ResponseWriter, req *http.Request) {
+	contact := &models.Contact{}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	limit, ok := queryLimit(w, req)
+	if !ok {
+		return
+	}
+
+	query := req.URL.Query()
+	options := &models.ContactSearchOptions{
+		Query: query.Get("q"),
+		Limit: limit,
+		Mode:  query.Get("mode"),
+	}
+	if threshold := query.Get("threshold"); threshold != "" {
+		thresholdValue, err := strconv.ParseFloat(threshold, 64)
+		if err != nil {
+			response := utl.Message(102, "request failed, threshold should be a number")
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			utl.Respond(w, response)
+			return
+		}
+		options.Threshold = thresholdValue
+	}
+
+	// search contacts
+	response := contact.SearchContacts(accountId, options)
+	utl.Respond(w, response)
+	return
+}
+
+// queryLimit private function that reads the optional limit query parameter.
+// It responds to the client and returns false when the value is not a number
+func queryLimit(w http.ResponseWriter, req *http.Request) (int, bool) {
+	limit := req.URL.Query().Get("limit")
+	if limit == "" {
+		return 0, true
+	}
+
+	limitValue, err := strconv.Atoi(limit)
+	if err != nil {
+		response := utl.Message(102, "request failed, limit should be a number")
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		utl.Respond(w, response)
+		return 0, false
+	}
+	return limitValue, true
+}
+
+// uriId private function that reads a numeric id from the request URI.
+// It responds to the client and returns false when the id is missing or not a number
+func uriId(w http.ResponseWriter, req *http.Request, name, label string) (uint, bool) {
+	params := mux.Vars(req)
+	id, err := strconv.Atoi(params[name])
+	if err != nil || id <= 0 {
+		response := utl.Message(101, "request failed, "+label+" id missing in URI")
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		utl.Respond(w, response)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondContact private function that responds with a contact, its version is sent in the ETag header.
+// A change refused because the contact's version did not match If-Match gets a 412 status
+func respondContact(w http.ResponseWriter, response map[string]interface{}) {
+	if contact, ok := response["data"].(*models.Contact); ok {
+		w.Header().Set("ETag", utl.ETag(contact.Version))
+	}
+	if response["response_code"] == int32(107) {
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusPreconditionFailed)
+	}
+	utl.Respond(w, response)
+}
+
+// optionalId private function that reads an optional numeric id passed in the query string or a form,
+// 0 is returned when it is not passed. It responds to the client and returns false when it is not a number
+func optionalId(w http.ResponseWriter, value, name string) (uint, bool) {
+	if value == "" {
+		return 0, true
+	}
+
+	id, err := strconv.Atoi(value)
+	if err != nil || id <= 0 {
+		response := utl.Message(102, "request failed, "+name+" should be a number")
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		utl.Respond(w, response)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// TouchContact public handler variable for recording that a contact has been called/messaged
+var TouchContact = func(w http.ResponseWriter, req *http.Request) {
+	contact := &models.Contact{}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := contact.TouchContact(contactId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// StarContact public handler variable for starring or un-starring a contact
+var StarContact = func(w http.ResponseWriter, req *http.Request) {
+	star := &models.StarContact{}
+
+	// decode the request body into a struct
+	err := json.NewDecoder(req.Body).Decode(star)
+	if err != nil {
+		response := utl.Message(102, "request failed, check your inputs")
+		utl.Respond(w, response)
+		return
+	}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := star.SetStarred(contactId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// FetchFavorites public handler variable for fetching starred and frequently contacted contacts
+var FetchFavorites = func(w http.ResponseWriter, req *http.Request) {
+	contact := &models.Contact{}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	limit, ok := queryLimit(w, req)
+	if !ok {
+		return
+	}
+
+	response := contact.FetchFavorites(accountId, limit)
+	utl.Respond(w, response)
+	return
+}
+
+// ExportContacts public handler variable for downloading the account's contacts as a vCard file
+var ExportContacts = func(w http.ResponseWriter, req *http.Request) {
+	version, ok := vCardVersion(w, req)
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	if response := models.ExportContactsVCard(accountId, version, w); response != nil {
+		utl.Respond(w, response)
+	}
+	return
+}
+
+// ExportContact public handler variable for downloading a single contact as a vCard file
+var ExportContact = func(w http.ResponseWriter, req *http.Request) {
+	contact := &models.Contact{}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+
+	version, ok := vCardVersion(w, req)
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	if response := contact.ExportContactVCard(contactId, accountId, version, w); response != nil {
+		utl.Respond(w, response)
+	}
+	return
+}
+
+// vCardVersion private function that reads the requested vCard version from the version
+// query parameter or the Accept header. It responds to the client when the version is not supported
+func vCardVersion(w http.ResponseWriter, req *http.Request) (string, bool) {
+	version, err := vcard.NegotiateVersion(req.URL.Query().Get("version"), req.Header.Get("Accept"))
+	if err != nil {
+		response := utl.Message(102, "request failed, "+err.Error())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		utl.Respond(w, response)
+		return "", false
+	}
+	return version, true
+}
+
+// maxImportBytes is the largest file accepted by the import endpoints
+const maxImportBytes = 10 << 20
+
+// ImportContactsVCard public handler variable for importing contacts from an uploaded .vcf file
+var ImportContactsVCard = func(w http.ResponseWriter, req *http.Request) {
+	req.Body = http.MaxBytesReader(w, req.Body, maxImportBytes)
+	file, _, err := req.FormFile("file")
+	if err != nil {
+		response := utl.Message(102, "request failed, upload a .vcf file of at most 10MB in the file field")
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		utl.Respond(w, response)
+		return
+	}
+	defer file.Close()
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	bookId, ok := optionalId(w, req.FormValue("address_book_id"), "address_book_id")
+	if !ok {
+		return
+	}
+
+	response := models.ImportVCards(accountId, bookId, file)
+	utl.Respond(w, response)
+	return
+}
+
+// ImportContactsCSV public handler variable for importing contacts from an uploaded CSV file.
+// The optional mapping form field is a JSON object of column header to contact field, and
+// dry_run=true only validates the file
+var ImportContactsCSV = func(w http.ResponseWriter, req *http.Request) {
+	req.Body = http.MaxBytesReader(w, req.Body, maxImportBytes)
+	file, _, err := req.FormFile("file")
+	if err != nil {
+		response := utl.Message(102, "request failed, upload a CSV file of at most 10MB in the file field")
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		utl.Respond(w, response)
+		return
+	}
+	defer file.Close()
+
+	options := &models.CSVImportOptions{DryRun: req.FormValue("dry_run") == "true"}
+	bookId, ok := optionalId(w, req.FormValue("address_book_id"), "address_book_id")
+	if !ok {
+		return
+	}
+	options.AddressBookID = bookId
+	if mapping := req.FormValue("mapping"); mapping != "" {
+		if mappingErr := json.Unmarshal([]byte(mapping), &options.Mapping); mappingErr != nil {
+			response := utl.Message(102, "request failed, mapping should be a JSON object of header to field")
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			utl.Respond(w, response)
+			return
+		}
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := models.ImportCSV(accountId, file, options)
+	utl.Respond(w, response)
+	return
+}
+
+// ExportContactsCSV public handler variable for downloading the account's contacts as a CSV file
+var ExportContactsCSV = func(w http.ResponseWriter, req *http.Request) {
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	if response := models.ExportContactsCSV(accountId, w); response != nil {
+		utl.Respond(w, response)
+	}
+	return
+}
+
+// FindDuplicates public handler variable for listing clusters of likely duplicate contacts
+var FindDuplicates = func(w http.ResponseWriter, req *http.Request) {
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := models.FindDuplicates(accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// MergeContacts public handler variable for merging duplicate contacts into one
+var MergeContacts = func(w http.ResponseWriter, req *http.Request) {
+	merge := &models.MergeContacts{}
+
+	// decode the request body into a struct
+	err := json.NewDecoder(req.Body).Decode(merge)
+	if err != nil {
+		response := utl.Message(102, "request failed, check your inputs")
+		utl.Respond(w, response)
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := merge.MergeContacts(accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// FetchUpcomingEvents public handler variable for listing upcoming birthdays, anniversaries and custom dates
+var FetchUpcomingEvents = func(w http.ResponseWriter, req *http.Request) {
+	days := 0
+	if value := req.URL.Query().Get("days"); value != "" {
+		daysValue, err := strconv.Atoi(value)
+		if err != nil {
+			response := utl.Message(102, "request failed, days should be a number")
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			utl.Respond(w, response)
+			return
+		}
+		days = daysValue
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := models.FetchUpcomingEvents(accountId, days)
+	utl.Respond(w, response)
+	return
+}
+
+// SyncContacts public handler variable for fetching the contacts that changed since a sync token
+var SyncContacts = func(w http.ResponseWriter, req *http.Request) {
+	contact := &models.Contact{}
+
+	limit, ok := queryLimit(w, req)
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := contact.SyncContacts(accountId, req.URL.Query().Get("sync_token"), limit)
+	if response["response_code"] == int32(108) {
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusGone)
+	}
 	utl.Respond(w, response)
 	return
 }
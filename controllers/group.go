@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/cermu/Go-phoneBook-API/models"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"net/http"
+)
+
+// CreateGroup public handler variable for creating contact groups
+var CreateGroup = func(w http.ResponseWriter, req *http.Request) {
+	group := &models.Group{}
+
+	// decode the request body into a struct
+	err := json.NewDecoder(req.Body).Decode(group)
+	if err != nil {
+		response := utl.Message(102, "request failed, check your inputs")
+		utl.Respond(w, response)
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := group.CreateGroup(accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// FetchGroupsByAccountId public handler variable for fetching the groups of the authenticated account
+var FetchGroupsByAccountId = func(w http.ResponseWriter, req *http.Request) {
+	group := &models.Group{}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := group.FetchGroupsByAccountId(accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// FetchGroupById public handler variable for fetching a single group and its contacts
+var FetchGroupById = func(w http.ResponseWriter, req *http.Request) {
+	group := &models.Group{}
+
+	// extract id from URI
+	groupId, ok := uriId(w, req, "groupId", "group")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := group.FetchGroupById(groupId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// UpdateGroup public handler variable for updating an existing group
+var UpdateGroup = func(w http.ResponseWriter, req *http.Request) {
+	group := &models.Group{}
+
+	// decode the request body into a struct
+	err := json.NewDecoder(req.Body).Decode(group)
+	if err != nil {
+		response := utl.Message(102, "request failed, check your inputs")
+		utl.Respond(w, response)
+		return
+	}
+
+	// extract id from URI
+	groupId, ok := uriId(w, req, "groupId", "group")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := group.UpdateGroup(groupId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// DeleteGroup public handler variable for deleting a group, its contacts are kept
+var DeleteGroup = func(w http.ResponseWriter, req *http.Request) {
+	group := &models.Group{}
+
+	// extract id from URI
+	groupId, ok := uriId(w, req, "groupId", "group")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := group.DeleteGroup(groupId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// AddGroupMembers public handler variable for adding contacts to a group
+var AddGroupMembers = func(w http.ResponseWriter, req *http.Request) {
+	members := &models.GroupMembers{}
+
+	// decode the request body into a struct
+	err := json.NewDecoder(req.Body).Decode(members)
+	if err != nil {
+		response := utl.Message(102, "request failed, check your inputs")
+		utl.Respond(w, response)
+		return
+	}
+
+	// extract id from URI
+	groupId, ok := uriId(w, req, "groupId", "group")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := members.AddGroupMembers(groupId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// RemoveGroupMembers public handler variable for removing contacts from a group
+var RemoveGroupMembers = func(w http.ResponseWriter, req *http.Request) {
+	members := &models.GroupMembers{}
+
+	// decode the request body into a struct
+	err := json.NewDecoder(req.Body).Decode(members)
+	if err != nil {
+		response := utl.Message(102, "request failed, check your inputs")
+		utl.Respond(w, response)
+		return
+	}
+
+	// extract id from URI
+	groupId, ok := uriId(w, req, "groupId", "group")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := members.RemoveGroupMembers(groupId, accountId)
+	utl.Respond(w, response)
+	return
+}
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/cermu/Go-phoneBook-API/models"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"net/http"
+)
+
+// FetchNotes public handler variable for listing a contact's notes
+var FetchNotes = func(w http.ResponseWriter, req *http.Request) {
+	note := &models.ContactNote{}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := note.FetchNotes(contactId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// FetchNote public handler variable for fetching one of a contact's notes
+var FetchNote = func(w http.ResponseWriter, req *http.Request) {
+	note := &models.ContactNote{}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+	noteId, ok := uriId(w, req, "noteId", "note")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := note.FetchNote(noteId, contactId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// CreateNote public handler variable for adding a note to a contact
+var CreateNote = func(w http.ResponseWriter, req *http.Request) {
+	note := &models.ContactNote{}
+
+	// decode the request body into a struct
+	err := json.NewDecoder(req.Body).Decode(note)
+	if err != nil {
+		response := utl.Message(102, "request failed, check your inputs")
+		utl.Respond(w, response)
+		return
+	}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := note.CreateNote(contactId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// UpdateNote public handler variable for editing one of a contact's notes
+var UpdateNote = func(w http.ResponseWriter, req *http.Request) {
+	note := &models.ContactNote{}
+
+	// decode the request body into a struct
+	err := json.NewDecoder(req.Body).Decode(note)
+	if err != nil {
+		response := utl.Message(102, "request failed, check your inputs")
+		utl.Respond(w, response)
+		return
+	}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+	noteId, ok := uriId(w, req, "noteId", "note")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := note.UpdateNote(noteId, contactId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// DeleteNote public handler variable for removing one of a contact's notes
+var DeleteNote = func(w http.ResponseWriter, req *http.Request) {
+	note := &models.ContactNote{}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+	noteId, ok := uriId(w, req, "noteId", "note")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := note.DeleteNote(noteId, contactId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// FetchNoteVersions public handler variable for listing the earlier texts of a note
+var FetchNoteVersions = func(w http.ResponseWriter, req *http.Request) {
+	note := &models.ContactNote{}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+	noteId, ok := uriId(w, req, "noteId", "note")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := note.FetchNoteVersions(noteId, contactId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// RestoreNoteVersion public handler variable for bringing back an earlier text of a note
+var RestoreNoteVersion = func(w http.ResponseWriter, req *http.Request) {
+	note := &models.ContactNote{}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+	noteId, ok := uriId(w, req, "noteId", "note")
+	if !ok {
+		return
+	}
+	version, ok := uriId(w, req, "version", "note version")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := note.RestoreNoteVersion(noteId, version, contactId, accountId)
+	utl.Respond(w, response)
+	return
+}
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/cermu/Go-phoneBook-API/models"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"github.com/gorilla/mux"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// UploadPhoto public handler variable for setting a contact's photo from a multipart upload
+var UploadPhoto = func(w http.ResponseWriter, req *http.Request) {
+	contact := &models.Contact{}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+
+	// the limit leaves room for the multipart headers around the file
+	maxBytes := models.MaxPhotoBytes()
+	req.Body = http.MaxBytesReader(w, req.Body, maxBytes+(1<<20))
+	file, _, err := req.FormFile("photo")
+	if err != nil {
+		response := utl.Message(102, fmt.Sprintf("request failed, upload a JPEG or PNG image of at most %dMB "+
+			"in the photo field", maxBytes>>20))
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		utl.Respond(w, response)
+		return
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil || int64(len(data)) > maxBytes {
+		response := utl.Message(102, fmt.Sprintf("request failed, photo should not be more than %dMB", maxBytes>>20))
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		utl.Respond(w, response)
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := contact.UploadPhoto(contactId, accountId, data, req.Header.Get("If-Match"))
+	respondContact(w, response)
+	return
+}
+
+// FetchPhoto public handler variable for downloading the original or a thumbnail of a contact's photo
+var FetchPhoto = func(w http.ResponseWriter, req *http.Request) {
+	contact := &models.Contact{}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	data, contentType, response := contact.FetchPhoto(contactId, accountId, mux.Vars(req)["size"])
+	if response != nil {
+		utl.Respond(w, response)
+		return
+	}
+
+	// the URLs change with every upload so the photo can be cached for long
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	_, _ = w.Write(data)
+	return
+}
+
+// DeletePhoto public handler variable for removing a contact's photo
+var DeletePhoto = func(w http.ResponseWriter, req *http.Request) {
+	contact := &models.Contact{}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := contact.DeletePhoto(contactId, accountId, req.Header.Get("If-Match"))
+	respondContact(w, response)
+	return
+}
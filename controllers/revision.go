@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"github.com/cermu/Go-phoneBook-API/models"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"net/http"
+)
+
+// FetchContactRevisions public handler variable for listing the history of a contact
+var FetchContactRevisions = func(w http.ResponseWriter, req *http.Request) {
+	revision := &models.ContactRevision{}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+	limit, ok := queryLimit(w, req)
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := revision.FetchContactRevisions(contactId, accountId, limit)
+	utl.Respond(w, response)
+	return
+}
+
+// RevertContact public handler variable for bringing a contact back to one of its revisions
+var RevertContact = func(w http.ResponseWriter, req *http.Request) {
+	revision := &models.ContactRevision{}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+	number, ok := uriId(w, req, "revision", "revision")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := revision.RevertContact(number, contactId, accountId, req.Header.Get("If-Match"))
+	respondContact(w, response)
+	return
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/cermu/Go-phoneBook-API/models"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"net/http"
+)
+
+// ShareContact public handler variable for sharing a contact with another account
+var ShareContact = func(w http.ResponseWriter, req *http.Request) {
+	share := &models.ContactShare{}
+
+	// decode the request body into a struct
+	err := json.NewDecoder(req.Body).Decode(share)
+	if err != nil {
+		response := utl.Message(102, "request failed, check your inputs")
+		utl.Respond(w, response)
+		return
+	}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := share.ShareContact(contactId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// FetchContactShares public handler variable for listing the accounts a contact is shared with
+var FetchContactShares = func(w http.ResponseWriter, req *http.Request) {
+	share := &models.ContactShare{}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := share.FetchContactShares(contactId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// RevokeShare public handler variable for removing a share of a contact
+var RevokeShare = func(w http.ResponseWriter, req *http.Request) {
+	share := &models.ContactShare{}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+	shareId, ok := uriId(w, req, "shareId", "share")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := share.RevokeShare(shareId, contactId, accountId)
+	utl.Respond(w, response)
+	return
+}
+
+// FetchSharedContacts public handler variable for listing the contacts other accounts have shared with the account
+var FetchSharedContacts = func(w http.ResponseWriter, req *http.Request) {
+	contact := &models.Contact{}
+
+	limit, ok := queryLimit(w, req)
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := contact.FetchSharedContacts(accountId, limit, req.URL.Query().Get("cursor"))
+	utl.Respond(w, response)
+	return
+}
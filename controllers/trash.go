@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"github.com/cermu/Go-phoneBook-API/models"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"net/http"
+)
+
+// FetchTrash public handler variable for listing the deleted contacts of the account's address books
+var FetchTrash = func(w http.ResponseWriter, req *http.Request) {
+	contact := &models.Contact{}
+
+	limit, ok := queryLimit(w, req)
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := contact.FetchTrash(accountId, limit, req.URL.Query().Get("cursor"))
+	utl.Respond(w, response)
+	return
+}
+
+// RestoreContact public handler variable for bringing a deleted contact back from the trash
+var RestoreContact = func(w http.ResponseWriter, req *http.Request) {
+	contact := &models.Contact{}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := contact.RestoreContact(contactId, accountId)
+	respondContact(w, response)
+	return
+}
+
+// PurgeContact public handler variable for permanently deleting a contact from the trash
+var PurgeContact = func(w http.ResponseWriter, req *http.Request) {
+	contact := &models.Contact{}
+
+	contactId, ok := uriId(w, req, "contactId", "contact")
+	if !ok {
+		return
+	}
+
+	// fetch account id from request context
+	accountId := req.Context().Value("account").(uint)
+
+	response := contact.PurgeContact(contactId, accountId)
+	utl.Respond(w, response)
+	return
+}
@@ -0,0 +1,48 @@
+// Package lock hands out short lived keys shared by all the replicas, so that a background job such
+// as the birthday reminders or the trash purge runs on one replica at a time
+package lock
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/go-redis/redis/v7"
+	"time"
+)
+
+// releaseScript deletes a key only when it still holds this replica's token,
+// so a key that expired and was taken by another replica is left alone
+const releaseScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`
+
+// Locker interface takes and releases short lived keys shared by all the replicas
+type Locker interface {
+	Obtain(key string, ttl time.Duration) (bool, error)
+	Release(key string) error
+}
+
+// RedisLocker struct is the Locker shared by all the replicas through redis
+type RedisLocker struct {
+	client *redis.Client
+	token  string
+}
+
+// NewRedisLocker public function that returns a Locker holding keys under a token unique to this process
+func NewRedisLocker(client *redis.Client) (*RedisLocker, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return &RedisLocker{client: client, token: hex.EncodeToString(b)}, nil
+}
+
+// Obtain public method that sets a key if it does not exist yet, reporting whether it was set
+func (locker *RedisLocker) Obtain(key string, ttl time.Duration) (bool, error) {
+	return locker.client.SetNX(key, locker.token, ttl).Result()
+}
+
+// Release public method that deletes a key set by this process
+func (locker *RedisLocker) Release(key string) error {
+	return locker.client.Eval(releaseScript, []string{key}, locker.token).Err()
+}
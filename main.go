@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"github.com/cermu/Go-phoneBook-API/lock"
 	"github.com/cermu/Go-phoneBook-API/models"
+	"github.com/cermu/Go-phoneBook-API/reminders"
 	"github.com/cermu/Go-phoneBook-API/routers"
 	utl "github.com/cermu/Go-phoneBook-API/utils"
 	"log"
@@ -10,6 +12,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 func main() {
@@ -18,6 +21,8 @@ func main() {
 
 	models.InitDB()    // Initialize a database connection
 	models.MigrateDB() //perform database migrations
+	// contact photos are kept on disk or in an S3-compatible bucket
+	models.InitPhotoStorage()
 	// close database and redis connection after use
 	defer func() {
 		if dbErr := models.DBConnection.Close(); dbErr != nil {
@@ -35,7 +40,7 @@ func main() {
 	// API server
 	apiServer := &http.Server{
 		Addr:    utl.ReadConfigs().GetString("APP.ADDRESS"),
-		Handler: routers.NewRouter(),
+		Handler: routers.NewHandler(),
 	}
 
 	// start the server in a go routine
@@ -50,17 +55,83 @@ func main() {
 		}
 	}()
 
+	// start the background jobs, they are stopped before the API server shuts down
+	ctx, cancelJobs := context.WithCancel(context.Background())
+
+	// birthday reminders scheduler
+	remindersDone := make(chan struct{})
+	if utl.ReadConfigs().GetBool("REMINDERS.ENABLED") {
+		scheduler, err := newReminderScheduler()
+		if err != nil {
+			log.Fatalf("ERROR | Failed to set up birthday reminders: %v\n", err)
+		}
+		go func() {
+			scheduler.Run(ctx)
+			close(remindersDone)
+		}()
+	} else {
+		close(remindersDone)
+	}
+
+	// purge contacts that have been in the trash longer than the retention period
+	purgeDone := make(chan struct{})
+	if utl.ReadConfigs().GetBool("TRASH.PURGE_ENABLED") {
+		purgeLocker, err := lock.NewRedisLocker(utl.RedisClient())
+		if err != nil {
+			log.Fatalf("ERROR | Failed to set up the trash purge: %v\n", err)
+		}
+		purgeInterval := time.Duration(utl.ReadConfigs().GetInt("TRASH.PURGE_INTERVAL_MINUTES")) * time.Minute
+		if purgeInterval <= 0 {
+			purgeInterval = time.Hour
+		}
+		go func() {
+			models.RunTrashPurge(ctx, purgeLocker, purgeInterval)
+			close(purgeDone)
+		}()
+	} else {
+		close(purgeDone)
+	}
+
 	// shut down the server
-	ch := make(chan os.Signal)
+	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
 
 	// block until a signal is received
 	receivedSignal := <-ch
 
 	log.Printf("WARNING | Shutting down API server %v signal received\n", receivedSignal)
+	cancelJobs()
+	<-remindersDone
+	<-purgeDone
+
 	err := apiServer.Shutdown(context.Background())
 	if err != nil {
 		log.Fatalf("ERROR | Failed to shut down API server: %v\n", err)
 	}
 	log.Println("INFO | API server has shut down")
 }
+
+// newReminderScheduler private function that builds the birthday reminders scheduler from the configs,
+// emails are logged instead of sent when no SMTP host is configured
+func newReminderScheduler() (*reminders.Scheduler, error) {
+	configs := utl.ReadConfigs()
+
+	locker, err := lock.NewRedisLocker(utl.RedisClient())
+	if err != nil {
+		return nil, err
+	}
+
+	var mailer reminders.Mailer = reminders.LogMailer{}
+	if configs.GetString("MAIL.HOST") != "" {
+		mailer = &reminders.SMTPMailer{Host: configs.GetString("MAIL.HOST"), Port: configs.GetInt("MAIL.PORT"),
+			Username: configs.GetString("MAIL.USERNAME"), Password: configs.GetString("MAIL.PASSWORD"),
+			From: configs.GetString("MAIL.FROM"), Timeout: time.Duration(configs.GetInt("MAIL.TIMEOUT_SECONDS")) * time.Second}
+	}
+
+	interval := time.Duration(configs.GetInt("REMINDERS.CHECK_INTERVAL_MINUTES")) * time.Minute
+	if interval <= 0 {
+		interval = 15 * time.Minute
+	}
+	return &reminders.Scheduler{Store: models.ReminderStore{}, Mailer: mailer, Locker: locker,
+		Clock: reminders.SystemClock{}, DigestHour: configs.GetInt("REMINDERS.DIGEST_HOUR"), Interval: interval}, nil
+}
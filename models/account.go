@@ -5,11 +5,14 @@ import (
 	"github.com/badoux/checkmail"
 	"github.com/cermu/Go-phoneBook-API/auth"
 	"github.com/cermu/Go-phoneBook-API/middlewares"
+	"github.com/cermu/Go-phoneBook-API/phonenumber"
 	utl "github.com/cermu/Go-phoneBook-API/utils"
 	"github.com/jinzhu/gorm"
 	"golang.org/x/crypto/bcrypt"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 )
 
 /* Account struct to store user information
@@ -23,7 +26,11 @@ type Account struct {
 	PhoneNumber string    `gorm:"type:varchar(15);not null;unique;index:idx_phone" json:"phone_number"`
 	Password    string    `gorm:"type:varchar(255); not null" json:"password"`
 	Active      bool      `gorm:"default:true" json:"active"`
+	TimeZone    string    `gorm:"size:64;default:'UTC'" json:"time_zone"` // IANA name e.g. Africa/Nairobi
 	Contacts    []Contact `gorm:"ForeignKey:AccountID" json:"contacts"`
+
+	// region national phone numbers of the account's contacts are read in, ISO 3166-1 alpha-2 e.g. KE
+	DefaultRegion string `gorm:"size:2;default:'KE'" json:"default_region"`
 }
 
 /* LoginDetails struct used to fetch login credentials
@@ -42,6 +49,10 @@ type UpdateAccountDetails struct {
 	LastName    string `json:"last_name"`
 	Email       string `json:"email"`
 	PhoneNumber string `json:"phone_number"`
+	TimeZone    string `json:"time_zone"` // optional, the current time zone is kept when empty
+
+	// optional, the current default region is kept when empty
+	DefaultRegion string `json:"default_region"`
 }
 
 // RefreshToken struct to fetch refresh_token from json request
@@ -80,6 +91,21 @@ func (account *Account) validateAccountData() (map[string]interface{}, bool) {
 		return utl.Message(102, "password should not be less than six characters"), false
 	}
 
+	// validate time zone
+	if account.TimeZone != "" {
+		if _, err := time.LoadLocation(account.TimeZone); err != nil {
+			return utl.Message(102, "provide a valid time_zone e.g. Africa/Nairobi"), false
+		}
+	}
+
+	// validate default region
+	if account.DefaultRegion != "" {
+		account.DefaultRegion = strings.ToUpper(account.DefaultRegion)
+		if !phonenumber.SupportedRegion(account.DefaultRegion) {
+			return utl.Message(102, "provide a supported default_region e.g. KE"), false
+		}
+	}
+
 	// email address and phone number must be unique
 	tmp := &Account{}
 	emailErr := DBConnection.Table("account").Where("email=?", account.Email).First(tmp).Error
@@ -114,9 +140,21 @@ func (account *Account) CreateAccount() map[string]interface{} {
 	// hash the password before storing it
 	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(account.Password), bcrypt.DefaultCost)
 	account.Password = string(hashedPassword)
-	DBConnection.Create(account) // save account in the DB
 
+	// save account in the DB together with its personal address book
+	tx := DBConnection.Begin()
+	tx.Create(account)
 	if account.ID <= 0 {
+		tx.Rollback()
+		return utl.Message(105, "failed to save account, try again")
+	}
+	if err := createPersonalBook(tx, account.ID); err != nil {
+		tx.Rollback()
+		log.Printf("WARNING | An error occurred while creating personal address book: %v\n", err.Error())
+		return utl.Message(105, "failed to save account, try again")
+	}
+	if err := tx.Commit().Error; err != nil {
+		log.Printf("WARNING | An error occurred while saving account: %v\n", err.Error())
 		return utl.Message(105, "failed to save account, try again")
 	}
 
@@ -279,6 +317,21 @@ func UpdateAccount(updateAccount *UpdateAccountDetails, accountId uint) map[stri
 		return utl.Message(102, "provide a valid email address")
 	}
 
+	// validate time zone
+	if updateAccount.TimeZone != "" {
+		if _, err := time.LoadLocation(updateAccount.TimeZone); err != nil {
+			return utl.Message(102, "provide a valid time_zone e.g. Africa/Nairobi")
+		}
+	}
+
+	// validate default region
+	if updateAccount.DefaultRegion != "" {
+		updateAccount.DefaultRegion = strings.ToUpper(updateAccount.DefaultRegion)
+		if !phonenumber.SupportedRegion(updateAccount.DefaultRegion) {
+			return utl.Message(102, "provide a supported default_region e.g. KE")
+		}
+	}
+
 	// email address and phone number must be unique
 	tmp := &Account{}
 	emailErr := DBConnection.Table("account").Where("email=? AND id NOT IN (?)",
@@ -304,8 +357,15 @@ func UpdateAccount(updateAccount *UpdateAccountDetails, accountId uint) map[stri
 	}
 
 	// update the account
-	DBConnection.Model(account).Where("id=?", accountId).Updates(map[string]interface{}{"first_name": updateAccount.FirstName,
-		"last_name": updateAccount.LastName, "email": updateAccount.Email, "phone_number": updateAccount.PhoneNumber})
+	updates := map[string]interface{}{"first_name": updateAccount.FirstName,
+		"last_name": updateAccount.LastName, "email": updateAccount.Email, "phone_number": updateAccount.PhoneNumber}
+	if updateAccount.TimeZone != "" {
+		updates["time_zone"] = updateAccount.TimeZone
+	}
+	if updateAccount.DefaultRegion != "" {
+		updates["default_region"] = updateAccount.DefaultRegion
+	}
+	DBConnection.Model(account).Where("id=?", accountId).Updates(updates)
 
 	// fetch and return account
 	DBConnection.First(account, accountId)
@@ -0,0 +1,236 @@
+package models
+
+import (
+	"errors"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"github.com/jinzhu/gorm"
+	"log"
+	"strings"
+)
+
+// ContactAddress struct to store a contact's postal addresses.
+// Contact has many ContactAddresses, ContactID is the foreign key
+type ContactAddress struct {
+	gorm.Model        // fields `ID`, `CreatedAt`, `UpdatedAt`, `DeletedAt`will be added
+	ContactID  uint   `gorm:"not null;index:idx_contact_address_contact" json:"contact_id"`
+	Label      string `gorm:"size:10;not null" json:"label"`
+	Street     string `gorm:"size:255" json:"street"`
+	City       string `gorm:"size:100;index:idx_contact_address_city" json:"city"`
+	Region     string `gorm:"size:100" json:"region"`
+	PostalCode string `gorm:"size:20" json:"postal_code"`
+	Country    string `gorm:"size:100;index:idx_contact_address_country" json:"country"`
+}
+
+// addressLabels are the labels an address can carry
+var addressLabels = []string{"home", "work", "other"}
+
+// validateAddress private method that trims and validates an address before it is saved
+func (address *ContactAddress) validateAddress() (map[string]interface{}, bool) {
+	address.Street = strings.TrimSpace(address.Street)
+	address.City = strings.TrimSpace(address.City)
+	address.Region = strings.TrimSpace(address.Region)
+	address.PostalCode = strings.TrimSpace(address.PostalCode)
+	address.Country = strings.TrimSpace(address.Country)
+
+	address.Label = strings.ToLower(strings.TrimSpace(address.Label))
+	if address.Label == "" {
+		address.Label = "home"
+	}
+	if !stringInSlice(address.Label, addressLabels) {
+		return utl.Message(102, "address label should be one of: "+strings.Join(addressLabels, ", ")), false
+	}
+
+	if address.Street == "" && address.City == "" && address.Region == "" && address.PostalCode == "" &&
+		address.Country == "" {
+		return utl.Message(102, "an address should have at least one of: street, city, region, "+
+			"postal_code, country"), false
+	}
+
+	if len(address.Street) > 255 || len(address.City) > 100 || len(address.Region) > 100 ||
+		len(address.PostalCode) > 20 || len(address.Country) > 100 {
+		return utl.Message(102, "address fields are too long"), false
+	}
+	return utl.Message(0, "address validated successfully"), true
+}
+
+// contactCheck private function that responds with an error message when the account has no access
+// to the contact, or can only view it and edit is true. nil means the account can work on the contact
+func contactCheck(contactId, accountId uint, edit bool) map[string]interface{} {
+	found, access, err := fetchAccessibleContact(contactId, accountId)
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching contact from the DB: %v\n", err.Error())
+		return utl.Message(105, "failed to fetch contact, try again later")
+	}
+	if found == nil {
+		return utl.Message(104, "contact not found")
+	}
+	if edit && !canEdit(access) {
+		return utl.Message(106, "you can only view this contact")
+	}
+	return nil
+}
+
+// FetchAddresses public method that lists the addresses of one of an account's contacts
+func (address *ContactAddress) FetchAddresses(contactId, accountId uint) map[string]interface{} {
+	if errResponse := contactCheck(contactId, accountId, false); errResponse != nil {
+		return errResponse
+	}
+
+	addresses := make([]*ContactAddress, 0)
+	if err := DBConnection.Where("contact_id=?", contactId).Order("id").Find(&addresses).Error; err != nil {
+		log.Printf("WARNING | An error occurred while fetching addresses: %v\n", err.Error())
+		return utl.Message(105, "failed to fetch addresses, try again later")
+	}
+
+	response := utl.Message(0, "addresses fetched successfully")
+	response["data"] = addresses
+	return response
+}
+
+// CreateAddress public method that adds an address to one of an account's contacts, the change is
+// recorded in the contact's revisions
+func (address *ContactAddress) CreateAddress(contactId, accountId uint) map[string]interface{} {
+	if errResponse := contactCheck(contactId, accountId, true); errResponse != nil {
+		return errResponse
+	}
+	if resp, ok := address.validateAddress(); !ok {
+		return resp
+	}
+
+	address.ID = 0
+	address.ContactID = contactId
+	err := changeAddresses(contactId, accountId, func(tx *gorm.DB) (bool, error) {
+		return true, tx.Create(address).Error
+	})
+	if err != nil {
+		log.Printf("WARNING | An error occurred while saving address: %v\n", err.Error())
+		return utl.Message(105, "failed to save address, try again")
+	}
+
+	response := utl.Message(0, "address has been created")
+	response["data"] = address
+	return response
+}
+
+// UpdateAddress public method that replaces the fields of an existing address, the change is
+// recorded in the contact's revisions
+func (address *ContactAddress) UpdateAddress(addressId, contactId, accountId uint) map[string]interface{} {
+	if errResponse := contactCheck(contactId, accountId, true); errResponse != nil {
+		return errResponse
+	}
+	if resp, ok := address.validateAddress(); !ok {
+		return resp
+	}
+
+	// every field is written so that clearing a field is possible
+	err := changeAddresses(contactId, accountId, func(tx *gorm.DB) (bool, error) {
+		result := tx.Model(&ContactAddress{}).Where("id=? AND contact_id=?", addressId, contactId).
+			Updates(map[string]interface{}{"label": address.Label, "street": address.Street, "city": address.City,
+				"region": address.Region, "postal_code": address.PostalCode, "country": address.Country})
+		return result.RowsAffected > 0, result.Error
+	})
+	if err == errAddressNotFound {
+		return utl.Message(104, "address not found")
+	}
+	if err != nil {
+		log.Printf("WARNING | An error occurred while updating address: %v\n", err.Error())
+		return utl.Message(105, "failed to update address, try again later")
+	}
+
+	updated := &ContactAddress{}
+	DBConnection.First(updated, addressId)
+	response := utl.Message(0, "address updated successfully")
+	response["data"] = updated
+	return response
+}
+
+// DeleteAddress public method that removes an address from a contact, the change is recorded in the
+// contact's revisions
+func (address *ContactAddress) DeleteAddress(addressId, contactId, accountId uint) map[string]interface{} {
+	if errResponse := contactCheck(contactId, accountId, true); errResponse != nil {
+		return errResponse
+	}
+
+	err := changeAddresses(contactId, accountId, func(tx *gorm.DB) (bool, error) {
+		result := tx.Where("id=? AND contact_id=?", addressId, contactId).Delete(&ContactAddress{})
+		return result.RowsAffected > 0, result.Error
+	})
+	if err == errAddressNotFound {
+		return utl.Message(104, "address not found")
+	}
+	if err != nil {
+		log.Printf("WARNING | An error has occurred while deleting address: %v\n", err.Error())
+		return utl.Message(105, "failed to delete address, try again later")
+	}
+	return utl.Message(0, "address deleted successfully")
+}
+
+// errAddressNotFound is returned when the address being changed does not belong to the contact
+var errAddressNotFound = errors.New("address not found")
+
+// changeAddresses private function that applies a change to a contact's addresses in a transaction and
+// records it in the contact's revisions, which increments the contact's version. change reports whether
+// it found the address it works on
+func changeAddresses(contactId, accountId uint, change func(tx *gorm.DB) (bool, error)) error {
+	tx := DBConnection.Begin()
+	before, err := loadContactState(tx, contactId)
+	if err == nil {
+		var found bool
+		found, err = change(tx)
+		if err == nil && !found {
+			err = errAddressNotFound
+		}
+	}
+	if err == nil {
+		err = recordRevision(tx, contactId, accountId, RevisionUpdated, before)
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	return err
+}
+
+// replaceAddresses private function that replaces the addresses of a contact, they are left alone when
+// they already have the same values
+func replaceAddresses(tx *gorm.DB, contactId uint, addresses []ContactAddress) error {
+	current := make([]ContactAddress, 0)
+	if err := tx.Where("contact_id=?", contactId).Order("id").Find(&current).Error; err != nil {
+		return err
+	}
+	if len(current) == len(addresses) {
+		same := true
+		for i := range current {
+			a, b := current[i], addresses[i]
+			same = same && a.Label == b.Label && a.Street == b.Street && a.City == b.City && a.Region == b.Region &&
+				a.PostalCode == b.PostalCode && a.Country == b.Country
+		}
+		if same {
+			return nil
+		}
+	}
+
+	if err := tx.Where("contact_id=?", contactId).Delete(&ContactAddress{}).Error; err != nil {
+		return err
+	}
+	for i := range addresses {
+		addresses[i].ID, addresses[i].ContactID = 0, contactId
+		if err := tx.Create(&addresses[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addressFilter private function that returns the contact ids having an address in a city and/or country
+func addressFilter(city, country string) interface{} {
+	query := DBConnection.Model(&ContactAddress{}).Select("contact_id")
+	if city != "" {
+		query = query.Where("lower(city)=lower(?)", city)
+	}
+	if country != "" {
+		query = query.Where("lower(country)=lower(?)", country)
+	}
+	return query.SubQuery()
+}
@@ -0,0 +1,604 @@
+package models
+
+import (
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"github.com/jinzhu/gorm"
+	"log"
+	"strings"
+	"time"
+)
+
+// address book member roles. Owners manage the book and its members, editors manage
+// the book's contacts and viewers can only read them
+const (
+	RoleOwner        = "owner"
+	RoleEditor       = "editor"
+	RoleViewer       = "viewer"
+	personalBookName = "Personal"
+)
+
+// bookRoles lists the roles a member can be given
+var bookRoles = []string{RoleOwner, RoleEditor, RoleViewer}
+
+// AddressBook struct to store a collection of contacts several accounts can work on.
+// AddressBook has many Contacts, AddressBookID is the foreign key. Every account has a
+// personal book that can not be shared, contacts are saved in it unless another book is chosen
+type AddressBook struct {
+	gorm.Model        // fields `ID`, `CreatedAt`, `UpdatedAt`, `DeletedAt`will be added
+	Name       string `gorm:"size:50;not null" json:"name"`
+	Personal   bool   `gorm:"default:false" json:"personal"`
+	OwnerID    uint   `gorm:"not null;index:idx_address_book_owner" json:"owner_id"` // the account that created the book
+
+	// Role is the requesting account's role, Members and Invitations are filled in by FetchAddressBook
+	Role        string                   `gorm:"-" json:"role,omitempty"`
+	Members     []*AddressBookMember     `gorm:"-" json:"members,omitempty"`
+	Invitations []*AddressBookInvitation `gorm:"-" json:"invitations,omitempty"`
+}
+
+// AddressBookMember struct is the join table between AddressBook and Account
+type AddressBookMember struct {
+	AddressBookID uint      `gorm:"primary_key;auto_increment:false" json:"address_book_id"`
+	AccountID     uint      `gorm:"primary_key;auto_increment:false;index:idx_address_book_member_account" json:"account_id"`
+	Role          string    `gorm:"size:10;not null" json:"role"`
+	CreatedAt     time.Time `json:"created_at"`
+
+	Account *ShareAccount `gorm:"-" json:"account,omitempty"`
+}
+
+// AddressBookInvitation struct to store a pending invitation to join an address book.
+// Accepting it makes the invitee a member with the role, declining it removes it
+type AddressBookInvitation struct {
+	ID            uint      `gorm:"primary_key" json:"id"`
+	AddressBookID uint      `gorm:"not null;unique_index:idx_address_book_invitation_invitee" json:"address_book_id"`
+	InviterID     uint      `gorm:"not null" json:"inviter_id"`
+	InviteeID     uint      `gorm:"not null;unique_index:idx_address_book_invitation_invitee;index:idx_address_book_invitation_account" json:"invitee_id"`
+	Role          string    `gorm:"size:10;not null" json:"role"`
+	CreatedAt     time.Time `json:"created_at"`
+
+	// the account to invite, identified by email or phone_number in requests
+	Email           string        `gorm:"-" json:"email,omitempty"`
+	PhoneNumber     string        `gorm:"-" json:"phone_number,omitempty"`
+	AddressBookName string        `gorm:"-" json:"address_book_name,omitempty"`
+	Inviter         *ShareAccount `gorm:"-" json:"inviter,omitempty"`
+	Invitee         *ShareAccount `gorm:"-" json:"invitee,omitempty"`
+}
+
+// addressBookMigrations are run after the auto migration. Every account gets a personal book
+// and the contacts saved before address books existed are moved into their account's book
+var addressBookMigrations = []string{
+	`INSERT INTO address_book (created_at, updated_at, name, personal, owner_id)
+	SELECT now(), now(), 'Personal', true, a.id FROM account a
+	WHERE NOT EXISTS (SELECT 1 FROM address_book b WHERE b.owner_id = a.id AND b.personal)`,
+	`INSERT INTO address_book_member (address_book_id, account_id, role, created_at)
+	SELECT b.id, b.owner_id, 'owner', now() FROM address_book b WHERE b.personal
+	ON CONFLICT DO NOTHING`,
+	`UPDATE contact c SET address_book_id = b.id FROM address_book b
+	WHERE b.owner_id = c.account_id AND b.personal AND c.address_book_id IS NULL`,
+	`ALTER TABLE contact ALTER COLUMN address_book_id SET NOT NULL`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_address_book_personal ON address_book (owner_id)
+	WHERE personal AND deleted_at IS NULL`,
+}
+
+// migrateAddressBooks private function that creates the personal address books
+func migrateAddressBooks() {
+	for _, statement := range addressBookMigrations {
+		if err := DBConnection.Exec(statement).Error; err != nil {
+			log.Printf("WARNING | Address book migration failed with message: %v\n", err.Error())
+			return
+		}
+	}
+}
+
+// TableName sets the table name of AddressBookMember
+func (AddressBookMember) TableName() string {
+	return "address_book_member"
+}
+
+// TableName sets the table name of AddressBookInvitation
+func (AddressBookInvitation) TableName() string {
+	return "address_book_invitation"
+}
+
+// createPersonalBook private function that creates an account's personal address book
+func createPersonalBook(tx *gorm.DB, accountId uint) error {
+	book := &AddressBook{Name: personalBookName, Personal: true, OwnerID: accountId}
+	if err := tx.Create(book).Error; err != nil {
+		return err
+	}
+	return tx.Create(&AddressBookMember{AddressBookID: book.ID, AccountID: accountId, Role: RoleOwner}).Error
+}
+
+// personalBook private function that returns the id of an account's personal address book
+func personalBook(accountId uint) (uint, error) {
+	book := &AddressBook{}
+	err := DBConnection.Where("owner_id=? AND personal=?", accountId, true).First(book).Error
+	return book.ID, err
+}
+
+// accountBooks private function that returns a subquery of the ids of the address books an account is a member of
+func accountBooks(accountId uint) *gorm.SqlExpr {
+	return DBConnection.Table("address_book_member").Select("address_book_id").Where("account_id=?", accountId).SubQuery()
+}
+
+// editableBooks private function that returns a sub query selecting the address books an account owns or edits
+func editableBooks(accountId uint) *gorm.SqlExpr {
+	return DBConnection.Table("address_book_member").Select("address_book_id").
+		Where("account_id=? AND role IN (?)", accountId, []string{RoleOwner, RoleEditor}).SubQuery()
+}
+
+// bookRole private function that returns an account's role in an address book, "" when it is not a member
+func bookRole(bookId, accountId uint) (string, error) {
+	member := &AddressBookMember{}
+	err := DBConnection.Where("address_book_id=? AND account_id=?", bookId, accountId).First(member).Error
+	if err == gorm.ErrRecordNotFound {
+		return "", nil
+	}
+	return member.Role, err
+}
+
+// canEdit private function that checks whether an access level, a book role or a share
+// permission, allows changing a contact
+func canEdit(access string) bool {
+	return access == RoleOwner || access == RoleEditor || access == ShareReadWrite
+}
+
+// writableBook private function that resolves the address book contacts are saved in, the
+// account's personal book when bookId is 0. The account must be an owner or editor of the book
+func writableBook(bookId, accountId uint) (uint, map[string]interface{}) {
+	if bookId == 0 {
+		personalId, err := personalBook(accountId)
+		if err != nil {
+			log.Printf("WARNING | An error occurred while fetching personal address book of account: %d. Error: %v\n",
+				accountId, err.Error())
+			return 0, utl.Message(105, "failed to fetch address book, try again later")
+		}
+		return personalId, nil
+	}
+
+	role, err := bookRole(bookId, accountId)
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching address book from the DB: %v\n", err.Error())
+		return 0, utl.Message(105, "failed to fetch address book, try again later")
+	}
+	if role == "" {
+		return 0, utl.Message(104, "address book not found")
+	}
+	if !canEdit(role) {
+		return 0, utl.Message(106, "you can only view the contacts of this address book")
+	}
+	return bookId, nil
+}
+
+// fetchMemberBook private function that fetches an address book together with the account's role,
+// when owner is true the account must be one of the book's owners
+func fetchMemberBook(bookId, accountId uint, owner bool) (*AddressBook, map[string]interface{}) {
+	role, err := bookRole(bookId, accountId)
+	if err == nil && role != "" {
+		book := &AddressBook{}
+		if err = DBConnection.First(book, bookId).Error; err == nil {
+			if owner && role != RoleOwner {
+				return nil, utl.Message(106, "only the owners of an address book can manage it")
+			}
+			book.Role = role
+			return book, nil
+		}
+	}
+	if err == nil || err == gorm.ErrRecordNotFound {
+		return nil, utl.Message(104, "address book not found")
+	}
+	log.Printf("WARNING | An error occurred while fetching address book from the DB: %v\n", err.Error())
+	return nil, utl.Message(105, "failed to fetch address book, try again later")
+}
+
+// validRole private function that checks a member role
+func validRole(role string) (map[string]interface{}, bool) {
+	if !stringInSlice(role, bookRoles) {
+		return utl.Message(102, "role should be one of: "+strings.Join(bookRoles, ", ")), false
+	}
+	return nil, true
+}
+
+// otherOwners private function that counts the owners of a book other than an account
+func otherOwners(bookId, accountId uint) (int, error) {
+	count := 0
+	err := DBConnection.Model(&AddressBookMember{}).Where("address_book_id=? AND role=? AND account_id<>?",
+		bookId, RoleOwner, accountId).Count(&count).Error
+	return count, err
+}
+
+// CreateAddressBook public method that creates an address book owned by the account
+func (book *AddressBook) CreateAddressBook(accountId uint) map[string]interface{} {
+	book.Name = strings.TrimSpace(book.Name)
+	if book.Name == "" {
+		return utl.Message(102, "the following field is required: name")
+	}
+	if len(book.Name) > 50 {
+		return utl.Message(102, "name should not be more than 50 characters")
+	}
+
+	book.Personal, book.OwnerID = false, accountId
+	tx := DBConnection.Begin()
+	err := tx.Create(book).Error
+	if err == nil {
+		err = tx.Create(&AddressBookMember{AddressBookID: book.ID, AccountID: accountId, Role: RoleOwner}).Error
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		log.Printf("WARNING | An error occurred while creating address book: %v\n", err.Error())
+		return utl.Message(105, "failed to create address book, try again later")
+	}
+
+	book.Role = RoleOwner
+	response := utl.Message(0, "address book has been created")
+	response["data"] = book
+	return response
+}
+
+// FetchAddressBooks public method that lists the address books the account is a member of, personal book first
+func (book *AddressBook) FetchAddressBooks(accountId uint) map[string]interface{} {
+	members := make([]*AddressBookMember, 0)
+	err := DBConnection.Where("account_id=?", accountId).Find(&members).Error
+
+	roles := make(map[uint]string, len(members))
+	bookIds := make([]uint, 0, len(members))
+	for _, member := range members {
+		roles[member.AddressBookID] = member.Role
+		bookIds = append(bookIds, member.AddressBookID)
+	}
+	books := make([]*AddressBook, 0)
+	if err == nil {
+		err = DBConnection.Where("id IN (?)", bookIds).Order("personal DESC, name, id").Find(&books).Error
+	}
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching address books of account: %d. Error: %v\n",
+			accountId, err.Error())
+		return utl.Message(105, "failed to fetch address books, try again later")
+	}
+	for _, found := range books {
+		found.Role = roles[found.ID]
+	}
+
+	response := utl.Message(0, "address books fetched successfully")
+	response["data"] = books
+	return response
+}
+
+// FetchAddressBook public method that fetches an address book with its members,
+// its owners also get the pending invitations
+func (book *AddressBook) FetchAddressBook(bookId, accountId uint) map[string]interface{} {
+	found, errResponse := fetchMemberBook(bookId, accountId, false)
+	if errResponse != nil {
+		return errResponse
+	}
+
+	found.Members = make([]*AddressBookMember, 0)
+	err := DBConnection.Where("address_book_id=?", bookId).Order("created_at, account_id").Find(&found.Members).Error
+	if err == nil && found.Role == RoleOwner {
+		found.Invitations = make([]*AddressBookInvitation, 0)
+		err = DBConnection.Where("address_book_id=?", bookId).Order("created_at, id").Find(&found.Invitations).Error
+	}
+
+	accountIds := make([]uint, 0, len(found.Members)+len(found.Invitations))
+	for _, member := range found.Members {
+		accountIds = append(accountIds, member.AccountID)
+	}
+	for _, invitation := range found.Invitations {
+		accountIds = append(accountIds, invitation.InviteeID)
+	}
+	var accounts map[uint]*ShareAccount
+	if err == nil {
+		accounts, err = shareAccounts(accountIds)
+	}
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching members of address book: %d. Error: %v\n",
+			bookId, err.Error())
+		return utl.Message(105, "failed to fetch address book, try again later")
+	}
+	for _, member := range found.Members {
+		member.Account = accounts[member.AccountID]
+	}
+	for _, invitation := range found.Invitations {
+		invitation.Invitee = accounts[invitation.InviteeID]
+	}
+
+	response := utl.Message(0, "address book fetched successfully")
+	response["data"] = found
+	return response
+}
+
+// UpdateAddressBook public method that renames an address book, only its owners can rename it
+func (book *AddressBook) UpdateAddressBook(bookId, accountId uint) map[string]interface{} {
+	book.Name = strings.TrimSpace(book.Name)
+	if book.Name == "" {
+		return utl.Message(102, "the following field is required: name")
+	}
+	if len(book.Name) > 50 {
+		return utl.Message(102, "name should not be more than 50 characters")
+	}
+
+	found, errResponse := fetchMemberBook(bookId, accountId, true)
+	if errResponse != nil {
+		return errResponse
+	}
+	if err := DBConnection.Model(found).Update("name", book.Name).Error; err != nil {
+		log.Printf("WARNING | An error occurred while updating address book: %v\n", err.Error())
+		return utl.Message(105, "failed to update address book, try again later")
+	}
+
+	response := utl.Message(0, "address book updated successfully")
+	response["data"] = found
+	return response
+}
+
+// DeleteAddressBook public method that deletes an empty address book, personal books can not be deleted
+func (book *AddressBook) DeleteAddressBook(bookId, accountId uint) map[string]interface{} {
+	found, errResponse := fetchMemberBook(bookId, accountId, true)
+	if errResponse != nil {
+		return errResponse
+	}
+	if found.Personal {
+		return utl.Message(102, "a personal address book can not be deleted")
+	}
+
+	// contacts in the trash are counted too, without the book's members they could not be restored
+	count := 0
+	err := DBConnection.Unscoped().Model(&Contact{}).Where("address_book_id=?", bookId).Count(&count).Error
+	if err != nil {
+		log.Printf("WARNING | An error occurred while deleting address book: %v\n", err.Error())
+		return utl.Message(105, "failed to delete address book, try again later")
+	}
+	if count > 0 {
+		return utl.Message(102, "move or permanently delete the contacts of the address book, including "+
+			"the ones in the trash, before deleting it")
+	}
+
+	tx := DBConnection.Begin()
+	err = tx.Where("address_book_id=?", bookId).Delete(&AddressBookInvitation{}).Error
+	if err == nil {
+		err = tx.Where("address_book_id=?", bookId).Delete(&AddressBookMember{}).Error
+	}
+	if err == nil {
+		err = tx.Delete(found).Error
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		log.Printf("WARNING | An error occurred while deleting address book: %v\n", err.Error())
+		return utl.Message(105, "failed to delete address book, try again later")
+	}
+	return utl.Message(0, "address book deleted successfully")
+}
+
+// InviteMember public method that invites an account to join an address book with a role,
+// inviting an account again changes the role of its pending invitation
+func (invitation *AddressBookInvitation) InviteMember(bookId, accountId uint) map[string]interface{} {
+	if invitation.Role == "" {
+		invitation.Role = RoleViewer
+	}
+	if resp, ok := validRole(invitation.Role); !ok {
+		return resp
+	}
+
+	book, errResponse := fetchMemberBook(bookId, accountId, true)
+	if errResponse != nil {
+		return errResponse
+	}
+	if book.Personal {
+		return utl.Message(102, "a personal address book can not be shared, create another address book")
+	}
+
+	invitee, resp := findAccount(invitation.Email, invitation.PhoneNumber, accountRegion(accountId))
+	if invitee == nil {
+		return resp
+	}
+	role, err := bookRole(bookId, invitee.ID)
+	if err != nil {
+		log.Printf("WARNING | An error occurred while inviting member: %v\n", err.Error())
+		return utl.Message(105, "failed to invite member, try again later")
+	}
+	if role != "" {
+		return utl.Message(101, "the account is already a member of the address book")
+	}
+
+	result := &AddressBookInvitation{}
+	err = DBConnection.Where(AddressBookInvitation{AddressBookID: bookId, InviteeID: invitee.ID}).
+		Assign(AddressBookInvitation{InviterID: accountId, Role: invitation.Role}).FirstOrCreate(result).Error
+	if err != nil {
+		log.Printf("WARNING | An error occurred while inviting member: %v\n", err.Error())
+		return utl.Message(105, "failed to invite member, try again later")
+	}
+	result.AddressBookName = book.Name
+	result.Invitee = &ShareAccount{ID: invitee.ID, FirstName: invitee.FirstName, LastName: invitee.LastName,
+		Email: invitee.Email}
+
+	response := utl.Message(0, "invitation sent successfully")
+	response["data"] = result
+	return response
+}
+
+// CancelInvitation public method that withdraws a pending invitation to an address book
+func (invitation *AddressBookInvitation) CancelInvitation(invitationId, bookId, accountId uint) map[string]interface{} {
+	if _, errResponse := fetchMemberBook(bookId, accountId, true); errResponse != nil {
+		return errResponse
+	}
+
+	result := DBConnection.Where("id=? AND address_book_id=?", invitationId, bookId).Delete(&AddressBookInvitation{})
+	if result.Error != nil {
+		log.Printf("WARNING | An error occurred while cancelling invitation: %v\n", result.Error.Error())
+		return utl.Message(105, "failed to cancel invitation, try again later")
+	}
+	if result.RowsAffected == 0 {
+		return utl.Message(104, "invitation not found")
+	}
+	return utl.Message(0, "invitation cancelled successfully")
+}
+
+// FetchInvitations public method that lists the account's pending invitations to address books
+func (invitation *AddressBookInvitation) FetchInvitations(accountId uint) map[string]interface{} {
+	invitations := make([]*AddressBookInvitation, 0)
+	err := DBConnection.Where("invitee_id=?", accountId).Order("created_at DESC, id DESC").Find(&invitations).Error
+
+	bookIds := make([]uint, 0, len(invitations))
+	inviterIds := make([]uint, 0, len(invitations))
+	for _, found := range invitations {
+		bookIds = append(bookIds, found.AddressBookID)
+		inviterIds = append(inviterIds, found.InviterID)
+	}
+	books := make([]*AddressBook, 0)
+	if err == nil {
+		err = DBConnection.Where("id IN (?)", bookIds).Find(&books).Error
+	}
+	var inviters map[uint]*ShareAccount
+	if err == nil {
+		inviters, err = shareAccounts(inviterIds)
+	}
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching invitations of account: %d. Error: %v\n",
+			accountId, err.Error())
+		return utl.Message(105, "failed to fetch invitations, try again later")
+	}
+
+	names := make(map[uint]string, len(books))
+	for _, book := range books {
+		names[book.ID] = book.Name
+	}
+	for _, found := range invitations {
+		found.AddressBookName = names[found.AddressBookID]
+		found.Inviter = inviters[found.InviterID]
+	}
+
+	response := utl.Message(0, "invitations fetched successfully")
+	response["data"] = invitations
+	return response
+}
+
+// AcceptInvitation public method that makes the account a member of the address book it was invited to
+func (invitation *AddressBookInvitation) AcceptInvitation(invitationId, accountId uint) map[string]interface{} {
+	found := &AddressBookInvitation{}
+	err := DBConnection.Where("id=? AND invitee_id=?", invitationId, accountId).First(found).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return utl.Message(104, "invitation not found")
+		}
+		log.Printf("WARNING | An error occurred while fetching invitation from the DB: %v\n", err.Error())
+		return utl.Message(105, "failed to accept invitation, try again later")
+	}
+
+	tx := DBConnection.Begin()
+	err = tx.Exec(`INSERT INTO address_book_member (address_book_id, account_id, role, created_at)
+		VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING`, found.AddressBookID, accountId, found.Role, time.Now()).Error
+	if err == nil {
+		err = tx.Delete(found).Error
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		log.Printf("WARNING | An error occurred while accepting invitation: %v\n", err.Error())
+		return utl.Message(105, "failed to accept invitation, try again later")
+	}
+
+	book := &AddressBook{}
+	return book.FetchAddressBook(found.AddressBookID, accountId)
+}
+
+// DeclineInvitation public method that turns down an invitation to an address book
+func (invitation *AddressBookInvitation) DeclineInvitation(invitationId, accountId uint) map[string]interface{} {
+	result := DBConnection.Where("id=? AND invitee_id=?", invitationId, accountId).Delete(&AddressBookInvitation{})
+	if result.Error != nil {
+		log.Printf("WARNING | An error occurred while declining invitation: %v\n", result.Error.Error())
+		return utl.Message(105, "failed to decline invitation, try again later")
+	}
+	if result.RowsAffected == 0 {
+		return utl.Message(104, "invitation not found")
+	}
+	return utl.Message(0, "invitation declined successfully")
+}
+
+// UpdateMemberRole public method that changes the role of a member of an address book.
+// A book always keeps at least one owner
+func (member *AddressBookMember) UpdateMemberRole(bookId, memberId, accountId uint) map[string]interface{} {
+	if resp, ok := validRole(member.Role); !ok {
+		return resp
+	}
+	if _, errResponse := fetchMemberBook(bookId, accountId, true); errResponse != nil {
+		return errResponse
+	}
+
+	found := &AddressBookMember{}
+	err := DBConnection.Where("address_book_id=? AND account_id=?", bookId, memberId).First(found).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return utl.Message(104, "member not found")
+		}
+		log.Printf("WARNING | An error occurred while fetching member from the DB: %v\n", err.Error())
+		return utl.Message(105, "failed to update member, try again later")
+	}
+	if found.Role == RoleOwner && member.Role != RoleOwner {
+		owners, err := otherOwners(bookId, memberId)
+		if err != nil {
+			log.Printf("WARNING | An error occurred while updating member: %v\n", err.Error())
+			return utl.Message(105, "failed to update member, try again later")
+		}
+		if owners == 0 {
+			return utl.Message(102, "an address book needs at least one owner")
+		}
+	}
+
+	err = DBConnection.Model(found).Where("address_book_id=? AND account_id=?", bookId, memberId).
+		UpdateColumn("role", member.Role).Error
+	if err != nil {
+		log.Printf("WARNING | An error occurred while updating member: %v\n", err.Error())
+		return utl.Message(105, "failed to update member, try again later")
+	}
+	found.Role = member.Role
+
+	response := utl.Message(0, "member updated successfully")
+	response["data"] = found
+	return response
+}
+
+// RemoveMember public method that removes a member from an address book. Owners remove members,
+// any member can remove itself to leave the book. A book always keeps at least one owner
+func (member *AddressBookMember) RemoveMember(bookId, memberId, accountId uint) map[string]interface{} {
+	if _, errResponse := fetchMemberBook(bookId, accountId, memberId != accountId); errResponse != nil {
+		return errResponse
+	}
+
+	found := &AddressBookMember{}
+	err := DBConnection.Where("address_book_id=? AND account_id=?", bookId, memberId).First(found).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return utl.Message(104, "member not found")
+		}
+		log.Printf("WARNING | An error occurred while fetching member from the DB: %v\n", err.Error())
+		return utl.Message(105, "failed to remove member, try again later")
+	}
+	if found.Role == RoleOwner {
+		owners, err := otherOwners(bookId, memberId)
+		if err != nil {
+			log.Printf("WARNING | An error occurred while removing member: %v\n", err.Error())
+			return utl.Message(105, "failed to remove member, try again later")
+		}
+		if owners == 0 {
+			return utl.Message(102, "an address book needs at least one owner, make another member an owner "+
+				"or delete the address book")
+		}
+	}
+
+	err = DBConnection.Where("address_book_id=? AND account_id=?", bookId, memberId).Delete(&AddressBookMember{}).Error
+	if err != nil {
+		log.Printf("WARNING | An error occurred while removing member: %v\n", err.Error())
+		return utl.Message(105, "failed to remove member, try again later")
+	}
+	return utl.Message(0, "member removed successfully")
+}
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"github.com/jinzhu/gorm"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxAppPasswords = 20 // per account
+
+// AppPassword struct to store a password an account generates for a contacts app, CardDAV clients
+// sign in with it instead of the account's password. The password starts with the id of its record,
+// e.g. 12-abcd-efgh-ijkl-mnop, so that only one hash is checked when a client signs in. Only the
+// bcrypt hash of the random part is kept
+type AppPassword struct {
+	ID         uint       `gorm:"primary_key" json:"id"`
+	AccountID  uint       `gorm:"not null;index:idx_app_password_account" json:"-"`
+	Name       string     `gorm:"size:50;not null" json:"name"` // e.g. iPhone, where the password is used
+	Hash       string     `gorm:"type:varchar(255);not null" json:"-"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+
+	// the generated password, only returned when it is created
+	Password string `gorm:"-" json:"password,omitempty"`
+}
+
+// generateAppPassword private function that returns the random part of an app password, four groups of
+// four letters and digits, e.g. abcd-efgh-ijkl-mnop, easy to type on a phone
+func generateAppPassword() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	encoded := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+	return strings.Join([]string{encoded[0:4], encoded[4:8], encoded[8:12], encoded[12:16]}, "-"), nil
+}
+
+// CreateAppPassword public method that generates a new app password for an account, the password is
+// only returned in this response
+func (appPassword *AppPassword) CreateAppPassword(accountId uint) map[string]interface{} {
+	appPassword.Name = strings.TrimSpace(appPassword.Name)
+	if appPassword.Name == "" || len(appPassword.Name) > 50 {
+		return utl.Message(102, "name is required and should not be more than 50 characters")
+	}
+
+	var count int
+	if err := DBConnection.Model(&AppPassword{}).Where("account_id=?", accountId).Count(&count).Error; err != nil {
+		log.Printf("WARNING | An error occurred while counting app passwords of account: %d. Error: %v\n",
+			accountId, err.Error())
+		return utl.Message(105, "failed to create app password, try again later")
+	}
+	if count >= maxAppPasswords {
+		return utl.Message(102, "an account can have at most 20 app passwords, delete one first")
+	}
+
+	secret, err := generateAppPassword()
+	if err != nil {
+		log.Printf("WARNING | An error occurred while generating app password: %v\n", err.Error())
+		return utl.Message(105, "failed to create app password, try again later")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("WARNING | An error occurred while hashing app password: %v\n", err.Error())
+		return utl.Message(105, "failed to create app password, try again later")
+	}
+
+	appPassword.ID, appPassword.AccountID, appPassword.Hash, appPassword.LastUsedAt = 0, accountId, string(hash), nil
+	if err := DBConnection.Create(appPassword).Error; err != nil {
+		log.Printf("WARNING | An error occurred while saving app password: %v\n", err.Error())
+		return utl.Message(105, "failed to create app password, try again later")
+	}
+
+	appPassword.Password = fmt.Sprintf("%d-%s", appPassword.ID, secret)
+	response := utl.Message(0, "app password created, it will not be shown again")
+	response["data"] = appPassword
+	return response
+}
+
+// FetchAppPasswords public method that lists the app passwords of an account, the passwords themselves are not returned
+func (appPassword *AppPassword) FetchAppPasswords(accountId uint) map[string]interface{} {
+	appPasswords := make([]*AppPassword, 0)
+	if err := DBConnection.Where("account_id=?", accountId).Order("id").Find(&appPasswords).Error; err != nil {
+		log.Printf("WARNING | An error occurred while fetching app passwords of account: %d. Error: %v\n",
+			accountId, err.Error())
+		return utl.Message(105, "failed to fetch app passwords, try again later")
+	}
+
+	response := utl.Message(0, "app passwords fetched successfully")
+	response["data"] = appPasswords
+	return response
+}
+
+// DeleteAppPassword public method that revokes an app password, the apps using it can no longer sign in
+func (appPassword *AppPassword) DeleteAppPassword(appPasswordId, accountId uint) map[string]interface{} {
+	result := DBConnection.Where("id=? AND account_id=?", appPasswordId, accountId).Delete(&AppPassword{})
+	if result.Error != nil {
+		log.Printf("WARNING | An error occurred while deleting app password: %v\n", result.Error.Error())
+		return utl.Message(105, "failed to delete app password, try again later")
+	}
+	if result.RowsAffected == 0 {
+		return utl.Message(104, "app password not found")
+	}
+	return utl.Message(0, "app password deleted successfully")
+}
+
+// splitAppPassword private function that splits an app password into the id of its record and its
+// random part, ok is false when the password does not have the shape of an app password
+func splitAppPassword(password string) (uint, string, bool) {
+	parts := strings.SplitN(password, "-", 2)
+	if len(parts) != 2 || len(parts[1]) != 19 {
+		return 0, "", false
+	}
+	id, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil || id == 0 {
+		return 0, "", false
+	}
+	return uint(id), parts[1], true
+}
+
+// appPasswordHash private function that returns the hash of an account's app password, empty when the
+// account has no app password with that id
+func appPasswordHash(appPasswordId, accountId uint) (string, error) {
+	appPassword := &AppPassword{}
+	err := DBConnection.Select("id, hash").Where("id=? AND account_id=?", appPasswordId, accountId).
+		First(appPassword).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return "", nil
+	}
+	return appPassword.Hash, err
+}
+
+// markAppPasswordUsed private function that records when an app password was last used, a failure is only logged
+func markAppPasswordUsed(appPasswordId uint) {
+	err := DBConnection.Model(&AppPassword{}).Where("id=?", appPasswordId).UpdateColumn("last_used_at", time.Now()).Error
+	if err != nil {
+		log.Printf("WARNING | An error occurred while updating app password: %d. Error: %v\n",
+			appPasswordId, err.Error())
+	}
+}
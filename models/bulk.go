@@ -0,0 +1,300 @@
+package models
+
+import (
+	"fmt"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"github.com/jinzhu/gorm"
+	"log"
+)
+
+// bulk modes
+const (
+	BulkAllOrNothing = "all_or_nothing" // every item is saved in one transaction, or none is
+	BulkBestEffort   = "best_effort"    // every valid item is saved on its own
+)
+
+const defaultBulkMaxItems = 500 // used when CONTACTS.BULK_MAX_ITEMS is not set
+
+// BulkCreate struct to decode a request creating many contacts at once
+type BulkCreate struct {
+	Mode     string     `json:"mode"`
+	Contacts []*Contact `json:"contacts"`
+}
+
+// BulkUpdateItem struct is a contact update in a bulk request, contact_id picks the contact and
+// the other fields are the same as in an update of a single contact. A version, when passed, has to
+// match the contact's version like an If-Match header
+type BulkUpdateItem struct {
+	ContactID uint `json:"contact_id"`
+	Contact
+}
+
+// BulkUpdate struct to decode a request updating many contacts at once
+type BulkUpdate struct {
+	Mode     string            `json:"mode"`
+	Contacts []*BulkUpdateItem `json:"contacts"`
+}
+
+// BulkDelete struct to decode a request deleting many contacts at once
+type BulkDelete struct {
+	Mode       string `json:"mode"`
+	ContactIDs []uint `json:"contact_ids"`
+}
+
+// BulkItemResult struct reports the outcome of a single item of a bulk request, Index is the
+// position of the item in the request starting from 0. Status is created, updated or deleted when the
+// item was saved, rejected when it failed validation or its version did not match, failed when it
+// could not be saved and skipped
+// when it was not saved because another item of an all_or_nothing request was not
+type BulkItemResult struct {
+	Index     int    `json:"index"`
+	ContactID uint   `json:"contact_id,omitempty"`
+	Status    string `json:"status"`
+	Code      int32  `json:"code,omitempty"` // response_code of a rejected or failed item
+	Reason    string `json:"reason,omitempty"`
+}
+
+// bulkItem struct holds how to validate and save an item of a bulk request
+type bulkItem struct {
+	result  *BulkItemResult
+	prepare func() map[string]interface{}
+	save    func(tx *gorm.DB) error
+	done    string // the status of a saved item
+}
+
+// bulkMaxItems private function that returns the number of items a bulk request can carry,
+// from CONTACTS.BULK_MAX_ITEMS
+func bulkMaxItems() int {
+	maxItems := utl.ReadConfigs().GetInt("CONTACTS.BULK_MAX_ITEMS")
+	if maxItems <= 0 {
+		maxItems = defaultBulkMaxItems
+	}
+	return maxItems
+}
+
+// checkBulkRequest private function that validates the mode and size of a bulk request
+func checkBulkRequest(mode string, count int) (string, map[string]interface{}) {
+	if mode == "" {
+		mode = BulkAllOrNothing
+	}
+	if mode != BulkAllOrNothing && mode != BulkBestEffort {
+		return "", utl.Message(102, "mode should be either all_or_nothing or best_effort")
+	}
+	if count == 0 {
+		return "", utl.Message(102, "the request does not contain any items")
+	}
+	if maxItems := bulkMaxItems(); count > maxItems {
+		return "", utl.Message(102, fmt.Sprintf("a bulk request can carry at most %d items", maxItems))
+	}
+	return mode, nil
+}
+
+// rejectItem private function that marks an item with the error response it got
+func rejectItem(result *BulkItemResult, status string, resp map[string]interface{}) {
+	result.Status, result.Code = status, resp["response_code"].(int32)
+	result.Reason = resp["response_description"].(string)
+}
+
+// runBulk private function that validates every item of a bulk request and saves the valid ones,
+// in one transaction for all_or_nothing requests or each in its own for best_effort requests
+func runBulk(mode string, items []*bulkItem) map[string]interface{} {
+	results := make([]*BulkItemResult, 0, len(items))
+	valid := make([]*bulkItem, 0, len(items))
+	for _, item := range items {
+		results = append(results, item.result)
+		if resp := item.prepare(); resp != nil {
+			rejectItem(item.result, "rejected", resp)
+			continue
+		}
+		valid = append(valid, item)
+	}
+
+	if mode == BulkAllOrNothing {
+		if rejected := len(items) - len(valid); rejected > 0 {
+			for _, item := range valid {
+				item.result.Status = "skipped"
+			}
+			response := utl.Message(102, fmt.Sprintf("no changes were made, %d items were rejected", rejected))
+			response["results"] = results
+			return response
+		}
+
+		tx := DBConnection.Begin()
+		for _, item := range items {
+			if err := item.save(tx); err != nil {
+				tx.Rollback()
+				skipAll(items)
+				if err == errVersionMismatch {
+					rejectItem(item.result, "rejected", versionConflict())
+					response := utl.Message(107, "no changes were made, a contact has been changed since it was fetched")
+					response["results"] = results
+					return response
+				}
+				log.Printf("WARNING | An error occurred while saving bulk item %d: %v\n", item.result.Index,
+					err.Error())
+				rejectItem(item.result, "failed", utl.Message(105, "failed to save contact, try again later"))
+				response := utl.Message(105, "no changes were made, try again later")
+				response["results"] = results
+				return response
+			}
+		}
+		if err := tx.Commit().Error; err != nil {
+			log.Printf("WARNING | An error occurred while saving bulk request: %v\n", err.Error())
+			skipAll(items)
+			response := utl.Message(105, "no changes were made, try again later")
+			response["results"] = results
+			return response
+		}
+		for _, item := range items {
+			item.result.Status = item.done
+		}
+	} else {
+		for _, item := range valid {
+			tx := DBConnection.Begin()
+			err := item.save(tx)
+			if err == nil {
+				err = tx.Commit().Error
+			} else {
+				tx.Rollback()
+			}
+			if err == errVersionMismatch {
+				rejectItem(item.result, "rejected", versionConflict())
+				continue
+			}
+			if err != nil {
+				log.Printf("WARNING | An error occurred while saving bulk item %d: %v\n", item.result.Index,
+					err.Error())
+				rejectItem(item.result, "failed", utl.Message(105, "failed to save contact, try again later"))
+				continue
+			}
+			item.result.Status = item.done
+		}
+	}
+
+	succeeded := 0
+	for _, item := range items {
+		if item.result.Status == item.done {
+			succeeded++
+		}
+	}
+	response := utl.Message(0, fmt.Sprintf("%d of %d items completed successfully", succeeded, len(items)))
+	response["succeeded"] = succeeded
+	response["failed"] = len(items) - succeeded
+	response["results"] = results
+	return response
+}
+
+// skipAll private function that marks every item of a rolled back all_or_nothing request as skipped,
+// the ids of the contacts that were being created are dropped
+func skipAll(items []*bulkItem) {
+	for _, item := range items {
+		item.result.Status = "skipped"
+		if item.done == "created" {
+			item.result.ContactID = 0
+		}
+	}
+}
+
+// duplicateCheck private function that returns a prepare step rejecting a contact passed more than
+// once in a bulk request, every other item goes through the prepare step passed
+func duplicateCheck(seen map[uint]bool, contactId uint, prepare func() map[string]interface{}) func() map[string]interface{} {
+	duplicate := contactId != 0 && seen[contactId]
+	seen[contactId] = true
+	return func() map[string]interface{} {
+		if duplicate {
+			return utl.Message(102, "the contact appears more than once in the request")
+		}
+		return prepare()
+	}
+}
+
+// BulkCreateContacts public method that creates many contacts of an account at once, every contact
+// goes through the same validation as CreateContact
+func (bulk *BulkCreate) BulkCreateContacts(accountId uint) map[string]interface{} {
+	mode, errResponse := checkBulkRequest(bulk.Mode, len(bulk.Contacts))
+	if errResponse != nil {
+		return errResponse
+	}
+
+	region := accountRegion(accountId)
+	items := make([]*bulkItem, 0, len(bulk.Contacts))
+	for i, contact := range bulk.Contacts {
+		contact, result := contact, &BulkItemResult{Index: i}
+		if contact == nil {
+			contact = &Contact{}
+		}
+		items = append(items, &bulkItem{result: result, done: "created",
+			prepare: func() map[string]interface{} {
+				return contact.prepareCreate(accountId, region)
+			},
+			save: func(tx *gorm.DB) error {
+				if err := contact.createInTransaction(tx, accountId); err != nil {
+					return err
+				}
+				result.ContactID = contact.ID
+				return nil
+			},
+		})
+	}
+	return runBulk(mode, items)
+}
+
+// BulkUpdateContacts public method that updates many contacts at once, every update goes through the
+// same checks and validation as UpdateContact
+func (bulk *BulkUpdate) BulkUpdateContacts(accountId uint) map[string]interface{} {
+	mode, errResponse := checkBulkRequest(bulk.Mode, len(bulk.Contacts))
+	if errResponse != nil {
+		return errResponse
+	}
+
+	seen := make(map[uint]bool, len(bulk.Contacts))
+	items := make([]*bulkItem, 0, len(bulk.Contacts))
+	for i, update := range bulk.Contacts {
+		update := update
+		if update == nil {
+			update = &BulkUpdateItem{}
+		}
+		contactId := update.ContactID
+		items = append(items, &bulkItem{result: &BulkItemResult{Index: i, ContactID: contactId}, done: "updated",
+			prepare: duplicateCheck(seen, contactId, func() map[string]interface{} {
+				if contactId == 0 {
+					return utl.Message(102, "the following field is required: contact_id")
+				}
+				return update.Contact.prepareUpdate(contactId, accountId)
+			}),
+			save: func(tx *gorm.DB) error {
+				if update.Version != 0 {
+					if err := lockVersion(tx, contactId, utl.ETag(update.Version)); err != nil {
+						return err
+					}
+				}
+				return update.Contact.updateInTransaction(tx, contactId, accountId)
+			},
+		})
+	}
+	return runBulk(mode, items)
+}
+
+// BulkDeleteContacts public method that moves many contacts to the trash at once, only owners and
+// editors of a contact's address book can delete it
+func (bulk *BulkDelete) BulkDeleteContacts(accountId uint) map[string]interface{} {
+	mode, errResponse := checkBulkRequest(bulk.Mode, len(bulk.ContactIDs))
+	if errResponse != nil {
+		return errResponse
+	}
+
+	seen := make(map[uint]bool, len(bulk.ContactIDs))
+	items := make([]*bulkItem, 0, len(bulk.ContactIDs))
+	for i, contactId := range bulk.ContactIDs {
+		contactId := contactId
+		items = append(items, &bulkItem{result: &BulkItemResult{Index: i, ContactID: contactId}, done: "deleted",
+			prepare: duplicateCheck(seen, contactId, func() map[string]interface{} {
+				return prepareDelete(contactId, accountId)
+			}),
+			save: func(tx *gorm.DB) error {
+				return deleteInTransaction(tx, contactId, accountId)
+			},
+		})
+	}
+	return runBulk(mode, items)
+}
@@ -0,0 +1,460 @@
+package models
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/cermu/Go-phoneBook-API/carddav"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"github.com/cermu/Go-phoneBook-API/vcard"
+	"github.com/go-redis/redis/v7"
+	"github.com/jinzhu/gorm"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cardDAVMigrations are run after the auto migration, two cards of an address book can not have the
+// same resource name
+var cardDAVMigrations = []string{
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_contact_book_dav_name ON contact (address_book_id, dav_name)
+	WHERE dav_name <> '' AND deleted_at IS NULL`,
+	`CREATE INDEX IF NOT EXISTS idx_contact_book_vcard_uid ON contact (address_book_id, vcard_uid)
+	WHERE vcard_uid <> ''`,
+}
+
+// migrateCardDAV private function that creates the indexes used to find the cards of CardDAV clients
+func migrateCardDAV() {
+	for _, statement := range cardDAVMigrations {
+		if err := DBConnection.Exec(statement).Error; err != nil {
+			log.Printf("WARNING | CardDAV migration failed with message: %v\n", err.Error())
+			return
+		}
+	}
+}
+
+// CardDAVBackend struct gives the CardDAV handler access to accounts, their address books and contacts.
+// Every address book an account is a member of is served, viewers can only read theirs
+type CardDAVBackend struct{}
+
+// cardDAVBook private struct holds an address book together with what its CTag is made of
+type cardDAVBook struct {
+	ID         uint
+	Name       string
+	Role       string
+	PurgedTxid int64
+	Cards      int
+	LastTxid   int64
+}
+
+// Authenticate public method that checks the email and password of an account, or one of its app passwords.
+// The same number of bcrypt hashes is compared whether the account exists or not, so the time taken does
+// not tell which emails have an account. An email is refused from a client address for a while after too
+// many failed attempts from that address, so failures elsewhere do not lock the account's owner out
+func (CardDAVBackend) Authenticate(username, password, clientIP string) (uint, error) {
+	configs := utl.ReadConfigs()
+	maxFailures := configs.GetInt64("CARDDAV.MAX_FAILED_LOGINS")
+	if maxFailures <= 0 {
+		maxFailures = 10
+	}
+	lockout := time.Duration(configs.GetInt("CARDDAV.LOCKOUT_MINUTES")) * time.Minute
+	if lockout <= 0 {
+		lockout = 15 * time.Minute
+	}
+
+	failuresKey := "carddav:failed-logins:" + strings.ToLower(username) + ":" + clientIP
+	failures, err := utl.RedisClient().Get(failuresKey).Int64()
+	if err != nil && err != redis.Nil {
+		return 0, err
+	}
+	if failures >= maxFailures {
+		return 0, carddav.ErrTooManyAttempts
+	}
+
+	accountId, err := checkCardDAVPassword(username, password)
+	if err != carddav.ErrUnauthorized {
+		return accountId, err
+	}
+	// the window starts with the first failure, it is not extended by the next ones
+	failures, redisErr := utl.RedisClient().Incr(failuresKey).Result()
+	if redisErr == nil && failures == 1 {
+		redisErr = utl.RedisClient().Expire(failuresKey, lockout).Err()
+	}
+	if redisErr != nil {
+		log.Printf("WARNING | An error occurred while counting failed CardDAV logins: %v\n", redisErr.Error())
+	}
+	return 0, carddav.ErrUnauthorized
+}
+
+// checkCardDAVPassword private function that checks the password of an account, and one of its app passwords
+// too when the password has the shape of one, since an account password can have that shape as well. A dummy
+// hash is compared in place of a missing account or app password
+func checkCardDAVPassword(username, password string) (uint, error) {
+	account := &Account{}
+	err := DBConnection.Table("account").Select("id, password").Where("email=? AND active=?", username, true).
+		First(account).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return 0, err
+	}
+	found := err == nil
+
+	appPasswordId, appSecret, isAppPassword := splitAppPassword(password)
+	if isAppPassword {
+		// looked up for missing accounts as well, with an account id no app password has
+		hash, err := appPasswordHash(appPasswordId, account.ID)
+		if err != nil {
+			return 0, err
+		}
+		if matchesHash(hash, appSecret) && found {
+			markAppPasswordUsed(appPasswordId)
+			return account.ID, nil
+		}
+	}
+
+	if !matchesHash(account.Password, password) || !found {
+		return 0, carddav.ErrUnauthorized
+	}
+	return account.ID, nil
+}
+
+// matchesHash private function that compares a password with a bcrypt hash, the dummy hash is compared
+// when the hash is empty so that the time taken is the same
+func matchesHash(hash, password string) bool {
+	if hash == "" {
+		_ = bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash()), []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+// dummyPasswordHash private function that returns a bcrypt hash of the default cost that no password
+// matches, compared instead of a real hash so that a missing account takes as long as a wrong password
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		random := make([]byte, 32)
+		_, _ = rand.Read(random)
+		dummyHash, _ = bcrypt.GenerateFromPassword(random, bcrypt.DefaultCost)
+	})
+	return string(dummyHash)
+}
+
+// Books public method that lists the address books an account is a member of, the personal book first.
+// The CTag changes with every change of a contact of the book, the trash and permanent deletes included
+func (CardDAVBackend) Books(accountId uint) ([]*carddav.Book, error) {
+	rows := make([]*cardDAVBook, 0)
+	err := DBConnection.Raw(`SELECT b.id, b.name, m.role, b.purged_txid,
+		(SELECT COUNT(*) FROM contact c WHERE c.address_book_id = b.id) AS cards,
+		(SELECT COALESCE(MAX(c.sync_txid), 0) FROM contact c WHERE c.address_book_id = b.id) AS last_txid
+		FROM address_book b JOIN address_book_member m ON m.address_book_id = b.id
+		WHERE m.account_id = ? AND b.deleted_at IS NULL
+		ORDER BY b.personal DESC, b.name, b.id`, accountId).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	books := make([]*carddav.Book, 0, len(rows))
+	for _, row := range rows {
+		books = append(books, &carddav.Book{ID: row.ID, Name: row.Name, ReadOnly: !canEdit(row.Role),
+			CTag: fmt.Sprintf("%d-%d-%d", row.LastTxid, row.Cards, row.PurgedTxid)})
+	}
+	return books, nil
+}
+
+// davNameId private function that reads the contact id out of the {id}.vcf name of a contact that was
+// not created over CardDAV
+func davNameId(name string) (uint, bool) {
+	if !strings.HasSuffix(name, ".vcf") {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(strings.TrimSuffix(name, ".vcf"), 10, 64)
+	return uint(id), err == nil && id > 0
+}
+
+// davName private method that returns the name of the contact's card in its address book
+func (contact *Contact) davName() string {
+	if contact.DavName != "" {
+		return contact.DavName
+	}
+	return fmt.Sprintf("%d.vcf", contact.ID)
+}
+
+// whereDavNames private function that restricts a contact query to the cards with the names passed
+func whereDavNames(query *gorm.DB, names []string) *gorm.DB {
+	ids := make([]uint, 0)
+	for _, name := range names {
+		if id, ok := davNameId(name); ok {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return query.Where("dav_name IN (?)", names)
+	}
+	return query.Where("dav_name IN (?) OR (dav_name = '' AND id IN (?))", names, ids)
+}
+
+// cardDAVContact private function that loads the contact behind a card of an address book, nil when there is none
+func cardDAVContact(bookId uint, name string) (*Contact, error) {
+	contact := &Contact{}
+	err := whereDavNames(DBConnection.Table("contact").Where("address_book_id=?", bookId), []string{name}).
+		Order("id").First(contact).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	return contact, err
+}
+
+// cardDAVError private function that turns the error response of a rejected change into the error of the CardDAV handler
+func cardDAVError(response map[string]interface{}) error {
+	description := response["response_description"].(string)
+	switch response["response_code"].(int32) {
+	case 102:
+		return &carddav.InvalidCardError{Reason: description}
+	case 104:
+		return carddav.ErrNotFound
+	case 106:
+		return carddav.ErrForbidden
+	}
+	return errors.New(description)
+}
+
+// Objects public method that lists the cards of an address book the account is a member of, or the ones
+// with the names passed. Cards are only built when withCards is set
+func (CardDAVBackend) Objects(accountId, bookId uint, names []string, withCards bool) ([]*carddav.Object, error) {
+	role, err := bookRole(bookId, accountId)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, carddav.ErrNotFound
+	}
+	objects := make([]*carddav.Object, 0)
+	if names != nil && len(names) == 0 {
+		return objects, nil
+	}
+
+	query := DBConnection.Table("contact").Where("address_book_id=?", bookId)
+	if names != nil {
+		query = whereDavNames(query, names)
+	}
+	if withCards {
+		query = query.Preload("Phones").Preload("Emails").Preload("Addresses")
+	}
+	contacts := make([]*Contact, 0)
+	if err := query.Order("id").Find(&contacts).Error; err != nil {
+		return nil, err
+	}
+
+	for _, contact := range contacts {
+		object := &carddav.Object{Name: contact.davName(), ETag: utl.ETag(contact.Version), Modified: contact.UpdatedAt}
+		if withCards {
+			object.Card = contact.toVCard()
+			object.Card.Photo = vCardPhoto(contact)
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+// uidConflict private function that checks whether another contact of an address book has a card with
+// the UID, contacts not created over CardDAV have a generated one
+func uidConflict(bookId, contactId uint, uid string) (bool, error) {
+	query := DBConnection.Table("contact").Where("address_book_id=? AND id<>? AND deleted_at IS NULL", bookId, contactId)
+	if generated, err := strconv.ParseUint(strings.TrimPrefix(uid, "phonebook-contact-"), 10, 64); err == nil &&
+		strings.HasPrefix(uid, "phonebook-contact-") {
+		query = query.Where("vcard_uid=? OR (vcard_uid='' AND id=?)", uid, generated)
+	} else {
+		query = query.Where("vcard_uid=?", uid)
+	}
+	var count int
+	err := query.Count(&count).Error
+	return count > 0, err
+}
+
+// PutObject public method that saves a card as a contact of an address book the account owns or edits.
+// A new name creates a contact, the name of an existing card replaces the contact's names, phone numbers,
+// emails, addresses and photo with the card's. Significant dates, notes and groups are kept
+func (CardDAVBackend) PutObject(accountId, bookId uint, name string, card *vcard.Card, ifMatch, ifNoneMatch string) (bool, error) {
+	role, err := bookRole(bookId, accountId)
+	if err != nil {
+		return false, err
+	}
+	if role == "" {
+		return false, carddav.ErrNotFound
+	}
+	if !canEdit(role) {
+		return false, carddav.ErrForbidden
+	}
+
+	existing, err := cardDAVContact(bookId, name)
+	if err != nil {
+		return false, err
+	}
+	if (existing == nil && ifMatch != "") ||
+		(existing != nil && ifNoneMatch != "" && utl.ETagMatches(ifNoneMatch, utl.ETag(existing.Version), true)) {
+		return false, carddav.ErrPreconditionFailed
+	}
+
+	var existingId uint
+	if existing != nil {
+		existingId = existing.ID
+	}
+	if card.UID != "" {
+		conflict, err := uidConflict(bookId, existingId, card.UID)
+		if err != nil {
+			return false, err
+		}
+		if conflict {
+			return false, carddav.ErrUIDConflict
+		}
+	}
+
+	contact := contactFromVCard(card)
+	if existing == nil {
+		err = contact.createFromCard(accountId, bookId, name, card.UID)
+	} else {
+		err = contact.replaceFromCard(existing, accountId, card.UID, ifMatch)
+	}
+	if err != nil {
+		return false, err
+	}
+	if existing == nil {
+		existing = contact
+	}
+	savePhotoFromCard(existing, accountId, card.Photo)
+	return existingId == 0, nil
+}
+
+// createFromCard private method that saves the contact of a new card in an address book
+func (contact *Contact) createFromCard(accountId, bookId uint, name, uid string) error {
+	contact.AddressBookID = bookId
+	if errResponse := contact.prepareCreate(accountId, accountRegion(accountId)); errResponse != nil {
+		return cardDAVError(errResponse)
+	}
+	contact.VCardUID, contact.DavName = uid, name
+
+	tx := DBConnection.Begin()
+	err := contact.createInTransaction(tx, accountId)
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	return err
+}
+
+// replaceFromCard private method that overwrites an existing contact with the contact of a card, ifMatch
+// is the If-Match header. The change is recorded in the contact's revisions
+func (contact *Contact) replaceFromCard(existing *Contact, accountId uint, uid, ifMatch string) error {
+	if resp, ok := contact.validateContactData(contactRegion(existing.ID)); !ok {
+		return cardDAVError(resp)
+	}
+	// a card without phone numbers or emails clears them
+	if contact.Phones == nil {
+		contact.Phones = []ContactPhone{}
+	}
+	if contact.Emails == nil {
+		contact.Emails = []ContactEmail{}
+	}
+
+	columns := map[string]interface{}{"first_name": contact.FirstName, "last_name": contact.LastName,
+		"phone_number": contact.PhoneNumber, "email": contact.Email, "updated_at": time.Now()}
+	if uid != "" && uid != fmt.Sprintf("phonebook-contact-%d", existing.ID) {
+		columns["vcard_uid"] = uid
+	}
+
+	var before *contactState
+	tx := DBConnection.Begin()
+	err := lockVersion(tx, existing.ID, ifMatch)
+	if err == nil {
+		before, err = loadContactState(tx, existing.ID)
+	}
+	if err == nil {
+		err = tx.Table("contact").Where("id=?", existing.ID).UpdateColumns(columns).Error
+	}
+	if err == nil {
+		err = contact.saveChannels(tx, existing.ID)
+	}
+	if err == nil {
+		err = replaceAddresses(tx, existing.ID, contact.Addresses)
+	}
+	if err == nil {
+		err = recordRevision(tx, existing.ID, accountId, RevisionUpdated, before)
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err == errVersionMismatch {
+		return carddav.ErrPreconditionFailed
+	}
+	return err
+}
+
+// savePhotoFromCard private function that brings a contact's photo in line with the photo of a card,
+// failures are only logged since the rest of the card has been saved. The thumbnail embedded in the
+// cards the server sends is not uploaded again when a client sends it back unchanged
+func savePhotoFromCard(contact *Contact, accountId uint, cardPhoto *vcard.Photo) {
+	var response map[string]interface{}
+	switch {
+	case cardPhoto == nil || len(cardPhoto.Data) == 0:
+		if contact.PhotoID == "" {
+			return
+		}
+		response = contact.DeletePhoto(contact.ID, accountId, "")
+	default:
+		if current := vCardPhoto(contact); current != nil && bytes.Equal(current.Data, cardPhoto.Data) {
+			return
+		}
+		response = contact.UploadPhoto(contact.ID, accountId, cardPhoto.Data, "")
+	}
+	if response["response_code"].(int32) != 0 {
+		log.Printf("WARNING | The photo of contact: %d was not saved from its vCard: %v\n", contact.ID,
+			response["response_description"])
+	}
+}
+
+// DeleteObject public method that moves the contact behind a card to the trash, ifMatch is the If-Match header
+func (CardDAVBackend) DeleteObject(accountId, bookId uint, name, ifMatch string) error {
+	role, err := bookRole(bookId, accountId)
+	if err != nil {
+		return err
+	}
+	if role == "" {
+		return carddav.ErrNotFound
+	}
+	if !canEdit(role) {
+		return carddav.ErrForbidden
+	}
+	existing, err := cardDAVContact(bookId, name)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return carddav.ErrNotFound
+	}
+
+	tx := DBConnection.Begin()
+	err = lockVersion(tx, existing.ID, ifMatch)
+	if err == nil {
+		err = deleteInTransaction(tx, existing.ID, accountId)
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err == errVersionMismatch {
+		return carddav.ErrPreconditionFailed
+	}
+	return err
+}
@@ -1,7 +1,10 @@
 package models
 
 import (
+	"errors"
+	"fmt"
 	"github.com/badoux/checkmail"
+	"github.com/cermu/Go-phoneBook-API/phonenumber"
 	utl "github.com/cermu/Go-phoneBook-API/utils"
 	"github.com/jinzhu/gorm"
 	"log"
@@ -13,45 +16,107 @@ type Contact struct {
 	gorm.Model         // fields `ID`, `CreatedAt`, `UpdatedAt`, `DeletedAt`will be added
 	FirstName   string `gorm:"size:15" json:"first_name"`
 	LastName    string `gorm:"size:15" json:"last_name"`
-	PhoneNumber string `gorm:"type:varchar(15);not null" json:"phone_number"`
+	PhoneNumber string `gorm:"type:varchar(16);not null" json:"phone_number"` // E.164, e.g. +254712345678
 	Email       string `gorm:"size:255;not null" json:"email"`
-	AccountID   uint   `gorm:"not null" json:"account_id"` // this is a foreign_key from the account table
+	AccountID   uint   `gorm:"not null" json:"account_id"` // foreign_key from the account table, the account that added it
+
+	// the address book the contact belongs to, the account's personal book when none is chosen
+	AddressBookID uint `gorm:"index:idx_contact_address_book" json:"address_book_id"`
+
+	// incremented on every change of the contact and returned as its ETag. Clients can not set
+	// it directly, they pass it back in If-Match
+	Version uint `gorm:"not null;default:1" json:"version"`
+
+	// country, line type and mobile network of the primary phone number, looked up in the
+	// bundled numbering plans whenever the number is saved. Clients can not set them directly
+	PhoneCountry  string `gorm:"size:2" json:"phone_country"`
+	PhoneLineType string `gorm:"size:16" json:"phone_line_type"`
+	PhoneNetwork  string `gorm:"size:30" json:"phone_network"`
+
+	// set on contacts that were merged away into another contact, see MergeContacts
+	MergedIntoID *uint `json:"merged_into_id,omitempty"`
+
+	// the UID and resource name a CardDAV client gave the contact's vCard when it created it, contacts
+	// created otherwise are served as {id}.vcf with a generated UID. Clients can not set them directly
+	VCardUID string `gorm:"column:vcard_uid;size:255;default:''" json:"-"`
+	DavName  string `gorm:"column:dav_name;size:255;default:''" json:"-"`
+
+	// labeled phone numbers and emails, PhoneNumber and Email mirror the primary entries
+	Phones []ContactPhone `gorm:"ForeignKey:ContactID" json:"phones"`
+	Emails []ContactEmail `gorm:"ForeignKey:ContactID" json:"emails"`
+
+	// postal addresses, managed through the /contact/{contactId}/addresses endpoints
+	Addresses []ContactAddress `gorm:"ForeignKey:ContactID" json:"addresses"`
+
+	// birthday, anniversary and custom labeled dates
+	Dates []ContactDate `gorm:"ForeignKey:ContactID" json:"dates"`
+
+	// the photo renditions live in the photo storage, see UploadPhoto. Photo holds their URLs
+	PhotoID   string            `gorm:"size:16" json:"-"`
+	PhotoType string            `gorm:"size:20" json:"-"`
+	Photo     map[string]string `gorm:"-" json:"photo,omitempty"`
+
+	// phoneInput is the phone_number as typed in an update, kept as the primary entry's raw_number.
+	// phoneLine is the parsed primary number, nil when the primary number was removed
+	phoneInput string
+	phoneLine  *phonenumber.Number
 }
 
-// CreateContact public method that allows a user/account to create/save a contact
-func (contact *Contact) CreateContact(accountId uint) map[string]interface{} {
-	// check for empty data
-	if contact.PhoneNumber == "" || contact.Email == "" {
-		return utl.Message(102, "the following fields are required: phone_number and email")
-	}
+// preloadContactDetails private function that makes a contact query load the
+// contact's phone numbers, emails, addresses and dates
+func preloadContactDetails(query *gorm.DB) *gorm.DB {
+	return query.Preload("Phones").Preload("Emails").Preload("Addresses").Preload("Dates")
+}
 
-	// validate email
-	if err := checkmail.ValidateFormat(contact.Email); err != nil {
-		return utl.Message(102, "email address is not valid")
+// validateContactData private method used to validate and normalize contact details
+// before they are saved, it is shared by every path that creates contacts. National phone
+// numbers are read in the region passed, the account's default region
+func (contact *Contact) validateContactData(region string) (map[string]interface{}, bool) {
+	// names should fit in their columns
+	if len(contact.FirstName) > 15 || len(contact.LastName) > 15 {
+		return utl.Message(102, "first_name and last_name should not be more than 15 characters"), false
 	}
 
-	// validate phone number
-	// should not be less than 9 digits and more than 12 chars
-	// accepted: 0712345678, 254712345678, 712345678
-	// store: 712345678
-	if len(contact.PhoneNumber) > 12 || len(contact.PhoneNumber) < 9 {
-		return utl.Message(102, "enter a valid phone number, between 9 to 12 digits.")
+	// phone_number and email are folded into the phones and emails lists
+	contact.adoptSingleValues()
+	if len(contact.Phones) == 0 && len(contact.Emails) == 0 {
+		return utl.Message(102, "at least one phone number or email is required"), false
 	}
 
-	if strings.HasPrefix(contact.PhoneNumber, "254") {
-		phoneNumber_ := contact.PhoneNumber[3:len(contact.PhoneNumber)]
-		contact.PhoneNumber = phoneNumber_
+	if resp, ok := contact.validatePhones(region); !ok {
+		return resp, false
+	}
+	if resp, ok := contact.validateEmails(); !ok {
+		return resp, false
+	}
+	for i := range contact.Addresses {
+		contact.Addresses[i].ID, contact.Addresses[i].ContactID = 0, 0
+		if resp, ok := contact.Addresses[i].validateAddress(); !ok {
+			return resp, false
+		}
+	}
+	if resp, ok := contact.validateDates(); !ok {
+		return resp, false
 	}
+	return utl.Message(0, "contact data validated successfully"), true
+}
 
-	if strings.HasPrefix(contact.PhoneNumber, "0") {
-		phoneNumber_ := contact.PhoneNumber[1:len(contact.PhoneNumber)]
-		contact.PhoneNumber = phoneNumber_
+// CreateContact public method that allows a user/account to create/save a contact in one of
+// the address books it edits, its personal book when address_book_id is not passed
+func (contact *Contact) CreateContact(accountId uint) map[string]interface{} {
+	if errResponse := contact.prepareCreate(accountId, accountRegion(accountId)); errResponse != nil {
+		return errResponse
 	}
 
 	// save the contact in DB
-	contact.AccountID = accountId
-	DBConnection.Table("contact").Create(contact)
-	if contact.ID <= 0 {
+	tx := DBConnection.Begin()
+	err := contact.createInTransaction(tx, accountId)
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil || contact.ID <= 0 {
 		return utl.Message(105, "failed to save contact, tyr again")
 	}
 
@@ -60,28 +125,156 @@ func (contact *Contact) CreateContact(accountId uint) map[string]interface{} {
 	return response
 }
 
-// FetchContactsByAccountId public method that fetches contacts belonging to a specified account
-func (contact *Contact) FetchContactsByAccountId(accountId uint) map[string]interface{} {
-	// query contact table by account_id
+// prepareCreate private method that checks the address book and validates a new contact, the
+// columns maintained by the server are reset. It returns the error response of an invalid contact
+func (contact *Contact) prepareCreate(accountId uint, region string) map[string]interface{} {
+	bookId, errResponse := writableBook(contact.AddressBookID, accountId)
+	if errResponse != nil {
+		return errResponse
+	}
+	if resp, ok := contact.validateContactData(region); !ok {
+		return resp
+	}
+
+	contact.ID, contact.Version = 0, 1
+	contact.AccountID, contact.AddressBookID = accountId, bookId
+	contact.MergedIntoID = nil
+	return nil
+}
+
+// createInTransaction private method that saves a validated contact together with its first revision
+func (contact *Contact) createInTransaction(tx *gorm.DB, accountId uint) error {
+	if err := tx.Table("contact").Create(contact).Error; err != nil {
+		return err
+	}
+	return recordRevision(tx, contact.ID, accountId, RevisionCreated, nil)
+}
+
+// errVersionMismatch is returned when a contact changed since the client fetched it
+var errVersionMismatch = errors.New("contact version does not match")
+
+// versionConflict private function that returns the response to a change made on an outdated contact
+func versionConflict() map[string]interface{} {
+	return utl.Message(107, "the contact has been changed since it was fetched, fetch it again and retry")
+}
+
+// lockVersion private function that locks a contact's row until the end of the transaction and checks
+// it still has the version the client expects, ifMatch is an If-Match header. Nothing is checked without it
+func lockVersion(tx *gorm.DB, contactId uint, ifMatch string) error {
+	if ifMatch == "" {
+		return nil
+	}
+	current := &Contact{}
+	err := tx.Table("contact").Set("gorm:query_option", "FOR UPDATE").Select("id, version").
+		Where("id=?", contactId).First(current).Error
+	if err != nil {
+		return err
+	}
+	if !utl.ETagMatches(ifMatch, utl.ETag(current.Version), false) {
+		return errVersionMismatch
+	}
+	return nil
+}
+
+// bumpVersion private function that increments a contact's version after a change
+func bumpVersion(tx *gorm.DB, contactId uint) error {
+	return tx.Table("contact").Where("id=?", contactId).UpdateColumn("version", gorm.Expr("version + 1")).Error
+}
+
+// FetchContactsByAccountId public method that fetches the contacts of the address books an account
+// is a member of, or of one of them when address_book_id is passed. Results are returned a page at
+// a time, next_cursor is used to request the following page
+func (contact *Contact) FetchContactsByAccountId(accountId uint, options *ContactListOptions) map[string]interface{} {
+	if err := options.normalize(); err != nil {
+		return utl.Message(102, err.Error())
+	}
+
+	column := contactSortColumns[options.SortBy]
+	query := DBConnection.Table("contact").Where("address_book_id IN (?)", accountBooks(accountId))
+
+	// restrict the listing to one address book
+	if options.AddressBookID != 0 {
+		query = query.Where("address_book_id=?", options.AddressBookID)
+	}
+
+	// restrict the listing to contacts with an address in a city and/or country
+	if options.City != "" || options.Country != "" {
+		query = query.Where("id IN (?)", addressFilter(options.City, options.Country))
+	}
+
+	// restrict the listing by the primary phone number's country, line type and/or network
+	if options.PhoneCountry != "" {
+		query = query.Where("phone_country=?", options.PhoneCountry)
+	}
+	if options.LineType != "" {
+		query = query.Where("phone_line_type=?", options.LineType)
+	}
+	if options.Network != "" {
+		query = query.Where("LOWER(phone_network)=LOWER(?)", options.Network)
+	}
+
+	// restrict the listing to members of a group
+	if options.GroupID != 0 {
+		query = query.Where("id IN (?)", DBConnection.Table("contact_group_member").
+			Select("contact_id").Where("group_id=?", options.GroupID).SubQuery())
+	}
+
+	// keyset pagination, continue from the last record of the previous page
+	if options.Cursor != "" {
+		value, lastId, err := decodeCursor(options)
+		if err != nil {
+			return utl.Message(102, err.Error())
+		}
+
+		comparison := ">"
+		if options.Order == "desc" {
+			comparison = "<"
+		}
+		query = query.Where(fmt.Sprintf("(%s, id) %s (?, ?)", column, comparison), value, lastId)
+	}
+
+	// query contact table by address_book_id
+	// one extra record is fetched to find out whether there is a next page
 	contacts := make([]*Contact, 0) // results will be stored in a slice of type Contact pointer
-	err := DBConnection.Table("contact").Where("account_id=?", accountId).Find(&contacts).Error
+	err := preloadContactDetails(query).
+		Order(fmt.Sprintf("%s %s, id %s", column, options.Order, options.Order)).
+		Limit(options.Limit + 1).Find(&contacts).Error
 	if err != nil {
 		log.Printf("WARNING | An error occurred while fetching contacts for account: %d. Error: %v\n",
 			accountId, err.Error())
 		return utl.Message(105, "failed to fetch contacts, try again later")
 	}
 
+	nextCursor := ""
+	if len(contacts) > options.Limit {
+		contacts = contacts[:options.Limit]
+		nextCursor = encodeCursor(options, contacts[len(contacts)-1])
+	}
+
 	// return the results
 	response := utl.Message(0, "contacts fetched successfully")
 	response["data"] = contacts
+	response["limit"] = options.Limit
+	response["next_cursor"] = nextCursor
 	return response
 }
 
-// FetchContactById public method that fetches a contact by its id passed in the URI
-func (contact *Contact) FetchContactById(contactId uint) map[string]interface{} {
+// FetchContactById public method that fetches a contact by its id passed in the URI. Contacts
+// shared with the account are fetched too, permission tells how the account can use the contact
+func (contact *Contact) FetchContactById(contactId, accountId uint) map[string]interface{} {
+	existing, access, err := fetchAccessibleContact(contactId, accountId)
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching contact from the DB: %v\n", err.Error())
+		return utl.Message(105, "failed to fetch contact, try again later.")
+	}
+	if existing == nil {
+		return utl.Message(104, "contact not found")
+	}
+
 	// fetch contact from DB
 	result := &Contact{}
-	err := DBConnection.Table("contact").Where("id=?", contactId).First(result).Error
+	err = preloadContactDetails(DBConnection.Table("contact")).Where("id=?", contactId).
+		First(result).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return utl.Message(104, "contact not found")
@@ -90,65 +283,193 @@ func (contact *Contact) FetchContactById(contactId uint) map[string]interface{}
 		return utl.Message(105, "failed to fetch contact, try again later.")
 	}
 
+	result.Photo = photoURLs(result)
+
 	// return results
 	response := utl.Message(0, "contact fetched successfully")
 	response["data"] = result
+	response["permission"] = access
 	return response
 }
 
-// UpdateContact public method that is called to make updates to an existing contact record
-func (contact *Contact) UpdateContact(contactId uint) map[string]interface{} {
-	// validate email
-	if contact.Email != "" {
-		if err := checkmail.ValidateFormat(contact.Email); err != nil {
-			return utl.Message(102, "email address is not valid")
+// UpdateContact public method that is called to make updates to an existing contact record.
+// When phones or emails are passed they replace the contact's lists, a phone_number or email
+// passed on its own replaces the primary entry. Dates, when passed, replace the contact's dates.
+// Owners and editors of the contact's address book and accounts it is shared with read_write can
+// update it, address_book_id moves it to another address book the account edits. ifMatch is the
+// If-Match header, the update is refused when the contact's version does not match it
+func (contact *Contact) UpdateContact(contactId, accountId uint, ifMatch string) map[string]interface{} {
+	if errResponse := contact.prepareUpdate(contactId, accountId); errResponse != nil {
+		return errResponse
+	}
+
+	// update contact record together with its phone numbers, emails and dates
+	tx := DBConnection.Begin()
+	err := lockVersion(tx, contactId, ifMatch)
+	if err == nil {
+		err = contact.updateInTransaction(tx, contactId, accountId)
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err == errVersionMismatch {
+		return versionConflict()
+	}
+	if err != nil {
+		log.Printf("WARNING | An error occurred while updating contact: %v\n", err.Error())
+		return utl.Message(105, "failed to update contact, try again later")
+	}
+
+	// fetch and return updated contact
+	result := &Contact{}
+	preloadContactDetails(DBConnection.Table("contact")).First(result, contactId)
+	response := utl.Message(0, "contact updated successfully")
+	response["data"] = result
+	return response
+}
+
+// prepareUpdate private method that checks the account can update a contact and validates the
+// changes. It returns the error response of a rejected update
+func (contact *Contact) prepareUpdate(contactId, accountId uint) map[string]interface{} {
+	existing, access, err := fetchAccessibleContact(contactId, accountId)
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching contact from the DB: %v\n", err.Error())
+		return utl.Message(105, "failed to update contact, try again later")
+	}
+	if existing == nil {
+		return utl.Message(104, "contact not found")
+	}
+	if !canEdit(access) {
+		return utl.Message(106, "you can only view this contact")
+	}
+	if contact.AddressBookID != 0 && contact.AddressBookID != existing.AddressBookID {
+		if access == ShareReadWrite {
+			return utl.Message(106, "only members of the contact's address book can move it")
+		}
+		if _, errResponse := writableBook(contact.AddressBookID, accountId); errResponse != nil {
+			return errResponse
 		}
 	}
 
-	// validate phone number
-	// should not be less than 9 digits and more than 12 chars
-	// accepted: 0712345678, 254712345678, 712345678
-	// store: 712345678
-	if contact.PhoneNumber != "" {
-		if len(contact.PhoneNumber) > 12 || len(contact.PhoneNumber) < 9 {
-			return utl.Message(102, "enter a valid phone number, between 9 to 12 digits.")
+	// names should fit in their columns
+	if len(contact.FirstName) > 15 || len(contact.LastName) > 15 {
+		return utl.Message(102, "first_name and last_name should not be more than 15 characters")
+	}
+
+	// validate phone numbers
+	if contact.Phones != nil {
+		if resp, ok := contact.validatePhones(contactRegion(contactId)); !ok {
+			return resp
 		}
+	} else if contact.PhoneNumber != "" {
+		number, resp, ok := normalizePhone(contact.PhoneNumber, contactRegion(contactId))
+		if !ok {
+			return resp
+		}
+		contact.phoneInput = strings.TrimSpace(contact.PhoneNumber)
+		contact.PhoneNumber = number.E164()
+		contact.phoneLine = number
+	}
 
-		if strings.HasPrefix(contact.PhoneNumber, "254") {
-			phoneNumber_ := contact.PhoneNumber[3:len(contact.PhoneNumber)]
-			contact.PhoneNumber = phoneNumber_
+	// validate emails
+	if contact.Emails != nil {
+		if resp, ok := contact.validateEmails(); !ok {
+			return resp
+		}
+	} else if contact.Email != "" {
+		if err := checkmail.ValidateFormat(contact.Email); err != nil {
+			return utl.Message(102, "email address is not valid")
 		}
+	}
 
-		if strings.HasPrefix(contact.PhoneNumber, "0") {
-			phoneNumber_ := contact.PhoneNumber[1:len(contact.PhoneNumber)]
-			contact.PhoneNumber = phoneNumber_
+	// validate significant dates
+	if contact.Dates != nil {
+		if resp, ok := contact.validateDates(); !ok {
+			return resp
 		}
 	}
+	return nil
+}
 
-	// update contact record
-	err := DBConnection.Table("contact").Model(contact).Where("id=?", contactId).Updates(contact).Error
+// updateInTransaction private method that writes a validated update of a contact together with
+// its phone numbers, emails and dates, the change is recorded in the contact's revisions
+func (contact *Contact) updateInTransaction(tx *gorm.DB, contactId, accountId uint) error {
+	before, err := loadContactState(tx, contactId)
 	if err != nil {
-		log.Printf("WARNING | An error occurred while updating contact: %v\n", err.Error())
-		return utl.Message(105, "failed to update contact, try again later")
+		return err
+	}
+	err = tx.Table("contact").Model(contact).Where("id=?", contactId).Set("gorm:save_associations", false).
+		Omit("account_id", "merged_into_id", "phone_country", "phone_line_type", "phone_network", "version").
+		Updates(contact).Error
+	if err != nil {
+		return err
+	}
+	if err := contact.saveChannels(tx, contactId); err != nil {
+		return err
+	}
+	if err := contact.saveDates(tx, contactId); err != nil {
+		return err
 	}
+	return recordRevision(tx, contactId, accountId, RevisionUpdated, before)
+}
 
-	// fetch and return updated contact
-	DBConnection.Table("contact").First(contact, contactId)
-	response := utl.Message(0, "contact updated successfully")
-	response["data"] = contact
-	return response
+// DeleteContact public method to remove a contact record from database, only owners and
+// editors of the contact's address book can delete it. ifMatch is the If-Match header, the contact
+// is only deleted when its version matches it
+func (contact *Contact) DeleteContact(contactId, accountId uint, ifMatch string) map[string]interface{} {
+	if errResponse := prepareDelete(contactId, accountId); errResponse != nil {
+		return errResponse
+	}
+
+	tx := DBConnection.Begin()
+	err := lockVersion(tx, contactId, ifMatch)
+	if err == nil {
+		err = deleteInTransaction(tx, contactId, accountId)
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err == errVersionMismatch {
+		return versionConflict()
+	}
+	if err != nil {
+		log.Printf("WARNING | An error has occurred while deleting contact: %v\n", err.Error())
+		return utl.Message(105, "failed to delete contact, try again later")
+	}
+	return utl.Message(0, "contact deleted successfully")
 }
 
-// DeleteContact public method to remove a contact record from database
-func (contact *Contact) DeleteContact(contactId uint) map[string]interface{} {
+// prepareDelete private function that checks the account can delete a contact, it returns the
+// error response when it can not
+func prepareDelete(contactId, accountId uint) map[string]interface{} {
+	existing, err := fetchAccountContact(contactId, accountId)
+	if err != nil {
+		log.Printf("WARNING | An error has occurred while deleting contact: %v\n", err.Error())
+		return utl.Message(105, "failed to delete contact, try again later")
+	}
+	if existing == nil {
+		return utl.Message(104, "contact not found")
+	}
+	return nil
+}
+
+// deleteInTransaction private function that moves a contact to the trash and records it in the contact's revisions
+func deleteInTransaction(tx *gorm.DB, contactId, accountId uint) error {
+	before, err := loadContactState(tx, contactId)
+	if err != nil {
+		return err
+	}
+
 	/*
 		Soft delete a record if there is a DeletedAt column. the column will only be updated with the deletion time.
 		For permanent deletion, add `.Unscoped()` before .Delete()
 	*/
-	err := DBConnection.Table("contact").Where("id=?", contactId).Delete(contact).Error
-	if err != nil {
-		log.Printf("WARNING | An error has occurred while deleting contact: %v\n", err.Error())
-		return utl.Message(105, "failed to delete contact, try again later")
+	if err := tx.Table("contact").Where("id=?", contactId).Delete(&Contact{}).Error; err != nil {
+		return err
 	}
-	return utl.Message(0, "contact deleted successfully")
+	return recordRevision(tx, contactId, accountId, RevisionDeleted, before)
 }
@@ -0,0 +1,248 @@
+package models
+
+import (
+	"fmt"
+	"github.com/badoux/checkmail"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"github.com/jinzhu/gorm"
+	"log"
+	"strings"
+)
+
+// channelLabels are the labels a phone number or email can carry
+var channelLabels = []string{"mobile", "home", "work", "other"}
+
+// ContactPhone struct to store a contact's labeled phone numbers.
+// Contact has many ContactPhones, ContactID is the foreign key
+type ContactPhone struct {
+	gorm.Model        // fields `ID`, `CreatedAt`, `UpdatedAt`, `DeletedAt`will be added
+	ContactID  uint   `gorm:"not null;index:idx_contact_phone_contact" json:"contact_id"`
+	Label      string `gorm:"size:10;not null" json:"label"`
+	Number     string `gorm:"type:varchar(16);not null" json:"number"` // E.164, e.g. +254712345678
+	RawNumber  string `gorm:"size:40" json:"raw_number"`               // the number as it was typed, for display
+	Country    string `gorm:"size:2" json:"country"`                   // read only, from the numbering plans
+	LineType   string `gorm:"size:16" json:"line_type"`                // read only, e.g. mobile or toll_free
+	Network    string `gorm:"size:30" json:"network"`                  // read only, e.g. Safaricom
+	Primary    bool   `gorm:"column:is_primary;default:false" json:"primary"`
+}
+
+// ContactEmail struct to store a contact's labeled email addresses.
+// Contact has many ContactEmails, ContactID is the foreign key
+type ContactEmail struct {
+	gorm.Model        // fields `ID`, `CreatedAt`, `UpdatedAt`, `DeletedAt`will be added
+	ContactID  uint   `gorm:"not null;index:idx_contact_email_contact" json:"contact_id"`
+	Label      string `gorm:"size:10;not null" json:"label"`
+	Address    string `gorm:"size:255;not null" json:"address"`
+	Primary    bool   `gorm:"column:is_primary;default:false" json:"primary"`
+}
+
+// contactChannelMigrations copies the single phone_number and email of contacts created before
+// labeled phone numbers and emails existed into the new tables, it is safe to run repeatedly
+var contactChannelMigrations = []string{
+	`INSERT INTO contact_phone (contact_id, label, number, is_primary, created_at, updated_at)
+	SELECT c.id, 'mobile', c.phone_number, true, now(), now() FROM contact c
+	WHERE c.phone_number <> '' AND NOT EXISTS (SELECT 1 FROM contact_phone p WHERE p.contact_id = c.id)`,
+	`INSERT INTO contact_email (contact_id, label, address, is_primary, created_at, updated_at)
+	SELECT c.id, 'other', c.email, true, now(), now() FROM contact c
+	WHERE c.email <> '' AND NOT EXISTS (SELECT 1 FROM contact_email e WHERE e.contact_id = c.id)`,
+	// duplicate detection joins contacts on any of their phone numbers and emails
+	`CREATE INDEX IF NOT EXISTS idx_contact_phone_number ON contact_phone (number) WHERE deleted_at IS NULL`,
+	`CREATE INDEX IF NOT EXISTS idx_contact_email_address ON contact_email (lower(address)) WHERE deleted_at IS NULL`,
+}
+
+// migrateContactChannels private function that backfills the contact_phone and contact_email tables
+func migrateContactChannels() {
+	for _, statement := range contactChannelMigrations {
+		if err := DBConnection.Exec(statement).Error; err != nil {
+			log.Printf("WARNING | Contact phones/emails migration failed with message: %v\n", err.Error())
+			return
+		}
+	}
+}
+
+// adoptSingleValues private method that turns a phone_number/email passed without
+// phones/emails lists into the primary entries of those lists
+func (contact *Contact) adoptSingleValues() {
+	if len(contact.Phones) == 0 && contact.PhoneNumber != "" {
+		contact.Phones = []ContactPhone{{Label: "mobile", Number: contact.PhoneNumber, Primary: true}}
+	}
+	if len(contact.Emails) == 0 && contact.Email != "" {
+		contact.Emails = []ContactEmail{{Label: "other", Address: contact.Email, Primary: true}}
+	}
+}
+
+// validateLabel private function that defaults and checks a phone/email label
+func validateLabel(label, fallback string) (string, bool) {
+	label = strings.ToLower(strings.TrimSpace(label))
+	if label == "" {
+		return fallback, true
+	}
+	return label, stringInSlice(label, channelLabels)
+}
+
+// validatePhones private method that validates and normalizes a contact's phone numbers to E.164,
+// makes sure exactly one of them is primary and mirrors the primary number in PhoneNumber.
+// National numbers are read in the region passed, the original input is kept in RawNumber
+func (contact *Contact) validatePhones(region string) (map[string]interface{}, bool) {
+	primary := -1
+	for i := range contact.Phones {
+		phone := &contact.Phones[i]
+		phone.ID, phone.ContactID = 0, 0
+
+		label, ok := validateLabel(phone.Label, "mobile")
+		if !ok {
+			return utl.Message(102, "phone label should be one of: "+strings.Join(channelLabels, ", ")), false
+		}
+		phone.Label = label
+
+		number, resp, ok := normalizePhone(phone.Number, region)
+		if !ok {
+			return resp, false
+		}
+		phone.RawNumber = strings.TrimSpace(phone.Number)
+		phone.Number = number.E164()
+		info := number.Lookup()
+		phone.Country, phone.LineType, phone.Network = number.Region, info.LineType, info.Network
+
+		if phone.Primary {
+			if primary >= 0 {
+				return utl.Message(102, "only one phone number can be primary"), false
+			}
+			primary = i
+		}
+	}
+
+	contact.PhoneNumber = ""
+	contact.PhoneCountry, contact.PhoneLineType, contact.PhoneNetwork = "", "", ""
+	if len(contact.Phones) > 0 {
+		if primary < 0 {
+			primary = 0
+			contact.Phones[0].Primary = true
+		}
+		phone := contact.Phones[primary]
+		contact.PhoneNumber = phone.Number
+		contact.PhoneCountry, contact.PhoneLineType, contact.PhoneNetwork = phone.Country, phone.LineType, phone.Network
+	}
+	return utl.Message(0, "phone numbers validated successfully"), true
+}
+
+// validateEmails private method that validates a contact's emails, makes sure exactly
+// one of them is primary and mirrors the primary address in Email
+func (contact *Contact) validateEmails() (map[string]interface{}, bool) {
+	primary := -1
+	for i := range contact.Emails {
+		email := &contact.Emails[i]
+		email.ID, email.ContactID = 0, 0
+
+		label, ok := validateLabel(email.Label, "other")
+		if !ok {
+			return utl.Message(102, "email label should be one of: "+strings.Join(channelLabels, ", ")), false
+		}
+		email.Label = label
+
+		email.Address = strings.TrimSpace(email.Address)
+		if err := checkmail.ValidateFormat(email.Address); err != nil {
+			return utl.Message(102, fmt.Sprintf("email address %q is not valid", email.Address)), false
+		}
+
+		if email.Primary {
+			if primary >= 0 {
+				return utl.Message(102, "only one email can be primary"), false
+			}
+			primary = i
+		}
+	}
+
+	contact.Email = ""
+	if len(contact.Emails) > 0 {
+		if primary < 0 {
+			primary = 0
+			contact.Emails[0].Primary = true
+		}
+		contact.Email = contact.Emails[primary].Address
+	}
+	return utl.Message(0, "emails validated successfully"), true
+}
+
+// saveChannels private method that writes the phone numbers and emails passed in an update.
+// Lists replace the existing entries, a lone phone_number/email replaces the primary entry
+func (contact *Contact) saveChannels(tx *gorm.DB, contactId uint) error {
+	if contact.Phones != nil {
+		if err := tx.Unscoped().Where("contact_id=?", contactId).Delete(&ContactPhone{}).Error; err != nil {
+			return err
+		}
+		for i := range contact.Phones {
+			contact.Phones[i].ContactID = contactId
+			if err := tx.Create(&contact.Phones[i]).Error; err != nil {
+				return err
+			}
+		}
+		// an empty list clears the mirrored column as well
+		if len(contact.Phones) == 0 {
+			if err := tx.Table("contact").Where("id=?", contactId).UpdateColumn("phone_number", "").Error; err != nil {
+				return err
+			}
+		}
+		columns := map[string]interface{}{"phone_country": contact.PhoneCountry,
+			"phone_line_type": contact.PhoneLineType, "phone_network": contact.PhoneNetwork}
+		if err := tx.Table("contact").Where("id=?", contactId).UpdateColumns(columns).Error; err != nil {
+			return err
+		}
+	} else if contact.PhoneNumber != "" {
+		values := phoneLineColumns(contact.phoneLine, "")
+		values["number"], values["raw_number"] = contact.PhoneNumber, contact.phoneInput
+		if err := replacePrimary(tx, &ContactPhone{ContactID: contactId, Label: "mobile", Number: contact.PhoneNumber,
+			RawNumber: contact.phoneInput, Country: values["country"].(string), LineType: values["line_type"].(string),
+			Network: values["network"].(string), Primary: true}, values); err != nil {
+			return err
+		}
+		if err := tx.Table("contact").Where("id=?", contactId).
+			UpdateColumns(phoneLineColumns(contact.phoneLine, "phone_")).Error; err != nil {
+			return err
+		}
+	}
+
+	if contact.Emails != nil {
+		if err := tx.Unscoped().Where("contact_id=?", contactId).Delete(&ContactEmail{}).Error; err != nil {
+			return err
+		}
+		for i := range contact.Emails {
+			contact.Emails[i].ContactID = contactId
+			if err := tx.Create(&contact.Emails[i]).Error; err != nil {
+				return err
+			}
+		}
+		if len(contact.Emails) == 0 {
+			if err := tx.Table("contact").Where("id=?", contactId).UpdateColumn("email", "").Error; err != nil {
+				return err
+			}
+		}
+	} else if contact.Email != "" {
+		if err := replacePrimary(tx, &ContactEmail{ContactID: contactId, Label: "other",
+			Address: contact.Email, Primary: true}, map[string]interface{}{"address": contact.Email}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replacePrimary private function that updates the values of a contact's primary phone/email,
+// the entry is created when the contact has none
+func replacePrimary(tx *gorm.DB, entry interface{}, values map[string]interface{}) error {
+	var contactId uint
+	switch channel := entry.(type) {
+	case *ContactPhone:
+		contactId = channel.ContactID
+	case *ContactEmail:
+		contactId = channel.ContactID
+	}
+
+	result := tx.Model(entry).Where("contact_id=? AND is_primary=?", contactId, true).Updates(values)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return tx.Create(entry).Error
+	}
+	return nil
+}
@@ -0,0 +1,332 @@
+package models
+
+import (
+	"encoding/csv"
+	"fmt"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"github.com/jinzhu/gorm"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// csvFields are the contact fields that can be imported from and exported to CSV. phone_numbers and
+// emails list every phone number and email of a contact with its label, the primary one first
+var csvFields = []string{"first_name", "last_name", "phone_number", "email", "phone_numbers", "emails"}
+
+// csvListSeparator separates the values of a phone_numbers or emails cell, the separator Google uses
+const csvListSeparator = " ::: "
+
+// csvFormulaPrefixes are the characters that make a spreadsheet treat a cell as a formula, a leading
+// tab or carriage return is skipped by some spreadsheets before they look for one of the others
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// csvHeaderAliases maps the column headers used by Google Contacts, Outlook and common
+// spreadsheets to contact fields. Headers are compared in lower case
+var csvHeaderAliases = map[string]string{
+	"first_name":       "first_name",
+	"first name":       "first_name",
+	"firstname":        "first_name",
+	"given name":       "first_name",
+	"last_name":        "last_name",
+	"last name":        "last_name",
+	"lastname":         "last_name",
+	"family name":      "last_name",
+	"surname":          "last_name",
+	"name":             "full_name",
+	"full name":        "full_name",
+	"display name":     "full_name",
+	"phone_number":     "phone_number",
+	"phone number":     "phone_number",
+	"phone":            "phone_number",
+	"mobile":           "phone_number",
+	"mobile phone":     "phone_number",
+	"primary phone":    "phone_number",
+	"phone 1 - value":  "phone_number",
+	"home phone":       "phone_number",
+	"business phone":   "phone_number",
+	"email":            "email",
+	"e-mail":           "email",
+	"email address":    "email",
+	"e-mail address":   "email",
+	"e-mail 1 - value": "email",
+	"email 1 - value":  "email",
+	"phone_numbers":    "phone_numbers",
+	"phone numbers":    "phone_numbers",
+	"emails":           "emails",
+}
+
+// CSVImportOptions struct used to carry the options of a CSV import
+type CSVImportOptions struct {
+	Mapping map[string]string // column header to contact field, overrides the built in aliases
+	DryRun  bool              // validate only, nothing is saved
+
+	// address book the contacts are saved in, the account's personal book when 0
+	AddressBookID uint
+}
+
+// ImportRowResult struct reports the outcome of a single CSV row. Row is the spreadsheet
+// row number, the header being row 1
+type ImportRowResult struct {
+	Row       int    `json:"row"`
+	Status    string `json:"status"` // imported, valid (dry run) or rejected
+	Reason    string `json:"reason,omitempty"`
+	ContactID uint   `json:"contact_id,omitempty"`
+}
+
+// csvColumns private function that works out which column feeds which contact field
+func csvColumns(header []string, mapping map[string]string) (map[string][]int, error) {
+	custom := make(map[string]string, len(mapping))
+	for column, field := range mapping {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field != "full_name" && !stringInSlice(field, csvFields) {
+			return nil, fmt.Errorf("unknown field %q in mapping, use one of: %s, full_name", field,
+				strings.Join(csvFields, ", "))
+		}
+		custom[strings.ToLower(strings.TrimSpace(column))] = field
+	}
+
+	columns := make(map[string][]int)
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		field, ok := custom[column]
+		if !ok {
+			field, ok = csvHeaderAliases[column]
+		}
+		if ok {
+			columns[field] = append(columns[field], i)
+		}
+	}
+
+	if len(columns["phone_number"]) == 0 && len(columns["email"]) == 0 && len(columns["phone_numbers"]) == 0 &&
+		len(columns["emails"]) == 0 {
+		return nil, fmt.Errorf("could not find a phone_number or email column, pass a mapping")
+	}
+	return columns, nil
+}
+
+// csvValue private function that returns the first non empty value of a field in a row.
+// Google exports several values in one cell separated by " ::: ", the first one is used
+func csvValue(record []string, columns map[string][]int, field string) string {
+	for _, i := range columns[field] {
+		if i < len(record) {
+			value := strings.TrimSpace(strings.Split(record[i], ":::")[0])
+			if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(csvFormulaPrefixes, rune(value[1])) {
+				value = value[1:] // escaped by ExportContactsCSV
+			}
+			if value != "" {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// csvList private function that reads the labeled values of a phone_numbers or emails cell, e.g.
+// "+254712345678 (mobile) ::: +254202222222 (work)". The label is optional
+func csvList(record []string, columns map[string][]int, field string) [][2]string {
+	values := make([][2]string, 0)
+	for _, i := range columns[field] {
+		if i >= len(record) {
+			continue
+		}
+		cell := strings.TrimSpace(record[i])
+		if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune(csvFormulaPrefixes, rune(cell[1])) {
+			cell = cell[1:] // escaped by ExportContactsCSV
+		}
+		for _, item := range strings.Split(cell, strings.TrimSpace(csvListSeparator)) {
+			value, label := strings.TrimSpace(item), ""
+			if open := strings.LastIndex(value, " ("); open > 0 && strings.HasSuffix(value, ")") {
+				value, label = strings.TrimSpace(value[:open]), value[open+2:len(value)-1]
+			}
+			if value != "" {
+				values = append(values, [2]string{value, label})
+			}
+		}
+	}
+	return values
+}
+
+// ImportCSV public function that imports contacts from a CSV file. Every row goes through the same
+// validation as CreateContact and the valid rows are saved in one transaction unless it is a dry run
+func ImportCSV(accountId uint, r io.Reader, options *CSVImportOptions) map[string]interface{} {
+	bookId, errResponse := writableBook(options.AddressBookID, accountId)
+	if errResponse != nil {
+		return errResponse
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return utl.Message(102, "failed to read the uploaded file, it should be a CSV file with a header row")
+	}
+	columns, columnsErr := csvColumns(header, options.Mapping)
+	if columnsErr != nil {
+		return utl.Message(102, columnsErr.Error())
+	}
+
+	region := accountRegion(accountId)
+	results := make([]*ImportRowResult, 0)
+	contacts := make(map[*ImportRowResult]*Contact)
+	for row := 2; ; row++ {
+		record, readErr := reader.Read()
+		if readErr == io.EOF {
+			break
+		}
+		result := &ImportRowResult{Row: row}
+		results = append(results, result)
+		if readErr != nil {
+			result.Status, result.Reason = "rejected", "row could not be read"
+			continue
+		}
+
+		contact := &Contact{
+			FirstName:   csvValue(record, columns, "first_name"),
+			LastName:    csvValue(record, columns, "last_name"),
+			PhoneNumber: csvValue(record, columns, "phone_number"),
+			Email:       csvValue(record, columns, "email"),
+		}
+		// the lists keep every phone number and email, the first value is the primary one
+		for i, phone := range csvList(record, columns, "phone_numbers") {
+			contact.Phones = append(contact.Phones, ContactPhone{Number: phone[0], Label: phone[1], Primary: i == 0})
+		}
+		for i, email := range csvList(record, columns, "emails") {
+			contact.Emails = append(contact.Emails, ContactEmail{Address: email[0], Label: email[1], Primary: i == 0})
+		}
+		if contact.FirstName == "" && contact.LastName == "" {
+			names := strings.SplitN(csvValue(record, columns, "full_name"), " ", 2)
+			contact.FirstName = names[0]
+			if len(names) > 1 {
+				contact.LastName = strings.TrimSpace(names[1])
+			}
+		}
+
+		if resp, ok := contact.validateContactData(region); !ok {
+			result.Status, result.Reason = "rejected", resp["response_description"].(string)
+			continue
+		}
+		result.Status = "valid"
+		contact.AccountID, contact.AddressBookID = accountId, bookId
+		contacts[result] = contact
+	}
+	if len(results) == 0 {
+		return utl.Message(102, "the uploaded file does not contain any rows")
+	}
+
+	if !options.DryRun {
+		// save the valid rows, all or nothing
+		tx := DBConnection.Begin()
+		for _, result := range results {
+			contact, ok := contacts[result]
+			if !ok {
+				continue
+			}
+			createErr := tx.Table("contact").Create(contact).Error
+			if createErr == nil {
+				createErr = recordRevision(tx, contact.ID, accountId, RevisionCreated, nil)
+			}
+			if createErr != nil {
+				tx.Rollback()
+				log.Printf("WARNING | An error occurred while saving CSV import: %v\n", createErr.Error())
+				return utl.Message(105, "failed to import contacts, try again later")
+			}
+			result.Status, result.ContactID = "imported", contact.ID
+		}
+		if commitErr := tx.Commit().Error; commitErr != nil {
+			log.Printf("WARNING | An error occurred while saving CSV import: %v\n", commitErr.Error())
+			return utl.Message(105, "failed to import contacts, try again later")
+		}
+	}
+
+	message := "contacts imported successfully"
+	if options.DryRun {
+		message = "dry run completed, no contacts were saved"
+	}
+	response := utl.Message(0, message)
+	response["valid"] = len(contacts)
+	response["rejected"] = len(results) - len(contacts)
+	response["rows"] = results
+	return response
+}
+
+// ExportContactsCSV public function that streams the contacts of an account's address books as a CSV file.
+// It returns a response message when the export could not be started, nil once the file has been streamed
+func ExportContactsCSV(accountId uint, w http.ResponseWriter) map[string]interface{} {
+	var writer *csv.Writer
+	var last *Contact
+	for {
+		page := make([]*Contact, 0, exportPageSize)
+		query := DBConnection.Table("contact").Preload("Phones", orderChannels).Preload("Emails", orderChannels).
+			Where("address_book_id IN (?) AND deleted_at IS NULL", accountBooks(accountId))
+		if last != nil {
+			query = query.Where("(coalesce(first_name, ''), coalesce(last_name, ''), id) > (?, ?, ?)",
+				last.FirstName, last.LastName, last.ID)
+		}
+		err := query.Order("coalesce(first_name, ''), coalesce(last_name, ''), id").Limit(exportPageSize).Find(&page).Error
+		if err != nil {
+			log.Printf("WARNING | An error occurred while exporting contacts for account: %d. Error: %v\n",
+				accountId, err.Error())
+			if last == nil {
+				return utl.Message(105, "failed to export contacts, try again later")
+			}
+			break
+		}
+		if last == nil {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="contacts.csv"`)
+			writer = csv.NewWriter(w)
+			_ = writer.Write(csvFields)
+		}
+
+		for _, contact := range page {
+			phones := make([]string, 0, len(contact.Phones))
+			for _, phone := range contact.Phones {
+				phones = append(phones, phone.Number+" ("+phone.Label+")")
+			}
+			emails := make([]string, 0, len(contact.Emails))
+			for _, email := range contact.Emails {
+				emails = append(emails, email.Address+" ("+email.Label+")")
+			}
+			_ = writer.Write([]string{csvCell(contact.FirstName), csvCell(contact.LastName),
+				csvCell(contact.PhoneNumber), csvCell(contact.Email), csvCell(strings.Join(phones, csvListSeparator)),
+				csvCell(strings.Join(emails, csvListSeparator))})
+		}
+		if len(page) < exportPageSize {
+			break
+		}
+		last = page[len(page)-1]
+	}
+	writer.Flush()
+	if writer.Error() != nil {
+		log.Printf("WARNING | An error occurred while streaming CSV export: %v\n", writer.Error().Error())
+	}
+	return nil
+}
+
+// orderChannels private function that loads a contact's phone numbers or emails primary first
+func orderChannels(db *gorm.DB) *gorm.DB {
+	return db.Order("is_primary DESC, id")
+}
+
+// csvCell private function that escapes a value a spreadsheet would run as a formula, e.g. =HYPERLINK(...),
+// by prefixing it with a quote. Phone numbers in E.164 start with + and are escaped too
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune(csvFormulaPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// stringInSlice private function that checks if a slice contains a string
+func stringInSlice(value string, slice []string) bool {
+	for _, item := range slice {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
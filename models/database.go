@@ -39,10 +39,77 @@ func InitDB() {
 // Our models will be translated to database tables
 func MigrateDB () {
 	log.Println("INFO | Running database migrations ...")
-	DBConnection.Debug().AutoMigrate(Account{}, Contact{})
+	DBConnection.Debug().AutoMigrate(Account{}, Contact{}, Group{}, GroupMember{}, ContactPhone{}, ContactEmail{},
+		ContactAddress{}, ContactDate{}, ContactNote{}, ContactNoteVersion{}, ContactShare{}, AddressBook{},
+		AddressBookMember{}, AddressBookInvitation{}, ContactRevision{}, AppPassword{}, ContactUsage{})
+
+	// move existing contacts into personal address books
+	migrateAddressBooks()
+
+	// move stars and usage statistics into the per account table
+	migrateContactUsage()
 	// DBConnection.Debug().AUtoMigrate(...)
 
 	// migrating foreign keys
 	DBConnection.Model(&Contact{}).AddForeignKey("account_id", "account(id)", "CASCADE", "CASCADE")
+	DBConnection.Model(&Group{}).AddForeignKey("account_id", "account(id)", "CASCADE", "CASCADE")
+	DBConnection.Model(&GroupMember{}).AddForeignKey("group_id", "contact_group(id)", "CASCADE", "CASCADE")
+	DBConnection.Model(&GroupMember{}).AddForeignKey("contact_id", "contact(id)", "CASCADE", "CASCADE")
+	DBConnection.Model(&ContactPhone{}).AddForeignKey("contact_id", "contact(id)", "CASCADE", "CASCADE")
+	DBConnection.Model(&ContactEmail{}).AddForeignKey("contact_id", "contact(id)", "CASCADE", "CASCADE")
+	DBConnection.Model(&ContactAddress{}).AddForeignKey("contact_id", "contact(id)", "CASCADE", "CASCADE")
+	DBConnection.Model(&ContactDate{}).AddForeignKey("contact_id", "contact(id)", "CASCADE", "CASCADE")
+	DBConnection.Model(&ContactNote{}).AddForeignKey("contact_id", "contact(id)", "CASCADE", "CASCADE")
+	DBConnection.Model(&ContactNoteVersion{}).AddForeignKey("note_id", "contact_note(id)", "CASCADE", "CASCADE")
+	DBConnection.Model(&ContactShare{}).AddForeignKey("contact_id", "contact(id)", "CASCADE", "CASCADE")
+	DBConnection.Model(&ContactShare{}).AddForeignKey("owner_id", "account(id)", "CASCADE", "CASCADE")
+	DBConnection.Model(&ContactShare{}).AddForeignKey("grantee_id", "account(id)", "CASCADE", "CASCADE")
+	DBConnection.Model(&AddressBook{}).AddForeignKey("owner_id", "account(id)", "CASCADE", "CASCADE")
+	DBConnection.Model(&AddressBookMember{}).AddForeignKey("address_book_id", "address_book(id)", "CASCADE", "CASCADE")
+	DBConnection.Model(&AddressBookMember{}).AddForeignKey("account_id", "account(id)", "CASCADE", "CASCADE")
+	DBConnection.Model(&AddressBookInvitation{}).AddForeignKey("address_book_id", "address_book(id)", "CASCADE", "CASCADE")
+	DBConnection.Model(&AddressBookInvitation{}).AddForeignKey("inviter_id", "account(id)", "CASCADE", "CASCADE")
+	DBConnection.Model(&AddressBookInvitation{}).AddForeignKey("invitee_id", "account(id)", "CASCADE", "CASCADE")
+	DBConnection.Model(&Contact{}).AddForeignKey("address_book_id", "address_book(id)", "CASCADE", "CASCADE")
+	DBConnection.Model(&ContactRevision{}).AddForeignKey("contact_id", "contact(id)", "CASCADE", "CASCADE")
+	DBConnection.Model(&ContactRevision{}).AddForeignKey("account_id", "account(id)", "SET NULL", "CASCADE")
+	DBConnection.Model(&AppPassword{}).AddForeignKey("account_id", "account(id)", "CASCADE", "CASCADE")
+	DBConnection.Model(&ContactUsage{}).AddForeignKey("account_id", "account(id)", "CASCADE", "CASCADE")
+	DBConnection.Model(&ContactUsage{}).AddForeignKey("contact_id", "contact(id)", "CASCADE", "CASCADE")
+
+	// indexes backing the sorted and paginated contact listing
+	DBConnection.Model(&Contact{}).AddIndex("idx_contact_account_first_name", "account_id", "first_name", "id")
+	DBConnection.Model(&Contact{}).AddIndex("idx_contact_account_last_name", "account_id", "last_name", "id")
+	DBConnection.Model(&Contact{}).AddIndex("idx_contact_account_created_at", "account_id", "created_at", "id")
+	DBConnection.Model(&Contact{}).AddIndex("idx_contact_account_updated_at", "account_id", "updated_at", "id")
+	DBConnection.Model(&Contact{}).AddIndex("idx_contact_account_phone_country", "account_id", "phone_country")
+	DBConnection.Model(&Contact{}).AddIndex("idx_contact_account_phone_line_type", "account_id", "phone_line_type")
+	DBConnection.Model(&Contact{}).AddIndex("idx_contact_account_phone_network", "account_id", "phone_network")
+	DBConnection.Model(&Contact{}).AddIndex("idx_contact_book_first_name", "address_book_id", "first_name", "id")
+	DBConnection.Model(&Contact{}).AddIndex("idx_contact_book_last_name", "address_book_id", "last_name", "id")
+	DBConnection.Model(&Contact{}).AddIndex("idx_contact_book_created_at", "address_book_id", "created_at", "id")
+	DBConnection.Model(&Contact{}).AddIndex("idx_contact_book_updated_at", "address_book_id", "updated_at", "id")
+
+	// full text search columns, triggers and GIN indexes
+	migrateContactSearch()
+	migrateContactNoteSearch()
+
+	// trigram indexes for typo tolerant search
+	migrateContactTrigram()
+
+	// move single phone numbers and emails into the labeled tables
+	migrateContactChannels()
+
+	// convert phone numbers stored in the old Kenyan format to E.164
+	migrateContactPhoneNumbers()
+
+	// look up the country, line type and network of numbers saved before they were recorded
+	migrateContactPhoneLines()
+
+	// stamp contact changes with their transaction ids for the delta sync
+	migrateContactSync()
+
+	// unique card names and UID lookups for CardDAV clients
+	migrateCardDAV()
 	log.Println("INFO | Database migrations completed")
 }
@@ -0,0 +1,441 @@
+package models
+
+import (
+	"fmt"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"github.com/jinzhu/gorm"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DuplicateCluster struct holds contacts that are likely the same person
+type DuplicateCluster struct {
+	Reasons  []string   `json:"reasons"` // phone_number, email and/or name
+	Contacts []*Contact `json:"contacts"`
+}
+
+// MergeContacts struct to fetch merge instructions from json request.
+// Fields maps a contact field to the id of the contact whose value should be kept,
+// fields that are not listed keep the survivor's value, or the first non empty value
+// of the merged contacts when the survivor has none
+type MergeContacts struct {
+	SurvivorID uint            `json:"survivor_id"`
+	ContactIDs []uint          `json:"contact_ids"`
+	Fields     map[string]uint `json:"fields"`
+}
+
+// mergeableFields are the contact fields a merge can pick values for
+var mergeableFields = []string{"first_name", "last_name", "phone_number", "email"}
+
+// duplicatePair private struct holding two contacts that matched on a reason
+type duplicatePair struct {
+	A, B   uint
+	Reason string
+}
+
+// unionFind private struct used to group matching pairs into clusters
+type unionFind map[uint]uint
+
+// find private method that returns the root of an id's cluster
+func (uf unionFind) find(id uint) uint {
+	if _, ok := uf[id]; !ok {
+		uf[id] = id
+	}
+	for uf[id] != id {
+		uf[id] = uf[uf[id]]
+		id = uf[id]
+	}
+	return id
+}
+
+// union private method that puts two ids in the same cluster
+func (uf unionFind) union(a, b uint) {
+	rootA, rootB := uf.find(a), uf.find(b)
+	if rootA != rootB {
+		uf[rootB] = rootA
+	}
+}
+
+// duplicatePairs private function that finds pairs of an account's contacts sharing any of their phone
+// numbers or email addresses, or with very similar names
+func duplicatePairs(accountId uint) ([]duplicatePair, error) {
+	threshold := utl.ReadConfigs().GetFloat64("CONTACTS.DUPLICATE_NAME_THRESHOLD")
+	if threshold <= 0 || threshold > 1 {
+		threshold = 0.6
+	}
+
+	tx := DBConnection.Begin()
+	defer tx.Rollback()
+
+	// the % operator reads its threshold from the session, see fuzzySearch
+	if err := tx.Exec("SELECT set_config('pg_trgm.similarity_threshold', ?, true)",
+		fmt.Sprintf("%f", threshold)).Error; err != nil {
+		return nil, err
+	}
+
+	// contacts are only compared with contacts of the same address book
+	books := accountBooks(accountId)
+	// every phone number and email of a contact is compared, not only the primary ones, empty values never match
+	rows, err := tx.Raw(`SELECT DISTINCT a.id, b.id, 'phone_number' FROM contact a
+		JOIN contact_phone pa ON pa.contact_id = a.id AND pa.deleted_at IS NULL AND pa.number <> ''
+		JOIN contact_phone pb ON pb.number = pa.number AND pb.deleted_at IS NULL
+		JOIN contact b ON b.id = pb.contact_id AND a.address_book_id = b.address_book_id AND a.id < b.id
+		WHERE a.address_book_id IN (?) AND a.deleted_at IS NULL AND b.deleted_at IS NULL
+	UNION ALL
+	SELECT DISTINCT a.id, b.id, 'email' FROM contact a
+		JOIN contact_email ea ON ea.contact_id = a.id AND ea.deleted_at IS NULL AND ea.address <> ''
+		JOIN contact_email eb ON lower(eb.address) = lower(ea.address) AND eb.deleted_at IS NULL
+		JOIN contact b ON b.id = eb.contact_id AND a.address_book_id = b.address_book_id AND a.id < b.id
+		WHERE a.address_book_id IN (?) AND a.deleted_at IS NULL AND b.deleted_at IS NULL
+	UNION ALL
+	SELECT a.id, b.id, 'name' FROM contact a JOIN contact b
+		ON a.address_book_id = b.address_book_id AND a.id < b.id
+		AND lower(a.first_name || ' ' || a.last_name) % lower(b.first_name || ' ' || b.last_name)
+		WHERE a.address_book_id IN (?) AND a.deleted_at IS NULL AND b.deleted_at IS NULL
+		AND trim(a.first_name || a.last_name) <> ''`, books, books, books).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pairs := make([]duplicatePair, 0)
+	for rows.Next() {
+		pair := duplicatePair{}
+		if scanErr := rows.Scan(&pair.A, &pair.B, &pair.Reason); scanErr != nil {
+			return nil, scanErr
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, rows.Err()
+}
+
+// FindDuplicates public function that clusters an account's contacts that are likely the same person
+func FindDuplicates(accountId uint) map[string]interface{} {
+	pairs, err := duplicatePairs(accountId)
+	if err != nil {
+		log.Printf("WARNING | An error occurred while finding duplicates for account: %d. Error: %v\n",
+			accountId, err.Error())
+		return utl.Message(105, "failed to find duplicate contacts, try again later")
+	}
+
+	uf := make(unionFind)
+	for _, pair := range pairs {
+		uf.union(pair.A, pair.B)
+	}
+
+	// collect the members and reasons of each cluster
+	members := make(map[uint][]uint)
+	reasons := make(map[uint]map[string]bool)
+	ids := make([]uint, 0, len(uf))
+	for id := range uf {
+		root := uf.find(id)
+		members[root] = append(members[root], id)
+		ids = append(ids, id)
+	}
+	for _, pair := range pairs {
+		root := uf.find(pair.A)
+		if reasons[root] == nil {
+			reasons[root] = make(map[string]bool)
+		}
+		reasons[root][pair.Reason] = true
+	}
+
+	contacts := make([]*Contact, 0)
+	if len(ids) > 0 {
+		if err := DBConnection.Table("contact").Where("id IN (?)", ids).Order("id").Find(&contacts).Error; err != nil {
+			log.Printf("WARNING | An error occurred while fetching duplicate contacts: %v\n", err.Error())
+			return utl.Message(105, "failed to find duplicate contacts, try again later")
+		}
+	}
+	byId := make(map[uint]*Contact, len(contacts))
+	for _, contact := range contacts {
+		byId[contact.ID] = contact
+	}
+
+	clusters := make([]*DuplicateCluster, 0, len(members))
+	for root, memberIds := range members {
+		cluster := &DuplicateCluster{Reasons: make([]string, 0)}
+		for reason := range reasons[root] {
+			cluster.Reasons = append(cluster.Reasons, reason)
+		}
+		sort.Strings(cluster.Reasons)
+		sort.Slice(memberIds, func(i, j int) bool { return memberIds[i] < memberIds[j] })
+		for _, id := range memberIds {
+			if contact, ok := byId[id]; ok {
+				cluster.Contacts = append(cluster.Contacts, contact)
+			}
+		}
+		clusters = append(clusters, cluster)
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].Contacts[0].ID < clusters[j].Contacts[0].ID })
+
+	response := utl.Message(0, "duplicate contacts fetched successfully")
+	response["data"] = clusters
+	return response
+}
+
+// addressKey compares addresses regardless of case and of the label they carry
+const addressKey = "lower(concat_ws('|', street, city, region, postal_code, country))"
+
+// dateKey compares birthdays and anniversaries by kind only, custom dates by label and day
+const dateKey = "CASE WHEN kind = 'custom' THEN concat_ws('|', kind, lower(label), month, day) ELSE kind END"
+
+// contactField private function that returns the value of a mergeable field
+func contactField(contact *Contact, field string) string {
+	switch field {
+	case "first_name":
+		return contact.FirstName
+	case "last_name":
+		return contact.LastName
+	case "phone_number":
+		return contact.PhoneNumber
+	case "email":
+		return contact.Email
+	}
+	return ""
+}
+
+// MergeContacts public method that combines contacts into a survivor. The survivor takes the chosen
+// field values, and the phone numbers, emails, addresses, dates, notes, photo, group memberships and
+// usage of the merged contacts it does not have yet. The merged contacts are then soft deleted with
+// merged_into_id pointing at the survivor
+func (merge *MergeContacts) MergeContacts(accountId uint) map[string]interface{} {
+	merged := uniqueIds(merge.ContactIDs)
+	if merge.SurvivorID == 0 || len(merged) == 0 {
+		return utl.Message(102, "the following fields are required: survivor_id and contact_ids")
+	}
+	for _, id := range merged {
+		if id == merge.SurvivorID {
+			return utl.Message(102, "survivor_id should not be part of contact_ids")
+		}
+	}
+
+	for field := range merge.Fields {
+		if !stringInSlice(field, mergeableFields) {
+			return utl.Message(102, "fields can only contain: "+strings.Join(mergeableFields, ", "))
+		}
+	}
+
+	contacts := make([]*Contact, 0)
+	err := DBConnection.Table("contact").Where("address_book_id IN (?) AND id IN (?)", accountBooks(accountId),
+		append([]uint{merge.SurvivorID}, merged...)).Order("id").Find(&contacts).Error
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching contacts to merge: %v\n", err.Error())
+		return utl.Message(105, "failed to merge contacts, try again later")
+	}
+	if len(contacts) != len(merged)+1 {
+		return utl.Message(104, "one or more contacts were not found")
+	}
+
+	byId := make(map[uint]*Contact, len(contacts))
+	for _, contact := range contacts {
+		byId[contact.ID] = contact
+	}
+	survivor := byId[merge.SurvivorID]
+
+	// merged contacts should all be in the survivor's address book, which the account edits
+	for _, contact := range contacts {
+		if contact.AddressBookID != survivor.AddressBookID {
+			return utl.Message(102, "only contacts of the same address book can be merged")
+		}
+	}
+	if _, errResponse := writableBook(survivor.AddressBookID, accountId); errResponse != nil {
+		return errResponse
+	}
+
+	// pick the value of every field
+	values := make(map[string]interface{})
+	for _, field := range mergeableFields {
+		if sourceId, ok := merge.Fields[field]; ok {
+			source, found := byId[sourceId]
+			if !found {
+				return utl.Message(102, fmt.Sprintf("the value of %s should come from one of the merged contacts", field))
+			}
+			values[field] = contactField(source, field)
+			continue
+		}
+		if contactField(survivor, field) == "" {
+			for _, id := range merged {
+				if value := contactField(byId[id], field); value != "" {
+					values[field] = value
+					break
+				}
+			}
+		}
+	}
+
+	// the phone number's country, line type and network come along with it
+	if number, ok := values["phone_number"].(string); ok {
+		for _, contact := range contacts {
+			if contact.PhoneNumber == number {
+				values["phone_country"], values["phone_line_type"], values["phone_network"] =
+					contact.PhoneCountry, contact.PhoneLineType, contact.PhoneNetwork
+				break
+			}
+		}
+	}
+
+	// a survivor without a photo takes the photo of the oldest merged contact that has one, its renditions
+	// are copied since they are stored under the contact. The merged contact's renditions go with it
+	// when it is purged from the trash
+	var photoSource *Contact
+	if survivor.PhotoID == "" {
+		for _, id := range merged {
+			if byId[id].PhotoID != "" {
+				photoSource = byId[id]
+				break
+			}
+		}
+	}
+	if photoSource != nil {
+		if err := copyPhotoBlobs(photoSource.ID, survivor.ID, photoSource.PhotoID, photoSource.PhotoType); err != nil {
+			log.Printf("WARNING | An error occurred while copying photo of contact: %d. Error: %v\n",
+				photoSource.ID, err.Error())
+			return utl.Message(105, "failed to merge contacts, try again later")
+		}
+		values["photo_id"], values["photo_type"] = photoSource.PhotoID, photoSource.PhotoType
+	}
+
+	tx := DBConnection.Begin()
+	err = mergeInTransaction(tx, accountId, survivor, merged, values)
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		if photoSource != nil {
+			deletePhotoBlobs(survivor.ID, photoSource.PhotoID, photoSource.PhotoType)
+		}
+		log.Printf("WARNING | An error occurred while merging contacts: %v\n", err.Error())
+		return utl.Message(105, "failed to merge contacts, try again later")
+	}
+
+	result := &Contact{}
+	preloadContactDetails(DBConnection.Table("contact")).First(result, survivor.ID)
+	result.Photo = photoURLs(result)
+	response := utl.Message(0, "contacts merged successfully")
+	response["data"] = result
+	return response
+}
+
+// mergeInTransaction private function that applies a merge inside a transaction, the survivor
+// and every merged contact get a revision
+func mergeInTransaction(tx *gorm.DB, accountId uint, survivor *Contact, merged []uint,
+	values map[string]interface{}) error {
+	before := make(map[uint]*contactState, len(merged)+1)
+	for _, id := range append([]uint{survivor.ID}, merged...) {
+		state, err := loadContactState(tx, id)
+		if err != nil {
+			return err
+		}
+		before[id] = state
+	}
+
+	if err := tx.Table("contact").Where("id=?", survivor.ID).Updates(values).Error; err != nil {
+		return err
+	}
+
+	// the survivor joins every group the merged contacts were in
+	if err := tx.Exec(`INSERT INTO contact_group_member (group_id, contact_id, created_at)
+		SELECT group_id, ?, ? FROM contact_group_member WHERE contact_id IN (?)
+		ON CONFLICT DO NOTHING`, survivor.ID, time.Now(), merged).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("contact_id IN (?)", merged).Delete(&GroupMember{}).Error; err != nil {
+		return err
+	}
+
+	// phone numbers and emails the survivor does not have yet are moved over, a number or email several
+	// merged contacts share is moved once, from the oldest entry. The primary entries are then realigned
+	// with the survivor's chosen values
+	if err := tx.Exec(`UPDATE contact_phone SET contact_id = ?, is_primary = false WHERE id IN
+		(SELECT DISTINCT ON (number) id FROM contact_phone
+		WHERE contact_id IN (?) AND deleted_at IS NULL AND number NOT IN
+		(SELECT number FROM contact_phone WHERE contact_id = ? AND deleted_at IS NULL)
+		ORDER BY number, id)`, survivor.ID, merged, survivor.ID).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec(`UPDATE contact_email SET contact_id = ?, is_primary = false WHERE id IN
+		(SELECT DISTINCT ON (lower(address)) id FROM contact_email
+		WHERE contact_id IN (?) AND deleted_at IS NULL AND lower(address) NOT IN
+		(SELECT lower(address) FROM contact_email WHERE contact_id = ? AND deleted_at IS NULL)
+		ORDER BY lower(address), id)`, survivor.ID, merged, survivor.ID).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec(`UPDATE contact_phone SET is_primary = (number = (SELECT phone_number FROM contact WHERE id = ?))
+		WHERE contact_id = ?`, survivor.ID, survivor.ID).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec(`UPDATE contact_email SET is_primary = (address = (SELECT email FROM contact WHERE id = ?))
+		WHERE contact_id = ?`, survivor.ID, survivor.ID).Error; err != nil {
+		return err
+	}
+
+	// addresses the survivor does not have yet are moved over, an address several merged contacts
+	// share is moved once
+	if err := tx.Exec(`UPDATE contact_address SET contact_id = ? WHERE id IN
+		(SELECT DISTINCT ON (`+addressKey+`) id FROM contact_address
+		WHERE contact_id IN (?) AND deleted_at IS NULL AND `+addressKey+` NOT IN
+		(SELECT `+addressKey+` FROM contact_address WHERE contact_id = ? AND deleted_at IS NULL)
+		ORDER BY `+addressKey+`, id)`, survivor.ID, merged, survivor.ID).Error; err != nil {
+		return err
+	}
+
+	// a contact has one birthday and one anniversary, the survivor keeps its own or takes the oldest of the
+	// merged contacts'. Custom dates it does not have yet are moved over
+	if err := tx.Exec(`UPDATE contact_date SET contact_id = ? WHERE id IN
+		(SELECT DISTINCT ON (`+dateKey+`) id FROM contact_date
+		WHERE contact_id IN (?) AND deleted_at IS NULL AND `+dateKey+` NOT IN
+		(SELECT `+dateKey+` FROM contact_date WHERE contact_id = ? AND deleted_at IS NULL)
+		ORDER BY `+dateKey+`, id)`, survivor.ID, merged, survivor.ID).Error; err != nil {
+		return err
+	}
+
+	// every account's stars and usage statistics of the merged contacts are added to the survivor's
+	if err := tx.Exec(`INSERT INTO contact_usage (account_id, contact_id, starred, times_contacted, last_contacted_at,
+		usage_score)
+		SELECT account_id, ?, bool_or(starred), sum(times_contacted), max(last_contacted_at), sum(usage_score)
+		FROM contact_usage WHERE contact_id IN (?) GROUP BY account_id
+		ON CONFLICT (account_id, contact_id) DO UPDATE SET starred = EXCLUDED.starred,
+		times_contacted = EXCLUDED.times_contacted, last_contacted_at = EXCLUDED.last_contacted_at,
+		usage_score = EXCLUDED.usage_score`, survivor.ID, append([]uint{survivor.ID}, merged...)).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("contact_id IN (?)", merged).Delete(&ContactUsage{}).Error; err != nil {
+		return err
+	}
+
+	// notes are kept with their history
+	if err := tx.Table("contact_note").Where("contact_id IN (?)", merged).
+		UpdateColumn("contact_id", survivor.ID).Error; err != nil {
+		return err
+	}
+
+	// accounts the merged contacts were shared with keep seeing the survivor
+	if err := tx.Exec(`INSERT INTO contact_share (contact_id, owner_id, grantee_id, permission, created_at, updated_at)
+		SELECT ?, owner_id, grantee_id, permission, created_at, ? FROM contact_share WHERE contact_id IN (?)
+		ON CONFLICT DO NOTHING`, survivor.ID, time.Now(), merged).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("contact_id IN (?)", merged).Delete(&ContactShare{}).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Table("contact").Where("id IN (?)", merged).
+		Updates(map[string]interface{}{"merged_into_id": survivor.ID, "deleted_at": time.Now()}).Error; err != nil {
+		return err
+	}
+
+	if err := recordRevision(tx, survivor.ID, accountId, RevisionMerged, before[survivor.ID]); err != nil {
+		return err
+	}
+	for _, id := range merged {
+		if err := recordRevision(tx, id, accountId, RevisionMerged, before[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package models
+
+import (
+	"fmt"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"github.com/jinzhu/gorm"
+	"log"
+	"math"
+	"time"
+)
+
+// ContactUsage struct to store how an account uses a contact: whether it starred it and how often it
+// contacted it. Members of a shared address book each keep their own, so it is not part of the contact
+type ContactUsage struct {
+	AccountID       uint       `gorm:"primary_key;auto_increment:false" json:"-"`
+	ContactID       uint       `gorm:"primary_key;auto_increment:false;index:idx_contact_usage_contact" json:"contact_id"`
+	Starred         bool       `gorm:"not null;default:false" json:"starred"`
+	TimesContacted  uint       `gorm:"not null;default:0" json:"times_contacted"`
+	LastContactedAt *time.Time `json:"last_contacted_at"`
+	UsageScore      float64    `gorm:"not null;default:0" json:"-"`
+}
+
+// StarContact struct to fetch the starred flag from json request
+type StarContact struct {
+	Starred bool `json:"starred"`
+}
+
+// Favorite struct is an entry of an account's favorites, a contact together with the account's usage of it
+type Favorite struct {
+	Contact         *Contact   `json:"contact"`
+	Starred         bool       `json:"starred"`
+	TimesContacted  uint       `json:"times_contacted"`
+	LastContactedAt *time.Time `json:"last_contacted_at"`
+}
+
+// contactUsageMigrations move the stars and usage statistics kept on the contact row before
+// address books were shared to the account that added the contact
+var contactUsageMigrations = []string{
+	`DO $$ BEGIN
+		IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'contact' AND column_name = 'starred') THEN
+			INSERT INTO contact_usage (account_id, contact_id, starred, times_contacted, last_contacted_at, usage_score)
+			SELECT account_id, id, starred, times_contacted, last_contacted_at, usage_score FROM contact
+			WHERE starred OR times_contacted > 0
+			ON CONFLICT DO NOTHING;
+			ALTER TABLE contact DROP COLUMN starred, DROP COLUMN times_contacted, DROP COLUMN last_contacted_at,
+			DROP COLUMN usage_score;
+		END IF;
+	END $$`,
+}
+
+// TableName sets the table name of ContactUsage
+func (ContactUsage) TableName() string {
+	return "contact_usage"
+}
+
+// migrateContactUsage private function that moves the usage statistics off the contact table
+func migrateContactUsage() {
+	for _, statement := range contactUsageMigrations {
+		if err := DBConnection.Exec(statement).Error; err != nil {
+			log.Printf("WARNING | Contact usage migration failed with message: %v\n", err.Error())
+			return
+		}
+	}
+}
+
+// usageDecayRate private function that returns the per second decay rate of a contact's usage
+// score, derived from the configured half life so that a touch loses half its weight every
+// CONTACTS.FAVORITES_HALF_LIFE_DAYS days
+func usageDecayRate() float64 {
+	halfLifeDays := utl.ReadConfigs().GetFloat64("CONTACTS.FAVORITES_HALF_LIFE_DAYS")
+	if halfLifeDays <= 0 {
+		halfLifeDays = 14
+	}
+	return math.Ln2 / (halfLifeDays * 24 * 60 * 60)
+}
+
+// decayedUsageScore is the usage score of a contact decayed to the current time
+const decayedUsageScore = "COALESCE(contact_usage.usage_score * " +
+	"exp(-? * extract(epoch FROM (now() - contact_usage.last_contacted_at))), 0)"
+
+// fetchContactUsage private function that loads an account's usage of a contact, zero when it has none
+func fetchContactUsage(contactId, accountId uint) (*ContactUsage, error) {
+	usage := &ContactUsage{}
+	err := DBConnection.Where("account_id=? AND contact_id=?", accountId, contactId).First(usage).Error
+	if err == gorm.ErrRecordNotFound {
+		return &ContactUsage{AccountID: accountId, ContactID: contactId}, nil
+	}
+	return usage, err
+}
+
+// TouchContact public method that records that an account has contacted one of the contacts it can
+// see. The usage score is decayed to the current time before the new touch is added. Only the
+// account's own usage changes, so viewers can touch contacts and the contact's version stays the same
+func (contact *Contact) TouchContact(contactId, accountId uint) map[string]interface{} {
+	if errResponse := contactCheck(contactId, accountId, false); errResponse != nil {
+		return errResponse
+	}
+
+	err := DBConnection.Exec(`INSERT INTO contact_usage
+		(account_id, contact_id, starred, times_contacted, last_contacted_at, usage_score)
+		VALUES (?, ?, false, 1, now(), 1)
+		ON CONFLICT (account_id, contact_id) DO UPDATE SET
+		usage_score = `+decayedUsageScore+` + 1,
+		times_contacted = contact_usage.times_contacted + 1,
+		last_contacted_at = now()`, accountId, contactId, usageDecayRate()).Error
+	if err != nil {
+		log.Printf("WARNING | An error occurred while touching contact: %v\n", err.Error())
+		return utl.Message(105, "failed to record contact usage, try again later")
+	}
+
+	usage, err := fetchContactUsage(contactId, accountId)
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching contact usage: %v\n", err.Error())
+		return utl.Message(105, "failed to record contact usage, try again later")
+	}
+	response := utl.Message(0, "contact usage recorded successfully")
+	response["data"] = usage
+	return response
+}
+
+// SetStarred public method that stars or un-stars one of the contacts an account can see, the star is
+// the account's own and is not shared with the other members of the contact's address book
+func (star *StarContact) SetStarred(contactId, accountId uint) map[string]interface{} {
+	if errResponse := contactCheck(contactId, accountId, false); errResponse != nil {
+		return errResponse
+	}
+
+	err := DBConnection.Exec(`INSERT INTO contact_usage (account_id, contact_id, starred) VALUES (?, ?, ?)
+		ON CONFLICT (account_id, contact_id) DO UPDATE SET starred = EXCLUDED.starred`,
+		accountId, contactId, star.Starred).Error
+	if err != nil {
+		log.Printf("WARNING | An error occurred while starring contact: %v\n", err.Error())
+		return utl.Message(105, "failed to update contact, try again later")
+	}
+
+	usage, err := fetchContactUsage(contactId, accountId)
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching contact usage: %v\n", err.Error())
+		return utl.Message(105, "failed to update contact, try again later")
+	}
+	response := utl.Message(0, "contact updated successfully")
+	response["data"] = usage
+	return response
+}
+
+// FetchFavorites public method that returns an account's starred contacts followed by the
+// contacts it uses most, ranked by their time decayed usage score
+func (contact *Contact) FetchFavorites(accountId uint, limit int) map[string]interface{} {
+	if limit == 0 {
+		limit = defaultPageLimit
+	}
+	if limit < 0 || limit > maxPageLimit {
+		return utl.Message(102, fmt.Sprintf("limit should be between 1 and %d", maxPageLimit))
+	}
+
+	// contacts of books the account left keep their usage but are no longer listed
+	usages := make([]*ContactUsage, 0)
+	err := DBConnection.Table("contact_usage").Select("contact_usage.*").
+		Joins("JOIN contact ON contact.id = contact_usage.contact_id AND contact.deleted_at IS NULL").
+		Where("contact_usage.account_id=? AND contact.address_book_id IN (?)", accountId, accountBooks(accountId)).
+		Where("contact_usage.starred=? OR contact_usage.times_contacted > 0", true).
+		Order(gorm.Expr("contact_usage.starred DESC, "+decayedUsageScore+" DESC, contact.first_name, contact.id",
+			usageDecayRate())).
+		Limit(limit).Find(&usages).Error
+
+	contacts := make([]*Contact, 0)
+	if err == nil && len(usages) > 0 {
+		contactIds := make([]uint, 0, len(usages))
+		for _, usage := range usages {
+			contactIds = append(contactIds, usage.ContactID)
+		}
+		err = DBConnection.Table("contact").Where("id IN (?)", contactIds).Find(&contacts).Error
+	}
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching favorites for account: %d. Error: %v\n",
+			accountId, err.Error())
+		return utl.Message(105, "failed to fetch favorite contacts, try again later")
+	}
+
+	byId := make(map[uint]*Contact, len(contacts))
+	for _, found := range contacts {
+		found.Photo = photoURLs(found)
+		byId[found.ID] = found
+	}
+	favorites := make([]*Favorite, 0, len(usages))
+	for _, usage := range usages {
+		if found, ok := byId[usage.ContactID]; ok {
+			favorites = append(favorites, &Favorite{Contact: found, Starred: usage.Starred,
+				TimesContacted: usage.TimesContacted, LastContactedAt: usage.LastContactedAt})
+		}
+	}
+
+	response := utl.Message(0, "favorite contacts fetched successfully")
+	response["data"] = favorites
+	return response
+}
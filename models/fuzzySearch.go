@@ -0,0 +1,138 @@
+package models
+
+import (
+	"fmt"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"github.com/jinzhu/gorm"
+	"log"
+	"strings"
+)
+
+const maxSuggestions = 5 // number of "did you mean" suggestions returned with fuzzy results
+
+// contactTrigramMigrations holds the statements that enable trigram matching on the contact table
+var contactTrigramMigrations = []string{
+	`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+	`CREATE INDEX IF NOT EXISTS idx_contact_first_name_trgm ON contact USING GIN (lower(first_name) gin_trgm_ops)`,
+	`CREATE INDEX IF NOT EXISTS idx_contact_last_name_trgm ON contact USING GIN (lower(last_name) gin_trgm_ops)`,
+	`CREATE INDEX IF NOT EXISTS idx_contact_full_name_trgm ON contact
+	USING GIN (lower(first_name || ' ' || last_name) gin_trgm_ops)`,
+	// every phone number and email of a contact is matched, not only the primary ones on the contact row
+	`DROP INDEX IF EXISTS idx_contact_email_trgm`,
+	`DROP INDEX IF EXISTS idx_contact_phone_number_trgm`,
+	`CREATE INDEX IF NOT EXISTS idx_contact_email_address_trgm ON contact_email
+	USING GIN (lower(address) gin_trgm_ops) WHERE deleted_at IS NULL`,
+	`CREATE INDEX IF NOT EXISTS idx_contact_phone_trgm ON contact_phone
+	USING GIN (number gin_trgm_ops) WHERE deleted_at IS NULL`,
+}
+
+// fuzzyScore is the similarity of a contact to the search text, the best of its names and emails
+const fuzzyScore = `GREATEST(similarity(lower(first_name), ?), similarity(lower(last_name), ?),
+	similarity(lower(first_name || ' ' || last_name), ?),
+	(SELECT max(similarity(lower(address), ?)) FROM contact_email
+	WHERE contact_email.contact_id = contact.id AND contact_email.deleted_at IS NULL))`
+
+// fuzzyMatch uses the pg_trgm % operator so that the trigram indexes can be used
+const fuzzyMatch = `(lower(first_name) % ? OR lower(last_name) % ? OR
+	lower(first_name || ' ' || last_name) % ? OR contact.id IN (SELECT contact_id FROM contact_email
+	WHERE lower(address) % ? AND deleted_at IS NULL))`
+
+// fuzzyPhoneScore and fuzzyPhoneMatch match digits against any part of any phone number of a contact
+const fuzzyPhoneScore = `(SELECT max(similarity(number, ?)) FROM contact_phone
+	WHERE contact_phone.contact_id = contact.id AND contact_phone.deleted_at IS NULL)`
+
+const fuzzyPhoneMatch = `contact.id IN (SELECT contact_id FROM contact_phone WHERE number LIKE ? AND deleted_at IS NULL)`
+
+// migrateContactTrigram private function that enables pg_trgm and creates the trigram indexes
+func migrateContactTrigram() {
+	for _, statement := range contactTrigramMigrations {
+		if err := DBConnection.Exec(statement).Error; err != nil {
+			log.Printf("WARNING | Contact trigram migration failed with message: %v\n", err.Error())
+			return
+		}
+	}
+}
+
+// fuzzySearch private function that matches contacts by trigram similarity, which tolerates typos.
+// Digit only queries are matched against any part of the stored phone numbers instead
+func fuzzySearch(accountId uint, options *ContactSearchOptions) map[string]interface{} {
+	threshold := options.Threshold
+	if threshold == 0 {
+		threshold = utl.ReadConfigs().GetFloat64("SEARCH.FUZZY_THRESHOLD")
+	}
+	if threshold <= 0 || threshold > 1 {
+		return utl.Message(102, "threshold should be greater than 0 and not more than 1")
+	}
+
+	text := strings.ToLower(strings.Join(strings.Fields(options.Query), " "))
+	digits := strings.NewReplacer(" ", "", "+", "", "-", "").Replace(text)
+
+	// the % operator reads its threshold from the session, set_config with is_local=true
+	// limits the setting to this transaction so pooled connections are not affected
+	tx := DBConnection.Begin()
+	defer tx.Rollback()
+	if err := tx.Exec("SELECT set_config('pg_trgm.similarity_threshold', ?, true)",
+		fmt.Sprintf("%f", threshold)).Error; err != nil {
+		log.Printf("WARNING | An error occurred while setting similarity threshold: %v\n", err.Error())
+		return utl.Message(105, "failed to search contacts, try again later")
+	}
+
+	contacts := make([]*Contact, 0)
+	query := tx.Table("contact").Where("address_book_id IN (?)", accountBooks(accountId))
+	if isDigits(digits) {
+		digits = trimPhonePrefix(digits)
+		if digits == "" {
+			return utl.Message(102, "search query should contain letters or digits")
+		}
+		query = query.Select("contact.*, "+fuzzyPhoneScore+" AS score", digits).
+			Where(fuzzyPhoneMatch, "%"+digits+"%")
+	} else {
+		query = query.Select("contact.*, "+fuzzyScore+" AS score", text, text, text, text).
+			Where(fuzzyMatch, text, text, text, text)
+	}
+
+	err := query.Order("score DESC, id").Limit(options.Limit).Find(&contacts).Error
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fuzzy searching contacts for account: %d. Error: %v\n",
+			accountId, err.Error())
+		return utl.Message(105, "failed to search contacts, try again later")
+	}
+
+	suggestions := make([]string, 0)
+	if !isDigits(digits) {
+		suggestions = searchSuggestions(tx, accountId, text)
+	}
+	tx.Commit()
+
+	response := utl.Message(0, "contacts searched successfully")
+	response["data"] = contacts
+	response["suggestions"] = suggestions
+	return response
+}
+
+// searchSuggestions private function that returns the names in an account's phone book
+// that are closest to the search text, used as "did you mean" hints
+func searchSuggestions(tx *gorm.DB, accountId uint, text string) []string {
+	suggestions := make([]string, 0, maxSuggestions)
+	rows, err := tx.Raw(`SELECT word FROM (
+		SELECT lower(first_name) AS word FROM contact WHERE address_book_id IN (?) AND deleted_at IS NULL
+		UNION SELECT lower(last_name) FROM contact WHERE address_book_id IN (?) AND deleted_at IS NULL
+		UNION SELECT lower(first_name || ' ' || last_name) FROM contact WHERE address_book_id IN (?) AND deleted_at IS NULL
+	) AS words WHERE word <> '' AND word <> ? AND word % ?
+	ORDER BY similarity(word, ?) DESC, word LIMIT ?`,
+		accountBooks(accountId), accountBooks(accountId), accountBooks(accountId), text, text, text,
+		maxSuggestions).Rows()
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching search suggestions: %v\n", err.Error())
+		return suggestions
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var word string
+		if scanErr := rows.Scan(&word); scanErr == nil {
+			suggestions = append(suggestions, word)
+		}
+	}
+	return suggestions
+}
@@ -0,0 +1,250 @@
+package models
+
+import (
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"github.com/jinzhu/gorm"
+	"log"
+	"strings"
+	"time"
+)
+
+// Group struct to store contact groups/labels e.g. Family, Suppliers
+// Account has many Groups, AccountID is the foreign key.
+// Group has many Contacts through the GroupMember join table
+type Group struct {
+	gorm.Model         // fields `ID`, `CreatedAt`, `UpdatedAt`, `DeletedAt`will be added
+	Name        string `gorm:"size:50;not null" json:"name"`
+	Description string `gorm:"size:255" json:"description"`
+	AccountID   uint   `gorm:"not null;index:idx_contact_group_account" json:"account_id"` // foreign_key from the account table
+}
+
+// GroupMember struct is the join table between Group and Contact
+type GroupMember struct {
+	GroupID   uint      `gorm:"primary_key;auto_increment:false" json:"group_id"`
+	ContactID uint      `gorm:"primary_key;auto_increment:false;index:idx_contact_group_member_contact" json:"contact_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GroupMembers struct to fetch contact ids from json request
+type GroupMembers struct {
+	ContactIDs []uint `json:"contact_ids"`
+}
+
+// TableName sets the table name of Group, "group" is a reserved word in SQL
+func (Group) TableName() string {
+	return "contact_group"
+}
+
+// TableName sets the table name of GroupMember
+func (GroupMember) TableName() string {
+	return "contact_group_member"
+}
+
+// fetchAccountGroup private function that fetches a group making sure it belongs to the account
+func fetchAccountGroup(groupId, accountId uint) (*Group, map[string]interface{}) {
+	group := &Group{}
+	err := DBConnection.Where("id=? AND account_id=?", groupId, accountId).First(group).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, utl.Message(104, "group not found")
+		}
+		log.Printf("WARNING | An error occurred while fetching group from the DB: %v\n", err.Error())
+		return nil, utl.Message(105, "failed to fetch group, try again later")
+	}
+	return group, nil
+}
+
+// groupNameTaken private function that checks if an account already has a group with the name
+func groupNameTaken(name string, accountId, excludeId uint) (bool, error) {
+	count := 0
+	err := DBConnection.Model(&Group{}).Where("account_id=? AND lower(name)=lower(?) AND id<>?",
+		accountId, name, excludeId).Count(&count).Error
+	return count > 0, err
+}
+
+// CreateGroup public method that allows an account to create a contact group
+func (group *Group) CreateGroup(accountId uint) map[string]interface{} {
+	group.Name = strings.TrimSpace(group.Name)
+	if group.Name == "" {
+		return utl.Message(102, "the following field is required: name")
+	}
+
+	taken, err := groupNameTaken(group.Name, accountId, 0)
+	if err != nil {
+		log.Printf("WARNING | An error occurred while validating group name: %v\n", err.Error())
+		return utl.Message(105, "failed to validate group name, try again later")
+	}
+	if taken {
+		return utl.Message(101, "a group with that name already exists")
+	}
+
+	group.ID = 0
+	group.AccountID = accountId
+	DBConnection.Create(group)
+	if group.ID <= 0 {
+		return utl.Message(105, "failed to save group, try again")
+	}
+
+	response := utl.Message(0, "group has been created")
+	response["data"] = group
+	return response
+}
+
+// FetchGroupsByAccountId public method that fetches the groups belonging to an account
+func (group *Group) FetchGroupsByAccountId(accountId uint) map[string]interface{} {
+	groups := make([]*Group, 0)
+	err := DBConnection.Where("account_id=?", accountId).Order("name").Find(&groups).Error
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching groups for account: %d. Error: %v\n",
+			accountId, err.Error())
+		return utl.Message(105, "failed to fetch groups, try again later")
+	}
+
+	response := utl.Message(0, "groups fetched successfully")
+	response["data"] = groups
+	return response
+}
+
+// FetchGroupById public method that fetches a group together with its member contacts
+func (group *Group) FetchGroupById(groupId, accountId uint) map[string]interface{} {
+	result, errResponse := fetchAccountGroup(groupId, accountId)
+	if errResponse != nil {
+		return errResponse
+	}
+
+	// members the account lost access to, e.g. after leaving a shared address book, are left out
+	contacts := make([]*Contact, 0)
+	err := DBConnection.Table("contact").
+		Joins("JOIN contact_group_member ON contact_group_member.contact_id = contact.id").
+		Where("contact_group_member.group_id=? AND contact.address_book_id IN (?)", groupId, accountBooks(accountId)).
+		Order("contact.first_name, contact.id").Find(&contacts).Error
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching members of group: %d. Error: %v\n",
+			groupId, err.Error())
+		return utl.Message(105, "failed to fetch group, try again later")
+	}
+
+	response := utl.Message(0, "group fetched successfully")
+	response["data"] = result
+	response["contacts"] = contacts
+	return response
+}
+
+// UpdateGroup public method that is called to rename or describe an existing group
+func (group *Group) UpdateGroup(groupId, accountId uint) map[string]interface{} {
+	existing, errResponse := fetchAccountGroup(groupId, accountId)
+	if errResponse != nil {
+		return errResponse
+	}
+
+	group.Name = strings.TrimSpace(group.Name)
+	if group.Name != "" {
+		taken, err := groupNameTaken(group.Name, accountId, groupId)
+		if err != nil {
+			log.Printf("WARNING | An error occurred while validating group name: %v\n", err.Error())
+			return utl.Message(105, "failed to validate group name, try again later")
+		}
+		if taken {
+			return utl.Message(101, "a group with that name already exists")
+		}
+	}
+
+	err := DBConnection.Model(existing).Updates(Group{Name: group.Name, Description: group.Description}).Error
+	if err != nil {
+		log.Printf("WARNING | An error occurred while updating group: %v\n", err.Error())
+		return utl.Message(105, "failed to update group, try again later")
+	}
+
+	response := utl.Message(0, "group updated successfully")
+	response["data"] = existing
+	return response
+}
+
+// DeleteGroup public method that removes a group, the member contacts are not deleted
+func (group *Group) DeleteGroup(groupId, accountId uint) map[string]interface{} {
+	existing, errResponse := fetchAccountGroup(groupId, accountId)
+	if errResponse != nil {
+		return errResponse
+	}
+
+	tx := DBConnection.Begin()
+	if err := tx.Where("group_id=?", groupId).Delete(&GroupMember{}).Error; err != nil {
+		tx.Rollback()
+		log.Printf("WARNING | An error has occurred while deleting group members: %v\n", err.Error())
+		return utl.Message(105, "failed to delete group, try again later")
+	}
+	if err := tx.Delete(existing).Error; err != nil {
+		tx.Rollback()
+		log.Printf("WARNING | An error has occurred while deleting group: %v\n", err.Error())
+		return utl.Message(105, "failed to delete group, try again later")
+	}
+	if err := tx.Commit().Error; err != nil {
+		log.Printf("WARNING | An error has occurred while deleting group: %v\n", err.Error())
+		return utl.Message(105, "failed to delete group, try again later")
+	}
+	return utl.Message(0, "group deleted successfully")
+}
+
+// AddGroupMembers public method that adds an account's contacts to one of its groups
+func (members *GroupMembers) AddGroupMembers(groupId, accountId uint) map[string]interface{} {
+	if _, errResponse := fetchAccountGroup(groupId, accountId); errResponse != nil {
+		return errResponse
+	}
+	if len(members.ContactIDs) == 0 {
+		return utl.Message(102, "the following field is required: contact_ids")
+	}
+
+	// only contacts of the account's address books can be added
+	ownedIds := make([]uint, 0)
+	err := DBConnection.Table("contact").Where("address_book_id IN (?) AND id IN (?) AND deleted_at IS NULL",
+		accountBooks(accountId), members.ContactIDs).
+		Pluck("id", &ownedIds).Error
+	if err != nil {
+		log.Printf("WARNING | An error occurred while validating group members: %v\n", err.Error())
+		return utl.Message(105, "failed to add contacts to group, try again later")
+	}
+	if len(ownedIds) != len(uniqueIds(members.ContactIDs)) {
+		return utl.Message(104, "one or more contacts were not found")
+	}
+
+	for _, contactId := range ownedIds {
+		insertErr := DBConnection.Exec("INSERT INTO contact_group_member (group_id, contact_id, created_at) "+
+			"VALUES (?, ?, ?) ON CONFLICT DO NOTHING", groupId, contactId, time.Now()).Error
+		if insertErr != nil {
+			log.Printf("WARNING | An error occurred while adding contact to group: %v\n", insertErr.Error())
+			return utl.Message(105, "failed to add contacts to group, try again later")
+		}
+	}
+	return utl.Message(0, "contacts added to group successfully")
+}
+
+// RemoveGroupMembers public method that removes contacts from a group without deleting them
+func (members *GroupMembers) RemoveGroupMembers(groupId, accountId uint) map[string]interface{} {
+	if _, errResponse := fetchAccountGroup(groupId, accountId); errResponse != nil {
+		return errResponse
+	}
+	if len(members.ContactIDs) == 0 {
+		return utl.Message(102, "the following field is required: contact_ids")
+	}
+
+	err := DBConnection.Where("group_id=? AND contact_id IN (?)", groupId, members.ContactIDs).
+		Delete(&GroupMember{}).Error
+	if err != nil {
+		log.Printf("WARNING | An error occurred while removing contacts from group: %v\n", err.Error())
+		return utl.Message(105, "failed to remove contacts from group, try again later")
+	}
+	return utl.Message(0, "contacts removed from group successfully")
+}
+
+// uniqueIds private function that removes duplicate ids from a slice
+func uniqueIds(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
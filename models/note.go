@@ -0,0 +1,282 @@
+package models
+
+import (
+	"fmt"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"github.com/jinzhu/gorm"
+	"log"
+	"strings"
+	"time"
+)
+
+const maxNoteLength = 20000 // bytes of Markdown a single note can hold
+
+// ContactNote struct to store a free-form Markdown note on a contact.
+// Contact has many ContactNotes, ContactID is the foreign key
+type ContactNote struct {
+	gorm.Model        // fields `ID`, `CreatedAt`, `UpdatedAt`, `DeletedAt`will be added
+	ContactID  uint   `gorm:"not null;index:idx_contact_note_contact" json:"contact_id"`
+	Body       string `gorm:"type:text;not null" json:"body"`
+	Version    int    `gorm:"not null;default:1" json:"version"` // the latest entry in the note's history
+}
+
+// ContactNoteVersion struct keeps every text a note has had, the latest one included.
+// ContactNote has many ContactNoteVersions, NoteID is the foreign key
+type ContactNoteVersion struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	NoteID    uint      `gorm:"not null;unique_index:idx_contact_note_version" json:"note_id"`
+	Version   int       `gorm:"not null;unique_index:idx_contact_note_version" json:"version"`
+	Body      string    `gorm:"type:text;not null" json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// contactNoteSearchMigrations holds the statements that maintain the contact_note.search_vector
+// column used by the contact search, in the same way as contact.search_vector
+var contactNoteSearchMigrations = []string{
+	`ALTER TABLE contact_note ADD COLUMN IF NOT EXISTS search_vector tsvector`,
+	`CREATE OR REPLACE FUNCTION contact_note_search_vector_update() RETURNS trigger AS $$
+	BEGIN
+		NEW.search_vector := setweight(to_tsvector('simple', coalesce(NEW.body, '')), 'D');
+		RETURN NEW;
+	END
+	$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS contact_note_search_vector_trigger ON contact_note`,
+	`CREATE TRIGGER contact_note_search_vector_trigger BEFORE INSERT OR UPDATE ON contact_note
+	FOR EACH ROW EXECUTE PROCEDURE contact_note_search_vector_update()`,
+	`UPDATE contact_note SET search_vector = NULL WHERE search_vector IS NULL`,
+	`CREATE INDEX IF NOT EXISTS idx_contact_note_search_vector ON contact_note USING GIN (search_vector)`,
+}
+
+// migrateContactNoteSearch private function that creates the notes full text search column, trigger and index
+func migrateContactNoteSearch() {
+	for _, statement := range contactNoteSearchMigrations {
+		if err := DBConnection.Exec(statement).Error; err != nil {
+			log.Printf("WARNING | Contact note search migration failed with message: %v\n", err.Error())
+			return
+		}
+	}
+}
+
+// validateNote private method that checks a note's body before it is saved
+func (note *ContactNote) validateNote() (map[string]interface{}, bool) {
+	if strings.TrimSpace(note.Body) == "" {
+		return utl.Message(102, "the following field is required: body"), false
+	}
+	if len(note.Body) > maxNoteLength {
+		return utl.Message(102, fmt.Sprintf("a note should not be more than %d characters", maxNoteLength)), false
+	}
+	return utl.Message(0, "note validated successfully"), true
+}
+
+// fetchContactNote private function that loads a note of a contact, nil means it was not found
+func fetchContactNote(noteId, contactId uint) (*ContactNote, error) {
+	note := &ContactNote{}
+	err := DBConnection.Where("id=? AND contact_id=?", noteId, contactId).First(note).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, nil
+	}
+	return note, err
+}
+
+// saveNoteBody private function that writes a new body on a note and records it as the next version.
+// The note row is locked before the version is read so that concurrent saves get consecutive versions
+func saveNoteBody(tx *gorm.DB, note *ContactNote, body string) error {
+	locked := &ContactNote{}
+	err := tx.Set("gorm:query_option", "FOR UPDATE").Select("id, version").Where("id=?", note.ID).First(locked).Error
+	if err != nil {
+		return err
+	}
+	note.Body = body
+	note.Version = locked.Version + 1
+	if err := tx.Model(note).Updates(map[string]interface{}{"body": note.Body, "version": note.Version}).Error; err != nil {
+		return err
+	}
+	return tx.Create(&ContactNoteVersion{NoteID: note.ID, Version: note.Version, Body: body}).Error
+}
+
+// noteFailure private function that logs a failed note query and responds with a generic message
+func noteFailure(action string, err error) map[string]interface{} {
+	log.Printf("WARNING | An error occurred while trying to %s note: %v\n", action, err.Error())
+	return utl.Message(105, fmt.Sprintf("failed to %s note, try again later", action))
+}
+
+// FetchNotes public method that lists the notes of one of an account's contacts, latest first
+func (note *ContactNote) FetchNotes(contactId, accountId uint) map[string]interface{} {
+	if errResponse := contactCheck(contactId, accountId, false); errResponse != nil {
+		return errResponse
+	}
+
+	notes := make([]*ContactNote, 0)
+	if err := DBConnection.Where("contact_id=?", contactId).Order("updated_at DESC, id DESC").Find(&notes).Error; err != nil {
+		return noteFailure("fetch", err)
+	}
+
+	response := utl.Message(0, "notes fetched successfully")
+	response["data"] = notes
+	return response
+}
+
+// FetchNote public method that returns a single note of a contact
+func (note *ContactNote) FetchNote(noteId, contactId, accountId uint) map[string]interface{} {
+	if errResponse := contactCheck(contactId, accountId, false); errResponse != nil {
+		return errResponse
+	}
+
+	found, err := fetchContactNote(noteId, contactId)
+	if err != nil {
+		return noteFailure("fetch", err)
+	}
+	if found == nil {
+		return utl.Message(104, "note not found")
+	}
+
+	response := utl.Message(0, "note fetched successfully")
+	response["data"] = found
+	return response
+}
+
+// CreateNote public method that adds a note to one of an account's contacts, the body is the note's first version
+func (note *ContactNote) CreateNote(contactId, accountId uint) map[string]interface{} {
+	if errResponse := contactCheck(contactId, accountId, true); errResponse != nil {
+		return errResponse
+	}
+	if resp, ok := note.validateNote(); !ok {
+		return resp
+	}
+
+	note.ID = 0
+	note.ContactID = contactId
+	note.Version = 1
+	tx := DBConnection.Begin()
+	if err := tx.Create(note).Error; err != nil {
+		tx.Rollback()
+		return noteFailure("save", err)
+	}
+	if err := tx.Create(&ContactNoteVersion{NoteID: note.ID, Version: 1, Body: note.Body}).Error; err != nil {
+		tx.Rollback()
+		return noteFailure("save", err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return noteFailure("save", err)
+	}
+
+	response := utl.Message(0, "note has been created")
+	response["data"] = note
+	return response
+}
+
+// UpdateNote public method that replaces the body of a note, the previous body stays in the note's history
+func (note *ContactNote) UpdateNote(noteId, contactId, accountId uint) map[string]interface{} {
+	if errResponse := contactCheck(contactId, accountId, true); errResponse != nil {
+		return errResponse
+	}
+	if resp, ok := note.validateNote(); !ok {
+		return resp
+	}
+
+	existing, err := fetchContactNote(noteId, contactId)
+	if err != nil {
+		return noteFailure("update", err)
+	}
+	if existing == nil {
+		return utl.Message(104, "note not found")
+	}
+	if existing.Body == note.Body {
+		response := utl.Message(0, "note updated successfully")
+		response["data"] = existing
+		return response
+	}
+
+	tx := DBConnection.Begin()
+	if err := saveNoteBody(tx, existing, note.Body); err != nil {
+		tx.Rollback()
+		return noteFailure("update", err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return noteFailure("update", err)
+	}
+
+	response := utl.Message(0, "note updated successfully")
+	response["data"] = existing
+	return response
+}
+
+// DeleteNote public method that removes a note from a contact
+func (note *ContactNote) DeleteNote(noteId, contactId, accountId uint) map[string]interface{} {
+	if errResponse := contactCheck(contactId, accountId, true); errResponse != nil {
+		return errResponse
+	}
+
+	result := DBConnection.Where("id=? AND contact_id=?", noteId, contactId).Delete(&ContactNote{})
+	if result.Error != nil {
+		return noteFailure("delete", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return utl.Message(104, "note not found")
+	}
+	return utl.Message(0, "note deleted successfully")
+}
+
+// FetchNoteVersions public method that lists every version of a note, latest first
+func (note *ContactNote) FetchNoteVersions(noteId, contactId, accountId uint) map[string]interface{} {
+	if errResponse := contactCheck(contactId, accountId, false); errResponse != nil {
+		return errResponse
+	}
+
+	found, err := fetchContactNote(noteId, contactId)
+	if err != nil {
+		return noteFailure("fetch", err)
+	}
+	if found == nil {
+		return utl.Message(104, "note not found")
+	}
+
+	versions := make([]*ContactNoteVersion, 0)
+	if err := DBConnection.Where("note_id=?", noteId).Order("version DESC").Find(&versions).Error; err != nil {
+		return noteFailure("fetch", err)
+	}
+
+	response := utl.Message(0, "note versions fetched successfully")
+	response["data"] = versions
+	return response
+}
+
+// RestoreNoteVersion public method that brings back the text of an earlier version. The restored
+// text is saved as a new version so that the history is never rewritten
+func (note *ContactNote) RestoreNoteVersion(noteId, version, contactId, accountId uint) map[string]interface{} {
+	if errResponse := contactCheck(contactId, accountId, true); errResponse != nil {
+		return errResponse
+	}
+
+	existing, err := fetchContactNote(noteId, contactId)
+	if err != nil {
+		return noteFailure("restore", err)
+	}
+	if existing == nil {
+		return utl.Message(104, "note not found")
+	}
+
+	earlier := &ContactNoteVersion{}
+	err = DBConnection.Where("note_id=? AND version=?", noteId, version).First(earlier).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return utl.Message(104, "note version not found")
+	}
+	if err != nil {
+		return noteFailure("restore", err)
+	}
+
+	if earlier.Body != existing.Body {
+		tx := DBConnection.Begin()
+		if err := saveNoteBody(tx, existing, earlier.Body); err != nil {
+			tx.Rollback()
+			return noteFailure("restore", err)
+		}
+		if err := tx.Commit().Error; err != nil {
+			return noteFailure("restore", err)
+		}
+	}
+
+	response := utl.Message(0, fmt.Sprintf("note version %d restored successfully", version))
+	response["data"] = existing
+	return response
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cermu/Go-phoneBook-API/phonenumber"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageLimit = 50  // number of records returned when no limit is passed
+	maxPageLimit     = 200 // maximum number of records a client can request at once
+)
+
+// contactSortColumns maps the sort keys accepted from clients to contact table columns
+var contactSortColumns = map[string]string{
+	"first_name": "first_name",
+	"last_name":  "last_name",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+// ContactListOptions struct used to carry paging and sorting
+// options when listing an account's contacts
+type ContactListOptions struct {
+	Limit   int
+	Cursor  string
+	SortBy  string
+	Order   string
+	GroupID uint   // when set only members of the group are listed
+	City    string // when set only contacts with an address in the city are listed
+	Country string // when set only contacts with an address in the country are listed
+
+	// when set only contacts of the address book are listed
+	AddressBookID uint
+
+	// filters on the primary phone number's country, line type and mobile network
+	PhoneCountry string
+	LineType     string
+	Network      string
+}
+
+// pageCursor private struct holding the position of the last record on a page.
+// It is serialized to JSON and base64 encoded so that clients treat it as an opaque value
+type pageCursor struct {
+	SortBy string `json:"s"`
+	Order  string `json:"o"`
+	Value  string `json:"v"`
+	ID     uint   `json:"i"`
+}
+
+// normalize private method that validates the options and fills in defaults
+func (options *ContactListOptions) normalize() error {
+	if options.Limit == 0 {
+		options.Limit = defaultPageLimit
+	}
+	if options.Limit < 0 || options.Limit > maxPageLimit {
+		return fmt.Errorf("limit should be between 1 and %d", maxPageLimit)
+	}
+
+	if options.SortBy == "" {
+		options.SortBy = "first_name"
+	}
+	if _, ok := contactSortColumns[options.SortBy]; !ok {
+		return errors.New("sort should be one of: first_name, last_name, created_at, updated_at")
+	}
+
+	if options.Order == "" {
+		options.Order = "asc"
+	}
+	if options.Order != "asc" && options.Order != "desc" {
+		return errors.New("order should be either asc or desc")
+	}
+
+	options.PhoneCountry = strings.ToUpper(strings.TrimSpace(options.PhoneCountry))
+	if options.LineType != "" && !stringInSlice(options.LineType, phonenumber.LineTypes) {
+		return errors.New("line_type should be one of: " + strings.Join(phonenumber.LineTypes, ", "))
+	}
+	options.Network = strings.TrimSpace(options.Network)
+	return nil
+}
+
+// encodeCursor private function that builds an opaque cursor pointing after the passed contact
+func encodeCursor(options *ContactListOptions, contact *Contact) string {
+	cursor := &pageCursor{SortBy: options.SortBy, Order: options.Order, ID: contact.ID}
+	switch options.SortBy {
+	case "first_name":
+		cursor.Value = contact.FirstName
+	case "last_name":
+		cursor.Value = contact.LastName
+	case "created_at":
+		cursor.Value = contact.CreatedAt.Format(time.RFC3339Nano)
+	case "updated_at":
+		cursor.Value = contact.UpdatedAt.Format(time.RFC3339Nano)
+	}
+
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeCursor private function that unpacks a cursor received from a client. It returns the
+// value to compare the sort column against, which is a time for the timestamp columns
+func decodeCursor(options *ContactListOptions) (interface{}, uint, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(options.Cursor)
+	if err != nil {
+		return nil, 0, errors.New("cursor is not valid")
+	}
+
+	cursor := &pageCursor{}
+	if err := json.Unmarshal(raw, cursor); err != nil || cursor.ID == 0 {
+		return nil, 0, errors.New("cursor is not valid")
+	}
+
+	// a cursor is only meaningful for the ordering it was issued with
+	if cursor.SortBy != options.SortBy || cursor.Order != options.Order {
+		return nil, 0, errors.New("cursor does not match the requested sort and order")
+	}
+
+	if options.SortBy == "created_at" || options.SortBy == "updated_at" {
+		value, timeErr := time.Parse(time.RFC3339Nano, cursor.Value)
+		if timeErr != nil {
+			return nil, 0, errors.New("cursor is not valid")
+		}
+		return value, cursor.ID, nil
+	}
+	return cursor.Value, cursor.ID, nil
+}
+
+// encodeTimeCursor private function that builds an opaque cursor pointing after a record of a listing
+// ordered by a timestamp and id, most recent first, such as the shared contacts or the trash
+func encodeTimeCursor(sortBy string, at time.Time, id uint) string {
+	raw, _ := json.Marshal(&pageCursor{SortBy: sortBy, Order: "desc", Value: at.Format(time.RFC3339Nano), ID: id})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeTimeCursor private function that unpacks a cursor issued by encodeTimeCursor for the same listing
+func decodeTimeCursor(value, sortBy string) (time.Time, uint, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return time.Time{}, 0, errors.New("cursor is not valid")
+	}
+
+	cursor := &pageCursor{}
+	if err := json.Unmarshal(raw, cursor); err != nil || cursor.ID == 0 || cursor.SortBy != sortBy {
+		return time.Time{}, 0, errors.New("cursor is not valid")
+	}
+	at, err := time.Parse(time.RFC3339Nano, cursor.Value)
+	if err != nil {
+		return time.Time{}, 0, errors.New("cursor is not valid")
+	}
+	return at, cursor.ID, nil
+}
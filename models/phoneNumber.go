@@ -0,0 +1,118 @@
+package models
+
+import (
+	"fmt"
+	"github.com/cermu/Go-phoneBook-API/phonenumber"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"log"
+	"strings"
+)
+
+const defaultPhoneRegion = "KE" // used for accounts created before default regions existed
+
+// contactPhoneMigrations widen the phone number columns to fit E.164 and convert the numbers
+// stored in the old Kenyan format (9 digits without the 254 prefix or leading zero), it is
+// safe to run repeatedly
+var contactPhoneMigrations = []string{
+	`ALTER TABLE contact ALTER COLUMN phone_number TYPE varchar(16)`,
+	`ALTER TABLE contact_phone ALTER COLUMN number TYPE varchar(16)`,
+	`UPDATE contact_phone SET raw_number = '0' || number, number = '+254' || number WHERE number ~ '^[0-9]{9}$'`,
+	`UPDATE contact_phone SET raw_number = number WHERE raw_number IS NULL OR raw_number = ''`,
+	`UPDATE contact SET phone_number = '+254' || phone_number WHERE phone_number ~ '^[0-9]{9}$'`,
+}
+
+// migrateContactPhoneNumbers private function that converts stored phone numbers to E.164
+func migrateContactPhoneNumbers() {
+	for _, statement := range contactPhoneMigrations {
+		if err := DBConnection.Exec(statement).Error; err != nil {
+			log.Printf("WARNING | Contact phone numbers migration failed with message: %v\n", err.Error())
+			return
+		}
+	}
+}
+
+// normalizePhone private function that validates a phone number typed in national or
+// international format, the number's E164 method returns the format it is stored in
+func normalizePhone(phoneNumber, region string) (*phonenumber.Number, map[string]interface{}, bool) {
+	number, err := phonenumber.Parse(phoneNumber, region)
+	if err != nil {
+		return nil, utl.Message(102, fmt.Sprintf("enter a valid phone number, %q: %v", strings.TrimSpace(phoneNumber),
+			err)), false
+	}
+	return number, utl.Message(0, "phone number validated successfully"), true
+}
+
+// phoneLineColumns private function that returns the country, line type and network columns of a
+// contact_phone row, or with prefix "phone_" of a contact row, for a parsed number
+func phoneLineColumns(number *phonenumber.Number, prefix string) map[string]interface{} {
+	if number == nil {
+		return map[string]interface{}{prefix + "country": "", prefix + "line_type": "", prefix + "network": ""}
+	}
+	info := number.Lookup()
+	return map[string]interface{}{prefix + "country": number.Region, prefix + "line_type": info.LineType,
+		prefix + "network": info.Network}
+}
+
+// migrateContactPhoneLines private function that looks up the country, line type and network of
+// phone numbers saved before they were recorded. Numbers that can not be parsed are marked unknown
+// so that they are only looked at once
+func migrateContactPhoneLines() {
+	type phoneRow struct {
+		ID     uint
+		Number string
+	}
+	statements := []struct{ table, column, prefix string }{
+		{"contact", "phone_number", "phone_"},
+		{"contact_phone", "number", ""},
+	}
+	for _, statement := range statements {
+		// the batches advance by id, a row that is still not looked up after its update is not read again
+		var lastId uint
+		for {
+			rows := make([]*phoneRow, 0)
+			err := DBConnection.Table(statement.table).Select(fmt.Sprintf("id, %s AS number", statement.column)).
+				Where(fmt.Sprintf("id > ? AND %s <> '' AND (%sline_type IS NULL OR %[2]sline_type = '')",
+					statement.column, statement.prefix), lastId).Order("id").Limit(500).Scan(&rows).Error
+			if err != nil {
+				log.Printf("WARNING | Phone line migration failed with message: %v\n", err.Error())
+				return
+			}
+			if len(rows) == 0 {
+				break
+			}
+
+			for _, row := range rows {
+				columns := map[string]interface{}{statement.prefix + "country": "",
+					statement.prefix + "line_type": phonenumber.Unknown, statement.prefix + "network": ""}
+				if number, parseErr := phonenumber.Parse(row.Number, ""); parseErr == nil {
+					columns = phoneLineColumns(number, statement.prefix)
+				}
+				if err := DBConnection.Table(statement.table).Where("id=?", row.ID).UpdateColumns(columns).Error; err != nil {
+					log.Printf("WARNING | Phone line migration failed with message: %v\n", err.Error())
+					return
+				}
+			}
+			lastId = rows[len(rows)-1].ID
+		}
+	}
+}
+
+// accountRegion private function that returns the region national phone numbers of an account's
+// contacts are read in
+func accountRegion(accountId uint) string {
+	account := &Account{}
+	err := DBConnection.Table("account").Select("default_region").Where("id=?", accountId).First(account).Error
+	if err != nil || account.DefaultRegion == "" {
+		return defaultPhoneRegion
+	}
+	return account.DefaultRegion
+}
+
+// contactRegion private function that returns the default region of the account owning a contact
+func contactRegion(contactId uint) string {
+	contact := &Contact{}
+	if err := DBConnection.Table("contact").Select("account_id").Where("id=?", contactId).First(contact).Error; err != nil {
+		return defaultPhoneRegion
+	}
+	return accountRegion(contact.AccountID)
+}
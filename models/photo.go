@@ -0,0 +1,298 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/cermu/Go-phoneBook-API/photo"
+	"github.com/cermu/Go-phoneBook-API/storage"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"github.com/cermu/Go-phoneBook-API/vcard"
+	"github.com/jinzhu/gorm"
+	"log"
+	"strconv"
+	"sync"
+)
+
+// errNoPhoto is returned when the photo of a contact without one is removed
+var errNoPhoto = errors.New("contact has no photo")
+
+const (
+	photoOriginal  = "original"
+	vCardPhotoSize = 256 // the thumbnail embedded in vCard exports
+	defaultPhotoMB = 5
+
+	photoFetchWorkers = 8 // photos read at the same time by the bulk vCard export
+)
+
+// photoStore holds the contact photos, it is set up by InitPhotoStorage
+var photoStore storage.BlobStore
+
+// InitPhotoStorage public function that sets up the storage backend for contact photos
+// from the PHOTOS configs, either the local filesystem (default) or an S3-compatible bucket
+func InitPhotoStorage() {
+	configs := utl.ReadConfigs()
+	var err error
+	switch backend := configs.GetString("PHOTOS.STORAGE"); backend {
+	case "", "local":
+		photoStore, err = storage.NewLocalStore(configs.GetString("PHOTOS.LOCAL_DIR"))
+	case "s3":
+		photoStore, err = storage.NewS3Store(configs.GetString("PHOTOS.S3.ENDPOINT"), configs.GetString("PHOTOS.S3.REGION"),
+			configs.GetString("PHOTOS.S3.BUCKET"), configs.GetString("PHOTOS.S3.ACCESS_KEY"),
+			configs.GetString("PHOTOS.S3.SECRET_KEY"))
+	default:
+		err = fmt.Errorf("unknown photo storage %q, use local or s3", backend)
+	}
+	if err != nil {
+		log.Fatalf("ERROR | Photo storage initialization failed with message: %v\n", err.Error())
+	}
+	log.Printf("INFO | Initializing photo storage \t [OK]")
+}
+
+// MaxPhotoBytes public function that returns the largest photo upload accepted, in bytes
+func MaxPhotoBytes() int64 {
+	megabytes := utl.ReadConfigs().GetInt64("PHOTOS.MAX_UPLOAD_MB")
+	if megabytes <= 0 {
+		megabytes = defaultPhotoMB
+	}
+	return megabytes << 20
+}
+
+// photoSizes private function that lists the renditions of a photo, the original first
+func photoSizes() []string {
+	sizes := []string{photoOriginal}
+	for _, size := range photo.ThumbnailSizes {
+		sizes = append(sizes, strconv.Itoa(size))
+	}
+	return sizes
+}
+
+// photoKey private function that returns the storage key of a photo rendition. Every upload gets
+// a new photo id so that clients caching the previous photo's URLs pick up the new one
+func photoKey(contactId uint, photoId, size, contentType string) string {
+	return fmt.Sprintf("contacts/%d/%s/%s%s", contactId, photoId, size, photo.Extension(contentType))
+}
+
+// photoURLs private function that returns the API URLs of a contact's photo renditions, nil without a photo
+func photoURLs(contact *Contact) map[string]string {
+	if contact.PhotoID == "" {
+		return nil
+	}
+	urls := make(map[string]string)
+	for _, size := range photoSizes() {
+		urls[size] = fmt.Sprintf("%s/contact/%d/photo/%s?v=%s", utl.APIPrefix, contact.ID, size, contact.PhotoID)
+	}
+	return urls
+}
+
+// deletePhotoBlobs private function that removes the stored renditions of a photo, failures are only logged
+func deletePhotoBlobs(contactId uint, photoId, contentType string) {
+	for _, size := range photoSizes() {
+		if err := photoStore.Delete(photoKey(contactId, photoId, size, contentType)); err != nil {
+			log.Printf("WARNING | An error occurred while deleting photo of contact: %d. Error: %v\n",
+				contactId, err.Error())
+		}
+	}
+}
+
+// copyPhotoBlobs private function that stores the renditions of a contact's photo under another contact,
+// the copies made so far are removed when one fails
+func copyPhotoBlobs(fromId, toId uint, photoId, contentType string) error {
+	for _, size := range photoSizes() {
+		data, err := photoStore.Get(photoKey(fromId, photoId, size, contentType))
+		if err == nil {
+			err = photoStore.Put(photoKey(toId, photoId, size, contentType), data, contentType)
+		}
+		if err != nil {
+			deletePhotoBlobs(toId, photoId, contentType)
+			return err
+		}
+	}
+	return nil
+}
+
+// swapPhoto private function that points a contact at another photo, photoId is empty to remove it. The
+// contact's row stays locked while its photo is read and changed, so concurrent uploads each get back
+// the photo they replaced and no renditions are left without a contact pointing at them. ifMatch is
+// the If-Match header, the photo is only changed when the contact's version matches it
+func swapPhoto(contactId uint, photoId, contentType, ifMatch string) (*Contact, error) {
+	tx := DBConnection.Begin()
+	previous := &Contact{}
+	err := lockVersion(tx, contactId, ifMatch)
+	if err == nil {
+		err = tx.Table("contact").Set("gorm:query_option", "FOR UPDATE").Select("id, photo_id, photo_type").
+			Where("id=?", contactId).First(previous).Error
+	}
+	if err == nil && photoId == "" && previous.PhotoID == "" {
+		err = errNoPhoto
+	}
+	if err == nil {
+		err = tx.Table("contact").Where("id=?", contactId).UpdateColumns(map[string]interface{}{
+			"photo_id": photoId, "photo_type": contentType, "version": gorm.Expr("version + 1")}).Error
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	return previous, err
+}
+
+// fetchAccountContact private function that loads a contact of an address book the account owns or
+// edits, nil means it was not found or the account can not manage it
+func fetchAccountContact(contactId, accountId uint) (*Contact, error) {
+	found, access, err := fetchAccessibleContact(contactId, accountId)
+	if err != nil || found == nil || (access != RoleOwner && access != RoleEditor) {
+		return nil, err
+	}
+	return found, nil
+}
+
+// UploadPhoto public method that validates an uploaded image, strips its metadata and stores
+// it together with its thumbnails as the contact's photo. A previous photo is removed. Any account
+// that can edit the contact can change its photo, read_write grantees included. ifMatch is the
+// If-Match header, the photo is refused when the contact's version does not match it
+func (contact *Contact) UploadPhoto(contactId, accountId uint, data []byte, ifMatch string) map[string]interface{} {
+	if errResponse := contactCheck(contactId, accountId, true); errResponse != nil {
+		return errResponse
+	}
+
+	processed, err := photo.Process(data)
+	if err != nil {
+		return utl.Message(102, err.Error())
+	}
+
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		log.Printf("WARNING | An error occurred while generating photo id: %v\n", err.Error())
+		return utl.Message(105, "failed to save photo, try again later")
+	}
+	photoId := hex.EncodeToString(idBytes)
+
+	renditions := map[string][]byte{photoOriginal: processed.Original}
+	for size, thumbnail := range processed.Thumbnails {
+		renditions[strconv.Itoa(size)] = thumbnail
+	}
+	for size, rendition := range renditions {
+		if err := photoStore.Put(photoKey(contactId, photoId, size, processed.ContentType), rendition,
+			processed.ContentType); err != nil {
+			log.Printf("WARNING | An error occurred while storing photo of contact: %d. Error: %v\n",
+				contactId, err.Error())
+			deletePhotoBlobs(contactId, photoId, processed.ContentType)
+			return utl.Message(105, "failed to save photo, try again later")
+		}
+	}
+
+	previous, err := swapPhoto(contactId, photoId, processed.ContentType, ifMatch)
+	if err != nil {
+		deletePhotoBlobs(contactId, photoId, processed.ContentType)
+		if err == errVersionMismatch {
+			return versionConflict()
+		}
+		if err == gorm.ErrRecordNotFound {
+			return utl.Message(104, "contact not found")
+		}
+		log.Printf("WARNING | An error occurred while saving photo of contact: %d. Error: %v\n", contactId, err.Error())
+		return utl.Message(105, "failed to save photo, try again later")
+	}
+	if previous.PhotoID != "" {
+		deletePhotoBlobs(contactId, previous.PhotoID, previous.PhotoType)
+	}
+
+	response := utl.Message(0, "photo uploaded successfully")
+	response["data"] = photoURLs(&Contact{Model: gorm.Model{ID: contactId}, PhotoID: photoId})
+	return response
+}
+
+// FetchPhoto public method that reads a rendition of a contact's photo, size is original or one of
+// the thumbnail sizes. A response message is returned when the photo can not be read. The photos
+// of contacts shared with the account can be read too
+func (contact *Contact) FetchPhoto(contactId, accountId uint, size string) ([]byte, string, map[string]interface{}) {
+	if !stringInSlice(size, photoSizes()) {
+		return nil, "", utl.Message(102, "photo size should be one of: original, 64, 256")
+	}
+
+	existing, _, err := fetchAccessibleContact(contactId, accountId)
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching contact from the DB: %v\n", err.Error())
+		return nil, "", utl.Message(105, "failed to fetch photo, try again later")
+	}
+	if existing == nil {
+		return nil, "", utl.Message(104, "contact not found")
+	}
+	if existing.PhotoID == "" {
+		return nil, "", utl.Message(104, "contact has no photo")
+	}
+
+	data, err := photoStore.Get(photoKey(contactId, existing.PhotoID, size, existing.PhotoType))
+	if err != nil {
+		if err == storage.ErrNotFound {
+			return nil, "", utl.Message(104, "photo not found")
+		}
+		log.Printf("WARNING | An error occurred while reading photo of contact: %d. Error: %v\n", contactId, err.Error())
+		return nil, "", utl.Message(105, "failed to fetch photo, try again later")
+	}
+	return data, existing.PhotoType, nil
+}
+
+// DeletePhoto public method that removes a contact's photo, ifMatch is the If-Match header. The photo
+// is only removed when the contact's version matches it
+func (contact *Contact) DeletePhoto(contactId, accountId uint, ifMatch string) map[string]interface{} {
+	if errResponse := contactCheck(contactId, accountId, true); errResponse != nil {
+		return errResponse
+	}
+
+	previous, err := swapPhoto(contactId, "", "", ifMatch)
+	if err == errVersionMismatch {
+		return versionConflict()
+	}
+	if err == gorm.ErrRecordNotFound {
+		return utl.Message(104, "contact not found")
+	}
+	if err == errNoPhoto {
+		return utl.Message(104, "contact has no photo")
+	}
+	if err != nil {
+		log.Printf("WARNING | An error occurred while deleting photo of contact: %d. Error: %v\n", contactId, err.Error())
+		return utl.Message(105, "failed to delete photo, try again later")
+	}
+	deletePhotoBlobs(contactId, previous.PhotoID, previous.PhotoType)
+	return utl.Message(0, "photo deleted successfully")
+}
+
+// vCardPhoto private function that loads the thumbnail embedded in a contact's vCard, nil without a photo
+func vCardPhoto(contact *Contact) *vcard.Photo {
+	if contact.PhotoID == "" {
+		return nil
+	}
+	data, err := photoStore.Get(photoKey(contact.ID, contact.PhotoID, strconv.Itoa(vCardPhotoSize), contact.PhotoType))
+	if err != nil {
+		log.Printf("WARNING | An error occurred while reading photo of contact: %d for export. Error: %v\n",
+			contact.ID, err.Error())
+		return nil
+	}
+	return &vcard.Photo{MediaType: contact.PhotoType, Data: data}
+}
+
+// vCardPhotos private function that loads the thumbnails embedded in the vCards of a page of contacts, a few
+// at a time so that a remote photo store is not waited on once per contact
+func vCardPhotos(contacts []*Contact) []*vcard.Photo {
+	photos := make([]*vcard.Photo, len(contacts))
+	workers := make(chan struct{}, photoFetchWorkers)
+	var wg sync.WaitGroup
+	for i, contact := range contacts {
+		if contact.PhotoID == "" {
+			continue
+		}
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(i int, contact *Contact) {
+			defer wg.Done()
+			photos[i] = vCardPhoto(contact)
+			<-workers
+		}(i, contact)
+	}
+	wg.Wait()
+	return photos
+}
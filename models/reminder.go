@@ -0,0 +1,45 @@
+package models
+
+import (
+	"github.com/cermu/Go-phoneBook-API/reminders"
+	"time"
+)
+
+// ReminderStore struct gives the birthday reminders scheduler access to accounts and contacts
+type ReminderStore struct{}
+
+// Recipients public method that lists the active accounts
+func (ReminderStore) Recipients() ([]*reminders.Recipient, error) {
+	accounts := make([]*Account, 0)
+	err := DBConnection.Table("account").Select("id, first_name, email, time_zone").
+		Where("active=? AND deleted_at IS NULL", true).Order("id").Find(&accounts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	recipients := make([]*reminders.Recipient, 0, len(accounts))
+	for _, account := range accounts {
+		recipients = append(recipients, &reminders.Recipient{AccountID: account.ID, FirstName: account.FirstName,
+			Email: account.Email, TimeZone: account.TimeZone})
+	}
+	return recipients, nil
+}
+
+// Birthdays public method that lists the birthdays of an account's contacts within a number of days of from
+func (ReminderStore) Birthdays(accountId uint, from time.Time, days int) ([]*reminders.Birthday, error) {
+	events, err := upcomingEvents(accountId, from, days)
+	if err != nil {
+		return nil, err
+	}
+
+	birthdays := make([]*reminders.Birthday, 0)
+	for _, event := range events {
+		if event.Kind != "birthday" {
+			continue
+		}
+		date, _ := time.ParseInLocation("2006-01-02", event.Date, from.Location())
+		birthdays = append(birthdays, &reminders.Birthday{FirstName: event.FirstName, LastName: event.LastName,
+			Date: date, DaysUntil: event.DaysUntil, Age: event.Years})
+	}
+	return birthdays, nil
+}
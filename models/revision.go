@@ -0,0 +1,416 @@
+package models
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"github.com/jinzhu/gorm"
+	"log"
+	"time"
+)
+
+// revision actions
+const (
+	RevisionCreated  = "created"
+	RevisionUpdated  = "updated"
+	RevisionDeleted  = "deleted"
+	RevisionRestored = "restored"
+	RevisionMerged   = "merged"
+	RevisionReverted = "reverted"
+)
+
+// ContactRevision struct is an immutable record of a change made to a contact: who made it, the
+// fields it changed and the contact as it was right after it. Contact has many ContactRevisions,
+// ContactID is the foreign key. AccountID is the account that made the change, it is cleared
+// when that account is removed
+type ContactRevision struct {
+	ID         uint            `gorm:"primary_key" json:"id"`
+	ContactID  uint            `gorm:"not null;unique_index:idx_contact_revision" json:"contact_id"`
+	Revision   int             `gorm:"not null;unique_index:idx_contact_revision" json:"revision"`
+	AccountID  *uint           `json:"account_id"`
+	Action     string          `gorm:"size:10;not null" json:"action"`
+	Changes    RevisionChanges `gorm:"type:jsonb;not null" json:"changes"`
+	Snapshot   *contactState   `gorm:"type:jsonb;not null" json:"snapshot"`
+	RevertedTo *int            `json:"reverted_to,omitempty"` // the revision brought back by a revert
+	CreatedAt  time.Time       `json:"created_at"`
+
+	Account *ShareAccount `gorm:"-" json:"account,omitempty"`
+}
+
+// FieldChange struct holds the values of a field before and after a change, null when there was none
+type FieldChange struct {
+	Old json.RawMessage `json:"old"`
+	New json.RawMessage `json:"new"`
+}
+
+// RevisionChanges maps the name of every field a change touched to its old and new values
+type RevisionChanges map[string]*FieldChange
+
+// Value public method that stores the changes as JSON
+func (changes RevisionChanges) Value() (driver.Value, error) {
+	return json.Marshal(changes)
+}
+
+// Scan public method that reads the changes from JSON
+func (changes *RevisionChanges) Scan(value interface{}) error {
+	return scanJSON(value, changes)
+}
+
+// contactState struct holds the fields of a contact that are tracked in its revisions
+type contactState struct {
+	FirstName     string          `json:"first_name"`
+	LastName      string          `json:"last_name"`
+	PhoneNumber   string          `json:"phone_number"`
+	Email         string          `json:"email"`
+	AddressBookID uint            `json:"address_book_id"`
+	Phones        []revisionPhone `json:"phones"`
+	Emails        []revisionEmail `json:"emails"`
+	Dates         []revisionDate  `json:"dates"`
+
+	// nil in revisions recorded before addresses were tracked
+	Addresses []revisionAddress `json:"addresses"`
+}
+
+// revisionPhone, revisionEmail, revisionDate and revisionAddress structs hold the tracked fields of a
+// contact's phone numbers, emails, dates and addresses
+type revisionPhone struct {
+	Label     string `json:"label"`
+	Number    string `json:"number"`
+	RawNumber string `json:"raw_number"`
+	Primary   bool   `json:"primary"`
+}
+
+type revisionEmail struct {
+	Label   string `json:"label"`
+	Address string `json:"address"`
+	Primary bool   `json:"primary"`
+}
+
+type revisionDate struct {
+	Kind  string `json:"kind"`
+	Label string `json:"label"`
+	Month int    `json:"month"`
+	Day   int    `json:"day"`
+	Year  *int   `json:"year"`
+}
+
+type revisionAddress struct {
+	Label      string `json:"label"`
+	Street     string `json:"street"`
+	City       string `json:"city"`
+	Region     string `json:"region"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country"`
+}
+
+// Value public method that stores the contact's state as JSON
+func (state *contactState) Value() (driver.Value, error) {
+	return json.Marshal(state)
+}
+
+// Scan public method that reads the contact's state from JSON
+func (state *contactState) Scan(value interface{}) error {
+	return scanJSON(value, state)
+}
+
+// scanJSON private function that decodes a JSON column into a value
+func scanJSON(value interface{}, target interface{}) error {
+	switch data := value.(type) {
+	case []byte:
+		return json.Unmarshal(data, target)
+	case string:
+		return json.Unmarshal([]byte(data), target)
+	case nil:
+		return nil
+	}
+	return fmt.Errorf("unsupported JSON column value: %v", value)
+}
+
+// loadContactState private function that reads the tracked fields of a contact, deleted or not. The
+// contact's row stays locked until the end of the transaction, so concurrent changes of a contact are
+// applied and numbered one after the other and the state read is the one the change starts from
+func loadContactState(tx *gorm.DB, contactId uint) (*contactState, error) {
+	contact := &Contact{}
+	err := tx.Unscoped().Table("contact").Set("gorm:query_option", "FOR UPDATE").Where("id=?", contactId).
+		First(contact).Error
+	if err != nil {
+		return nil, err
+	}
+	state := &contactState{FirstName: contact.FirstName, LastName: contact.LastName, PhoneNumber: contact.PhoneNumber,
+		Email: contact.Email, AddressBookID: contact.AddressBookID,
+		Phones: make([]revisionPhone, 0), Emails: make([]revisionEmail, 0), Dates: make([]revisionDate, 0),
+		Addresses: make([]revisionAddress, 0)}
+
+	phones := make([]*ContactPhone, 0)
+	if err := tx.Where("contact_id=?", contactId).Order("id").Find(&phones).Error; err != nil {
+		return nil, err
+	}
+	for _, phone := range phones {
+		state.Phones = append(state.Phones, revisionPhone{Label: phone.Label, Number: phone.Number,
+			RawNumber: phone.RawNumber, Primary: phone.Primary})
+	}
+
+	emails := make([]*ContactEmail, 0)
+	if err := tx.Where("contact_id=?", contactId).Order("id").Find(&emails).Error; err != nil {
+		return nil, err
+	}
+	for _, email := range emails {
+		state.Emails = append(state.Emails, revisionEmail{Label: email.Label, Address: email.Address,
+			Primary: email.Primary})
+	}
+
+	dates := make([]*ContactDate, 0)
+	if err := tx.Where("contact_id=?", contactId).Order("id").Find(&dates).Error; err != nil {
+		return nil, err
+	}
+	for _, date := range dates {
+		state.Dates = append(state.Dates, revisionDate{Kind: date.Kind, Label: date.Label, Month: date.Month,
+			Day: date.Day, Year: date.Year})
+	}
+
+	addresses := make([]*ContactAddress, 0)
+	if err := tx.Where("contact_id=?", contactId).Order("id").Find(&addresses).Error; err != nil {
+		return nil, err
+	}
+	for _, address := range addresses {
+		state.Addresses = append(state.Addresses, revisionAddress{Label: address.Label, Street: address.Street,
+			City: address.City, Region: address.Region, PostalCode: address.PostalCode, Country: address.Country})
+	}
+	return state, nil
+}
+
+// diffStates private function that lists the fields whose values differ between two states of a
+// contact, every field of the new state when there is no old one
+func diffStates(before, after *contactState) (RevisionChanges, error) {
+	newFields, err := stateFields(after)
+	if err != nil {
+		return nil, err
+	}
+	oldFields := make(map[string]json.RawMessage)
+	if before != nil {
+		if oldFields, err = stateFields(before); err != nil {
+			return nil, err
+		}
+	}
+
+	changes := make(RevisionChanges)
+	for field, value := range newFields {
+		if old, ok := oldFields[field]; !ok || !bytes.Equal(old, value) {
+			changes[field] = &FieldChange{Old: oldFields[field], New: value}
+		}
+	}
+	return changes, nil
+}
+
+// stateFields private function that splits a contact's state into the JSON values of its fields
+func stateFields(state *contactState) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]json.RawMessage)
+	return fields, json.Unmarshal(data, &fields)
+}
+
+// recordRevision private function that appends a revision to a contact's history inside the
+// transaction making the change. before is the contact's state ahead of the change, nil for a new
+// contact. Updates that did not change any tracked field are not recorded, the others increment
+// the contact's version
+func recordRevision(tx *gorm.DB, contactId, accountId uint, action string, before *contactState) error {
+	return saveRevision(tx, &ContactRevision{ContactID: contactId, AccountID: &accountId, Action: action}, before)
+}
+
+// saveRevision private function that fills in the changes, snapshot and number of a revision and saves it
+func saveRevision(tx *gorm.DB, revision *ContactRevision, before *contactState) error {
+	after, err := loadContactState(tx, revision.ContactID)
+	if err != nil {
+		return err
+	}
+	changes, err := diffStates(before, after)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 && revision.Action == RevisionUpdated {
+		return nil
+	}
+	if revision.Action != RevisionCreated {
+		if err := bumpVersion(tx, revision.ContactID); err != nil {
+			return err
+		}
+	}
+
+	// the row locked by loadContactState keeps a concurrent change from taking the same number
+	var latest struct{ Revision int }
+	err = tx.Table("contact_revision").Select("COALESCE(MAX(revision), 0) AS revision").
+		Where("contact_id=?", revision.ContactID).Scan(&latest).Error
+	if err != nil {
+		return err
+	}
+	revision.Revision, revision.Changes, revision.Snapshot = latest.Revision+1, changes, after
+	return tx.Create(revision).Error
+}
+
+// FetchContactRevisions public method that lists the history of a contact the account can access,
+// latest change first
+func (revision *ContactRevision) FetchContactRevisions(contactId, accountId uint, limit int) map[string]interface{} {
+	if limit == 0 {
+		limit = defaultPageLimit
+	}
+	if limit < 0 || limit > maxPageLimit {
+		return utl.Message(102, fmt.Sprintf("limit should be between 1 and %d", maxPageLimit))
+	}
+
+	contact, _, err := fetchAccessibleContact(contactId, accountId)
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching contact from the DB: %v\n", err.Error())
+		return utl.Message(105, "failed to fetch revisions, try again later")
+	}
+	if contact == nil {
+		return utl.Message(104, "contact not found")
+	}
+
+	revisions := make([]*ContactRevision, 0)
+	err = DBConnection.Where("contact_id=?", contactId).Order("revision DESC").Limit(limit).Find(&revisions).Error
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching revisions of contact: %d. Error: %v\n",
+			contactId, err.Error())
+		return utl.Message(105, "failed to fetch revisions, try again later")
+	}
+
+	accountIds := make([]uint, 0, len(revisions))
+	for _, found := range revisions {
+		if found.AccountID != nil {
+			accountIds = append(accountIds, *found.AccountID)
+		}
+	}
+	accounts, err := shareAccounts(accountIds)
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching revisions of contact: %d. Error: %v\n",
+			contactId, err.Error())
+		return utl.Message(105, "failed to fetch revisions, try again later")
+	}
+	for _, found := range revisions {
+		if found.AccountID != nil {
+			found.Account = accounts[*found.AccountID]
+		}
+	}
+
+	response := utl.Message(0, "revisions fetched successfully")
+	response["data"] = revisions
+	return response
+}
+
+// RevertContact public method that brings a contact's names, phone numbers, emails, dates
+// and addresses back to what they were at a revision. The revert is recorded as a new revision so that
+// the history is never rewritten, it does not move the contact between address books. Addresses are
+// left as they are when reverting to a revision recorded before they were tracked. ifMatch is the If-Match
+// header, the revert is refused when the contact's version does not match it
+func (revision *ContactRevision) RevertContact(number, contactId, accountId uint, ifMatch string) map[string]interface{} {
+	existing, access, err := fetchAccessibleContact(contactId, accountId)
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching contact from the DB: %v\n", err.Error())
+		return utl.Message(105, "failed to revert contact, try again later")
+	}
+	if existing == nil {
+		return utl.Message(104, "contact not found")
+	}
+	if !canEdit(access) {
+		return utl.Message(106, "you can only view this contact")
+	}
+
+	earlier := &ContactRevision{}
+	err = DBConnection.Where("contact_id=? AND revision=?", contactId, number).First(earlier).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return utl.Message(104, "revision not found")
+	}
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching revision from the DB: %v\n", err.Error())
+		return utl.Message(105, "failed to revert contact, try again later")
+	}
+
+	// rebuild the contact as it was, going through the same validation as an update
+	state := earlier.Snapshot
+	contact := &Contact{FirstName: state.FirstName, LastName: state.LastName,
+		Phones: make([]ContactPhone, 0), Emails: make([]ContactEmail, 0), Dates: make([]ContactDate, 0)}
+	for _, phone := range state.Phones {
+		contact.Phones = append(contact.Phones, ContactPhone{Label: phone.Label, Number: phone.Number,
+			Primary: phone.Primary})
+	}
+	for _, email := range state.Emails {
+		contact.Emails = append(contact.Emails, ContactEmail{Label: email.Label, Address: email.Address,
+			Primary: email.Primary})
+	}
+	for _, date := range state.Dates {
+		contact.Dates = append(contact.Dates, ContactDate{Kind: date.Kind, Label: date.Label, Month: date.Month,
+			Day: date.Day, Year: date.Year})
+	}
+	if resp, ok := contact.validatePhones(contactRegion(contactId)); !ok {
+		return resp
+	}
+	for i, phone := range state.Phones {
+		contact.Phones[i].RawNumber = phone.RawNumber
+	}
+	if resp, ok := contact.validateEmails(); !ok {
+		return resp
+	}
+	if resp, ok := contact.validateDates(); !ok {
+		return resp
+	}
+	if state.Addresses != nil {
+		contact.Addresses = make([]ContactAddress, 0, len(state.Addresses))
+		for _, address := range state.Addresses {
+			contact.Addresses = append(contact.Addresses, ContactAddress{Label: address.Label, Street: address.Street,
+				City: address.City, Region: address.Region, PostalCode: address.PostalCode, Country: address.Country})
+		}
+	}
+
+	tx := DBConnection.Begin()
+	var before *contactState
+	err = lockVersion(tx, contactId, ifMatch)
+	if err == nil {
+		before, err = loadContactState(tx, contactId)
+	}
+	if err == nil {
+		// the country, line type and network were looked up again by validatePhones for the restored number
+		err = tx.Table("contact").Where("id=?", contactId).UpdateColumns(map[string]interface{}{
+			"first_name": contact.FirstName, "last_name": contact.LastName,
+			"phone_number": contact.PhoneNumber, "phone_country": contact.PhoneCountry,
+			"phone_line_type": contact.PhoneLineType, "phone_network": contact.PhoneNetwork,
+			"email": contact.Email, "updated_at": time.Now()}).Error
+	}
+	if err == nil {
+		err = contact.saveChannels(tx, contactId)
+	}
+	if err == nil {
+		err = contact.saveDates(tx, contactId)
+	}
+	if err == nil && contact.Addresses != nil {
+		err = replaceAddresses(tx, contactId, contact.Addresses)
+	}
+	if err == nil {
+		revertedTo := int(number)
+		err = saveRevision(tx, &ContactRevision{ContactID: contactId, AccountID: &accountId,
+			Action: RevisionReverted, RevertedTo: &revertedTo}, before)
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err == errVersionMismatch {
+		return versionConflict()
+	}
+	if err != nil {
+		log.Printf("WARNING | An error occurred while reverting contact: %d. Error: %v\n", contactId, err.Error())
+		return utl.Message(105, "failed to revert contact, try again later")
+	}
+
+	result := &Contact{}
+	preloadContactDetails(DBConnection.Table("contact")).First(result, contactId)
+	result.Photo = photoURLs(result)
+	response := utl.Message(0, fmt.Sprintf("contact reverted to revision %d", number))
+	response["data"] = result
+	return response
+}
@@ -0,0 +1,196 @@
+package models
+
+import (
+	"fmt"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"log"
+	"strings"
+	"unicode"
+)
+
+const maxSearchTerms = 8 // search terms beyond this are ignored
+
+// contactSearchMigrations holds the statements that maintain the contact.search_vector column.
+// The column is kept up to date by a trigger so every insert/update path is covered, it reads every
+// phone number and email of the contact. Changes of the contact_phone and contact_email rows touch
+// the contact so that its vector is computed again. Phone numbers are indexed as every digit suffix
+// of six digits or more, so that national numbers (typed without the country code) and international
+// numbers both match as prefixes
+var contactSearchMigrations = []string{
+	`ALTER TABLE contact ADD COLUMN IF NOT EXISTS search_vector tsvector`,
+	`CREATE OR REPLACE FUNCTION contact_search_vector_update() RETURNS trigger AS $$
+	DECLARE
+		emails text;
+		phones text;
+	BEGIN
+		SELECT string_agg(address, ' ') INTO emails FROM contact_email
+		WHERE contact_id = NEW.id AND deleted_at IS NULL;
+		SELECT string_agg(number, ' ') INTO phones FROM contact_phone
+		WHERE contact_id = NEW.id AND deleted_at IS NULL;
+		emails := concat_ws(' ', NEW.email, emails);
+		phones := concat_ws(' ', NEW.phone_number, phones);
+
+		NEW.search_vector :=
+			setweight(to_tsvector('simple', coalesce(NEW.first_name, '')), 'A') ||
+			setweight(to_tsvector('simple', coalesce(NEW.last_name, '')), 'A') ||
+			setweight(to_tsvector('simple', emails), 'B') ||
+			setweight(to_tsvector('simple', replace(emails, '@', ' ')), 'B') ||
+			setweight(to_tsvector('simple', coalesce((SELECT string_agg(substr(digits, i), ' ')
+				FROM (SELECT regexp_replace(number, '[^0-9]', '', 'g') AS digits
+					FROM regexp_split_to_table(phones, ' ') AS number) phone,
+				generate_series(1, length(digits) - 5) AS i), '')), 'C');
+		RETURN NEW;
+	END
+	$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS contact_search_vector_trigger ON contact`,
+	`CREATE TRIGGER contact_search_vector_trigger BEFORE INSERT OR UPDATE ON contact
+	FOR EACH ROW EXECUTE PROCEDURE contact_search_vector_update()`,
+	`CREATE OR REPLACE FUNCTION contact_channel_search_update() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP <> 'INSERT' THEN
+			UPDATE contact SET search_vector = NULL WHERE id = OLD.contact_id;
+		END IF;
+		IF TG_OP = 'INSERT' OR (TG_OP = 'UPDATE' AND NEW.contact_id <> OLD.contact_id) THEN
+			UPDATE contact SET search_vector = NULL WHERE id = NEW.contact_id;
+		END IF;
+		RETURN NULL;
+	END
+	$$ LANGUAGE plpgsql`,
+	// vectors computed before the other phone numbers and emails were read are computed again, once
+	`DO $$ BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'contact_phone_search_trigger') THEN
+			UPDATE contact SET search_vector = NULL;
+		END IF;
+	END $$`,
+	`DROP TRIGGER IF EXISTS contact_phone_search_trigger ON contact_phone`,
+	`CREATE TRIGGER contact_phone_search_trigger AFTER INSERT OR UPDATE OR DELETE ON contact_phone
+	FOR EACH ROW EXECUTE PROCEDURE contact_channel_search_update()`,
+	`DROP TRIGGER IF EXISTS contact_email_search_trigger ON contact_email`,
+	`CREATE TRIGGER contact_email_search_trigger AFTER INSERT OR UPDATE OR DELETE ON contact_email
+	FOR EACH ROW EXECUTE PROCEDURE contact_channel_search_update()`,
+	// touching the rows fires the trigger and fills in the vector for existing contacts
+	`UPDATE contact SET search_vector = NULL WHERE search_vector IS NULL`,
+	`CREATE INDEX IF NOT EXISTS idx_contact_search_vector ON contact USING GIN (search_vector)`,
+}
+
+// migrateContactSearch private function that creates the full text search column, trigger and index
+func migrateContactSearch() {
+	for _, statement := range contactSearchMigrations {
+		if err := DBConnection.Exec(statement).Error; err != nil {
+			log.Printf("WARNING | Contact search migration failed with message: %v\n", err.Error())
+			return
+		}
+	}
+}
+
+// buildSearchQuery private function that turns free text typed by a user into a prefix
+// matching tsquery, e.g. "john 0712" becomes "john:* & 712:*"
+func buildSearchQuery(text string) string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '@' && r != '.' && r != '_'
+	})
+
+	terms := make([]string, 0, len(fields))
+	for _, field := range fields {
+		field = strings.Trim(field, "._")
+		if field == "" {
+			continue
+		}
+
+		if isDigits(field) {
+			if field = trimPhonePrefix(field); field == "" {
+				continue
+			}
+		}
+
+		terms = append(terms, field+":*")
+		if len(terms) == maxSearchTerms {
+			break
+		}
+	}
+	return strings.Join(terms, " & ")
+}
+
+// trimPhonePrefix private function that strips the trunk prefix (leading zeros) from a digit only
+// search term, stored E.164 numbers do not contain it
+func trimPhonePrefix(digits string) string {
+	return strings.TrimLeft(digits, "0")
+}
+
+// isDigits private function that checks whether a string is made up of digits only
+func isDigits(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ContactSearchOptions struct used to carry the options of a contact search
+type ContactSearchOptions struct {
+	Query     string
+	Limit     int
+	Mode      string  // "fulltext" (default) or "fuzzy"
+	Threshold float64 // minimum trigram similarity used by fuzzy mode, 0 means the configured default
+}
+
+// SearchContacts public method that searches an account's contacts, either with ranked
+// full text search or with typo tolerant trigram matching
+func (contact *Contact) SearchContacts(accountId uint, options *ContactSearchOptions) map[string]interface{} {
+	if strings.TrimSpace(options.Query) == "" {
+		return utl.Message(102, "the following query parameter is required: q")
+	}
+
+	if options.Limit == 0 {
+		options.Limit = defaultPageLimit
+	}
+	if options.Limit < 0 || options.Limit > maxPageLimit {
+		return utl.Message(102, fmt.Sprintf("limit should be between 1 and %d", maxPageLimit))
+	}
+
+	switch options.Mode {
+	case "", "fulltext":
+		return fullTextSearch(accountId, options)
+	case "fuzzy":
+		return fuzzySearch(accountId, options)
+	default:
+		return utl.Message(102, "mode should be either fulltext or fuzzy")
+	}
+}
+
+// fullTextSearch private function that runs a ranked full text search over an account's contacts
+func fullTextSearch(accountId uint, options *ContactSearchOptions) map[string]interface{} {
+	tsQuery := buildSearchQuery(options.Query)
+	if tsQuery == "" {
+		return utl.Message(102, "search query should contain letters or digits")
+	}
+
+	// contacts match on their own fields or on the text of their notes, note matches rank lower
+	noteRank := DBConnection.Table("contact_note").
+		Select("max(ts_rank(contact_note.search_vector, to_tsquery('simple', ?)))", tsQuery).
+		Where("contact_note.contact_id = contact.id AND contact_note.deleted_at IS NULL").
+		Where("contact_note.search_vector @@ to_tsquery('simple', ?)", tsQuery).SubQuery()
+
+	contacts := make([]*Contact, 0)
+	err := DBConnection.Table("contact").
+		Select("contact.*, ts_rank(search_vector, to_tsquery('simple', ?)) + coalesce(?, 0) AS rank", tsQuery, noteRank).
+		Where("address_book_id IN (?) AND (search_vector @@ to_tsquery('simple', ?) OR EXISTS (?))",
+			accountBooks(accountId), tsQuery,
+			DBConnection.Table("contact_note").Select("1").
+				Where("contact_note.contact_id = contact.id AND contact_note.deleted_at IS NULL").
+				Where("contact_note.search_vector @@ to_tsquery('simple', ?)", tsQuery).SubQuery()).
+		Order("rank DESC, id").Limit(options.Limit).Find(&contacts).Error
+	if err != nil {
+		log.Printf("WARNING | An error occurred while searching contacts for account: %d. Error: %v\n",
+			accountId, err.Error())
+		return utl.Message(105, "failed to search contacts, try again later")
+	}
+
+	response := utl.Message(0, "contacts searched successfully")
+	response["data"] = contacts
+	return response
+}
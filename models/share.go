@@ -0,0 +1,337 @@
+package models
+
+import (
+	"fmt"
+	"github.com/badoux/checkmail"
+	"github.com/cermu/Go-phoneBook-API/phonenumber"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"github.com/jinzhu/gorm"
+	"log"
+	"strings"
+	"time"
+)
+
+// share permissions
+const (
+	ShareReadOnly  = "read_only"
+	ShareReadWrite = "read_write"
+)
+
+// ContactShare struct to store a contact an account has shared with another account.
+// Contact has many ContactShares, ContactID is the foreign key. OwnerID, the account that
+// shared the contact, and GranteeID are foreign keys from the account table
+type ContactShare struct {
+	ID         uint      `gorm:"primary_key" json:"id"`
+	ContactID  uint      `gorm:"not null;unique_index:idx_contact_share_contact_grantee" json:"contact_id"`
+	OwnerID    uint      `gorm:"not null" json:"owner_id"`
+	GranteeID  uint      `gorm:"not null;unique_index:idx_contact_share_contact_grantee;index:idx_contact_share_grantee" json:"grantee_id"`
+	Permission string    `gorm:"size:10;not null" json:"permission"` // read_only or read_write
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	// the account the contact is shared with, identified by email or phone_number in requests
+	Email       string        `gorm:"-" json:"email,omitempty"`
+	PhoneNumber string        `gorm:"-" json:"phone_number,omitempty"`
+	Grantee     *ShareAccount `gorm:"-" json:"grantee,omitempty"`
+}
+
+// ShareAccount struct holds the public details of an account taking part in a share
+type ShareAccount struct {
+	ID        uint   `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+}
+
+// SharedContact struct is an entry of the listing of contacts shared with an account
+type SharedContact struct {
+	Contact    *Contact      `json:"contact"`
+	Permission string        `json:"permission"`
+	Owner      *ShareAccount `json:"owner"`
+	SharedAt   time.Time     `json:"shared_at"`
+}
+
+// fetchAccessibleContact private function that loads a contact from one of the account's address books
+// or shared with it, together with the account's access: its role in the contact's address book or
+// the share permission. A nil contact means it was not found or the account has no access to it
+func fetchAccessibleContact(contactId, accountId uint) (*Contact, string, error) {
+	contact := &Contact{}
+	err := DBConnection.Table("contact").Where("id=?", contactId).First(contact).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	role, err := bookRole(contact.AddressBookID, accountId)
+	if err != nil {
+		return nil, "", err
+	}
+	if role != "" {
+		return contact, role, nil
+	}
+
+	share := &ContactShare{}
+	err = DBConnection.Where("contact_id=? AND grantee_id=?", contactId, accountId).First(share).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return contact, share.Permission, nil
+}
+
+// shareAccounts private function that loads the public details of accounts by id
+func shareAccounts(accountIds []uint) (map[uint]*ShareAccount, error) {
+	accounts := make([]*ShareAccount, 0)
+	err := DBConnection.Table("account").Select("id, first_name, last_name, email").
+		Where("id IN (?)", accountIds).Scan(&accounts).Error
+	byId := make(map[uint]*ShareAccount, len(accounts))
+	for _, account := range accounts {
+		byId[account.ID] = account
+	}
+	return byId, err
+}
+
+// findAccount private function that looks up the active account identified by an email or phone number,
+// used to pick the accounts contacts are shared with and address books are shared with. A national
+// phone number is read in the region of the account looking it up
+func findAccount(email, phoneNumber, region string) (*Account, map[string]interface{}) {
+	email, phoneNumber = strings.TrimSpace(email), strings.TrimSpace(phoneNumber)
+
+	var found *Account
+	var err error
+	switch {
+	case email != "":
+		if err := checkmail.ValidateFormat(email); err != nil {
+			return nil, utl.Message(102, "email address is not valid")
+		}
+		found = &Account{}
+		err = DBConnection.Table("account").Where("active=? AND lower(email)=lower(?)", true, email).
+			First(found).Error
+	case phoneNumber != "":
+		number, resp, ok := normalizePhone(phoneNumber, region)
+		if !ok {
+			return nil, resp
+		}
+		found, err = findAccountByPhone(number)
+	default:
+		return nil, utl.Message(102, "the account is required, pass its email or phone_number")
+	}
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, utl.Message(104, "no account found with that email or phone number")
+		}
+		log.Printf("WARNING | An error occurred while fetching account from the DB: %v\n", err.Error())
+		return nil, utl.Message(105, "failed to fetch account, try again later")
+	}
+	return found, nil
+}
+
+// findAccountByPhone private function that finds the active account whose phone number is the same
+// number once both are in E164. Account phone numbers are saved as typed, so the accounts whose
+// digits end with the national number are read and their numbers parsed in their own region
+func findAccountByPhone(number *phonenumber.Number) (*Account, error) {
+	candidates := make([]*Account, 0)
+	err := DBConnection.Table("account").
+		Where("active=? AND regexp_replace(phone_number, '[^0-9]', '', 'g') LIKE ?", true, "%"+number.NationalNumber).
+		Order("id").Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, candidate := range candidates {
+		region := candidate.DefaultRegion
+		if region == "" {
+			region = defaultPhoneRegion
+		}
+		if parsed, parseErr := phonenumber.Parse(candidate.PhoneNumber, region); parseErr == nil &&
+			parsed.E164() == number.E164() {
+			return candidate, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// ShareContact public method that shares a contact of an address book the account edits with another
+// account, sharing again with the same account changes the permission
+func (share *ContactShare) ShareContact(contactId, accountId uint) map[string]interface{} {
+	if share.Permission == "" {
+		share.Permission = ShareReadOnly
+	}
+	if share.Permission != ShareReadOnly && share.Permission != ShareReadWrite {
+		return utl.Message(102, "permission should be either read_only or read_write")
+	}
+
+	contact, err := fetchAccountContact(contactId, accountId)
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching contact from the DB: %v\n", err.Error())
+		return utl.Message(105, "failed to share contact, try again later")
+	}
+	if contact == nil {
+		return utl.Message(104, "contact not found")
+	}
+
+	grantee, resp := findAccount(share.Email, share.PhoneNumber, accountRegion(accountId))
+	if grantee == nil {
+		return resp
+	}
+	if grantee.ID == accountId {
+		return utl.Message(102, "a contact can not be shared with its own account")
+	}
+
+	result := &ContactShare{}
+	err = DBConnection.Where(ContactShare{ContactID: contactId, GranteeID: grantee.ID}).
+		Assign(ContactShare{OwnerID: accountId, Permission: share.Permission}).FirstOrCreate(result).Error
+	if err != nil {
+		log.Printf("WARNING | An error occurred while sharing contact: %d. Error: %v\n", contactId, err.Error())
+		return utl.Message(105, "failed to share contact, try again later")
+	}
+	result.Grantee = &ShareAccount{ID: grantee.ID, FirstName: grantee.FirstName, LastName: grantee.LastName,
+		Email: grantee.Email}
+
+	response := utl.Message(0, "contact shared successfully")
+	response["data"] = result
+	return response
+}
+
+// FetchContactShares public method that lists the accounts one of the account's contacts is shared with
+func (share *ContactShare) FetchContactShares(contactId, accountId uint) map[string]interface{} {
+	contact, err := fetchAccountContact(contactId, accountId)
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching contact from the DB: %v\n", err.Error())
+		return utl.Message(105, "failed to fetch shares, try again later")
+	}
+	if contact == nil {
+		return utl.Message(104, "contact not found")
+	}
+
+	shares := make([]*ContactShare, 0)
+	if err := DBConnection.Where("contact_id=?", contactId).Order("created_at, id").Find(&shares).Error; err != nil {
+		log.Printf("WARNING | An error occurred while fetching shares of contact: %d. Error: %v\n",
+			contactId, err.Error())
+		return utl.Message(105, "failed to fetch shares, try again later")
+	}
+
+	granteeIds := make([]uint, 0, len(shares))
+	for _, found := range shares {
+		granteeIds = append(granteeIds, found.GranteeID)
+	}
+	grantees, err := shareAccounts(granteeIds)
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching shares of contact: %d. Error: %v\n",
+			contactId, err.Error())
+		return utl.Message(105, "failed to fetch shares, try again later")
+	}
+	for _, found := range shares {
+		found.Grantee = grantees[found.GranteeID]
+	}
+
+	response := utl.Message(0, "shares fetched successfully")
+	response["data"] = shares
+	return response
+}
+
+// RevokeShare public method that removes a share. Owners and editors of the contact's address book
+// revoke it, the account it was shared with can also remove it to stop seeing the contact
+func (share *ContactShare) RevokeShare(shareId, contactId, accountId uint) map[string]interface{} {
+	found := &ContactShare{}
+	err := DBConnection.Where("id=? AND contact_id=?", shareId, contactId).First(found).Error
+	if err == nil && found.GranteeID != accountId {
+		var contact *Contact
+		contact, err = fetchAccountContact(contactId, accountId)
+		if err == nil && contact == nil {
+			err = gorm.ErrRecordNotFound
+		}
+	}
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return utl.Message(104, "share not found")
+		}
+		log.Printf("WARNING | An error occurred while fetching share from the DB: %v\n", err.Error())
+		return utl.Message(105, "failed to revoke share, try again later")
+	}
+
+	if err := DBConnection.Delete(found).Error; err != nil {
+		log.Printf("WARNING | An error occurred while revoking share: %d. Error: %v\n", shareId, err.Error())
+		return utl.Message(105, "failed to revoke share, try again later")
+	}
+	return utl.Message(0, "share revoked successfully")
+}
+
+// FetchSharedContacts public method that lists the contacts other accounts have shared with the
+// account, most recently shared first. They are kept apart from the account's own contacts.
+// Results are returned a page at a time, next_cursor is used to request the following page
+func (contact *Contact) FetchSharedContacts(accountId uint, limit int, cursor string) map[string]interface{} {
+	if limit == 0 {
+		limit = defaultPageLimit
+	}
+	if limit < 0 || limit > maxPageLimit {
+		return utl.Message(102, fmt.Sprintf("limit should be between 1 and %d", maxPageLimit))
+	}
+
+	query := DBConnection.Where("grantee_id=? AND contact_id IN (?)", accountId,
+		DBConnection.Table("contact").Select("id").Where("deleted_at IS NULL").SubQuery())
+	if cursor != "" {
+		sharedAt, lastId, err := decodeTimeCursor(cursor, "shared_at")
+		if err != nil {
+			return utl.Message(102, err.Error())
+		}
+		query = query.Where("(created_at, id) < (?, ?)", sharedAt, lastId)
+	}
+
+	// one more share than the limit is fetched to know whether there is a next page
+	shares := make([]*ContactShare, 0)
+	err := query.Order("created_at DESC, id DESC").Limit(limit + 1).Find(&shares).Error
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching contacts shared with account: %d. Error: %v\n",
+			accountId, err.Error())
+		return utl.Message(105, "failed to fetch shared contacts, try again later")
+	}
+	nextCursor := ""
+	if len(shares) > limit {
+		shares = shares[:limit]
+		nextCursor = encodeTimeCursor("shared_at", shares[limit-1].CreatedAt, shares[limit-1].ID)
+	}
+
+	contactIds := make([]uint, 0, len(shares))
+	ownerIds := make([]uint, 0, len(shares))
+	for _, share := range shares {
+		contactIds = append(contactIds, share.ContactID)
+		ownerIds = append(ownerIds, share.OwnerID)
+	}
+
+	contacts := make([]*Contact, 0)
+	err = preloadContactDetails(DBConnection.Table("contact")).Where("id IN (?)", contactIds).Find(&contacts).Error
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching contacts shared with account: %d. Error: %v\n",
+			accountId, err.Error())
+		return utl.Message(105, "failed to fetch shared contacts, try again later")
+	}
+	owners, err := shareAccounts(ownerIds)
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching contacts shared with account: %d. Error: %v\n",
+			accountId, err.Error())
+		return utl.Message(105, "failed to fetch shared contacts, try again later")
+	}
+
+	byId := make(map[uint]*Contact, len(contacts))
+	for _, found := range contacts {
+		found.Photo = photoURLs(found)
+		byId[found.ID] = found
+	}
+	results := make([]*SharedContact, 0, len(shares))
+	for _, share := range shares {
+		if found, ok := byId[share.ContactID]; ok {
+			results = append(results, &SharedContact{Contact: found, Permission: share.Permission,
+				Owner: owners[share.OwnerID], SharedAt: share.CreatedAt})
+		}
+	}
+
+	response := utl.Message(0, "shared contacts fetched successfully")
+	response["data"] = results
+	response["limit"] = limit
+	response["next_cursor"] = nextCursor
+	return response
+}
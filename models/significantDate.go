@@ -0,0 +1,189 @@
+package models
+
+import (
+	"fmt"
+	"github.com/cermu/Go-phoneBook-API/calendar"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"github.com/jinzhu/gorm"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const maxUpcomingDays = 366 // the upcoming events window can cover at most a year
+
+// dateKinds are the kinds of significant dates a contact can carry
+var dateKinds = []string{"birthday", "anniversary", "custom"}
+
+// ContactDate struct to store a contact's birthday, anniversary and custom labeled dates.
+// The year is optional, e.g. a birthday where only the day and month are known.
+// Contact has many ContactDates, ContactID is the foreign key
+type ContactDate struct {
+	gorm.Model        // fields `ID`, `CreatedAt`, `UpdatedAt`, `DeletedAt`will be added
+	ContactID  uint   `gorm:"not null;index:idx_contact_date_contact" json:"contact_id"`
+	Kind       string `gorm:"size:15;not null" json:"kind"`
+	Label      string `gorm:"size:50" json:"label"`
+	Month      int    `gorm:"not null" json:"month"`
+	Day        int    `gorm:"not null" json:"day"`
+	Year       *int   `json:"year"`
+}
+
+// UpcomingEvent struct describes the next occurrence of a contact's significant date
+type UpcomingEvent struct {
+	ContactID uint   `json:"contact_id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Kind      string `json:"kind"`
+	Label     string `json:"label,omitempty"`
+	Date      string `json:"date"`            // YYYY-MM-DD of the occurrence
+	DaysUntil int    `json:"days_until"`      // 0 means today
+	Years     *int   `json:"years,omitempty"` // age or years married, only when the year is known
+}
+
+// validateDate private method that checks a significant date before it is saved
+func (date *ContactDate) validateDate() (map[string]interface{}, bool) {
+	date.Kind = strings.ToLower(strings.TrimSpace(date.Kind))
+	date.Label = strings.TrimSpace(date.Label)
+	if !stringInSlice(date.Kind, dateKinds) {
+		return utl.Message(102, "date kind should be one of: "+strings.Join(dateKinds, ", ")), false
+	}
+	if date.Kind == "custom" && date.Label == "" {
+		return utl.Message(102, "custom dates require a label"), false
+	}
+	if len(date.Label) > 50 {
+		return utl.Message(102, "date label should not be more than 50 characters"), false
+	}
+
+	// Feb 29 is accepted without a year, with a year it has to be a leap year
+	year := 2000
+	if date.Year != nil {
+		if *date.Year < 1 || *date.Year > time.Now().Year()+1 {
+			return utl.Message(102, "date year is not valid"), false
+		}
+		year = *date.Year
+	}
+	if date.Month < 1 || date.Month > 12 || date.Day < 1 || date.Day > calendar.DaysIn(time.Month(date.Month), year) {
+		return utl.Message(102, fmt.Sprintf("%d-%d is not a valid month and day", date.Month, date.Day)), false
+	}
+	return utl.Message(0, "date validated successfully"), true
+}
+
+// validateDates private method that validates a contact's significant dates,
+// a contact can only have one birthday and one anniversary
+func (contact *Contact) validateDates() (map[string]interface{}, bool) {
+	seen := make(map[string]bool)
+	for i := range contact.Dates {
+		date := &contact.Dates[i]
+		date.ID, date.ContactID = 0, 0
+		if resp, ok := date.validateDate(); !ok {
+			return resp, false
+		}
+		if date.Kind != "custom" {
+			if seen[date.Kind] {
+				return utl.Message(102, "a contact can only have one "+date.Kind), false
+			}
+			seen[date.Kind] = true
+		}
+	}
+	return utl.Message(0, "dates validated successfully"), true
+}
+
+// saveDates private method that replaces a contact's significant dates when they are passed in an update
+func (contact *Contact) saveDates(tx *gorm.DB, contactId uint) error {
+	if contact.Dates == nil {
+		return nil
+	}
+	if err := tx.Unscoped().Where("contact_id=?", contactId).Delete(&ContactDate{}).Error; err != nil {
+		return err
+	}
+	for i := range contact.Dates {
+		contact.Dates[i].ContactID = contactId
+		if err := tx.Create(&contact.Dates[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upcomingEvents private function that lists the significant dates of the contacts in an account's address books that
+// occur within a number of days of the from date, soonest first
+func upcomingEvents(accountId uint, from time.Time, days int) ([]*UpcomingEvent, error) {
+	type dateRow struct {
+		ContactDate
+		FirstName string
+		LastName  string
+	}
+	rows := make([]*dateRow, 0)
+	err := DBConnection.Table("contact_date").
+		Select("contact_date.*, contact.first_name, contact.last_name").
+		Joins("JOIN contact ON contact.id = contact_date.contact_id").
+		Where("contact.address_book_id IN (?) AND contact.deleted_at IS NULL AND contact_date.deleted_at IS NULL",
+			accountBooks(accountId)).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*UpcomingEvent, 0)
+	for _, row := range rows {
+		occurrence := calendar.NextOccurrence(time.Month(row.Month), row.Day, from)
+		daysUntil := calendar.DaysBetween(from, occurrence)
+		if daysUntil >= days {
+			continue
+		}
+
+		event := &UpcomingEvent{ContactID: row.ContactID, FirstName: row.FirstName, LastName: row.LastName,
+			Kind: row.Kind, Label: row.Label, Date: occurrence.Format("2006-01-02"), DaysUntil: daysUntil}
+		if row.Year != nil && occurrence.Year() >= *row.Year {
+			years := occurrence.Year() - *row.Year
+			event.Years = &years
+		}
+		events = append(events, event)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].DaysUntil != events[j].DaysUntil {
+			return events[i].DaysUntil < events[j].DaysUntil
+		}
+		return strings.ToLower(events[i].FirstName+events[i].LastName) < strings.ToLower(events[j].FirstName+events[j].LastName)
+	})
+	return events, nil
+}
+
+// FetchUpcomingEvents public function that lists the birthdays, anniversaries and custom dates
+// of an account's contacts coming up in the next number of days, today included
+func FetchUpcomingEvents(accountId uint, days int) map[string]interface{} {
+	if days == 0 {
+		days = 30
+	}
+	if days < 0 || days > maxUpcomingDays {
+		return utl.Message(102, fmt.Sprintf("days should be between 1 and %d", maxUpcomingDays))
+	}
+
+	// today is read in the account's time zone, the same day the birthday digest is sent for
+	events, err := upcomingEvents(accountId, time.Now().In(accountLocation(accountId)), days)
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching upcoming events for account: %d. Error: %v\n",
+			accountId, err.Error())
+		return utl.Message(105, "failed to fetch upcoming events, try again later")
+	}
+
+	response := utl.Message(0, "upcoming events fetched successfully")
+	response["data"] = events
+	return response
+}
+
+// accountLocation private function that loads an account's time zone, falling back to UTC
+func accountLocation(accountId uint) *time.Location {
+	account := &Account{}
+	err := DBConnection.Table("account").Select("time_zone").Where("id=?", accountId).First(account).Error
+	if err != nil || account.TimeZone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(account.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
@@ -0,0 +1,270 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// contactSyncMigrations holds the statements that stamp every insert and update of a contact with
+// the id of the transaction making it, the delta sync returns the contacts written by transactions
+// a client has not seen yet. Contact revisions are stamped too, they report contacts moved to
+// another address book, and address books record when a contact was purged from their trash
+var contactSyncMigrations = []string{
+	`ALTER TABLE contact ADD COLUMN IF NOT EXISTS sync_txid bigint NOT NULL DEFAULT txid_current()`,
+	`CREATE OR REPLACE FUNCTION contact_sync_txid_update() RETURNS trigger AS $$
+	BEGIN
+		NEW.sync_txid := txid_current();
+		RETURN NEW;
+	END
+	$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS contact_sync_txid_trigger ON contact`,
+	`CREATE TRIGGER contact_sync_txid_trigger BEFORE INSERT OR UPDATE ON contact
+	FOR EACH ROW EXECUTE PROCEDURE contact_sync_txid_update()`,
+	`CREATE INDEX IF NOT EXISTS idx_contact_book_sync_txid ON contact (address_book_id, sync_txid, id)`,
+	`ALTER TABLE contact_revision ADD COLUMN IF NOT EXISTS sync_txid bigint NOT NULL DEFAULT txid_current()`,
+	`CREATE INDEX IF NOT EXISTS idx_contact_revision_sync_txid ON contact_revision (sync_txid)`,
+	`ALTER TABLE address_book ADD COLUMN IF NOT EXISTS purged_txid bigint NOT NULL DEFAULT 0`,
+}
+
+// migrateContactSync private function that creates the columns, trigger and indexes used by the delta sync
+func migrateContactSync() {
+	for _, statement := range contactSyncMigrations {
+		if err := DBConnection.Exec(statement).Error; err != nil {
+			log.Printf("WARNING | Contact sync migration failed with message: %v\n", err.Error())
+			return
+		}
+	}
+}
+
+// ContactTombstone struct reports a contact a client should remove: it was deleted, merged into
+// another contact or moved to an address book the account is not a member of
+type ContactTombstone struct {
+	ID           uint       `json:"id"`
+	Reason       string     `json:"reason"` // deleted, merged or moved
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+	MergedIntoID *uint      `json:"merged_into_id,omitempty"`
+}
+
+// syncToken private struct holding the position of a client in the stream of contact changes. It is
+// serialized to JSON and base64 encoded so that clients treat it as an opaque value.
+// Changes are ordered by (sync_txid, id), TxID and ID point after the last change returned. Since
+// is the oldest transaction that could still have been running when the sync started, the next
+// sync starts from it so that no late commit is missed. Issued is when the position the token
+// points at was taken, Started when the current sync started. Books is a digest of the address
+// books the account was a member of
+type syncToken struct {
+	TxID    int64  `json:"t"`
+	ID      uint   `json:"i"`
+	Since   int64  `json:"s"`
+	Full    bool   `json:"f,omitempty"` // a first sync, deleted contacts are left out
+	Issued  int64  `json:"at"`
+	Started int64  `json:"st"`
+	Books   string `json:"b"`
+}
+
+// encode private method that returns the opaque form of a sync token
+func (token *syncToken) encode() string {
+	raw, _ := json.Marshal(token)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeSyncToken private function that unpacks a sync token received from a client
+func decodeSyncToken(value string) (*syncToken, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("sync_token is not valid")
+	}
+	token := &syncToken{}
+	if err := json.Unmarshal(raw, token); err != nil || token.Issued == 0 || token.Books == "" {
+		return nil, fmt.Errorf("sync_token is not valid")
+	}
+	return token, nil
+}
+
+// booksDigest private function that returns a digest of the address books an account is a member
+// of, a sync token is only valid as long as they do not change
+func booksDigest(bookIds []uint) string {
+	ids := make([]string, 0, len(bookIds))
+	for _, id := range bookIds {
+		ids = append(ids, strconv.FormatUint(uint64(id), 10))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(ids, ",")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// fullResync private function that returns the response to a sync token that can not be used anymore
+func fullResync(reason string) map[string]interface{} {
+	response := utl.Message(108, "a full resync is required, "+reason)
+	response["full_resync"] = true
+	return response
+}
+
+// syncRow private struct holds the position of a contact in the stream of changes
+type syncRow struct {
+	ID       uint
+	SyncTxid int64
+}
+
+// SyncContacts public method that returns the contacts of the address books an account is a member of
+// that changed since a sync token, a page at a time. Without a token every contact is returned.
+// Deleted, merged and moved away contacts are returned as tombstones. The sync_token of the response
+// is passed in the next call, more tells whether the changes continue on another page.
+// Tokens older than the trash retention, tokens issued before the account joined or left an address
+// book and tokens issued before a contact was permanently deleted can not be used, a full resync
+// is required
+func (contact *Contact) SyncContacts(accountId uint, tokenValue string, limit int) map[string]interface{} {
+	if limit == 0 {
+		limit = defaultPageLimit
+	}
+	if limit < 0 || limit > maxPageLimit {
+		return utl.Message(102, fmt.Sprintf("limit should be between 1 and %d", maxPageLimit))
+	}
+
+	bookIds := make([]uint, 0)
+	err := DBConnection.Table("address_book_member").Where("account_id=?", accountId).Order("address_book_id").
+		Pluck("address_book_id", &bookIds).Error
+	if err != nil {
+		log.Printf("WARNING | An error occurred while syncing contacts of account: %d. Error: %v\n",
+			accountId, err.Error())
+		return utl.Message(105, "failed to sync contacts, try again later")
+	}
+	books := booksDigest(bookIds)
+
+	var row struct{ Since int64 }
+	err = DBConnection.Raw("SELECT txid_snapshot_xmin(txid_current_snapshot()) AS since").Scan(&row).Error
+	if err != nil {
+		log.Printf("WARNING | An error occurred while syncing contacts of account: %d. Error: %v\n",
+			accountId, err.Error())
+		return utl.Message(105, "failed to sync contacts, try again later")
+	}
+
+	// a new token starts a first sync, a token pointing at the start of a delta starts a new one
+	now := time.Now().Unix()
+	token := &syncToken{Since: row.Since, Full: true, Issued: now, Started: now, Books: books}
+	startsDelta := false
+	if tokenValue != "" {
+		previous, tokenErr := decodeSyncToken(tokenValue)
+		if tokenErr != nil {
+			return utl.Message(102, tokenErr.Error())
+		}
+		if previous.Books != books {
+			return fullResync("the address books of the account have changed")
+		}
+		if time.Since(time.Unix(previous.Issued, 0)) > TrashRetention() {
+			return fullResync("the sync token has expired")
+		}
+		token = previous
+		if !token.Full && token.ID == 0 {
+			startsDelta = true
+			token.Since, token.Started = row.Since, now
+		}
+	}
+
+	tombstones := make([]*ContactTombstone, 0)
+	if !token.Full {
+		var purged int
+		err = DBConnection.Table("address_book").Where("id IN (?) AND purged_txid >= ?", bookIds, token.TxID).
+			Count(&purged).Error
+		if err == nil && purged > 0 {
+			return fullResync("contacts were permanently deleted since the last sync")
+		}
+		if err == nil && startsDelta {
+			tombstones, err = movedContacts(bookIds, token.TxID)
+		}
+		if err != nil {
+			log.Printf("WARNING | An error occurred while syncing contacts of account: %d. Error: %v\n",
+				accountId, err.Error())
+			return utl.Message(105, "failed to sync contacts, try again later")
+		}
+	}
+
+	// the next page of changes, in the order they were made
+	rows := make([]*syncRow, 0)
+	query := DBConnection.Table("contact").Select("id, sync_txid").
+		Where("address_book_id IN (?) AND (sync_txid, id) > (?, ?)", bookIds, token.TxID, token.ID)
+	if token.Full {
+		query = query.Where("deleted_at IS NULL")
+	}
+	if err := query.Order("sync_txid, id").Limit(limit + 1).Scan(&rows).Error; err != nil {
+		log.Printf("WARNING | An error occurred while syncing contacts of account: %d. Error: %v\n",
+			accountId, err.Error())
+		return utl.Message(105, "failed to sync contacts, try again later")
+	}
+	more := len(rows) > limit
+	if more {
+		rows = rows[:limit]
+	}
+
+	ids := make([]uint, 0, len(rows))
+	for _, found := range rows {
+		ids = append(ids, found.ID)
+	}
+	contacts := make([]*Contact, 0, len(rows))
+	err = preloadContactDetails(DBConnection.Unscoped().Table("contact")).Where("id IN (?)", ids).
+		Find(&contacts).Error
+	if err != nil {
+		log.Printf("WARNING | An error occurred while syncing contacts of account: %d. Error: %v\n",
+			accountId, err.Error())
+		return utl.Message(105, "failed to sync contacts, try again later")
+	}
+	byId := make(map[uint]*Contact, len(contacts))
+	for _, found := range contacts {
+		byId[found.ID] = found
+	}
+
+	changed := make([]*Contact, 0, len(rows))
+	for _, found := range rows {
+		result, ok := byId[found.ID]
+		if !ok {
+			continue
+		}
+		if result.DeletedAt != nil {
+			tombstone := &ContactTombstone{ID: result.ID, Reason: "deleted", DeletedAt: result.DeletedAt,
+				MergedIntoID: result.MergedIntoID}
+			if result.MergedIntoID != nil {
+				tombstone.Reason = "merged"
+			}
+			tombstones = append(tombstones, tombstone)
+			continue
+		}
+		result.Photo = photoURLs(result)
+		changed = append(changed, result)
+	}
+
+	// continue after the last change returned, or from the start of this sync once it is complete
+	if more {
+		last := rows[len(rows)-1]
+		token.TxID, token.ID = last.SyncTxid, last.ID
+	} else {
+		token.TxID, token.ID, token.Full, token.Issued = token.Since, 0, false, token.Started
+	}
+
+	response := utl.Message(0, "contacts synced successfully")
+	response["data"] = changed
+	response["deleted"] = tombstones
+	response["sync_token"] = token.encode()
+	response["more"] = more
+	return response
+}
+
+// movedContacts private function that returns tombstones for the contacts moved from one of the
+// address books to another address book by transactions from txid on
+func movedContacts(bookIds []uint, txid int64) ([]*ContactTombstone, error) {
+	tombstones := make([]*ContactTombstone, 0)
+	if len(bookIds) == 0 {
+		return tombstones, nil
+	}
+	err := DBConnection.Raw(`SELECT DISTINCT r.contact_id AS id, 'moved' AS reason FROM contact_revision r
+		JOIN contact c ON c.id = r.contact_id
+		WHERE r.sync_txid >= ? AND (r.changes->'address_book_id'->>'old')::bigint IN (?)
+		AND c.address_book_id NOT IN (?)`, txid, bookIds, bookIds).Scan(&tombstones).Error
+	return tombstones, err
+}
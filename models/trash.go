@@ -0,0 +1,214 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"github.com/cermu/Go-phoneBook-API/lock"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"github.com/jinzhu/gorm"
+	"log"
+	"time"
+)
+
+const (
+	defaultRetentionDays = 30
+	purgeBatchSize       = 500
+	purgeLockKey         = "trash:purge:run" // held by the replica purging the trash
+)
+
+// TrashRetention public function that returns how long deleted contacts stay in the trash
+// before they are purged, from TRASH.RETENTION_DAYS
+func TrashRetention() time.Duration {
+	days := utl.ReadConfigs().GetInt("TRASH.RETENTION_DAYS")
+	if days <= 0 {
+		days = defaultRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// trashedContact private function that loads a deleted contact of an address book the account owns
+// or edits. Contacts merged into another contact are not in the trash, they can not be restored
+func trashedContact(contactId, accountId uint) (*Contact, map[string]interface{}) {
+	contact := &Contact{}
+	err := DBConnection.Unscoped().Table("contact").
+		Where("id=? AND deleted_at IS NOT NULL AND merged_into_id IS NULL AND address_book_id IN (?)",
+			contactId, editableBooks(accountId)).First(contact).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, utl.Message(104, "contact not found in trash")
+		}
+		log.Printf("WARNING | An error occurred while fetching contact from the trash: %v\n", err.Error())
+		return nil, utl.Message(105, "failed to fetch contact, try again later")
+	}
+	return contact, nil
+}
+
+// FetchTrash public method that lists the deleted contacts of the address books the account owns
+// or edits, most recently deleted first. They are purged once the retention period has passed.
+// Results are returned a page at a time, next_cursor is used to request the following page
+func (contact *Contact) FetchTrash(accountId uint, limit int, cursor string) map[string]interface{} {
+	if limit == 0 {
+		limit = defaultPageLimit
+	}
+	if limit < 0 || limit > maxPageLimit {
+		return utl.Message(102, fmt.Sprintf("limit should be between 1 and %d", maxPageLimit))
+	}
+
+	query := preloadContactDetails(DBConnection.Unscoped().Table("contact")).
+		Where("address_book_id IN (?) AND deleted_at IS NOT NULL AND merged_into_id IS NULL", editableBooks(accountId))
+	if cursor != "" {
+		deletedAt, lastId, err := decodeTimeCursor(cursor, "deleted_at")
+		if err != nil {
+			return utl.Message(102, err.Error())
+		}
+		query = query.Where("(deleted_at, id) < (?, ?)", deletedAt, lastId)
+	}
+
+	// one more contact than the limit is fetched to know whether there is a next page
+	contacts := make([]*Contact, 0)
+	err := query.Order("deleted_at DESC, id DESC").Limit(limit + 1).Find(&contacts).Error
+	if err != nil {
+		log.Printf("WARNING | An error occurred while fetching trash for account: %d. Error: %v\n",
+			accountId, err.Error())
+		return utl.Message(105, "failed to fetch deleted contacts, try again later")
+	}
+	nextCursor := ""
+	if len(contacts) > limit {
+		contacts = contacts[:limit]
+		last := contacts[limit-1]
+		nextCursor = encodeTimeCursor("deleted_at", *last.DeletedAt, last.ID)
+	}
+
+	response := utl.Message(0, "deleted contacts fetched successfully")
+	response["data"] = contacts
+	response["limit"] = limit
+	response["next_cursor"] = nextCursor
+	response["retention_days"] = int(TrashRetention().Hours() / 24)
+	return response
+}
+
+// RestoreContact public method that brings a contact back from the trash
+func (contact *Contact) RestoreContact(contactId, accountId uint) map[string]interface{} {
+	if _, errResponse := trashedContact(contactId, accountId); errResponse != nil {
+		return errResponse
+	}
+
+	tx := DBConnection.Begin()
+	before, err := loadContactState(tx, contactId)
+	if err == nil {
+		err = tx.Unscoped().Table("contact").Where("id=?", contactId).
+			UpdateColumns(map[string]interface{}{"deleted_at": nil, "updated_at": time.Now()}).Error
+	}
+	if err == nil {
+		err = recordRevision(tx, contactId, accountId, RevisionRestored, before)
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		log.Printf("WARNING | An error occurred while restoring contact: %d. Error: %v\n", contactId, err.Error())
+		return utl.Message(105, "failed to restore contact, try again later")
+	}
+
+	result := &Contact{}
+	preloadContactDetails(DBConnection.Table("contact")).First(result, contactId)
+	result.Photo = photoURLs(result)
+	response := utl.Message(0, "contact restored successfully")
+	response["data"] = result
+	return response
+}
+
+// PurgeContact public method that permanently deletes a contact from the trash together with its
+// phone numbers, emails, addresses, dates, notes and photo
+func (contact *Contact) PurgeContact(contactId, accountId uint) map[string]interface{} {
+	trashed, errResponse := trashedContact(contactId, accountId)
+	if errResponse != nil {
+		return errResponse
+	}
+
+	// clients syncing the address book may not have seen the contact's tombstone yet, they resync
+	tx := DBConnection.Begin()
+	err := tx.Unscoped().Where("id=?", contactId).Delete(&Contact{}).Error
+	if err == nil {
+		err = tx.Table("address_book").Where("id=?", trashed.AddressBookID).
+			UpdateColumn("purged_txid", gorm.Expr("txid_current()")).Error
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		log.Printf("WARNING | An error occurred while purging contact: %d. Error: %v\n", contactId, err.Error())
+		return utl.Message(105, "failed to delete contact, try again later")
+	}
+	if trashed.PhotoID != "" {
+		deletePhotoBlobs(trashed.ID, trashed.PhotoID, trashed.PhotoType)
+	}
+	return utl.Message(0, "contact permanently deleted")
+}
+
+// PurgeTrash public function that permanently deletes the contacts deleted before a point in time,
+// merged away contacts included. The rows of the other tables go with them through the foreign
+// keys, photos are removed from the photo storage. It returns the number of contacts purged
+func PurgeTrash(before time.Time) (int, error) {
+	purged := 0
+	for {
+		contacts := make([]*Contact, 0)
+		err := DBConnection.Unscoped().Table("contact").Select("id, photo_id, photo_type").
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", before).Limit(purgeBatchSize).Find(&contacts).Error
+		if err != nil {
+			return purged, err
+		}
+		if len(contacts) == 0 {
+			return purged, nil
+		}
+
+		ids := make([]uint, 0, len(contacts))
+		for _, contact := range contacts {
+			ids = append(ids, contact.ID)
+		}
+		if err := DBConnection.Unscoped().Where("id IN (?)", ids).Delete(&Contact{}).Error; err != nil {
+			return purged, err
+		}
+		for _, contact := range contacts {
+			if contact.PhotoID != "" {
+				deletePhotoBlobs(contact.ID, contact.PhotoID, contact.PhotoType)
+			}
+		}
+		purged += len(contacts)
+	}
+}
+
+// RunTrashPurge public function that purges the contacts that have been in the trash longer than
+// the retention period every interval until the context is cancelled. The lock makes sure only
+// one replica purges at a time
+func RunTrashPurge(ctx context.Context, locker lock.Locker, interval time.Duration) {
+	for {
+		obtained, err := locker.Obtain(purgeLockKey, interval)
+		if err != nil {
+			log.Printf("WARNING | An error occurred while taking the trash purge lock: %v\n", err.Error())
+		}
+		if obtained {
+			purged, purgeErr := PurgeTrash(time.Now().Add(-TrashRetention()))
+			if purgeErr != nil {
+				log.Printf("WARNING | An error occurred while purging the trash: %v\n", purgeErr.Error())
+			}
+			if purged > 0 {
+				log.Printf("INFO | Purged %d contacts from the trash\n", purged)
+			}
+			if releaseErr := locker.Release(purgeLockKey); releaseErr != nil {
+				log.Printf("WARNING | An error occurred while releasing the trash purge lock: %v\n",
+					releaseErr.Error())
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"fmt"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"github.com/cermu/Go-phoneBook-API/vcard"
+	"github.com/jinzhu/gorm"
+	"log"
+	"net/http"
+)
+
+const exportPageSize = 200 // number of contacts read at a time by the bulk export
+
+// toVCard private method that maps a contact to a vCard
+func (contact *Contact) toVCard() *vcard.Card {
+	card := &vcard.Card{
+		UID:       fmt.Sprintf("phonebook-contact-%d", contact.ID),
+		FirstName: contact.FirstName,
+		LastName:  contact.LastName,
+		Revision:  contact.UpdatedAt,
+	}
+	if contact.VCardUID != "" {
+		card.UID = contact.VCardUID
+	}
+	for _, phone := range contact.Phones {
+		card.Phones = append(card.Phones, vcard.Phone{Type: phone.Label,
+			Value: phone.Number, Preferred: phone.Primary})
+	}
+	for _, email := range contact.Emails {
+		card.Emails = append(card.Emails, vcard.Email{Type: email.Label, Value: email.Address,
+			Preferred: email.Primary})
+	}
+
+	for _, address := range contact.Addresses {
+		card.Addresses = append(card.Addresses, vcard.Address{Type: address.Label, Street: address.Street,
+			City: address.City, Region: address.Region, PostalCode: address.PostalCode, Country: address.Country})
+	}
+
+	// contacts whose lists were not loaded still export their primary values
+	if len(contact.Phones) == 0 && contact.PhoneNumber != "" {
+		card.Phones = append(card.Phones, vcard.Phone{Type: "mobile", Value: contact.PhoneNumber})
+	}
+	if len(contact.Emails) == 0 && contact.Email != "" {
+		card.Emails = append(card.Emails, vcard.Email{Value: contact.Email})
+	}
+	return card
+}
+
+// setVCardHeaders private function that sets the headers of a .vcf download
+func setVCardHeaders(w http.ResponseWriter, version, filename string) {
+	w.Header().Set("Content-Type", "text/vcard; charset=utf-8; version="+version)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+}
+
+// ExportContactsVCard public function that streams all of an account's contacts as a .vcf file. Contacts are
+// read a page at a time together with their phone numbers, emails, addresses and photos, so memory use does
+// not grow with the size of the phone book. It returns a response message when the export could not be
+// started, nil once the file has been streamed
+func ExportContactsVCard(accountId uint, version string, w http.ResponseWriter) map[string]interface{} {
+	var last *Contact
+	for {
+		page := make([]*Contact, 0, exportPageSize)
+		query := DBConnection.Table("contact").Preload("Phones").Preload("Emails").Preload("Addresses").
+			Where("address_book_id IN (?) AND deleted_at IS NULL", accountBooks(accountId))
+		if last != nil {
+			query = query.Where("(coalesce(first_name, ''), coalesce(last_name, ''), id) > (?, ?, ?)",
+				last.FirstName, last.LastName, last.ID)
+		}
+		err := query.Order("coalesce(first_name, ''), coalesce(last_name, ''), id").Limit(exportPageSize).Find(&page).Error
+		if err != nil {
+			log.Printf("WARNING | An error occurred while exporting contacts for account: %d. Error: %v\n",
+				accountId, err.Error())
+			if last == nil {
+				return utl.Message(105, "failed to export contacts, try again later")
+			}
+			return nil
+		}
+		if last == nil {
+			setVCardHeaders(w, version, "contacts.vcf")
+		}
+
+		photos := vCardPhotos(page)
+		for i, contact := range page {
+			card := contact.toVCard()
+			card.Photo = photos[i]
+			if encodeErr := vcard.Encode(w, card, version); encodeErr != nil {
+				log.Printf("WARNING | An error occurred while streaming vCard export: %v\n", encodeErr.Error())
+				return nil
+			}
+		}
+		if len(page) < exportPageSize {
+			return nil
+		}
+		last = page[len(page)-1]
+	}
+}
+
+// ExportContactVCard public method that writes a single contact the account can see as a .vcf file.
+// It returns a response message when the contact could not be exported, nil once it has been written
+func (contact *Contact) ExportContactVCard(contactId, accountId uint, version string, w http.ResponseWriter) map[string]interface{} {
+	if errResponse := contactCheck(contactId, accountId, false); errResponse != nil {
+		return errResponse
+	}
+
+	err := DBConnection.Table("contact").Preload("Phones").Preload("Emails").Preload("Addresses").
+		Where("id=?", contactId).First(contact).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return utl.Message(104, "contact not found")
+		}
+		log.Printf("WARNING | An error occurred while fetching contact for export: %v\n", err.Error())
+		return utl.Message(105, "failed to export contact, try again later")
+	}
+
+	card := contact.toVCard()
+	card.Photo = vCardPhoto(contact)
+	setVCardHeaders(w, version, fmt.Sprintf("contact-%d.vcf", contact.ID))
+	if encodeErr := vcard.Encode(w, card, version); encodeErr != nil {
+		log.Printf("WARNING | An error occurred while writing vCard export: %v\n", encodeErr.Error())
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	utl "github.com/cermu/Go-phoneBook-API/utils"
+	"github.com/cermu/Go-phoneBook-API/vcard"
+	"io"
+	"log"
+	"strings"
+)
+
+// ImportRejection struct describes a record that was skipped during an import
+type ImportRejection struct {
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+}
+
+// contactFromVCard private function that maps a vCard to a contact, preferred
+// phone numbers and emails become the primary entries
+func contactFromVCard(card *vcard.Card) *Contact {
+	contact := &Contact{FirstName: card.FirstName, LastName: card.LastName}
+	if contact.FirstName == "" && contact.LastName == "" {
+		names := strings.SplitN(strings.TrimSpace(card.FullName), " ", 2)
+		contact.FirstName = names[0]
+		if len(names) > 1 {
+			contact.LastName = strings.TrimSpace(names[1])
+		}
+	}
+
+	for _, phone := range card.Phones {
+		contact.Phones = append(contact.Phones, ContactPhone{Label: phone.Type,
+			Number: phone.Value, Primary: phone.Preferred})
+	}
+	for _, email := range card.Emails {
+		contact.Emails = append(contact.Emails, ContactEmail{Label: email.Type, Address: email.Value,
+			Primary: email.Preferred})
+	}
+	for _, address := range card.Addresses {
+		contact.Addresses = append(contact.Addresses, ContactAddress{Label: address.Type, Street: address.Street,
+			City: address.City, Region: address.Region, PostalCode: address.PostalCode, Country: address.Country})
+	}
+	onlyFirstPrimary(contact)
+	return contact
+}
+
+// ImportVCards public function that saves the cards in a .vcf file as contacts of an account, in one
+// of its address books (its personal book when bookId is 0). Every card goes through the same
+// validation as CreateContact, valid cards are saved in a single transaction and every rejected
+// card is reported with its index and the reason it was skipped
+func ImportVCards(accountId, bookId uint, r io.Reader) map[string]interface{} {
+	bookId, errResponse := writableBook(bookId, accountId)
+	if errResponse != nil {
+		return errResponse
+	}
+
+	results, err := vcard.Decode(r)
+	if err != nil {
+		log.Printf("WARNING | An error occurred while reading vCard import: %v\n", err.Error())
+		return utl.Message(102, "failed to read the uploaded file, try again")
+	}
+	if len(results) == 0 {
+		return utl.Message(102, "the uploaded file does not contain any vCards")
+	}
+
+	region := accountRegion(accountId)
+	contacts := make([]*Contact, 0, len(results))
+	rejected := make([]*ImportRejection, 0)
+	for _, result := range results {
+		if result.Err != nil {
+			rejected = append(rejected, &ImportRejection{Index: result.Index, Reason: result.Err.Error()})
+			continue
+		}
+
+		contact := contactFromVCard(result.Card)
+		if resp, ok := contact.validateContactData(region); !ok {
+			rejected = append(rejected, &ImportRejection{Index: result.Index,
+				Reason: resp["response_description"].(string)})
+			continue
+		}
+		contact.AccountID, contact.AddressBookID = accountId, bookId
+		contacts = append(contacts, contact)
+	}
+
+	// save the valid contacts, all or nothing
+	tx := DBConnection.Begin()
+	for _, contact := range contacts {
+		createErr := tx.Table("contact").Create(contact).Error
+		if createErr == nil {
+			createErr = recordRevision(tx, contact.ID, accountId, RevisionCreated, nil)
+		}
+		if createErr != nil {
+			tx.Rollback()
+			log.Printf("WARNING | An error occurred while saving imported contacts: %v\n", createErr.Error())
+			return utl.Message(105, "failed to import contacts, try again later")
+		}
+	}
+	if commitErr := tx.Commit().Error; commitErr != nil {
+		log.Printf("WARNING | An error occurred while saving imported contacts: %v\n", commitErr.Error())
+		return utl.Message(105, "failed to import contacts, try again later")
+	}
+
+	response := utl.Message(0, "contacts imported successfully")
+	response["imported"] = len(contacts)
+	response["rejected"] = rejected
+	return response
+}
+
+// onlyFirstPrimary private function that keeps the first preferred phone number and email
+// as primary, cards sometimes mark several values as preferred
+func onlyFirstPrimary(contact *Contact) {
+	seen := false
+	for i := range contact.Phones {
+		contact.Phones[i].Primary = contact.Phones[i].Primary && !seen
+		seen = seen || contact.Phones[i].Primary
+	}
+	seen = false
+	for i := range contact.Emails {
+		contact.Emails[i].Primary = contact.Emails[i].Primary && !seen
+		seen = seen || contact.Emails[i].Primary
+	}
+}
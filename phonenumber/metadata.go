@@ -0,0 +1,137 @@
+package phonenumber
+
+// territory struct holds the numbering metadata of a region
+type territory struct {
+	region      string // ISO 3166-1 alpha-2 code
+	callingCode string // country calling code without the leading +
+	trunkPrefix string // dialled before national numbers inside the country, e.g. 0
+	minLength   int    // shortest national significant number
+	maxLength   int    // longest national significant number
+}
+
+// territories is the bundled numbering metadata. Regions sharing a calling code are listed with
+// the main region first, it is the one reported for international numbers of that calling code
+var territories = []territory{
+	// East Africa
+	{"KE", "254", "0", 8, 10},
+	{"UG", "256", "0", 9, 9},
+	{"TZ", "255", "0", 9, 9},
+	{"RW", "250", "0", 9, 9},
+	{"BI", "257", "", 8, 8},
+	{"ET", "251", "0", 9, 9},
+	{"SO", "252", "0", 7, 9},
+	{"SS", "211", "0", 9, 9},
+	{"SD", "249", "0", 9, 9},
+	{"DJ", "253", "", 8, 8},
+	{"ER", "291", "0", 7, 7},
+	{"CD", "243", "0", 7, 9},
+
+	// rest of Africa
+	{"NG", "234", "0", 8, 10},
+	{"GH", "233", "0", 9, 9},
+	{"ZA", "27", "0", 9, 9},
+	{"EG", "20", "0", 8, 10},
+	{"MA", "212", "0", 9, 9},
+	{"DZ", "213", "0", 8, 9},
+	{"TN", "216", "", 8, 8},
+	{"LY", "218", "0", 8, 9},
+	{"CM", "237", "", 9, 9},
+	{"CI", "225", "", 10, 10},
+	{"SN", "221", "", 9, 9},
+	{"ZM", "260", "0", 9, 9},
+	{"ZW", "263", "0", 8, 10},
+	{"MW", "265", "0", 7, 9},
+	{"MZ", "258", "", 8, 9},
+	{"AO", "244", "", 9, 9},
+	{"BW", "267", "", 7, 8},
+	{"NA", "264", "0", 8, 10},
+	{"MU", "230", "", 7, 8},
+
+	// North America, the NANP regions share +1
+	{"US", "1", "1", 10, 10},
+	{"CA", "1", "1", 10, 10},
+
+	// Latin America
+	{"MX", "52", "", 10, 10},
+	{"BR", "55", "0", 10, 11},
+	{"AR", "54", "0", 10, 11},
+	{"CL", "56", "", 9, 9},
+	{"CO", "57", "", 8, 10},
+	{"PE", "51", "0", 8, 9},
+	{"VE", "58", "0", 10, 10},
+	{"EC", "593", "0", 8, 9},
+
+	// Europe
+	{"GB", "44", "0", 9, 10},
+	{"IE", "353", "0", 7, 9},
+	{"FR", "33", "0", 9, 9},
+	{"DE", "49", "0", 6, 13},
+	{"NL", "31", "0", 9, 9},
+	{"BE", "32", "0", 8, 9},
+	{"LU", "352", "", 4, 11},
+	{"CH", "41", "0", 9, 9},
+	{"AT", "43", "0", 4, 13},
+	{"IT", "39", "", 6, 11}, // Italian fixed line numbers keep their leading 0
+	{"ES", "34", "", 9, 9},
+	{"PT", "351", "", 9, 9},
+	{"SE", "46", "0", 7, 10},
+	{"NO", "47", "", 8, 8},
+	{"DK", "45", "", 8, 8},
+	{"FI", "358", "0", 5, 12},
+	{"PL", "48", "", 9, 9},
+	{"CZ", "420", "", 9, 9},
+	{"SK", "421", "0", 9, 9},
+	{"HU", "36", "06", 8, 9},
+	{"RO", "40", "0", 9, 9},
+	{"BG", "359", "0", 8, 9},
+	{"GR", "30", "", 10, 10},
+	{"TR", "90", "0", 10, 10},
+	{"UA", "380", "0", 9, 9},
+	{"RU", "7", "8", 10, 10},
+	{"KZ", "7", "8", 10, 10},
+
+	// Middle East
+	{"IL", "972", "0", 8, 9},
+	{"AE", "971", "0", 8, 9},
+	{"SA", "966", "0", 9, 9},
+	{"QA", "974", "", 8, 8},
+	{"KW", "965", "", 8, 8},
+	{"OM", "968", "", 8, 8},
+	{"JO", "962", "0", 8, 9},
+	{"LB", "961", "0", 7, 8},
+
+	// Asia and Oceania
+	{"IN", "91", "0", 10, 10},
+	{"PK", "92", "0", 9, 10},
+	{"BD", "880", "0", 10, 10},
+	{"LK", "94", "0", 9, 9},
+	{"NP", "977", "0", 8, 10},
+	{"CN", "86", "0", 10, 11},
+	{"JP", "81", "0", 9, 10},
+	{"KR", "82", "0", 8, 10},
+	{"HK", "852", "", 8, 8},
+	{"SG", "65", "", 8, 8},
+	{"MY", "60", "0", 9, 10},
+	{"TH", "66", "0", 8, 9},
+	{"VN", "84", "0", 9, 10},
+	{"PH", "63", "0", 8, 10},
+	{"ID", "62", "0", 9, 12},
+	{"AU", "61", "0", 9, 9},
+	{"NZ", "64", "0", 8, 10},
+}
+
+// byRegion and byCallingCode index the territories, they are filled in by init
+var (
+	byRegion      = make(map[string]*territory)
+	byCallingCode = make(map[string]*territory)
+)
+
+func init() {
+	for i := range territories {
+		t := &territories[i]
+		byRegion[t.region] = t
+		if _, ok := byCallingCode[t.callingCode]; !ok {
+			byCallingCode[t.callingCode] = t
+		}
+	}
+}
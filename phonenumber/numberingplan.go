@@ -0,0 +1,183 @@
+package phonenumber
+
+// Line types reported by Lookup
+const (
+	Mobile        = "mobile"
+	Fixed         = "fixed"
+	FixedOrMobile = "fixed_or_mobile" // NANP numbers do not tell mobile and fixed lines apart
+	TollFree      = "toll_free"
+	Premium       = "premium"
+	Unknown       = "unknown"
+)
+
+// LineTypes are the line types a number can be reported with
+var LineTypes = []string{Mobile, Fixed, FixedOrMobile, TollFree, Premium, Unknown}
+
+// LineInfo struct describes what the numbering plan says about a number
+type LineInfo struct {
+	LineType string
+	Network  string // mobile network operator the range was allocated to, empty when unknown
+}
+
+// planEntry struct maps a national number prefix to a line type and, for mobile ranges, an operator
+type planEntry struct {
+	prefix   string
+	lineType string
+	network  string
+}
+
+// nanpPlan is shared by the NANP regions
+var nanpPlan = []planEntry{
+	{"800", TollFree, ""},
+	{"833", TollFree, ""},
+	{"844", TollFree, ""},
+	{"855", TollFree, ""},
+	{"866", TollFree, ""},
+	{"877", TollFree, ""},
+	{"888", TollFree, ""},
+	{"900", Premium, ""},
+	{"", FixedOrMobile, ""},
+}
+
+// numberingPlans holds the prefixes of the national significant number of each region, the
+// longest matching prefix wins. Operators are recorded for the East African mobile ranges, where
+// they are allocated by prefix. Regions without a plan report Unknown
+var numberingPlans = map[string][]planEntry{
+	"KE": {
+		{"70", Mobile, "Safaricom"},
+		{"71", Mobile, "Safaricom"},
+		{"72", Mobile, "Safaricom"},
+		{"740", Mobile, "Safaricom"},
+		{"741", Mobile, "Safaricom"},
+		{"742", Mobile, "Safaricom"},
+		{"743", Mobile, "Safaricom"},
+		{"745", Mobile, "Safaricom"},
+		{"746", Mobile, "Safaricom"},
+		{"748", Mobile, "Safaricom"},
+		{"757", Mobile, "Safaricom"},
+		{"758", Mobile, "Safaricom"},
+		{"759", Mobile, "Safaricom"},
+		{"768", Mobile, "Safaricom"},
+		{"769", Mobile, "Safaricom"},
+		{"79", Mobile, "Safaricom"},
+		{"110", Mobile, "Safaricom"},
+		{"111", Mobile, "Safaricom"},
+		{"112", Mobile, "Safaricom"},
+		{"113", Mobile, "Safaricom"},
+		{"114", Mobile, "Safaricom"},
+		{"115", Mobile, "Safaricom"},
+		{"73", Mobile, "Airtel"},
+		{"750", Mobile, "Airtel"},
+		{"751", Mobile, "Airtel"},
+		{"752", Mobile, "Airtel"},
+		{"753", Mobile, "Airtel"},
+		{"754", Mobile, "Airtel"},
+		{"755", Mobile, "Airtel"},
+		{"756", Mobile, "Airtel"},
+		{"762", Mobile, "Airtel"},
+		{"78", Mobile, "Airtel"},
+		{"100", Mobile, "Airtel"},
+		{"101", Mobile, "Airtel"},
+		{"102", Mobile, "Airtel"},
+		{"77", Mobile, "Telkom"},
+		{"763", Mobile, "Equitel"},
+		{"764", Mobile, "Equitel"},
+		{"765", Mobile, "Equitel"},
+		{"766", Mobile, "Equitel"},
+		{"747", Mobile, "Faiba"},
+		{"7", Mobile, ""},
+		{"1", Mobile, ""},
+		{"800", TollFree, ""},
+		{"900", Premium, ""},
+		{"2", Fixed, ""},
+		{"4", Fixed, ""},
+		{"5", Fixed, ""},
+		{"6", Fixed, ""},
+	},
+	"UG": {
+		{"70", Mobile, "Airtel"},
+		{"74", Mobile, "Airtel"},
+		{"75", Mobile, "Airtel"},
+		{"76", Mobile, "MTN"},
+		{"77", Mobile, "MTN"},
+		{"78", Mobile, "MTN"},
+		{"71", Mobile, "Uganda Telecom"},
+		{"7", Mobile, ""},
+		{"800", TollFree, ""},
+		{"900", Premium, ""},
+		{"2", Fixed, ""},
+		{"3", Fixed, ""},
+		{"4", Fixed, ""},
+	},
+	"TZ": {
+		{"74", Mobile, "Vodacom"},
+		{"75", Mobile, "Vodacom"},
+		{"76", Mobile, "Vodacom"},
+		{"68", Mobile, "Airtel"},
+		{"69", Mobile, "Airtel"},
+		{"78", Mobile, "Airtel"},
+		{"65", Mobile, "Tigo"},
+		{"67", Mobile, "Tigo"},
+		{"71", Mobile, "Tigo"},
+		{"77", Mobile, "Tigo"},
+		{"61", Mobile, "Halotel"},
+		{"62", Mobile, "Halotel"},
+		{"73", Mobile, "TTCL"},
+		{"6", Mobile, ""},
+		{"7", Mobile, ""},
+		{"800", TollFree, ""},
+		{"900", Premium, ""},
+		{"2", Fixed, ""},
+	},
+	"RW": {
+		{"78", Mobile, "MTN"},
+		{"79", Mobile, "MTN"},
+		{"72", Mobile, "Airtel"},
+		{"73", Mobile, "Airtel"},
+		{"7", Mobile, ""},
+		{"800", TollFree, ""},
+		{"2", Fixed, ""},
+	},
+	"ET": {
+		{"9", Mobile, "Ethio Telecom"},
+		{"7", Mobile, "Safaricom Ethiopia"},
+		{"1", Fixed, ""},
+		{"2", Fixed, ""},
+		{"3", Fixed, ""},
+		{"4", Fixed, ""},
+		{"5", Fixed, ""},
+	},
+	"GB": {
+		{"71", Mobile, ""},
+		{"72", Mobile, ""},
+		{"73", Mobile, ""},
+		{"74", Mobile, ""},
+		{"75", Mobile, ""},
+		{"77", Mobile, ""},
+		{"78", Mobile, ""},
+		{"79", Mobile, ""},
+		{"800", TollFree, ""},
+		{"808", TollFree, ""},
+		{"9", Premium, ""},
+		{"1", Fixed, ""},
+		{"2", Fixed, ""},
+		{"3", Fixed, ""},
+	},
+	"US": nanpPlan,
+	"CA": nanpPlan,
+}
+
+// Lookup public method that finds the line type and operator of a number in the bundled numbering plans
+func (number *Number) Lookup() LineInfo {
+	var match *planEntry
+	for i, entry := range numberingPlans[number.Region] {
+		if len(number.NationalNumber) >= len(entry.prefix) && number.NationalNumber[:len(entry.prefix)] == entry.prefix &&
+			(match == nil || len(entry.prefix) > len(match.prefix)) {
+			match = &numberingPlans[number.Region][i]
+		}
+	}
+	if match == nil {
+		return LineInfo{LineType: Unknown}
+	}
+	return LineInfo{LineType: match.lineType, Network: match.network}
+}
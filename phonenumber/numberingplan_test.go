@@ -0,0 +1,73 @@
+package phonenumber
+
+import (
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		input    string
+		lineType string
+		network  string
+	}{
+		{"+254712345678", Mobile, "Safaricom"},
+		{"+254110345678", Mobile, "Safaricom"},
+		{"+254733345678", Mobile, "Airtel"},
+		{"+254100345678", Mobile, "Airtel"},
+		{"+254772345678", Mobile, "Telkom"},
+		{"+254763345678", Mobile, "Equitel"},
+		{"+254747345678", Mobile, "Faiba"},
+		{"+254760345678", Mobile, ""}, // an unallocated mobile range falls back to the shorter prefix
+		{"+254202222222", Fixed, ""},
+		{"+254800221234", TollFree, ""},
+		{"+254900221234", Premium, ""},
+		{"+254312345678", Unknown, ""}, // no prefix matches
+		{"+256772345678", Mobile, "MTN"},
+		{"+255742345678", Mobile, "Vodacom"},
+		{"+250782345678", Mobile, "MTN"},
+		{"+447912345678", Mobile, ""},
+		{"+442079460000", Fixed, ""},
+		{"+448001234567", TollFree, ""},
+		{"+12025550143", FixedOrMobile, ""},
+		{"+18005550143", TollFree, ""},
+		{"+14165550143", FixedOrMobile, ""}, // CA shares the NANP plan
+		{"+19005550143", Premium, ""},
+		{"+4930123456", Unknown, ""}, // DE has no plan
+	}
+	for _, test := range tests {
+		number, err := Parse(test.input, "")
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", test.input, err)
+		}
+		if got := number.Lookup(); got.LineType != test.lineType || got.Network != test.network {
+			t.Errorf("Lookup(%s) = %+v, want %s on %q", test.input, got, test.lineType, test.network)
+		}
+	}
+}
+
+func TestNumberingPlans(t *testing.T) {
+	lineTypes := make(map[string]bool)
+	for _, lineType := range LineTypes {
+		lineTypes[lineType] = true
+	}
+	for region, plan := range numberingPlans {
+		if !SupportedRegion(region) {
+			t.Errorf("the numbering plan of %s has no metadata", region)
+		}
+		prefixes := make(map[string]bool)
+		for _, entry := range plan {
+			// Lookup never reports an empty line type, saved numbers are looked up only once
+			if !lineTypes[entry.lineType] || entry.lineType == Unknown {
+				t.Errorf("%s prefix %q has the line type %q", region, entry.prefix, entry.lineType)
+			}
+			if entry.network != "" && entry.lineType != Mobile {
+				t.Errorf("%s prefix %q records the network %s of a %s range", region, entry.prefix,
+					entry.network, entry.lineType)
+			}
+			if prefixes[entry.prefix] {
+				t.Errorf("%s prefix %q is listed twice", region, entry.prefix)
+			}
+			prefixes[entry.prefix] = true
+		}
+	}
+}
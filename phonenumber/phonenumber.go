@@ -0,0 +1,142 @@
+// Package phonenumber parses phone numbers typed in national or international format into
+// canonical E.164 (e.g. +254712345678) using the numbering metadata bundled in metadata.go
+package phonenumber
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+const maxE164Digits = 15 // ITU-T E.164 limits numbers to 15 digits, the country code included
+
+var (
+	// ErrInvalidNumber is returned when the input is not a phone number
+	ErrInvalidNumber = errors.New("not a valid phone number")
+	// ErrUnknownRegion is returned when a region or calling code is missing from the metadata
+	ErrUnknownRegion = errors.New("unknown or unsupported country")
+	// ErrInvalidLength is returned when a number has too few or too many digits for its country
+	ErrInvalidLength = errors.New("phone number has the wrong number of digits for its country")
+)
+
+// separators are the formatting characters people type between digits
+var separators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "", "/", "", "\u00a0", "")
+
+// Number struct is a parsed phone number
+type Number struct {
+	Region         string // ISO 3166-1 alpha-2 code of the number's country
+	CallingCode    string // e.g. 254
+	NationalNumber string // national significant number, without the trunk prefix
+}
+
+// E164 public method that returns the number in E.164 format
+func (number *Number) E164() string {
+	return "+" + number.CallingCode + number.NationalNumber
+}
+
+// SupportedRegion public function that checks if a region is in the bundled metadata
+func SupportedRegion(region string) bool {
+	_, ok := byRegion[strings.ToUpper(region)]
+	return ok
+}
+
+// Regions public function that lists the supported regions in alphabetical order
+func Regions() []string {
+	regions := make([]string, 0, len(byRegion))
+	for region := range byRegion {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// Parse public function that reads a phone number. Numbers starting with + or 00 are read as
+// international, other numbers are read as national numbers of the default region. Numbers typed
+// with the default region's calling code but without the + (e.g. 254712345678) are accepted too
+func Parse(input, defaultRegion string) (*Number, error) {
+	digits := separators.Replace(strings.TrimSpace(input))
+	international := false
+	switch {
+	case strings.HasPrefix(digits, "+"):
+		digits, international = digits[1:], true
+	case strings.HasPrefix(digits, "00"):
+		digits, international = digits[2:], true
+	}
+	if !isDigits(digits) {
+		return nil, ErrInvalidNumber
+	}
+
+	home := byRegion[strings.ToUpper(defaultRegion)]
+	if !international && home != nil && home.callingCode == "1" && strings.HasPrefix(digits, "011") {
+		// 011 is the international prefix dialled from NANP countries
+		digits, international = digits[3:], true
+	}
+	if international {
+		return parseInternational(digits, home)
+	}
+
+	if home == nil {
+		return nil, ErrUnknownRegion
+	}
+	national := digits
+	switch {
+	case home.trunkPrefix != "" && strings.HasPrefix(digits, home.trunkPrefix) &&
+		home.validLength(len(digits)-len(home.trunkPrefix)):
+		national = digits[len(home.trunkPrefix):]
+	case !home.validLength(len(digits)) && strings.HasPrefix(digits, home.callingCode):
+		// the calling code was typed without the +
+		return parseInternational(digits, home)
+	}
+	if !home.validLength(len(national)) {
+		return nil, ErrInvalidLength
+	}
+	return &Number{Region: home.region, CallingCode: home.callingCode, NationalNumber: national}, nil
+}
+
+// parseInternational private function that reads the calling code and national number of digits
+// that follow an international prefix. The default region is preferred when it shares the calling code
+func parseInternational(digits string, home *territory) (*Number, error) {
+	var t *territory
+	for length := 1; length <= 3 && length < len(digits); length++ {
+		if found, ok := byCallingCode[digits[:length]]; ok {
+			t = found
+			break
+		}
+	}
+	if t == nil {
+		return nil, ErrUnknownRegion
+	}
+	if home != nil && home.callingCode == t.callingCode {
+		t = home
+	}
+
+	national := digits[len(t.callingCode):]
+	// people often keep the trunk prefix after the calling code, e.g. +44 (0)20 7946 0000, it is
+	// dropped the same way as in national numbers
+	if t.trunkPrefix != "" && strings.HasPrefix(national, t.trunkPrefix) &&
+		t.validLength(len(national)-len(t.trunkPrefix)) {
+		national = national[len(t.trunkPrefix):]
+	}
+	if !t.validLength(len(national)) || len(t.callingCode)+len(national) > maxE164Digits {
+		return nil, ErrInvalidLength
+	}
+	return &Number{Region: t.region, CallingCode: t.callingCode, NationalNumber: national}, nil
+}
+
+// validLength private method that checks the length of a national significant number
+func (t *territory) validLength(length int) bool {
+	return length >= t.minLength && length <= t.maxLength
+}
+
+// isDigits private function that checks whether a string is made up of digits only
+func isDigits(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
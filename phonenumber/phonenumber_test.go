@@ -0,0 +1,113 @@
+package phonenumber
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		region  string
+		want    string // E.164, empty when an error is expected
+		wantErr error
+		country string
+	}{
+		// national input
+		{"national with trunk prefix", "0712345678", "KE", "+254712345678", nil, "KE"},
+		{"national with separators", "0712 345-678", "KE", "+254712345678", nil, "KE"},
+		{"national with brackets and dots", "(0712).345.678", "KE", "+254712345678", nil, "KE"},
+		{"national with a non-breaking space", "0712 345678", "KE", "+254712345678", nil, "KE"},
+		{"national landline", "020 2222222", "KE", "+254202222222", nil, "KE"},
+		{"national of lower case region", "0712345678", "ke", "+254712345678", nil, "KE"},
+		{"national UK", "020 7946 0000", "GB", "+442079460000", nil, "GB"},
+		{"national US", "(202) 555-0143", "US", "+12025550143", nil, "US"},
+		{"national US with trunk prefix", "1 202 555 0143", "US", "+12025550143", nil, "US"},
+		{"national without trunk prefix", "2079460000", "GB", "+442079460000", nil, "GB"},
+
+		// the old Kenyan format, 9 digits without the 254 prefix or trunk prefix, the migration
+		// stores these as +254 followed by the digits and keeps 0 followed by the digits as raw_number
+		{"old Kenyan format", "712345678", "KE", "+254712345678", nil, "KE"},
+		{"old Kenyan format raw number", "0712345678", "KE", "+254712345678", nil, "KE"},
+		{"old Kenyan format landline", "202222222", "KE", "+254202222222", nil, "KE"},
+
+		// international input
+		{"plus", "+254 712 345 678", "KE", "+254712345678", nil, "KE"},
+		{"plus from another region", "+254712345678", "GB", "+254712345678", nil, "KE"},
+		{"00 prefix", "00254712345678", "GB", "+254712345678", nil, "KE"},
+		{"011 prefix from NANP", "011 44 20 7946 0000", "US", "+442079460000", nil, "GB"},
+		{"011 outside NANP is national", "0112345678", "KE", "+254112345678", nil, "KE"},
+		{"calling code without plus", "254712345678", "KE", "+254712345678", nil, "KE"},
+		{"trunk prefix kept after the calling code", "+44 (0)20 7946 0000", "KE", "+442079460000", nil, "GB"},
+		{"trunk prefix kept after the Kenyan calling code", "+2540712345678", "KE", "+254712345678", nil, "KE"},
+		{"shared calling code prefers the default region", "+1 416 555 0143", "CA", "+14165550143", nil, "CA"},
+		{"shared calling code reports the main region", "+1 416 555 0143", "KE", "+14165550143", nil, "US"},
+		{"international without a default region", "+255712345678", "", "+255712345678", nil, "TZ"},
+
+		// invalid lengths
+		{"national too short", "07123", "KE", "", ErrInvalidLength, ""},
+		{"national too long", "07123456789012", "KE", "", ErrInvalidLength, ""},
+		{"international too short", "+2547123", "KE", "", ErrInvalidLength, ""},
+		{"international too long", "+25471234567890", "KE", "", ErrInvalidLength, ""},
+		{"fixed length country", "+256 7123 4567", "KE", "", ErrInvalidLength, ""},
+		{"US one digit short", "202 555 014", "US", "", ErrInvalidLength, ""},
+
+		// invalid input
+		{"empty", "", "KE", "", ErrInvalidNumber, ""},
+		{"only a plus", "+", "KE", "", ErrInvalidNumber, ""},
+		{"letters", "0712ABC678", "KE", "", ErrInvalidNumber, ""},
+		{"plus in the middle", "0712+345678", "KE", "", ErrInvalidNumber, ""},
+		{"unknown calling code", "+999123456789", "KE", "", ErrUnknownRegion, ""},
+		{"national without a default region", "0712345678", "", "", ErrUnknownRegion, ""},
+		{"national of an unknown region", "0712345678", "XX", "", ErrUnknownRegion, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			number, err := Parse(test.input, test.region)
+			if err != test.wantErr {
+				t.Fatalf("Parse(%q, %q) returned error %v, want %v", test.input, test.region, err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if number.E164() != test.want || number.Region != test.country {
+				t.Errorf("Parse(%q, %q) = %s in %s, want %s in %s", test.input, test.region, number.E164(),
+					number.Region, test.want, test.country)
+			}
+		})
+	}
+}
+
+func TestParseE164IsStable(t *testing.T) {
+	// stored numbers are parsed again on every update, parsing E.164 gives the same number back
+	for _, input := range []string{"+254712345678", "+442079460000", "+12025550143", "+4930123456"} {
+		number, err := Parse(input, "KE")
+		if err != nil || number.E164() != input {
+			t.Errorf("Parse(%q) = %v, %v, want the number unchanged", input, number, err)
+		}
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	for _, territory := range territories {
+		if territory.minLength < 1 || territory.minLength > territory.maxLength ||
+			len(territory.callingCode)+territory.maxLength > maxE164Digits {
+			t.Errorf("%s has the lengths %d to %d", territory.region, territory.minLength, territory.maxLength)
+		}
+		if !isDigits(territory.callingCode) || len(territory.callingCode) > 3 {
+			t.Errorf("%s has the calling code %q", territory.region, territory.callingCode)
+		}
+		if !SupportedRegion(territory.region) {
+			t.Errorf("%s is not supported", territory.region)
+		}
+	}
+	if SupportedRegion("XX") {
+		t.Errorf("XX is supported")
+	}
+	regions := Regions()
+	for i := 1; i < len(regions); i++ {
+		if regions[i-1] >= regions[i] {
+			t.Errorf("Regions is not sorted: %s before %s", regions[i-1], regions[i])
+		}
+	}
+}
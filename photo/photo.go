@@ -0,0 +1,139 @@
+// Package photo validates uploaded contact photos and prepares the stored renditions. Every
+// rendition is decoded and encoded again, which drops EXIF and any other embedded metadata
+package photo
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	maxPixels     = 16 * 1000 * 1000 // larger images are refused before they are decoded, about 64 MB once decoded
+	maxProcessing = 2                // uploads decoded at the same time, the others wait for a slot
+	jpegQuality   = 90
+)
+
+// processing holds a slot for every upload being decoded, so that concurrent uploads can not
+// together use more than maxProcessing times the memory of the largest image
+var processing = make(chan struct{}, maxProcessing)
+
+// ThumbnailSizes are the square renditions stored next to the original, in pixels
+var ThumbnailSizes = []int{64, 256}
+
+// ErrUnsupportedType is returned when the uploaded bytes are not a JPEG or PNG image
+var ErrUnsupportedType = errors.New("photo should be a JPEG or PNG image")
+
+// ErrTooLarge is returned when the image dimensions are too large to process
+var ErrTooLarge = errors.New("photo dimensions are too large")
+
+// Processed struct holds the encoded renditions of an uploaded photo
+type Processed struct {
+	ContentType string         // image/jpeg or image/png, the renditions keep the uploaded format
+	Original    []byte         // the full image, upright and without metadata
+	Thumbnails  map[int][]byte // square thumbnails keyed by size
+}
+
+// Process public function that checks the real content type of an upload, applies the EXIF
+// orientation, and encodes the original without metadata together with its thumbnails
+func Process(data []byte) (*Processed, error) {
+	contentType := http.DetectContentType(data)
+	if contentType != "image/jpeg" && contentType != "image/png" {
+		return nil, ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+
+	processing <- struct{}{}
+	defer func() { <-processing }()
+
+	var img image.Image
+	if contentType == "image/jpeg" {
+		img, err = jpeg.Decode(bytes.NewReader(data))
+	} else {
+		img, err = png.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+	if contentType == "image/jpeg" {
+		img = orient(img, exifOrientation(data))
+	}
+
+	processed := &Processed{ContentType: contentType, Thumbnails: make(map[int][]byte)}
+	if processed.Original, err = encode(img, contentType); err != nil {
+		return nil, err
+	}
+	for _, size := range ThumbnailSizes {
+		if processed.Thumbnails[size], err = encode(thumbnail(img, size), contentType); err != nil {
+			return nil, err
+		}
+	}
+	return processed, nil
+}
+
+// Extension public function that returns the file extension used for a content type
+func Extension(contentType string) string {
+	if contentType == "image/png" {
+		return ".png"
+	}
+	return ".jpg"
+}
+
+// encode private function that writes an image in the given format
+func encode(img image.Image, contentType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if contentType == "image/png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	}
+	return buf.Bytes(), err
+}
+
+// thumbnail private function that crops the center square of an image and scales it down to
+// size pixels by averaging the source pixels covered by each target pixel. Images smaller
+// than size are not scaled up
+func thumbnail(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	if size > side {
+		size = side
+	}
+	x0 := bounds.Min.X + (bounds.Dx()-side)/2
+	y0 := bounds.Min.Y + (bounds.Dy()-side)/2
+
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for dy := 0; dy < size; dy++ {
+		sy0, sy1 := y0+dy*side/size, y0+(dy+1)*side/size
+		for dx := 0; dx < size; dx++ {
+			sx0, sx1 := x0+dx*side/size, x0+(dx+1)*side/size
+
+			var r, g, b, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa), n+1
+				}
+			}
+			// the averages are alpha-premultiplied, NRGBAModel converts them back
+			average := color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)}
+			dst.Set(dx, dy, color.NRGBAModel.Convert(average))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,312 @@
+package photo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var (
+	red   = color.NRGBA{R: 255, A: 255}
+	green = color.NRGBA{G: 255, A: 255}
+	blue  = color.NRGBA{B: 255, A: 255}
+	white = color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+)
+
+// quadrants private function that returns a width x height image whose quarters are red, green,
+// blue and white from the top left, large blocks of one color survive JPEG compression
+func quadrants(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			switch {
+			case x < width/2 && y < height/2:
+				img.Set(x, y, red)
+			case y < height/2:
+				img.Set(x, y, green)
+			case x < width/2:
+				img.Set(x, y, blue)
+			default:
+				img.Set(x, y, white)
+			}
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatalf("encoding JPEG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encoding PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// withExif private function that inserts an APP1 EXIF segment holding an orientation and a
+// camera serial number right after the start of a JPEG
+func withExif(data []byte, orientation uint16, order binary.ByteOrder) []byte {
+	tiff := &bytes.Buffer{}
+	if order == binary.LittleEndian {
+		tiff.WriteString("II")
+	} else {
+		tiff.WriteString("MM")
+	}
+	_ = binary.Write(tiff, order, uint16(42))
+	_ = binary.Write(tiff, order, uint32(8)) // first IFD right after the header
+	_ = binary.Write(tiff, order, uint16(2))
+	// orientation, SHORT
+	_ = binary.Write(tiff, order, []uint16{0x0112, 3})
+	_ = binary.Write(tiff, order, uint32(1))
+	_ = binary.Write(tiff, order, []uint16{orientation, 0})
+	// body serial number, ASCII stored after the IFD
+	_ = binary.Write(tiff, order, []uint16{0xA431, 2})
+	_ = binary.Write(tiff, order, uint32(len("SERIAL-1234567\x00")))
+	_ = binary.Write(tiff, order, uint32(8+2+2*12+4))
+	_ = binary.Write(tiff, order, uint32(0)) // no next IFD
+	tiff.WriteString("SERIAL-1234567\x00")
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	header := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(segment)+2))
+
+	result := append([]byte{}, data[:2]...)
+	result = append(result, header...)
+	result = append(result, segment...)
+	return append(result, data[2:]...)
+}
+
+// pngWithSize private function that returns a PNG whose header claims the given dimensions, only the
+// header is needed for the pixel limit to refuse it
+func pngWithSize(t *testing.T, width, height uint32) []byte {
+	data := encodePNG(t, image.NewNRGBA(image.Rect(0, 0, 1, 1)))
+	// the IHDR chunk follows the 8 byte signature: length, type, width, height, ... and its CRC
+	binary.BigEndian.PutUint32(data[16:], width)
+	binary.BigEndian.PutUint32(data[20:], height)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestProcessSniffsTheContentType(t *testing.T) {
+	var gifData bytes.Buffer
+	if err := gif.Encode(&gifData, quadrants(8, 8), nil); err != nil {
+		t.Fatalf("encoding GIF: %v", err)
+	}
+	jpegData := encodeJPEG(t, quadrants(8, 8))
+
+	for name, data := range map[string][]byte{
+		"gif":            gifData.Bytes(),
+		"text":           []byte("not an image at all"),
+		"html":           []byte("<html><body><img src=x onerror=alert(1)></body></html>"),
+		"empty":          {},
+		"truncated jpeg": jpegData[:len(jpegData)/3],
+		"jpeg header":    {0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0x00},
+	} {
+		if _, err := Process(data); err != ErrUnsupportedType {
+			t.Errorf("Process(%s) returned %v, want ErrUnsupportedType", name, err)
+		}
+	}
+
+	for name, data := range map[string][]byte{"jpeg": jpegData, "png": encodePNG(t, quadrants(8, 8))} {
+		processed, err := Process(data)
+		if err != nil {
+			t.Fatalf("Process(%s) returned %v", name, err)
+		}
+		if processed.ContentType != "image/"+name {
+			t.Errorf("Process(%s) content type = %q, want image/%s", name, processed.ContentType, name)
+		}
+		if _, format, err := image.Decode(bytes.NewReader(processed.Original)); err != nil || format != name {
+			t.Errorf("Process(%s) original is %q (%v), want the uploaded format", name, format, err)
+		}
+	}
+}
+
+func TestProcessRefusesImagesOverThePixelLimit(t *testing.T) {
+	for _, size := range [][2]uint32{{4001, 4000}, {16 * 1000 * 1000, 2}, {40000, 40000}} {
+		if _, err := Process(pngWithSize(t, size[0], size[1])); err != ErrTooLarge {
+			t.Errorf("Process(%dx%d) returned %v, want ErrTooLarge", size[0], size[1], err)
+		}
+	}
+	// at the limit the header is accepted, the missing pixel data is what fails
+	if _, err := Process(pngWithSize(t, 4000, 4000)); err != ErrUnsupportedType {
+		t.Errorf("Process(4000x4000) returned %v, want the header accepted", err)
+	}
+}
+
+func TestProcessThumbnails(t *testing.T) {
+	processed, err := Process(encodePNG(t, quadrants(600, 300)))
+	if err != nil {
+		t.Fatalf("Process returned %v", err)
+	}
+	for _, size := range ThumbnailSizes {
+		img, err := png.Decode(bytes.NewReader(processed.Thumbnails[size]))
+		if err != nil {
+			t.Fatalf("decoding the %d thumbnail: %v", size, err)
+		}
+		if img.Bounds().Dx() != size || img.Bounds().Dy() != size {
+			t.Errorf("thumbnail %d is %v, want a %dx%d square", size, img.Bounds().Size(), size, size)
+		}
+	}
+
+	// small photos are not scaled up
+	processed, err = Process(encodePNG(t, quadrants(40, 30)))
+	if err != nil {
+		t.Fatalf("Process returned %v", err)
+	}
+	for _, size := range ThumbnailSizes {
+		img, _ := png.Decode(bytes.NewReader(processed.Thumbnails[size]))
+		if img == nil || img.Bounds().Dx() != 30 || img.Bounds().Dy() != 30 {
+			t.Errorf("thumbnail %d of a 40x30 photo should be 30x30", size)
+		}
+	}
+}
+
+func TestProcessStripsMetadata(t *testing.T) {
+	data := withExif(encodeJPEG(t, quadrants(32, 32)), 1, binary.BigEndian)
+	if exifOrientation(data) != 1 || !bytes.Contains(data, []byte("SERIAL-1234567")) {
+		t.Fatal("test photo should carry an EXIF block")
+	}
+	processed, err := Process(data)
+	if err != nil {
+		t.Fatalf("Process returned %v", err)
+	}
+	renditions := [][]byte{processed.Original}
+	for _, size := range ThumbnailSizes {
+		renditions = append(renditions, processed.Thumbnails[size])
+	}
+	for _, rendition := range renditions {
+		if bytes.Contains(rendition, []byte("Exif\x00\x00")) || bytes.Contains(rendition, []byte("SERIAL-1234567")) {
+			t.Error("a rendition still carries the EXIF block")
+		}
+	}
+
+	// PNG text chunks are dropped as well
+	pngData := encodePNG(t, quadrants(32, 32))
+	text := []byte("tEXtComment\x00taken at home")
+	chunk := make([]byte, 4, 4+len(text)+4)
+	binary.BigEndian.PutUint32(chunk, uint32(len(text)-4))
+	chunk = append(chunk, text...)
+	chunk = append(chunk, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(chunk[len(chunk)-4:], crc32.ChecksumIEEE(text))
+	pngData = append(append(append([]byte{}, pngData[:33]...), chunk...), pngData[33:]...)
+
+	processed, err = Process(pngData)
+	if err != nil {
+		t.Fatalf("Process of a PNG with a text chunk returned %v", err)
+	}
+	if bytes.Contains(processed.Original, []byte("taken at home")) {
+		t.Error("the PNG text chunk was kept")
+	}
+}
+
+func TestProcessAppliesTheExifOrientation(t *testing.T) {
+	const width, height = 64, 32
+	upright := quadrants(width, height)
+
+	// stored maps a pixel of the upright photo to where a camera saving it with an orientation puts it
+	cases := []struct {
+		orientation   uint16
+		storedWidth   int
+		storedHeight  int
+		stored        func(x, y int) (int, int)
+		littleEndian  bool
+		orientationOf string
+	}{
+		{1, width, height, func(x, y int) (int, int) { return x, y }, false, "upright"},
+		{2, width, height, func(x, y int) (int, int) { return width - 1 - x, y }, true, "mirrored"},
+		{3, width, height, func(x, y int) (int, int) { return width - 1 - x, height - 1 - y }, false, "upside down"},
+		{4, width, height, func(x, y int) (int, int) { return x, height - 1 - y }, true, "flipped"},
+		{5, height, width, func(x, y int) (int, int) { return y, x }, false, "transposed"},
+		{6, height, width, func(x, y int) (int, int) { return y, width - 1 - x }, true, "rotated left"},
+		{7, height, width, func(x, y int) (int, int) { return height - 1 - y, width - 1 - x }, false, "transversed"},
+		{8, height, width, func(x, y int) (int, int) { return height - 1 - y, x }, true, "rotated right"},
+	}
+	for _, c := range cases {
+		stored := image.NewNRGBA(image.Rect(0, 0, c.storedWidth, c.storedHeight))
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				sx, sy := c.stored(x, y)
+				stored.Set(sx, sy, upright.At(x, y))
+			}
+		}
+		var order binary.ByteOrder = binary.BigEndian
+		if c.littleEndian {
+			order = binary.LittleEndian
+		}
+		data := withExif(encodeJPEG(t, stored), c.orientation, order)
+		if got := exifOrientation(data); got != int(c.orientation) {
+			t.Fatalf("orientation %d read as %d", c.orientation, got)
+		}
+
+		processed, err := Process(data)
+		if err != nil {
+			t.Fatalf("Process(orientation %d) returned %v", c.orientation, err)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(processed.Original))
+		if err != nil {
+			t.Fatalf("decoding orientation %d: %v", c.orientation, err)
+		}
+		if img.Bounds().Dx() != width || img.Bounds().Dy() != height {
+			t.Errorf("orientation %d (%s): got %v, want %dx%d", c.orientation, c.orientationOf, img.Bounds().Size(),
+				width, height)
+			continue
+		}
+		for _, check := range []struct {
+			x, y int
+			want color.NRGBA
+		}{
+			{width / 4, height / 4, red}, {3 * width / 4, height / 4, green},
+			{width / 4, 3 * height / 4, blue}, {3 * width / 4, 3 * height / 4, white},
+		} {
+			if !near(img.At(check.x, check.y), check.want) {
+				t.Errorf("orientation %d (%s): pixel %d,%d is %v, want %v", c.orientation, c.orientationOf,
+					check.x, check.y, img.At(check.x, check.y), check.want)
+			}
+		}
+	}
+}
+
+// near private function that compares colors allowing for JPEG compression
+func near(got color.Color, want color.NRGBA) bool {
+	r, g, b, _ := got.RGBA()
+	wr, wg, wb, _ := want.RGBA()
+	diff := func(a, b uint32) uint32 {
+		if a > b {
+			return a - b
+		}
+		return b - a
+	}
+	const tolerance = 0x2000
+	return diff(r, wr) < tolerance && diff(g, wg) < tolerance && diff(b, wb) < tolerance
+}
+
+func TestExifOrientationIgnoresBrokenBlocks(t *testing.T) {
+	data := encodeJPEG(t, quadrants(8, 8))
+	for name, broken := range map[string][]byte{
+		"no exif":            data,
+		"not a jpeg":         encodePNG(t, quadrants(8, 8)),
+		"out of range":       withExif(data, 9, binary.BigEndian),
+		"zero":               withExif(data, 0, binary.LittleEndian),
+		"truncated segment":  withExif(data, 6, binary.BigEndian)[:20],
+		"unknown byte order": bytes.Replace(withExif(data, 6, binary.BigEndian), []byte("MM"), []byte("XX"), 1),
+	} {
+		if got := exifOrientation(broken); got != 1 {
+			t.Errorf("exifOrientation(%s) = %d, want 1", name, got)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package reminders
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+const defaultSendTimeout = 30 * time.Second
+
+// SMTPMailer struct sends emails through an SMTP server, authentication is skipped when Username is empty.
+// Timeout bounds the whole exchange with the server so that a stalled server cannot hold up the scheduler,
+// 30 seconds when zero
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	Timeout  time.Duration
+}
+
+// Send public method that sends a plain text email
+func (mailer *SMTPMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if mailer.Username != "" {
+		auth = smtp.PlainAuth("", mailer.Username, mailer.Password, mailer.Host)
+	}
+
+	message := strings.Join([]string{
+		"From: " + mailer.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		strings.ReplaceAll(body, "\n", "\r\n"),
+	}, "\r\n")
+	return mailer.send(auth, to, []byte(message))
+}
+
+// send private method that goes through the same steps as smtp.SendMail on a connection with a deadline
+func (mailer *SMTPMailer) send(auth smtp.Auth, to string, message []byte) error {
+	timeout := mailer.Timeout
+	if timeout <= 0 {
+		timeout = defaultSendTimeout
+	}
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", mailer.Host, mailer.Port), timeout)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	client, err := smtp.NewClient(conn, mailer.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: mailer.Host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err := client.Auth(auth); err != nil {
+				return err
+			}
+		}
+	}
+	if err := client.Mail(mailer.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(message); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// LogMailer struct writes emails to the log instead of sending them, used when no SMTP server is configured
+type LogMailer struct{}
+
+// Send public method that logs an email
+func (LogMailer) Send(to, subject, body string) error {
+	log.Printf("INFO | Email to: %s subject: %q\n%s", to, subject, body)
+	return nil
+}
@@ -0,0 +1,216 @@
+// Package reminders sends every active account a morning email digest of its contacts' birthdays.
+// The scheduler only depends on interfaces, the ones in this file and lock.Locker, so that it can be driven by a fake
+// clock, an in-memory lock and a fake mail transport
+package reminders
+
+import (
+	"context"
+	"fmt"
+	"github.com/cermu/Go-phoneBook-API/lock"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	digestDays    = 7                               // today and the six days after it
+	runLockKey    = "reminders:birthday-digest:run" // held by the replica going through the accounts
+	digestKeyBase = "reminders:birthday-digest"     // per account and local date marker
+	digestKeyTTL  = 48 * time.Hour                  // outlives the local day in every time zone
+)
+
+// Recipient struct describes an account that receives the digest
+type Recipient struct {
+	AccountID uint
+	FirstName string
+	Email     string
+	TimeZone  string // IANA name, UTC is used when empty or unknown
+}
+
+// Birthday struct describes the next birthday of one of a recipient's contacts
+type Birthday struct {
+	FirstName string
+	LastName  string
+	Date      time.Time // the occurrence in the recipient's time zone
+	DaysUntil int       // 0 means today
+	Age       *int      // only known when the birth year is saved
+}
+
+// Store interface gives the scheduler access to accounts and their contacts' birthdays
+type Store interface {
+	Recipients() ([]*Recipient, error)
+	Birthdays(accountId uint, from time.Time, days int) ([]*Birthday, error)
+}
+
+// Mailer interface sends a plain text email
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// Clock interface tells the time and wakes the scheduler up
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock struct is the Clock backed by the time package
+type SystemClock struct{}
+
+// Now public method that returns the current time
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// After public method that waits for a duration to elapse
+func (SystemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Scheduler struct checks every Interval which accounts have reached DigestHour in their
+// time zone and emails each of them the day's digest once
+type Scheduler struct {
+	Store      Store
+	Mailer     Mailer
+	Locker     lock.Locker
+	Clock      Clock
+	DigestHour int
+	Interval   time.Duration
+}
+
+// Run public method that checks for due digests right away and then every interval,
+// it returns once the context is cancelled
+func (scheduler *Scheduler) Run(ctx context.Context) {
+	log.Printf("INFO | Birthday reminders scheduled daily at %02d:00, checking every %v\n",
+		scheduler.DigestHour, scheduler.Interval)
+	for {
+		if err := scheduler.RunOnce(ctx); err != nil {
+			log.Printf("WARNING | Birthday reminders run failed with message: %v\n", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("INFO | Birthday reminders scheduler has stopped")
+			return
+		case <-scheduler.Clock.After(scheduler.Interval):
+		}
+	}
+}
+
+// RunOnce public method that sends the digests that are due. Only one replica goes through the
+// accounts at a time and every account is marked per local date, so a digest is sent once a day
+func (scheduler *Scheduler) RunOnce(ctx context.Context) error {
+	obtained, err := scheduler.Locker.Obtain(runLockKey, scheduler.Interval)
+	if err != nil {
+		return fmt.Errorf("obtaining run lock: %v", err)
+	}
+	if !obtained {
+		return nil // another replica is on it
+	}
+	defer func() {
+		if err := scheduler.Locker.Release(runLockKey); err != nil {
+			log.Printf("WARNING | Releasing birthday reminders run lock failed with message: %v\n", err.Error())
+		}
+	}()
+
+	recipients, err := scheduler.Store.Recipients()
+	if err != nil {
+		return fmt.Errorf("fetching accounts: %v", err)
+	}
+
+	now := scheduler.Clock.Now()
+	for _, recipient := range recipients {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		local := now.In(location(recipient.TimeZone))
+		if local.Hour() < scheduler.DigestHour {
+			continue
+		}
+		if err := scheduler.sendDigest(recipient, local); err != nil {
+			log.Printf("WARNING | Birthday digest for account: %d failed with message: %v\n",
+				recipient.AccountID, err.Error())
+		}
+	}
+	return nil
+}
+
+// sendDigest private method that emails a recipient their digest unless it was already sent on the local date.
+// The marker is released when sending fails so that the next run tries again
+func (scheduler *Scheduler) sendDigest(recipient *Recipient, local time.Time) error {
+	key := fmt.Sprintf("%s:%d:%s", digestKeyBase, recipient.AccountID, local.Format("2006-01-02"))
+	obtained, err := scheduler.Locker.Obtain(key, digestKeyTTL)
+	if err != nil || !obtained {
+		return err
+	}
+
+	birthdays, err := scheduler.Store.Birthdays(recipient.AccountID, local, digestDays)
+	if err == nil && len(birthdays) > 0 {
+		err = scheduler.Mailer.Send(recipient.Email, digestSubject(birthdays), digestBody(recipient, birthdays))
+	}
+	if err != nil {
+		if releaseErr := scheduler.Locker.Release(key); releaseErr != nil {
+			log.Printf("WARNING | Releasing birthday digest marker failed with message: %v\n", releaseErr.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+// location private function that loads a time zone, falling back to UTC
+func location(timeZone string) *time.Location {
+	if timeZone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		log.Printf("WARNING | Unknown time zone %q, using UTC\n", timeZone)
+		return time.UTC
+	}
+	return loc
+}
+
+// digestSubject private function that builds the digest's subject line
+func digestSubject(birthdays []*Birthday) string {
+	today := 0
+	for _, birthday := range birthdays {
+		if birthday.DaysUntil == 0 {
+			today++
+		}
+	}
+	switch today {
+	case 0:
+		return fmt.Sprintf("%d birthday(s) coming up this week", len(birthdays))
+	case 1:
+		return "1 birthday today"
+	default:
+		return fmt.Sprintf("%d birthdays today", today)
+	}
+}
+
+// digestBody private function that lists today's birthdays followed by the rest of the week's
+func digestBody(recipient *Recipient, birthdays []*Birthday) string {
+	var today, week strings.Builder
+	for _, birthday := range birthdays {
+		name := strings.TrimSpace(birthday.FirstName + " " + birthday.LastName)
+		if birthday.Age != nil {
+			name += fmt.Sprintf(" (turns %d)", *birthday.Age)
+		}
+		if birthday.DaysUntil == 0 {
+			today.WriteString("- " + name + "\n")
+		} else {
+			week.WriteString("- " + birthday.Date.Format("Mon 2 Jan") + ": " + name + "\n")
+		}
+	}
+
+	var body strings.Builder
+	body.WriteString("Hi " + recipient.FirstName + ",\n\n")
+	if today.Len() > 0 {
+		body.WriteString("Birthdays today:\n" + today.String() + "\n")
+	}
+	if week.Len() > 0 {
+		body.WriteString("Coming up this week:\n" + week.String() + "\n")
+	}
+	body.WriteString("Phone Book\n")
+	return body.String()
+}
@@ -0,0 +1,389 @@
+package reminders
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	_ "time/tzdata" // the tests do not depend on the zone files of the machine
+)
+
+// fakeClock struct is a Clock whose time only moves when a test sets it, After channels fire when the test ticks
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	ticks chan time.Time
+	waits chan time.Duration
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, ticks: make(chan time.Time), waits: make(chan time.Duration, 16)}
+}
+
+func (clock *fakeClock) Now() time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return clock.now
+}
+
+func (clock *fakeClock) After(d time.Duration) <-chan time.Time {
+	clock.waits <- d
+	return clock.ticks
+}
+
+func (clock *fakeClock) set(now time.Time) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	clock.now = now
+}
+
+// contactBirthday struct is a birthday kept by fakeStore, Year is 0 when the birth year is unknown
+type contactBirthday struct {
+	FirstName string
+	Month     time.Month
+	Day       int
+	Year      int
+}
+
+// fakeStore struct is a Store holding recipients and their contacts' birthdays in memory
+type fakeStore struct {
+	mu           sync.Mutex
+	recipients   []*Recipient
+	birthdays    map[uint][]contactBirthday
+	onRecipients func()
+	calls        int
+}
+
+func (store *fakeStore) Recipients() ([]*Recipient, error) {
+	store.mu.Lock()
+	store.calls++
+	hook := store.onRecipients
+	store.mu.Unlock()
+	if hook != nil {
+		hook()
+	}
+	return store.recipients, nil
+}
+
+// Birthdays public method that returns the birthdays falling within days of the local date of from,
+// the way models.ReminderStore does
+func (store *fakeStore) Birthdays(accountId uint, from time.Time, days int) ([]*Birthday, error) {
+	today := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+	birthdays := make([]*Birthday, 0)
+	for _, contact := range store.birthdays[accountId] {
+		date := time.Date(today.Year(), contact.Month, contact.Day, 0, 0, 0, 0, today.Location())
+		if date.Before(today) {
+			date = date.AddDate(1, 0, 0)
+		}
+		daysUntil := int(date.Sub(today).Round(24*time.Hour) / (24 * time.Hour))
+		if daysUntil >= days {
+			continue
+		}
+		birthday := &Birthday{FirstName: contact.FirstName, Date: date, DaysUntil: daysUntil}
+		if contact.Year != 0 {
+			age := date.Year() - contact.Year
+			birthday.Age = &age
+		}
+		birthdays = append(birthdays, birthday)
+	}
+	return birthdays, nil
+}
+
+// sentEmail struct is an email recorded by fakeMailer
+type sentEmail struct {
+	To, Subject, Body string
+}
+
+// fakeMailer struct records the emails it is asked to send, failing while err is set
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []sentEmail
+	err  error
+}
+
+func (mailer *fakeMailer) Send(to, subject, body string) error {
+	mailer.mu.Lock()
+	defer mailer.mu.Unlock()
+	if mailer.err != nil {
+		return mailer.err
+	}
+	mailer.sent = append(mailer.sent, sentEmail{To: to, Subject: subject, Body: body})
+	return nil
+}
+
+func (mailer *fakeMailer) emails() []sentEmail {
+	mailer.mu.Lock()
+	defer mailer.mu.Unlock()
+	return append([]sentEmail(nil), mailer.sent...)
+}
+
+// lockTable struct holds the keys shared by the replicas, like redis does for RedisLocker
+type lockTable struct {
+	mu    sync.Mutex
+	clock Clock
+	keys  map[string]lockEntry
+}
+
+type lockEntry struct {
+	token   string
+	expires time.Time
+}
+
+// memoryLocker struct is the Locker of one replica, keys are only released by the replica holding them
+type memoryLocker struct {
+	table *lockTable
+	token string
+}
+
+func (locker *memoryLocker) Obtain(key string, ttl time.Duration) (bool, error) {
+	locker.table.mu.Lock()
+	defer locker.table.mu.Unlock()
+	now := locker.table.clock.Now()
+	if entry, ok := locker.table.keys[key]; ok && now.Before(entry.expires) {
+		return false, nil
+	}
+	locker.table.keys[key] = lockEntry{token: locker.token, expires: now.Add(ttl)}
+	return true, nil
+}
+
+func (locker *memoryLocker) Release(key string) error {
+	locker.table.mu.Lock()
+	defer locker.table.mu.Unlock()
+	if entry, ok := locker.table.keys[key]; ok && entry.token == locker.token {
+		delete(locker.table.keys, key)
+	}
+	return nil
+}
+
+// replicas private function that returns schedulers sharing a store, a mailer, a clock and a lock table
+func replicas(count int, store *fakeStore, mailer *fakeMailer, clock *fakeClock) []*Scheduler {
+	table := &lockTable{clock: clock, keys: make(map[string]lockEntry)}
+	schedulers := make([]*Scheduler, 0, count)
+	for i := 0; i < count; i++ {
+		locker := &memoryLocker{table: table, token: string(rune('a' + i))}
+		schedulers = append(schedulers, &Scheduler{Store: store, Mailer: mailer, Locker: locker, Clock: clock,
+			DigestHour: 8, Interval: 15 * time.Minute})
+	}
+	return schedulers
+}
+
+func TestRunOnceSendsDigestsOnceTheLocalHourIsReached(t *testing.T) {
+	store := &fakeStore{
+		recipients: []*Recipient{
+			{AccountID: 1, FirstName: "Amina", Email: "amina@example.com", TimeZone: "Africa/Nairobi"},
+			{AccountID: 2, FirstName: "Bob", Email: "bob@example.com", TimeZone: "America/New_York"},
+			{AccountID: 3, FirstName: "Chiyo", Email: "chiyo@example.com", TimeZone: "Asia/Tokyo"},
+			{AccountID: 4, FirstName: "Dan", Email: "dan@example.com"},
+		},
+		birthdays: map[uint][]contactBirthday{
+			1: {{FirstName: "Wanjiru", Month: time.March, Day: 10}},
+			2: {{FirstName: "Wanjiru", Month: time.March, Day: 10}},
+			3: {{FirstName: "Wanjiru", Month: time.March, Day: 10}},
+			4: {{FirstName: "Wanjiru", Month: time.March, Day: 10}},
+		},
+	}
+	mailer := &fakeMailer{}
+	// 08:30 in Nairobi, 00:30 in New York, 14:30 in Tokyo and 05:30 in UTC
+	clock := newFakeClock(time.Date(2026, time.March, 10, 5, 30, 0, 0, time.UTC))
+	scheduler := replicas(1, store, mailer, clock)[0]
+
+	if err := scheduler.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce returned %v", err)
+	}
+	got := make([]string, 0)
+	for _, email := range mailer.emails() {
+		got = append(got, email.To)
+	}
+	if strings.Join(got, ",") != "amina@example.com,chiyo@example.com" {
+		t.Fatalf("digests sent to %v, want amina@example.com and chiyo@example.com", got)
+	}
+
+	// 08:00 in UTC, Dan is now due and the others are not emailed again
+	clock.set(time.Date(2026, time.March, 10, 8, 0, 0, 0, time.UTC))
+	if err := scheduler.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce returned %v", err)
+	}
+	emails := mailer.emails()
+	if len(emails) != 3 || emails[2].To != "dan@example.com" {
+		t.Fatalf("got %d digests, the last to %q, want a third one to dan@example.com", len(emails),
+			emails[len(emails)-1].To)
+	}
+}
+
+func TestRunOnceUsesTheRecipientsLocalDateAcrossMidnight(t *testing.T) {
+	store := &fakeStore{
+		recipients: []*Recipient{
+			{AccountID: 1, FirstName: "Aroha", Email: "aroha@example.com", TimeZone: "Pacific/Auckland"},
+			{AccountID: 2, FirstName: "Una", Email: "una@example.com", TimeZone: "UTC"},
+		},
+		birthdays: map[uint][]contactBirthday{
+			1: {{FirstName: "Tama", Month: time.March, Day: 11, Year: 1990}, {FirstName: "Mere", Month: time.March, Day: 16}},
+			2: {{FirstName: "Tama", Month: time.March, Day: 11, Year: 1990}, {FirstName: "Mere", Month: time.March, Day: 16}},
+		},
+	}
+	mailer := &fakeMailer{}
+	// 23:30 on the 10th in UTC is already 12:30 on the 11th in Auckland
+	clock := newFakeClock(time.Date(2026, time.March, 10, 23, 30, 0, 0, time.UTC))
+	scheduler := replicas(1, store, mailer, clock)[0]
+
+	if err := scheduler.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce returned %v", err)
+	}
+	emails := mailer.emails()
+	if len(emails) != 2 {
+		t.Fatalf("got %d digests, want 2", len(emails))
+	}
+	auckland, utc := emails[0], emails[1]
+
+	if auckland.Subject != "1 birthday today" {
+		t.Errorf("Auckland subject = %q, want 1 birthday today", auckland.Subject)
+	}
+	if !strings.Contains(auckland.Body, "Birthdays today:\n- Tama (turns 36)\n") {
+		t.Errorf("Auckland digest should list Tama today, got:\n%s", auckland.Body)
+	}
+	if !strings.Contains(auckland.Body, "Coming up this week:\n- Mon 16 Mar: Mere\n") {
+		t.Errorf("Auckland digest should list Mere this week, got:\n%s", auckland.Body)
+	}
+
+	if utc.Subject != "2 birthday(s) coming up this week" {
+		t.Errorf("UTC subject = %q, want 2 birthday(s) coming up this week", utc.Subject)
+	}
+	if strings.Contains(utc.Body, "Birthdays today:") {
+		t.Errorf("UTC digest should not have birthdays today, got:\n%s", utc.Body)
+	}
+	if !strings.Contains(utc.Body, "- Wed 11 Mar: Tama (turns 36)\n- Mon 16 Mar: Mere\n") {
+		t.Errorf("UTC digest should list Tama and Mere this week, got:\n%s", utc.Body)
+	}
+
+	// past midnight in UTC it is Tama's birthday there too, Auckland already had its digest for the 11th
+	clock.set(time.Date(2026, time.March, 11, 8, 15, 0, 0, time.UTC))
+	if err := scheduler.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce returned %v", err)
+	}
+	emails = mailer.emails()
+	if len(emails) != 3 {
+		t.Fatalf("got %d digests, want 3", len(emails))
+	}
+	if emails[2].To != "una@example.com" || emails[2].Subject != "1 birthday today" {
+		t.Errorf("third digest went to %q with subject %q, want una@example.com and 1 birthday today",
+			emails[2].To, emails[2].Subject)
+	}
+}
+
+func TestRunOnceSkipsRecipientsWithoutBirthdays(t *testing.T) {
+	store := &fakeStore{
+		recipients: []*Recipient{{AccountID: 1, FirstName: "Amina", Email: "amina@example.com"}},
+		birthdays:  map[uint][]contactBirthday{1: {{FirstName: "Later", Month: time.April, Day: 1}}},
+	}
+	mailer := &fakeMailer{}
+	clock := newFakeClock(time.Date(2026, time.March, 10, 9, 0, 0, 0, time.UTC))
+
+	if err := replicas(1, store, mailer, clock)[0].RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce returned %v", err)
+	}
+	if emails := mailer.emails(); len(emails) != 0 {
+		t.Fatalf("got %d digests, want none", len(emails))
+	}
+}
+
+func TestRunOnceRetriesADigestThatFailedToSend(t *testing.T) {
+	store := &fakeStore{
+		recipients: []*Recipient{{AccountID: 1, FirstName: "Amina", Email: "amina@example.com"}},
+		birthdays:  map[uint][]contactBirthday{1: {{FirstName: "Wanjiru", Month: time.March, Day: 10}}},
+	}
+	mailer := &fakeMailer{err: errors.New("connection refused")}
+	clock := newFakeClock(time.Date(2026, time.March, 10, 9, 0, 0, 0, time.UTC))
+	scheduler := replicas(1, store, mailer, clock)[0]
+
+	if err := scheduler.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce returned %v", err)
+	}
+	mailer.err = nil
+	clock.set(clock.Now().Add(15 * time.Minute))
+	if err := scheduler.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce returned %v", err)
+	}
+	if emails := mailer.emails(); len(emails) != 1 {
+		t.Fatalf("got %d digests, want the failed one sent on the next run", len(emails))
+	}
+}
+
+func TestRunLockBlocksASecondReplica(t *testing.T) {
+	store := &fakeStore{
+		recipients: []*Recipient{{AccountID: 1, FirstName: "Amina", Email: "amina@example.com"}},
+		birthdays:  map[uint][]contactBirthday{1: {{FirstName: "Wanjiru", Month: time.March, Day: 10}}},
+	}
+	mailer := &fakeMailer{}
+	clock := newFakeClock(time.Date(2026, time.March, 10, 9, 0, 0, 0, time.UTC))
+	schedulers := replicas(2, store, mailer, clock)
+
+	// the second replica wakes up while the first one is going through the accounts
+	store.onRecipients = func() {
+		store.onRecipients = nil
+		if err := schedulers[1].RunOnce(context.Background()); err != nil {
+			t.Errorf("second replica's RunOnce returned %v", err)
+		}
+	}
+	if err := schedulers[0].RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce returned %v", err)
+	}
+	if store.calls != 1 {
+		t.Errorf("accounts were fetched %d times, want once by the replica holding the lock", store.calls)
+	}
+	if emails := mailer.emails(); len(emails) != 1 {
+		t.Fatalf("got %d digests, want 1", len(emails))
+	}
+
+	// the lock is released after the run, the second replica can take the next one but finds nothing due
+	if err := schedulers[1].RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce returned %v", err)
+	}
+	if store.calls != 2 {
+		t.Errorf("accounts were fetched %d times, want the second replica to run once the lock is free", store.calls)
+	}
+	if emails := mailer.emails(); len(emails) != 1 {
+		t.Fatalf("got %d digests, want the digest sent once", len(emails))
+	}
+}
+
+func TestRunStopsWhenTheContextIsCancelled(t *testing.T) {
+	store := &fakeStore{}
+	clock := newFakeClock(time.Date(2026, time.March, 10, 9, 0, 0, 0, time.UTC))
+	scheduler := replicas(1, store, &fakeMailer{}, clock)[0]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		scheduler.Run(ctx)
+		close(done)
+	}()
+
+	// a run happens right away and then one per tick of the clock
+	for i := 0; i < 2; i++ {
+		select {
+		case wait := <-clock.waits:
+			if wait != scheduler.Interval {
+				t.Fatalf("scheduler waited %v, want %v", wait, scheduler.Interval)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("scheduler did not wait for the next interval")
+		}
+		if i == 0 {
+			clock.ticks <- clock.Now()
+		}
+	}
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after the context was cancelled")
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.calls != 2 {
+		t.Errorf("scheduler ran %d times, want 2", store.calls)
+	}
+}
@@ -1,16 +1,23 @@
 package routers
 
 import (
+	"github.com/cermu/Go-phoneBook-API/carddav"
 	"github.com/cermu/Go-phoneBook-API/middlewares"
+	"github.com/cermu/Go-phoneBook-API/models"
+	utl "github.com/cermu/Go-phoneBook-API/utils"
 	"github.com/gorilla/mux"
+	"net/http"
 )
 
+// cardDAVPrefix is the path the CardDAV service is mounted on
+const cardDAVPrefix = "/carddav"
+
 // NewRouter public function that returns a pointer to mux.Router
 func NewRouter() *mux.Router {
 	router := mux.NewRouter().StrictSlash(true)
 	router.Use(middlewares.EnableCORS)        // Attach the EnableCORS middleware
 	router.Use(middlewares.JWTAuthentication) // Attach the JWTAuthentication middleware
-	api := router.PathPrefix("/phonebookapi/v1").Subrouter()
+	api := router.PathPrefix(utl.APIPrefix).Subrouter()
 
 	for _, route := range routeSlice {
 		api.
@@ -21,3 +28,17 @@ func NewRouter() *mux.Router {
 	}
 	return router
 }
+
+// NewHandler public function that returns the handler of the API server. CardDAV requests are served
+// apart from the API router, contacts apps sign in with basic auth and send WebDAV methods
+// the API middlewares do not expect
+func NewHandler() http.Handler {
+	// photos are embedded in cards base64 encoded
+	cardDAV := &carddav.Handler{Backend: models.CardDAVBackend{}, Prefix: cardDAVPrefix,
+		MaxCardBytes: 2 * models.MaxPhotoBytes()}
+
+	handler := http.NewServeMux()
+	cardDAV.Mount(handler)
+	handler.Handle("/", NewRouter())
+	return handler
+}
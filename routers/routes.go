@@ -111,4 +111,370 @@ var routeSlice = routes{
 		Pattern:     "/delete/contact/{contactId}",
 		HandlerFunc: controllers.DeleteContact,
 	},
+	route{
+		Name:        "SearchContacts",
+		Method:      "GET",
+		Pattern:     "/contacts/search",
+		HandlerFunc: controllers.SearchContacts,
+	},
+	route{
+		Name:        "CreateGroup",
+		Method:      "POST",
+		Pattern:     "/group/create",
+		HandlerFunc: controllers.CreateGroup,
+	},
+	route{
+		Name:        "FetchGroupsByAccountId",
+		Method:      "GET",
+		Pattern:     "/fetch/account/groups",
+		HandlerFunc: controllers.FetchGroupsByAccountId,
+	},
+	route{
+		Name:        "FetchGroupById",
+		Method:      "GET",
+		Pattern:     "/group/{groupId}",
+		HandlerFunc: controllers.FetchGroupById,
+	},
+	route{
+		Name:        "UpdateGroup",
+		Method:      "POST",
+		Pattern:     "/update/group/{groupId}",
+		HandlerFunc: controllers.UpdateGroup,
+	},
+	route{
+		Name:        "DeleteGroup",
+		Method:      "GET",
+		Pattern:     "/delete/group/{groupId}",
+		HandlerFunc: controllers.DeleteGroup,
+	},
+	route{
+		Name:        "AddGroupMembers",
+		Method:      "POST",
+		Pattern:     "/group/{groupId}/add/members",
+		HandlerFunc: controllers.AddGroupMembers,
+	},
+	route{
+		Name:        "RemoveGroupMembers",
+		Method:      "POST",
+		Pattern:     "/group/{groupId}/remove/members",
+		HandlerFunc: controllers.RemoveGroupMembers,
+	},
+	route{
+		Name:        "TouchContact",
+		Method:      "POST",
+		Pattern:     "/contact/{contactId}/touch",
+		HandlerFunc: controllers.TouchContact,
+	},
+	route{
+		Name:        "StarContact",
+		Method:      "POST",
+		Pattern:     "/contact/{contactId}/star",
+		HandlerFunc: controllers.StarContact,
+	},
+	route{
+		Name:        "FetchFavorites",
+		Method:      "GET",
+		Pattern:     "/contacts/favorites",
+		HandlerFunc: controllers.FetchFavorites,
+	},
+	route{
+		Name:        "ExportContacts",
+		Method:      "GET",
+		Pattern:     "/contacts/export",
+		HandlerFunc: controllers.ExportContacts,
+	},
+	route{
+		Name:        "ExportContact",
+		Method:      "GET",
+		Pattern:     "/contact/{contactId}/export",
+		HandlerFunc: controllers.ExportContact,
+	},
+	route{
+		Name:        "ImportContactsVCard",
+		Method:      "POST",
+		Pattern:     "/contacts/import/vcard",
+		HandlerFunc: controllers.ImportContactsVCard,
+	},
+	route{
+		Name:        "ImportContactsCSV",
+		Method:      "POST",
+		Pattern:     "/contacts/import/csv",
+		HandlerFunc: controllers.ImportContactsCSV,
+	},
+	route{
+		Name:        "ExportContactsCSV",
+		Method:      "GET",
+		Pattern:     "/contacts/export/csv",
+		HandlerFunc: controllers.ExportContactsCSV,
+	},
+	route{
+		Name:        "FindDuplicates",
+		Method:      "GET",
+		Pattern:     "/contacts/duplicates",
+		HandlerFunc: controllers.FindDuplicates,
+	},
+	route{
+		Name:        "MergeContacts",
+		Method:      "POST",
+		Pattern:     "/contacts/merge",
+		HandlerFunc: controllers.MergeContacts,
+	},
+	route{
+		Name:        "FetchAddresses",
+		Method:      "GET",
+		Pattern:     "/contact/{contactId}/addresses",
+		HandlerFunc: controllers.FetchAddresses,
+	},
+	route{
+		Name:        "CreateAddress",
+		Method:      "POST",
+		Pattern:     "/contact/{contactId}/addresses",
+		HandlerFunc: controllers.CreateAddress,
+	},
+	route{
+		Name:        "UpdateAddress",
+		Method:      "POST",
+		Pattern:     "/contact/{contactId}/addresses/{addressId}",
+		HandlerFunc: controllers.UpdateAddress,
+	},
+	route{
+		Name:        "DeleteAddress",
+		Method:      "DELETE",
+		Pattern:     "/contact/{contactId}/addresses/{addressId}",
+		HandlerFunc: controllers.DeleteAddress,
+	},
+	route{
+		Name:        "FetchUpcomingEvents",
+		Method:      "GET",
+		Pattern:     "/contacts/upcoming",
+		HandlerFunc: controllers.FetchUpcomingEvents,
+	},
+	route{
+		Name:        "FetchNotes",
+		Method:      "GET",
+		Pattern:     "/contact/{contactId}/notes",
+		HandlerFunc: controllers.FetchNotes,
+	},
+	route{
+		Name:        "CreateNote",
+		Method:      "POST",
+		Pattern:     "/contact/{contactId}/notes",
+		HandlerFunc: controllers.CreateNote,
+	},
+	route{
+		Name:        "FetchNote",
+		Method:      "GET",
+		Pattern:     "/contact/{contactId}/notes/{noteId}",
+		HandlerFunc: controllers.FetchNote,
+	},
+	route{
+		Name:        "UpdateNote",
+		Method:      "POST",
+		Pattern:     "/contact/{contactId}/notes/{noteId}",
+		HandlerFunc: controllers.UpdateNote,
+	},
+	route{
+		Name:        "DeleteNote",
+		Method:      "DELETE",
+		Pattern:     "/contact/{contactId}/notes/{noteId}",
+		HandlerFunc: controllers.DeleteNote,
+	},
+	route{
+		Name:        "FetchNoteVersions",
+		Method:      "GET",
+		Pattern:     "/contact/{contactId}/notes/{noteId}/versions",
+		HandlerFunc: controllers.FetchNoteVersions,
+	},
+	route{
+		Name:        "RestoreNoteVersion",
+		Method:      "POST",
+		Pattern:     "/contact/{contactId}/notes/{noteId}/versions/{version}/restore",
+		HandlerFunc: controllers.RestoreNoteVersion,
+	},
+	route{
+		Name:        "UploadPhoto",
+		Method:      "POST",
+		Pattern:     "/contact/{contactId}/photo",
+		HandlerFunc: controllers.UploadPhoto,
+	},
+	route{
+		Name:        "FetchPhoto",
+		Method:      "GET",
+		Pattern:     "/contact/{contactId}/photo/{size}",
+		HandlerFunc: controllers.FetchPhoto,
+	},
+	route{
+		Name:        "DeletePhoto",
+		Method:      "DELETE",
+		Pattern:     "/contact/{contactId}/photo",
+		HandlerFunc: controllers.DeletePhoto,
+	},
+	route{
+		Name:        "ShareContact",
+		Method:      "POST",
+		Pattern:     "/contact/{contactId}/shares",
+		HandlerFunc: controllers.ShareContact,
+	},
+	route{
+		Name:        "FetchContactShares",
+		Method:      "GET",
+		Pattern:     "/contact/{contactId}/shares",
+		HandlerFunc: controllers.FetchContactShares,
+	},
+	route{
+		Name:        "RevokeShare",
+		Method:      "DELETE",
+		Pattern:     "/contact/{contactId}/shares/{shareId}",
+		HandlerFunc: controllers.RevokeShare,
+	},
+	route{
+		Name:        "FetchSharedContacts",
+		Method:      "GET",
+		Pattern:     "/contacts/shared",
+		HandlerFunc: controllers.FetchSharedContacts,
+	},
+	route{
+		Name:        "CreateAddressBook",
+		Method:      "POST",
+		Pattern:     "/addressbook/create",
+		HandlerFunc: controllers.CreateAddressBook,
+	},
+	route{
+		Name:        "FetchAddressBooks",
+		Method:      "GET",
+		Pattern:     "/fetch/account/addressbooks",
+		HandlerFunc: controllers.FetchAddressBooks,
+	},
+	route{
+		Name:        "FetchAddressBook",
+		Method:      "GET",
+		Pattern:     "/addressbook/{bookId}",
+		HandlerFunc: controllers.FetchAddressBook,
+	},
+	route{
+		Name:        "UpdateAddressBook",
+		Method:      "POST",
+		Pattern:     "/update/addressbook/{bookId}",
+		HandlerFunc: controllers.UpdateAddressBook,
+	},
+	route{
+		Name:        "DeleteAddressBook",
+		Method:      "DELETE",
+		Pattern:     "/addressbook/{bookId}",
+		HandlerFunc: controllers.DeleteAddressBook,
+	},
+	route{
+		Name:        "InviteMember",
+		Method:      "POST",
+		Pattern:     "/addressbook/{bookId}/invitations",
+		HandlerFunc: controllers.InviteMember,
+	},
+	route{
+		Name:        "CancelInvitation",
+		Method:      "DELETE",
+		Pattern:     "/addressbook/{bookId}/invitations/{invitationId}",
+		HandlerFunc: controllers.CancelInvitation,
+	},
+	route{
+		Name:        "UpdateMemberRole",
+		Method:      "POST",
+		Pattern:     "/addressbook/{bookId}/members/{memberId}",
+		HandlerFunc: controllers.UpdateMemberRole,
+	},
+	route{
+		Name:        "RemoveMember",
+		Method:      "DELETE",
+		Pattern:     "/addressbook/{bookId}/members/{memberId}",
+		HandlerFunc: controllers.RemoveMember,
+	},
+	route{
+		Name:        "FetchInvitations",
+		Method:      "GET",
+		Pattern:     "/addressbooks/invitations",
+		HandlerFunc: controllers.FetchInvitations,
+	},
+	route{
+		Name:        "AcceptInvitation",
+		Method:      "POST",
+		Pattern:     "/addressbooks/invitations/{invitationId}/accept",
+		HandlerFunc: controllers.AcceptInvitation,
+	},
+	route{
+		Name:        "DeclineInvitation",
+		Method:      "POST",
+		Pattern:     "/addressbooks/invitations/{invitationId}/decline",
+		HandlerFunc: controllers.DeclineInvitation,
+	},
+	route{
+		Name:        "FetchTrash",
+		Method:      "GET",
+		Pattern:     "/contacts/trash",
+		HandlerFunc: controllers.FetchTrash,
+	},
+	route{
+		Name:        "RestoreContact",
+		Method:      "POST",
+		Pattern:     "/contact/{contactId}/restore",
+		HandlerFunc: controllers.RestoreContact,
+	},
+	route{
+		Name:        "PurgeContact",
+		Method:      "DELETE",
+		Pattern:     "/contacts/trash/{contactId}",
+		HandlerFunc: controllers.PurgeContact,
+	},
+	route{
+		Name:        "FetchContactRevisions",
+		Method:      "GET",
+		Pattern:     "/contact/{contactId}/revisions",
+		HandlerFunc: controllers.FetchContactRevisions,
+	},
+	route{
+		Name:        "RevertContact",
+		Method:      "POST",
+		Pattern:     "/contact/{contactId}/revisions/{revision}/revert",
+		HandlerFunc: controllers.RevertContact,
+	},
+	route{
+		Name:        "BulkCreateContacts",
+		Method:      "POST",
+		Pattern:     "/contacts/bulk/create",
+		HandlerFunc: controllers.BulkCreateContacts,
+	},
+	route{
+		Name:        "BulkUpdateContacts",
+		Method:      "POST",
+		Pattern:     "/contacts/bulk/update",
+		HandlerFunc: controllers.BulkUpdateContacts,
+	},
+	route{
+		Name:        "BulkDeleteContacts",
+		Method:      "POST",
+		Pattern:     "/contacts/bulk/delete",
+		HandlerFunc: controllers.BulkDeleteContacts,
+	},
+	route{
+		Name:        "SyncContacts",
+		Method:      "GET",
+		Pattern:     "/contacts/sync",
+		HandlerFunc: controllers.SyncContacts,
+	},
+	route{
+		Name:        "CreateAppPassword",
+		Method:      "POST",
+		Pattern:     "/app-passwords",
+		HandlerFunc: controllers.CreateAppPassword,
+	},
+	route{
+		Name:        "FetchAppPasswords",
+		Method:      "GET",
+		Pattern:     "/app-passwords",
+		HandlerFunc: controllers.FetchAppPasswords,
+	},
+	route{
+		Name:        "DeleteAppPassword",
+		Method:      "DELETE",
+		Pattern:     "/app-passwords/{appPasswordId}",
+		HandlerFunc: controllers.DeleteAppPassword,
+	},
 }
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// LocalStore struct keeps blobs as files under a root directory
+type LocalStore struct {
+	Root string
+}
+
+// NewLocalStore public function that creates the root directory when it does not exist yet
+func NewLocalStore(root string) (*LocalStore, error) {
+	if err := os.MkdirAll(root, 0750); err != nil {
+		return nil, err
+	}
+	return &LocalStore{Root: root}, nil
+}
+
+// path private method that maps a key to a file under the root directory
+func (store *LocalStore) path(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(store.Root, filepath.FromSlash(key)), nil
+}
+
+// Put public method that writes a blob. The data is written to a temporary file first and then
+// renamed, so readers never see a partially written blob
+func (store *LocalStore) Put(key string, data []byte, contentType string) error {
+	name, err := store.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0750); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// Get public method that reads a blob
+func (store *LocalStore) Get(key string) ([]byte, error) {
+	name, err := store.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// Delete public method that removes a blob, removing a missing blob is not an error
+func (store *LocalStore) Delete(key string) error {
+	name, err := store.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestLocalStore(t *testing.T) *LocalStore {
+	t.Helper()
+	store, err := NewLocalStore(filepath.Join(t.TempDir(), "photos"))
+	if err != nil {
+		t.Fatalf("NewLocalStore returned %v", err)
+	}
+	return store
+}
+
+func TestLocalStorePutGetDelete(t *testing.T) {
+	store := newTestLocalStore(t)
+	key := "contacts/12/photo/64.jpg"
+
+	if err := store.Put(key, []byte("first"), "image/jpeg"); err != nil {
+		t.Fatalf("Put returned %v", err)
+	}
+	if err := store.Put("/"+key, []byte("second"), "image/jpeg"); err != nil {
+		t.Fatalf("Put of an existing key returned %v", err)
+	}
+	data, err := store.Get(key)
+	if err != nil {
+		t.Fatalf("Get returned %v", err)
+	}
+	if !bytes.Equal(data, []byte("second")) {
+		t.Errorf("Get returned %q, want the last data put", data)
+	}
+
+	// only the blob is left in its directory, the temporary file was renamed
+	files, err := ioutil.ReadDir(filepath.Join(store.Root, "contacts", "12", "photo"))
+	if err != nil {
+		t.Fatalf("reading the blob's directory returned %v", err)
+	}
+	if len(files) != 1 || files[0].Name() != "64.jpg" {
+		t.Errorf("blob directory holds %d files, want only 64.jpg", len(files))
+	}
+
+	if err := store.Delete(key); err != nil {
+		t.Fatalf("Delete returned %v", err)
+	}
+	if _, err := store.Get(key); err != ErrNotFound {
+		t.Errorf("Get of a deleted blob returned %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(key); err != nil {
+		t.Errorf("Delete of a missing blob returned %v, want nil", err)
+	}
+}
+
+func TestLocalStoreRejectsKeysOutsideTheRoot(t *testing.T) {
+	store := newTestLocalStore(t)
+	outside := filepath.Join(filepath.Dir(store.Root), "outside.jpg")
+
+	for _, key := range []string{"", "/", "..", "../outside.jpg", "contacts/../../outside.jpg", "contacts//12.jpg",
+		"contacts/./12.jpg"} {
+		if err := store.Put(key, []byte("data"), "image/jpeg"); err != ErrInvalidKey {
+			t.Errorf("Put(%q) returned %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := store.Get(key); err != ErrInvalidKey {
+			t.Errorf("Get(%q) returned %v, want ErrInvalidKey", key, err)
+		}
+		if err := store.Delete(key); err != ErrInvalidKey {
+			t.Errorf("Delete(%q) returned %v, want ErrInvalidKey", key, err)
+		}
+	}
+	if _, err := os.Stat(outside); !os.IsNotExist(err) {
+		t.Errorf("a file was written outside the root: %v", err)
+	}
+}
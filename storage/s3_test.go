@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	testRegion    = "eu-west-1"
+	testBucket    = "phonebook"
+)
+
+// fakeS3 struct is an S3 stand-in that keeps objects in memory and checks the Signature Version 4
+// of every request the way S3 does, without sharing any code with the signer
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	types    map[string]string
+	requests []string
+	fail     int // status returned to every request when set
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	fake := &fakeS3{objects: make(map[string][]byte), types: make(map[string]string)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func (fake *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	escapedPath := strings.SplitN(r.RequestURI, "?", 2)[0]
+	fake.requests = append(fake.requests, r.Method+" "+escapedPath)
+	if fake.fail != 0 {
+		http.Error(w, "<Error><Code>InternalError</Code></Error>", fake.fail)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	if problem := verifySignature(r, escapedPath, body); problem != "" {
+		http.Error(w, "<Error><Code>SignatureDoesNotMatch</Code><Message>"+problem+"</Message></Error>",
+			http.StatusForbidden)
+		return
+	}
+
+	prefix := "/" + testBucket + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		http.Error(w, "<Error><Code>NoSuchBucket</Code></Error>", http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, prefix)
+
+	switch r.Method {
+	case http.MethodPut:
+		fake.objects[key], fake.types[key] = body, r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		data, ok := fake.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", fake.types[key])
+		_, _ = w.Write(data)
+	case http.MethodDelete:
+		delete(fake.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// verifySignature private function that recomputes the signature of a request from what reached the server,
+// it returns why the request is refused or an empty string when it is correctly signed
+func verifySignature(r *http.Request, escapedPath string, body []byte) string {
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 ") {
+		return "missing AWS4-HMAC-SHA256 authorization"
+	}
+	fields := make(map[string]string)
+	for _, part := range strings.Split(strings.TrimPrefix(authorization, "AWS4-HMAC-SHA256 "), ",") {
+		pair := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(pair) == 2 {
+			fields[pair[0]] = pair[1]
+		}
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	signedAt, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil || time.Since(signedAt) > 15*time.Minute || time.Until(signedAt) > 15*time.Minute {
+		return "X-Amz-Date is missing or outside the allowed skew"
+	}
+	scope := amzDate[:8] + "/" + testRegion + "/s3/aws4_request"
+	if fields["Credential"] != testAccessKey+"/"+scope {
+		return "unexpected credential " + fields["Credential"]
+	}
+
+	sum := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		return "X-Amz-Content-Sha256 does not match the body"
+	}
+
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	if !sort.StringsAreSorted(signed) {
+		return "signed headers are not sorted"
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range signed {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	for _, required := range []string{"host", "x-amz-content-sha256", "x-amz-date"} {
+		if !strings.Contains(";"+fields["SignedHeaders"]+";", ";"+required+";") {
+			return required + " is not signed"
+		}
+	}
+
+	canonicalRequest := strings.Join([]string{r.Method, escapedPath, r.URL.RawQuery, canonicalHeaders.String(),
+		fields["SignedHeaders"], r.Header.Get("X-Amz-Content-Sha256")}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + testSecretKey)
+	for _, part := range []string{amzDate[:8], testRegion, "s3", "aws4_request", stringToSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	if !hmac.Equal([]byte(fields["Signature"]), []byte(hex.EncodeToString(key))) {
+		return "signature does not match"
+	}
+	return ""
+}
+
+func newTestS3Store(t *testing.T, endpoint, secretKey string) *S3Store {
+	t.Helper()
+	store, err := NewS3Store(endpoint, testRegion, testBucket, testAccessKey, secretKey)
+	if err != nil {
+		t.Fatalf("NewS3Store returned %v", err)
+	}
+	return store
+}
+
+func TestS3StorePutGetDelete(t *testing.T) {
+	fake, server := newFakeS3(t)
+	store := newTestS3Store(t, server.URL+"/", testSecretKey)
+
+	// the key has characters S3 expects percent-encoded in the signed path
+	key := "contacts/12/photo/my photo+café(1).jpg"
+	if err := store.Put(key, []byte("jpeg data"), "image/jpeg"); err != nil {
+		t.Fatalf("Put returned %v", err)
+	}
+	if fake.types[key] != "image/jpeg" {
+		t.Errorf("object saved with content type %q, want image/jpeg", fake.types[key])
+	}
+	data, err := store.Get(key)
+	if err != nil {
+		t.Fatalf("Get returned %v", err)
+	}
+	if !bytes.Equal(data, []byte("jpeg data")) {
+		t.Errorf("Get returned %q, want the data put", data)
+	}
+	if err := store.Delete(key); err != nil {
+		t.Fatalf("Delete returned %v", err)
+	}
+	if _, err := store.Get(key); err != ErrNotFound {
+		t.Errorf("Get of a deleted object returned %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(key); err != nil {
+		t.Errorf("Delete of a missing object returned %v, want nil", err)
+	}
+
+	want := "/" + testBucket + "/contacts/12/photo/my%20photo%2Bcaf%C3%A9%281%29.jpg"
+	for _, request := range fake.requests {
+		if !strings.HasSuffix(request, " "+want) {
+			t.Errorf("request %q, want the path %s", request, want)
+		}
+	}
+}
+
+func TestS3StoreEndpointWithPath(t *testing.T) {
+	fake := &fakeS3{objects: make(map[string][]byte), types: make(map[string]string)}
+	// the object store behind a reverse proxy, the bucket is under the proxy's path
+	mux := http.NewServeMux()
+	mux.Handle("/s3/", http.StripPrefix("/s3", fake))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	store := newTestS3Store(t, server.URL+"/s3", testSecretKey)
+	if err := store.Put("a.png", []byte("png data"), "image/png"); err != nil {
+		t.Fatalf("Put returned %v", err)
+	}
+	if data, err := store.Get("a.png"); err != nil || string(data) != "png data" {
+		t.Errorf("Get returned %q and %v, want the data put", data, err)
+	}
+	if len(fake.requests) == 0 || fake.requests[0] != "PUT /s3/"+testBucket+"/a.png" {
+		t.Errorf("requests %v, want the bucket under /s3", fake.requests)
+	}
+}
+
+func TestS3StoreErrors(t *testing.T) {
+	fake, server := newFakeS3(t)
+
+	store := newTestS3Store(t, server.URL, "wrong secret")
+	err := store.Put("a.jpg", []byte("data"), "image/jpeg")
+	if err == nil || !strings.Contains(err.Error(), "status 403") || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("Put with a wrong secret key returned %v, want a 403 SignatureDoesNotMatch error", err)
+	}
+	if _, err := store.Get("a.jpg"); err == nil || err == ErrNotFound {
+		t.Errorf("Get with a wrong secret key returned %v, want a 403 error", err)
+	}
+
+	store = newTestS3Store(t, server.URL, testSecretKey)
+	fake.fail = http.StatusInternalServerError
+	if err := store.Put("a.jpg", []byte("data"), "image/jpeg"); err == nil || !strings.Contains(err.Error(), "status 500") {
+		t.Errorf("Put returned %v, want a status 500 error", err)
+	}
+	if _, err := store.Get("a.jpg"); err == nil || err == ErrNotFound {
+		t.Errorf("Get returned %v, want a status 500 error", err)
+	}
+	if err := store.Delete("a.jpg"); err == nil {
+		t.Error("Delete returned nil, want a status 500 error")
+	}
+
+	fake.requests = nil
+	for _, key := range []string{"", "../a.jpg", "contacts/../../a.jpg"} {
+		if err := store.Put(key, []byte("data"), "image/jpeg"); err != ErrInvalidKey {
+			t.Errorf("Put(%q) returned %v, want ErrInvalidKey", key, err)
+		}
+	}
+	if len(fake.requests) != 0 {
+		t.Errorf("invalid keys were sent to the object store: %v", fake.requests)
+	}
+}
+
+func TestNewS3Store(t *testing.T) {
+	for _, endpoint := range []string{"", "localhost:9000", "ftp://localhost", "http://"} {
+		if _, err := NewS3Store(endpoint, testRegion, testBucket, testAccessKey, testSecretKey); err == nil {
+			t.Errorf("NewS3Store(%q) returned no error", endpoint)
+		}
+	}
+	if _, err := NewS3Store("http://localhost:9000", testRegion, "", testAccessKey, testSecretKey); err == nil {
+		t.Error("NewS3Store without a bucket returned no error")
+	}
+	store, err := NewS3Store("http://localhost:9000/", "", testBucket, testAccessKey, testSecretKey)
+	if err != nil {
+		t.Fatalf("NewS3Store returned %v", err)
+	}
+	if store.Region != "us-east-1" || store.Endpoint.String() != "http://localhost:9000" {
+		t.Errorf("got region %q and endpoint %q, want us-east-1 and http://localhost:9000", store.Region,
+			fmt.Sprint(store.Endpoint))
+	}
+}
@@ -0,0 +1,32 @@
+// Package storage keeps binary objects such as contact photos behind a small interface so that the
+// application can run against the local filesystem or any S3-compatible object store
+package storage
+
+import (
+	"errors"
+	"path"
+	"strings"
+)
+
+// ErrNotFound is returned when a blob does not exist
+var ErrNotFound = errors.New("blob not found")
+
+// ErrInvalidKey is returned for keys that are empty or try to leave the store's root
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobStore interface is implemented by every storage backend. Keys are slash separated paths
+// such as contacts/12/photo/64.jpg
+type BlobStore interface {
+	Put(key string, data []byte, contentType string) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+// cleanKey private function that checks a key and returns it without leading slashes
+func cleanKey(key string) (string, error) {
+	key = strings.TrimLeft(key, "/")
+	if key == "" || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return "", ErrInvalidKey
+	}
+	return key, nil
+}
@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ETag public function that returns the entity tag of a record version, e.g. "3"
+func ETag(version uint) string {
+	return fmt.Sprintf("%q", fmt.Sprint(version))
+}
+
+// ETagMatches public function that checks an If-Match or If-None-Match header against an entity tag.
+// The header holds "*" or a comma separated list of tags, weak tags (W/"3") only match when weak
+// comparison is allowed, as it is for If-None-Match
+func ETagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
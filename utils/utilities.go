@@ -9,6 +9,9 @@ import (
 	"net/http"
 )
 
+// APIPrefix is the path the API routes are served under
+const APIPrefix = "/phonebookapi/v1"
+
 var vp = viper.New()
 var redisClient *redis.Client
 
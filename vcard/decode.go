@@ -0,0 +1,351 @@
+package vcard
+
+import (
+	"encoding/base64"
+	"errors"
+	"golang.org/x/text/encoding/ianaindex"
+	"io"
+	"io/ioutil"
+	"mime/quotedprintable"
+	"strings"
+	"time"
+)
+
+// Result struct holds one card read from a .vcf file, or the reason it could not be read.
+// Index is the 1-based position of the card in the file
+type Result struct {
+	Index int
+	Card  *Card
+	Err   error
+}
+
+// property private struct holding a parsed content line
+type property struct {
+	name   string
+	params map[string][]string
+	value  string
+}
+
+// Decode public function that reads every card in a .vcf file. Folded lines, quoted-printable
+// values (as exported by older Android phones) and CHARSET parameters are supported. The returned error is only set when
+// the input could not be read, problems with individual cards are reported in their Result
+func Decode(r io.Reader) ([]*Result, error) {
+	lines, err := unfoldLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*Result, 0)
+	var current *Result
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		prop, parseErr := parseLine(line)
+		switch {
+		case parseErr == nil && prop.name == "BEGIN" && strings.EqualFold(prop.value, "VCARD"):
+			if current != nil && current.Err == nil {
+				current.Err = errors.New("card is not terminated with END:VCARD")
+			}
+			current = &Result{Index: len(results) + 1, Card: &Card{}}
+			results = append(results, current)
+		case current == nil:
+			// content outside of a card is ignored
+		case parseErr == nil && prop.name == "END" && strings.EqualFold(prop.value, "VCARD"):
+			current = nil
+		case current.Err != nil:
+			// the rest of a broken card is skipped
+		case parseErr != nil:
+			current.Err = parseErr
+		default:
+			current.Card.apply(prop)
+		}
+	}
+	if current != nil && current.Err == nil {
+		current.Err = errors.New("card is not terminated with END:VCARD")
+	}
+
+	for _, result := range results {
+		if result.Err != nil {
+			result.Card = nil
+		}
+	}
+	return results, nil
+}
+
+// unfoldLines private function that splits the input into logical content lines. Lines starting
+// with a space or tab continue the previous line, quoted-printable soft line breaks ("=" at the
+// end of a line) are joined as well
+func unfoldLines(r io.Reader) ([]string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]string, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		last := len(lines) - 1
+		switch {
+		case last >= 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")):
+			lines[last] += line[1:]
+		case last >= 0 && isQuotedPrintable(lines[last]) && strings.HasSuffix(lines[last], "="):
+			lines[last] = lines[last][:len(lines[last])-1] + line
+		default:
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// isQuotedPrintable private function that checks if a raw content line uses quoted-printable encoding
+func isQuotedPrintable(line string) bool {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return false
+	}
+	return strings.Contains(strings.ToUpper(line[:colon]), "QUOTED-PRINTABLE")
+}
+
+// parseLine private function that splits a content line into its name, parameters and value
+func parseLine(line string) (*property, error) {
+	// the first colon outside of a quoted parameter value ends the name and parameters
+	colon, quoted := -1, false
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon <= 0 {
+		return nil, errors.New("malformed line: " + truncate(line))
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	name := strings.ToUpper(parts[0])
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		name = name[dot+1:] // drop group prefixes such as item1.TEL
+	}
+
+	prop := &property{name: name, params: make(map[string][]string), value: line[colon+1:]}
+	for _, param := range parts[1:] {
+		key, value := "TYPE", param // vCard 2.1 allows bare parameters e.g. TEL;CELL
+		if eq := strings.Index(param, "="); eq >= 0 {
+			key, value = strings.ToUpper(param[:eq]), param[eq+1:]
+		}
+		if strings.EqualFold(value, "QUOTED-PRINTABLE") {
+			key = "ENCODING"
+		}
+		for _, v := range strings.Split(value, ",") {
+			prop.params[key] = append(prop.params[key], strings.ToLower(strings.Trim(v, `"`)))
+		}
+	}
+
+	if prop.hasParam("ENCODING", "quoted-printable") {
+		decoded, err := ioutil.ReadAll(quotedprintable.NewReader(strings.NewReader(prop.value)))
+		if err != nil {
+			return nil, errors.New("invalid quoted-printable value in " + name)
+		}
+		prop.value = string(decoded)
+	}
+	if charsets := prop.params["CHARSET"]; len(charsets) > 0 {
+		decoded, err := decodeCharset(charsets[0], prop.value)
+		if err != nil {
+			return nil, errors.New("unsupported charset " + charsets[0] + " in " + name)
+		}
+		prop.value = decoded
+	}
+	return prop, nil
+}
+
+// decodeCharset private function that converts a value in the charset named by a CHARSET parameter to
+// UTF-8, vCard 2.1 files exported by older phones often use ISO-8859-1 or a Windows code page
+func decodeCharset(charset, value string) (string, error) {
+	switch charset {
+	case "utf-8", "us-ascii":
+		return value, nil
+	}
+	encoding, err := ianaindex.IANA.Encoding(charset)
+	if err != nil || encoding == nil {
+		return "", errors.New("unknown charset")
+	}
+	return encoding.NewDecoder().String(value)
+}
+
+// hasParam private method that checks if a property parameter contains a value
+func (prop *property) hasParam(key, value string) bool {
+	for _, v := range prop.params[key] {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// apply private method that copies a property the phone book understands into the card
+func (card *Card) apply(prop *property) {
+	switch prop.name {
+	case "UID":
+		card.UID = unescapeText(prop.value)
+	case "FN":
+		card.FullName = unescapeText(prop.value)
+	case "N":
+		components := splitComponents(prop.value)
+		card.LastName = components[0]
+		if len(components) > 1 {
+			card.FirstName = components[1]
+		}
+	case "TEL":
+		value := strings.TrimSpace(strings.TrimPrefix(unescapeText(prop.value), "tel:"))
+		if value != "" {
+			card.Phones = append(card.Phones, Phone{Type: phoneLabel(prop), Value: value, Preferred: prop.preferred()})
+		}
+	case "EMAIL":
+		value := strings.TrimSpace(strings.TrimPrefix(unescapeText(prop.value), "mailto:"))
+		if value != "" {
+			card.Emails = append(card.Emails, Email{Type: emailLabel(prop), Value: value, Preferred: prop.preferred()})
+		}
+	case "ADR":
+		components := splitComponents(prop.value)
+		for len(components) < 7 {
+			components = append(components, "")
+		}
+		address := Address{Type: addressLabel(prop), Street: components[2], City: components[3],
+			Region: components[4], PostalCode: components[5], Country: components[6]}
+		if strings.TrimSpace(strings.Join(components, "")) != "" {
+			card.Addresses = append(card.Addresses, address)
+		}
+	case "PHOTO":
+		card.Photo = decodePhoto(prop)
+	case "REV":
+		for _, layout := range []string{"20060102T150405Z", "2006-01-02T15:04:05Z", time.RFC3339} {
+			if revision, err := time.Parse(layout, prop.value); err == nil {
+				card.Revision = revision
+				break
+			}
+		}
+	}
+}
+
+// decodePhoto private function that reads an inline photo, the 3.0 ENCODING=b (BASE64 in 2.1) form and
+// the 4.0 data URI. Photos linked by URL are not fetched and nil is returned for them
+func decodePhoto(prop *property) *Photo {
+	value, mediaType := prop.value, ""
+	switch {
+	case prop.hasParam("ENCODING", "b") || prop.hasParam("ENCODING", "base64"):
+		for _, photoType := range prop.params["TYPE"] {
+			mediaType = "image/" + photoType
+		}
+	case strings.HasPrefix(value, "data:"):
+		comma := strings.Index(value, ",")
+		if comma < 0 || !strings.HasSuffix(value[:comma], ";base64") {
+			return nil
+		}
+		mediaType, value = strings.TrimSuffix(value[len("data:"):comma], ";base64"), value[comma+1:]
+	default:
+		return nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	return &Photo{MediaType: strings.ToLower(mediaType), Data: data}
+}
+
+// preferred private method that checks the 3.0 TYPE=pref and 4.0 PREF parameters
+func (prop *property) preferred() bool {
+	return prop.hasParam("TYPE", "pref") || len(prop.params["PREF"]) > 0
+}
+
+// phoneLabel private function that maps TEL types to phone book labels
+func phoneLabel(prop *property) string {
+	switch {
+	case prop.hasParam("TYPE", "cell"):
+		return "mobile"
+	case prop.hasParam("TYPE", "work"):
+		return "work"
+	case prop.hasParam("TYPE", "home"):
+		return "home"
+	default:
+		return "other"
+	}
+}
+
+// emailLabel private function that maps EMAIL types to phone book labels
+func emailLabel(prop *property) string {
+	switch {
+	case prop.hasParam("TYPE", "work"):
+		return "work"
+	case prop.hasParam("TYPE", "home"):
+		return "home"
+	default:
+		return "other"
+	}
+}
+
+// addressLabel private function that maps ADR types to phone book labels
+func addressLabel(prop *property) string {
+	switch {
+	case prop.hasParam("TYPE", "work"):
+		return "work"
+	case prop.hasParam("TYPE", "home"):
+		return "home"
+	default:
+		return "other"
+	}
+}
+
+// unescapeText private function that reverses escapeText
+func unescapeText(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+
+	var builder strings.Builder
+	escaped := false
+	for _, r := range value {
+		switch {
+		case escaped && (r == 'n' || r == 'N'):
+			builder.WriteRune('\n')
+			escaped = false
+		case escaped:
+			builder.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		default:
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+// splitComponents private function that splits a structured value on unescaped semicolons
+func splitComponents(value string) []string {
+	components := make([]string, 0)
+	start, escaped := 0, false
+	for i, r := range value {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ';':
+			components = append(components, unescapeText(value[start:i]))
+			start = i + 1
+		}
+	}
+	return append(components, unescapeText(value[start:]))
+}
+
+// truncate private function that shortens long lines quoted in error messages
+func truncate(line string) string {
+	if len(line) > 40 {
+		return line[:40] + "..."
+	}
+	return line
+}
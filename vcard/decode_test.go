@@ -0,0 +1,295 @@
+package vcard
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// vcf private function that joins lines with CRLF the way cards are written
+func vcf(lines ...string) string {
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+// decodeOne private function that decodes input holding a single valid card
+func decodeOne(t *testing.T, input string) *Card {
+	t.Helper()
+	results, err := Decode(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("Decode returned %d results, want one valid card: %+v", len(results), results)
+	}
+	return results[0].Card
+}
+
+func TestDecodeUnfolding(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"space continuation", vcf("BEGIN:VCARD", "FN:Ada Love", " lace", "END:VCARD"), "Ada Lovelace"},
+		{"tab continuation", vcf("BEGIN:VCARD", "FN:Ada Love", "\tlace", "END:VCARD"), "Ada Lovelace"},
+		{"several continuations", vcf("BEGIN:VCARD", "FN:A", " d", " a", "END:VCARD"), "Ada"},
+		{"LF line endings", "BEGIN:VCARD\nFN:Ada Love\n lace\nEND:VCARD\n", "Ada Lovelace"},
+		{"multi-byte character split over lines", vcf("BEGIN:VCARD", "FN:Zo\xc3", " \xab", "END:VCARD"), "Zoë"},
+		{"folded inside the name", vcf("BEGIN:VCARD", "F", " N:Ada", "END:VCARD"), "Ada"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if card := decodeOne(t, test.input); card.FullName != test.want {
+				t.Errorf("FN = %q, want %q", card.FullName, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeQuotedPrintable(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  string
+	}{
+		{"utf-8", []string{"FN;CHARSET=UTF-8;ENCODING=QUOTED-PRINTABLE:Zo=C3=AB"}, "Zoë"},
+		{"bare parameter", []string{"FN;QUOTED-PRINTABLE:Caf=C3=A9"}, "Café"},
+		{"soft line break", []string{"FN;ENCODING=QUOTED-PRINTABLE:Ada Love=", "lace"}, "Ada Lovelace"},
+		{"soft line breaks over three lines", []string{"FN;ENCODING=QUOTED-PRINTABLE:A=", "d=", "a"}, "Ada"},
+		{"encoded equals sign", []string{"FN;ENCODING=QUOTED-PRINTABLE:a=3Db"}, "a=b"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := append(append([]string{"BEGIN:VCARD"}, test.lines...), "END:VCARD")
+			if card := decodeOne(t, vcf(lines...)); card.FullName != test.want {
+				t.Errorf("FN = %q, want %q", card.FullName, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCharset(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"utf-8", "FN;CHARSET=UTF-8:Zo\xc3\xab", "Zoë"},
+		{"us-ascii", "FN;CHARSET=US-ASCII:Ada", "Ada"},
+		{"iso-8859-1", "FN;CHARSET=ISO-8859-1:Zo\xeb", "Zoë"},
+		{"quoted charset", `FN;CHARSET="iso-8859-1":Zo` + "\xeb", "Zoë"},
+		{"windows-1252", "FN;CHARSET=windows-1252:\x93Ada\x94", "“Ada”"},
+		{"iso-8859-1 and quoted-printable", "FN;CHARSET=ISO-8859-1;ENCODING=QUOTED-PRINTABLE:Zo=EB", "Zoë"},
+		{"N components", "N;CHARSET=ISO-8859-1:M\xfcller;J\xfcrgen;;;", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			card := decodeOne(t, vcf("BEGIN:VCARD", test.line, "END:VCARD"))
+			if test.want != "" && card.FullName != test.want {
+				t.Errorf("FN = %q, want %q", card.FullName, test.want)
+			}
+			if test.want == "" && (card.LastName != "Müller" || card.FirstName != "Jürgen") {
+				t.Errorf("N = %q;%q, want Müller;Jürgen", card.LastName, card.FirstName)
+			}
+		})
+	}
+}
+
+func TestDecodeProperties(t *testing.T) {
+	card := decodeOne(t, vcf(
+		"BEGIN:VCARD",
+		"VERSION:3.0",
+		`UID:uid\,1`,
+		`N:O'Neil\, Jr.;Mary\; Jane;;;`,
+		"FN:Mary O'Neil",
+		"item1.TEL;TYPE=CELL,PREF:+254712345678",
+		"TEL;TYPE=WORK:+254202222222",
+		"TEL;VALUE=uri;TYPE=home:tel:+254203333333",
+		"TEL;TYPE=FAX:+254204444444",
+		"TEL:",
+		"EMAIL;TYPE=INTERNET,HOME:mary@example.com",
+		"EMAIL;PREF=1:mailto:mary@example.org",
+		"X-CUSTOM:ignored",
+		"REV:20260301T073000Z",
+		"END:VCARD",
+	))
+
+	want := &Card{
+		UID:       "uid,1",
+		FirstName: "Mary; Jane",
+		LastName:  "O'Neil, Jr.",
+		FullName:  "Mary O'Neil",
+		Phones: []Phone{
+			{Type: "mobile", Value: "+254712345678", Preferred: true},
+			{Type: "work", Value: "+254202222222"},
+			{Type: "home", Value: "+254203333333"},
+			{Type: "other", Value: "+254204444444"},
+		},
+		Emails: []Email{
+			{Type: "home", Value: "mary@example.com"},
+			{Type: "other", Value: "mary@example.org", Preferred: true},
+		},
+		Revision: time.Date(2026, time.March, 1, 7, 30, 0, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(card, want) {
+		t.Errorf("Decode returned\n%+v\nwant\n%+v", card, want)
+	}
+}
+
+func TestDecodeReport(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string // the full name of every card, or the start of the reason it was rejected
+		wantErr []bool
+	}{
+		{
+			name:    "valid cards",
+			input:   vcf("BEGIN:VCARD", "FN:Ada", "END:VCARD", "BEGIN:VCARD", "FN:Alan", "END:VCARD"),
+			want:    []string{"Ada", "Alan"},
+			wantErr: []bool{false, false},
+		},
+		{
+			name:    "malformed line",
+			input:   vcf("BEGIN:VCARD", "FN:Ada", "no colon here", "END:VCARD", "BEGIN:VCARD", "FN:Alan", "END:VCARD"),
+			want:    []string{"malformed line: no colon here", "Alan"},
+			wantErr: []bool{true, false},
+		},
+		{
+			name:    "missing END before the next card",
+			input:   vcf("BEGIN:VCARD", "FN:Ada", "BEGIN:VCARD", "FN:Alan", "END:VCARD"),
+			want:    []string{"card is not terminated with END:VCARD", "Alan"},
+			wantErr: []bool{true, false},
+		},
+		{
+			name:    "missing END at the end of the file",
+			input:   vcf("BEGIN:VCARD", "FN:Ada", "END:VCARD", "BEGIN:VCARD", "FN:Alan"),
+			want:    []string{"Ada", "card is not terminated with END:VCARD"},
+			wantErr: []bool{false, true},
+		},
+		{
+			name:    "unknown charset",
+			input:   vcf("BEGIN:VCARD", "FN;CHARSET=X-UNKNOWN:Ada", "END:VCARD", "BEGIN:VCARD", "FN:Alan", "END:VCARD"),
+			want:    []string{"unsupported charset x-unknown in FN", "Alan"},
+			wantErr: []bool{true, false},
+		},
+		{
+			name:    "content outside of cards",
+			input:   vcf("junk", "", "BEGIN:VCARD", "FN:Ada", "END:VCARD", "FN:stray", "END:VCARD"),
+			want:    []string{"Ada"},
+			wantErr: []bool{false},
+		},
+		{
+			name:    "lower case delimiters and blank lines",
+			input:   vcf("begin:vcard", "", "FN:Ada", "end:vcard"),
+			want:    []string{"Ada"},
+			wantErr: []bool{false},
+		},
+		{
+			name:  "empty file",
+			input: "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := Decode(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if len(results) != len(test.want) {
+				t.Fatalf("Decode returned %d results, want %d: %+v", len(results), len(test.want), results)
+			}
+			for i, result := range results {
+				if result.Index != i+1 {
+					t.Errorf("result %d has index %d", i, result.Index)
+				}
+				switch {
+				case test.wantErr[i] && (result.Err == nil || result.Card != nil):
+					t.Errorf("card %d returned %+v, %v, want it rejected", result.Index, result.Card, result.Err)
+				case test.wantErr[i] && !strings.HasPrefix(result.Err.Error(), test.want[i]):
+					t.Errorf("card %d was rejected with %q, want %q", result.Index, result.Err, test.want[i])
+				case !test.wantErr[i] && (result.Err != nil || result.Card.FullName != test.want[i]):
+					t.Errorf("card %d returned %+v, %v, want %s", result.Index, result.Card, result.Err, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeReadError(t *testing.T) {
+	readErr := errors.New("connection reset")
+	if _, err := Decode(&failingReader{err: readErr}); err != readErr {
+		t.Errorf("Decode returned %v, want the read error", err)
+	}
+}
+
+// failingReader struct is an io.Reader that always fails
+type failingReader struct {
+	err error
+}
+
+func (r *failingReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+func TestRoundTrip(t *testing.T) {
+	card := &Card{
+		UID:       "uid;1,2\\3",
+		FirstName: "Mary; Jane",
+		LastName:  "O'Neil, Jr.",
+		FullName:  strings.Repeat("Zoë Ñandú 漢字, ", 8),
+		Phones: []Phone{
+			{Type: "mobile", Value: "+254712345678", Preferred: true},
+			{Type: "work", Value: "+254202222222"},
+			{Type: "home", Value: "+254203333333"},
+			{Type: "other", Value: "+254204444444"},
+		},
+		Emails: []Email{
+			{Type: "home", Value: "mary@example.com"},
+			{Type: "work", Value: "mary@example.org", Preferred: true},
+			{Type: "other", Value: "mary@example.net"},
+		},
+		Addresses: []Address{
+			{Type: "home", Street: "Line one\nLine two; Suite 4", City: "Nairobi", Region: "Nairobi, Kenya",
+				PostalCode: "00100", Country: "Kenya"},
+			{Type: "work", Street: strings.Repeat("Long street name ", 6), City: `C:\Mombasa`},
+			{Type: "other", Country: "Tanzania"},
+		},
+		Photo:    &Photo{MediaType: "image/jpeg", Data: []byte(strings.Repeat("\xff\xd8\xff\xe0 photo bytes ", 20))},
+		Revision: time.Date(2026, time.March, 1, 7, 30, 0, 0, time.UTC),
+	}
+
+	for _, version := range []string{Version3, Version4} {
+		t.Run(version, func(t *testing.T) {
+			decoded := decodeOne(t, encodeString(t, card, version))
+			if !reflect.DeepEqual(decoded, card) {
+				t.Errorf("the %s round trip returned\n%+v\nwant\n%+v", version, decoded, card)
+			}
+		})
+	}
+}
+
+func TestDecodePhoto(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want *Photo
+	}{
+		{"3.0 base64", "PHOTO;ENCODING=b;TYPE=JPEG:/9j/", &Photo{MediaType: "image/jpeg", Data: []byte{0xff, 0xd8, 0xff}}},
+		{"2.1 base64", "PHOTO;ENCODING=BASE64;PNG:iVBO", &Photo{MediaType: "image/png", Data: []byte{0x89, 0x50, 0x4e}}},
+		{"4.0 data URI", "PHOTO:data:image/png;base64,iVBO", &Photo{MediaType: "image/png", Data: []byte{0x89, 0x50, 0x4e}}},
+		{"URL", "PHOTO;VALUE=uri:https://example.com/ada.jpg", nil},
+		{"data URI without base64", "PHOTO:data:image/png,abc", nil},
+		{"invalid base64", "PHOTO;ENCODING=b;TYPE=JPEG:!!!", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			card := decodeOne(t, vcf("BEGIN:VCARD", "FN:Ada", test.line, "END:VCARD"))
+			if !reflect.DeepEqual(card.Photo, test.want) {
+				t.Errorf("Photo = %+v, want %+v", card.Photo, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package vcard
+
+import (
+	"encoding/base64"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxLineOctets = 75 // RFC 6350 section 3.2, lines longer than this are folded
+
+// textEscaper escapes the characters that have a special meaning in property values
+var textEscaper = strings.NewReplacer(`\`, `\\`, "\r\n", `\n`, "\n", `\n`, ",", `\,`, ";", `\;`)
+
+// encoder private struct that writes content lines and remembers the first write error
+type encoder struct {
+	w   io.Writer
+	err error
+}
+
+// Encode public function that writes a card in the requested vCard version
+func Encode(w io.Writer, card *Card, version string) error {
+	if version != Version3 && version != Version4 {
+		return ErrUnsupportedVersion
+	}
+
+	enc := &encoder{w: w}
+	enc.line("BEGIN:VCARD")
+	enc.line("VERSION:" + version)
+	if card.UID != "" {
+		enc.line("UID:" + escapeText(card.UID))
+	}
+	enc.line("N:" + escapeText(card.LastName) + ";" + escapeText(card.FirstName) + ";;;")
+	enc.line("FN:" + escapeText(card.formattedName()))
+
+	for _, phone := range card.Phones {
+		if version == Version3 {
+			types := strings.ToUpper(phoneType(phone.Type))
+			if phone.Preferred {
+				types += ",PREF"
+			}
+			enc.line("TEL;TYPE=" + types + ":" + escapeText(phone.Value))
+		} else {
+			enc.line("TEL;VALUE=uri;TYPE=" + phoneType(phone.Type) + preference(phone.Preferred) + ":tel:" + phone.Value)
+		}
+	}
+
+	for _, email := range card.Emails {
+		if version == Version3 {
+			types := "INTERNET"
+			if emailType(email.Type) != "" {
+				types += "," + strings.ToUpper(emailType(email.Type))
+			}
+			if email.Preferred {
+				types += ",PREF"
+			}
+			enc.line("EMAIL;TYPE=" + types + ":" + escapeText(email.Value))
+		} else if emailType(email.Type) != "" {
+			enc.line("EMAIL;TYPE=" + emailType(email.Type) + preference(email.Preferred) + ":" + escapeText(email.Value))
+		} else {
+			enc.line("EMAIL" + preference(email.Preferred) + ":" + escapeText(email.Value))
+		}
+	}
+
+	for _, address := range card.Addresses {
+		// ADR components: post office box; extended address; street; locality; region; postal code; country
+		value := ";;" + escapeText(address.Street) + ";" + escapeText(address.City) + ";" +
+			escapeText(address.Region) + ";" + escapeText(address.PostalCode) + ";" + escapeText(address.Country)
+		if version == Version3 {
+			enc.line("ADR;TYPE=" + strings.ToUpper(addressType(address.Type)) + ":" + value)
+		} else {
+			enc.line("ADR;TYPE=" + addressType(address.Type) + ":" + value)
+		}
+	}
+
+	if card.Photo != nil && len(card.Photo.Data) > 0 {
+		data := base64.StdEncoding.EncodeToString(card.Photo.Data)
+		if version == Version3 {
+			enc.line("PHOTO;ENCODING=b;TYPE=" + strings.ToUpper(strings.TrimPrefix(card.Photo.MediaType, "image/")) + ":" + data)
+		} else {
+			enc.line("PHOTO:data:" + card.Photo.MediaType + ";base64," + data)
+		}
+	}
+
+	if !card.Revision.IsZero() {
+		enc.line("REV:" + card.Revision.UTC().Format("20060102T150405Z"))
+	}
+	enc.line("END:VCARD")
+	return enc.err
+}
+
+// line private method that folds and writes a single content line
+func (enc *encoder) line(content string) {
+	if enc.err != nil {
+		return
+	}
+	_, enc.err = io.WriteString(enc.w, fold(content)+"\r\n")
+}
+
+// preference private function that returns the vCard 4.0 PREF parameter
+func preference(preferred bool) string {
+	if preferred {
+		return ";PREF=1"
+	}
+	return ""
+}
+
+// escapeText private function that escapes a text value
+func escapeText(value string) string {
+	return textEscaper.Replace(value)
+}
+
+// fold private function that splits a content line into chunks of at most 75 octets,
+// continuation lines start with a single space. Multi-byte characters are never split
+func fold(content string) string {
+	if len(content) <= maxLineOctets {
+		return content
+	}
+
+	var builder strings.Builder
+	limit := maxLineOctets
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		builder.WriteString(content[:cut])
+		builder.WriteString("\r\n ")
+		content = content[cut:]
+		limit = maxLineOctets - 1 // the leading space counts towards the line length
+	}
+	builder.WriteString(content)
+	return builder.String()
+}
+
+// phoneType private function that maps phone book labels to TEL types
+func phoneType(label string) string {
+	switch strings.ToLower(label) {
+	case "", "mobile", "cell":
+		return "cell"
+	case "home":
+		return "home"
+	case "work":
+		return "work"
+	case "fax":
+		return "fax"
+	default:
+		return "voice"
+	}
+}
+
+// emailType private function that maps phone book labels to EMAIL types
+func emailType(label string) string {
+	switch strings.ToLower(label) {
+	case "home":
+		return "home"
+	case "work":
+		return "work"
+	default:
+		return ""
+	}
+}
+
+// addressType private function that maps phone book labels to ADR types
+func addressType(label string) string {
+	switch strings.ToLower(label) {
+	case "work":
+		return "work"
+	case "home":
+		return "home"
+	default:
+		return "postal"
+	}
+}
@@ -0,0 +1,208 @@
+package vcard
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// encodeString private function that encodes a card and fails the test on error
+func encodeString(t *testing.T, card *Card, version string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Encode(&buf, card, version); err != nil {
+		t.Fatalf("Encode(%s): %v", version, err)
+	}
+	return buf.String()
+}
+
+// contentLines private function that unfolds encoded output the way RFC 6350 section 3.2 describes,
+// a CRLF followed by a single space or tab is removed
+func contentLines(t *testing.T, encoded string) []string {
+	t.Helper()
+	if !strings.HasSuffix(encoded, "\r\n") {
+		t.Fatalf("encoded card does not end with CRLF: %q", encoded)
+	}
+	lines := make([]string, 0)
+	for _, physical := range strings.Split(strings.TrimSuffix(encoded, "\r\n"), "\r\n") {
+		if strings.HasPrefix(physical, " ") || strings.HasPrefix(physical, "\t") {
+			lines[len(lines)-1] += physical[1:]
+			continue
+		}
+		lines = append(lines, physical)
+	}
+	return lines
+}
+
+func TestEncodeVersions(t *testing.T) {
+	card := &Card{
+		UID:       "uid-1",
+		FirstName: "Ada",
+		LastName:  "Lovelace",
+		Phones: []Phone{
+			{Type: "mobile", Value: "+254712345678", Preferred: true},
+			{Type: "work", Value: "+254202222222"},
+		},
+		Emails: []Email{
+			{Type: "home", Value: "ada@example.com", Preferred: true},
+			{Type: "other", Value: "ada@example.org"},
+		},
+		Addresses: []Address{{Type: "work", Street: "1 Moi Avenue", City: "Nairobi", PostalCode: "00100",
+			Country: "Kenya"}},
+		Photo:    &Photo{MediaType: "image/jpeg", Data: []byte{0xff, 0xd8, 0xff}},
+		Revision: time.Date(2026, time.March, 1, 10, 30, 0, 0, time.FixedZone("EAT", 3*60*60)),
+	}
+
+	tests := []struct {
+		version string
+		want    []string
+	}{
+		{Version3, []string{
+			"BEGIN:VCARD",
+			"VERSION:3.0",
+			"UID:uid-1",
+			"N:Lovelace;Ada;;;",
+			"FN:Ada Lovelace",
+			"TEL;TYPE=CELL,PREF:+254712345678",
+			"TEL;TYPE=WORK:+254202222222",
+			"EMAIL;TYPE=INTERNET,HOME,PREF:ada@example.com",
+			"EMAIL;TYPE=INTERNET:ada@example.org",
+			"ADR;TYPE=WORK:;;1 Moi Avenue;Nairobi;;00100;Kenya",
+			"PHOTO;ENCODING=b;TYPE=JPEG:/9j/",
+			"REV:20260301T073000Z",
+			"END:VCARD",
+		}},
+		{Version4, []string{
+			"BEGIN:VCARD",
+			"VERSION:4.0",
+			"UID:uid-1",
+			"N:Lovelace;Ada;;;",
+			"FN:Ada Lovelace",
+			"TEL;VALUE=uri;TYPE=cell;PREF=1:tel:+254712345678",
+			"TEL;VALUE=uri;TYPE=work:tel:+254202222222",
+			"EMAIL;TYPE=home;PREF=1:ada@example.com",
+			"EMAIL:ada@example.org",
+			"ADR;TYPE=work:;;1 Moi Avenue;Nairobi;;00100;Kenya",
+			"PHOTO:data:image/jpeg;base64,/9j/",
+			"REV:20260301T073000Z",
+			"END:VCARD",
+		}},
+	}
+	for _, test := range tests {
+		got := contentLines(t, encodeString(t, card, test.version))
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("Encode(%s) wrote:\n%s\nwant:\n%s", test.version, strings.Join(got, "\n"),
+				strings.Join(test.want, "\n"))
+		}
+	}
+}
+
+func TestEncodeUnsupportedVersion(t *testing.T) {
+	if err := Encode(&bytes.Buffer{}, &Card{}, "2.1"); err != ErrUnsupportedVersion {
+		t.Errorf("Encode(2.1) returned %v, want ErrUnsupportedVersion", err)
+	}
+}
+
+func TestEncodeEscaping(t *testing.T) {
+	card := &Card{
+		UID:       `uid\1`,
+		FirstName: "Mary; Jane",
+		LastName:  "O'Neil, Jr.",
+		Emails:    []Email{{Value: "a,b@example.com"}},
+		Addresses: []Address{{Street: "Line one\nLine two; Suite 4", City: `C:\Nairobi`}},
+	}
+	lines := contentLines(t, encodeString(t, card, Version4))
+	for _, want := range []string{
+		`UID:uid\\1`,
+		`N:O'Neil\, Jr.;Mary\; Jane;;;`,
+		`FN:Mary\; Jane O'Neil\, Jr.`,
+		`EMAIL:a\,b@example.com`,
+		`ADR;TYPE=postal:;;Line one\nLine two\; Suite 4;C:\\Nairobi;;;`,
+	} {
+		if !containsLine(lines, want) {
+			t.Errorf("encoded card is missing %s:\n%s", want, strings.Join(lines, "\n"))
+		}
+	}
+}
+
+func TestEncodeFormattedName(t *testing.T) {
+	tests := []struct {
+		name string
+		card *Card
+		want string
+	}{
+		{"full name wins", &Card{FullName: "Dr. Ada", FirstName: "Ada"}, "FN:Dr. Ada"},
+		{"first and last name", &Card{FirstName: "Ada", LastName: "Lovelace"}, "FN:Ada Lovelace"},
+		{"first name only", &Card{FirstName: "Ada"}, "FN:Ada"},
+		{"email without a name", &Card{Emails: []Email{{Value: "ada@example.com"}}}, "FN:ada@example.com"},
+		{"phone without a name", &Card{Phones: []Phone{{Value: "+254712345678"}}}, "FN:+254712345678"},
+		{"nothing", &Card{}, "FN:Unnamed"},
+	}
+	for _, test := range tests {
+		if lines := contentLines(t, encodeString(t, test.card, Version3)); !containsLine(lines, test.want) {
+			t.Errorf("%s: encoded card is missing %s:\n%s", test.name, test.want, strings.Join(lines, "\n"))
+		}
+	}
+}
+
+func TestEncodeFolding(t *testing.T) {
+	tests := []struct {
+		name     string
+		fullName string
+	}{
+		{"ascii", strings.Repeat("abcdefghij", 20)},
+		{"exactly one line", strings.Repeat("a", maxLineOctets-len("FN:"))},
+		{"multi-byte characters", strings.Repeat("Zoë Ñandú 漢字 ", 12)},
+		{"emoji", strings.Repeat("😀", 40)},
+	}
+	for _, test := range tests {
+		encoded := encodeString(t, &Card{FullName: test.fullName}, Version4)
+		for _, physical := range strings.Split(strings.TrimSuffix(encoded, "\r\n"), "\r\n") {
+			if len(physical) > maxLineOctets {
+				t.Errorf("%s: line of %d octets: %q", test.name, len(physical), physical)
+			}
+			if !utf8.ValidString(physical) {
+				t.Errorf("%s: a multi-byte character was split: %q", test.name, physical)
+			}
+		}
+		if lines := contentLines(t, encoded); !containsLine(lines, "FN:"+test.fullName) {
+			t.Errorf("%s: unfolding the card does not give back FN:%s:\n%s", test.name, test.fullName,
+				strings.Join(lines, "\n"))
+		}
+	}
+}
+
+func TestNegotiateVersion(t *testing.T) {
+	tests := []struct {
+		query, accept string
+		want          string
+		wantErr       bool
+	}{
+		{"", "", Version3, false},
+		{"4", "", Version4, false},
+		{"3.0", "text/vcard;version=4.0", Version3, false},
+		{"", "text/vcard;version=4.0", Version4, false},
+		{"", `text/vcard; version="3.0"`, Version3, false},
+		{"", "text/x-vcard, text/vcard;version=4.0;q=0.9", Version4, false},
+		{"", "text/vcard;version=2.1", Version3, false},
+		{"2.1", "", "", true},
+	}
+	for _, test := range tests {
+		got, err := NegotiateVersion(test.query, test.accept)
+		if got != test.want || (err != nil) != test.wantErr {
+			t.Errorf("NegotiateVersion(%q, %q) = %q, %v, want %q", test.query, test.accept, got, err, test.want)
+		}
+	}
+}
+
+// containsLine private function that checks if a content line is part of an encoded card
+func containsLine(lines []string, want string) bool {
+	for _, line := range lines {
+		if line == want {
+			return true
+		}
+	}
+	return false
+}
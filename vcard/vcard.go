@@ -0,0 +1,109 @@
+package vcard
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Supported vCard versions
+const (
+	Version3 = "3.0"
+	Version4 = "4.0"
+)
+
+// ErrUnsupportedVersion is returned when a vCard version other than 3.0 or 4.0 is requested
+var ErrUnsupportedVersion = errors.New("vcard version should be either 3.0 or 4.0")
+
+// Phone struct to store a TEL property
+type Phone struct {
+	Type      string // phone book label: mobile, home, work or other
+	Value     string
+	Preferred bool
+}
+
+// Email struct to store an EMAIL property
+type Email struct {
+	Type      string // phone book label: home, work or other
+	Value     string
+	Preferred bool
+}
+
+// Address struct to store an ADR property
+type Address struct {
+	Type       string // phone book label: home, work or other
+	Street     string
+	City       string
+	Region     string
+	PostalCode string
+	Country    string
+}
+
+// Card struct holds the vCard properties the phone book works with
+type Card struct {
+	UID       string
+	FirstName string
+	LastName  string
+	FullName  string
+	Phones    []Phone
+	Emails    []Email
+	Addresses []Address
+	Photo     *Photo
+	Revision  time.Time
+}
+
+// Photo struct to store an inline PHOTO property
+type Photo struct {
+	MediaType string // e.g. image/jpeg
+	Data      []byte
+}
+
+// NegotiateVersion public function that picks the vCard version a client asked for.
+// The version query parameter wins over the Accept header, 3.0 is used when neither is set
+// since it is understood by the widest range of phones
+func NegotiateVersion(queryVersion, accept string) (string, error) {
+	if queryVersion != "" {
+		switch queryVersion {
+		case "3", Version3:
+			return Version3, nil
+		case "4", Version4:
+			return Version4, nil
+		}
+		return "", ErrUnsupportedVersion
+	}
+
+	// e.g. Accept: text/vcard;version=4.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		for _, param := range strings.Split(mediaRange, ";") {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(strings.ToLower(param), "version=") {
+				switch strings.Trim(param[len("version="):], `"`) {
+				case Version3:
+					return Version3, nil
+				case Version4:
+					return Version4, nil
+				}
+			}
+		}
+	}
+	return Version3, nil
+}
+
+// formattedName private method that returns the FN value, which is required by both versions
+func (card *Card) formattedName() string {
+	if card.FullName != "" {
+		return card.FullName
+	}
+
+	name := strings.TrimSpace(card.FirstName + " " + card.LastName)
+	if name != "" {
+		return name
+	}
+	if len(card.Emails) > 0 {
+		return card.Emails[0].Value
+	}
+	if len(card.Phones) > 0 {
+		return card.Phones[0].Value
+	}
+	return "Unnamed"
+}